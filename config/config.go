@@ -60,6 +60,39 @@ type Config struct {
 	// Rate limiting
 	RateLimit     int
 	RateLimitTime time.Duration
+
+	// Booking holds
+	BookingHoldDuration time.Duration
+	HoldSweepInterval   time.Duration
+
+	// No-shows
+	NoShowCutoff time.Duration // Time of day on the arrival date after which confirmed bookings not checked in are no-shows, e.g. 22h
+
+	// Currencies
+	PropertyCurrency  string // Base currency rooms are priced and paid in
+	ExchangeRatesFile string // Local CSV the exchange rate table is loaded from
+
+	// Taxes
+	PricesIncludeTax bool // Room, onsen and charge prices are quoted with service charge and VAT included
+
+	// Occupancy pricing age bands
+	InfantMaxAge int // Children up to this age stay free
+	ChildMaxAge  int // Children up to this age pay the child rate, older guests the adult rate
+
+	// Payments
+	CardGatewayURL    string
+	CardRefundURL     string
+	CardGatewayAPIKey string
+	EnableFakeGateway bool // Approves any token; for local testing only, never in production
+	CardWebhookSecret string
+	FakeWebhookSecret string
+
+	// Property details printed on invoices
+	PropertyName    string
+	PropertyAddress string
+	PropertyPhone   string
+	PropertyEmail   string
+	PropertyPAN     string // PAN/VAT registration number
 }
 
 // GetConfig returns the singleton config instance
@@ -111,6 +144,39 @@ func GetConfig() *Config {
 			// Rate limiting
 			RateLimit:     getIntEnv("RATE_LIMIT", 100),
 			RateLimitTime: getDurationEnv("RATE_LIMIT_TIME", 1*time.Minute),
+
+			// Booking holds
+			BookingHoldDuration: getDurationEnv("BOOKING_HOLD_DURATION", 15*time.Minute),
+			HoldSweepInterval:   getDurationEnv("HOLD_SWEEP_INTERVAL", 1*time.Minute),
+
+			// No-shows
+			NoShowCutoff: getDurationEnv("NO_SHOW_CUTOFF", 22*time.Hour),
+
+			// Currencies
+			PropertyCurrency:  getEnv("PROPERTY_CURRENCY", "NPR"),
+			ExchangeRatesFile: getEnv("EXCHANGE_RATES_FILE", "./data/exchange_rates.csv"),
+
+			// Taxes
+			PricesIncludeTax: getBoolEnv("PRICES_INCLUDE_TAX", false),
+
+			// Occupancy pricing age bands
+			InfantMaxAge: getIntEnv("INFANT_MAX_AGE", 3),
+			ChildMaxAge:  getIntEnv("CHILD_MAX_AGE", 11),
+
+			// Payments
+			CardGatewayURL:    getEnv("CARD_GATEWAY_URL", ""),
+			CardRefundURL:     getEnv("CARD_REFUND_URL", ""),
+			CardGatewayAPIKey: getEnv("CARD_GATEWAY_API_KEY", ""),
+			EnableFakeGateway: getBoolEnv("ENABLE_FAKE_GATEWAY", false),
+			CardWebhookSecret: getEnv("CARD_WEBHOOK_SECRET", ""),
+			FakeWebhookSecret: getEnv("FAKE_WEBHOOK_SECRET", ""),
+
+			// Property details printed on invoices
+			PropertyName:    getEnv("PROPERTY_NAME", "Kwangdi Pahuna Ghar"),
+			PropertyAddress: getEnv("PROPERTY_ADDRESS", "Shantipur Valley, Gulmi District, Lumbini Province, Nepal"),
+			PropertyPhone:   getEnv("PROPERTY_PHONE", "+977 9812345678"),
+			PropertyEmail:   getEnv("PROPERTY_EMAIL", "info@kwangdipahunaghar.com"),
+			PropertyPAN:     getEnv("PROPERTY_PAN", ""),
 		}
 	})
 
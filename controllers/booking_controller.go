@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
+	"html"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/IamMaheshGurung/privateOnsenBooking/models"
@@ -14,12 +17,22 @@ import (
 
 // BookingController handles booking-related HTTP requests
 type BookingController struct {
-	RoomService   *services.RoomBookingService
-	GuestService  *services.GuestService
-	EmailService  *services.EmailService
-	Logger        *zap.Logger
-	MinStayLength int // Minimum number of nights
-	MaxStayLength int // Maximum number of nights
+	RoomService    *services.RoomBookingService
+	GuestService   *services.GuestService
+	EmailService   *services.EmailService
+	PaymentService *services.PaymentService
+	FolioService   *services.FolioService
+	InvoiceService *services.InvoiceService
+	Pricing        *services.PricingService
+	TaxService     *services.TaxService
+	PromoService   *services.PromoService
+	Cancellation   *services.CancellationService // Gives new bookings their cancellation terms
+	Modifications  *services.BookingModificationService
+	ExchangeRates  *services.ExchangeRateService // Locks the guest's display currency rate on new bookings
+	Logger         *zap.Logger
+	MinStayLength  int           // Minimum number of nights
+	MaxStayLength  int           // Maximum number of nights
+	HoldDuration   time.Duration // How long a room is held while the guest pays
 }
 
 // NewBookingController creates a new instance of BookingController
@@ -27,20 +40,37 @@ func NewBookingController(
 	roomService *services.RoomBookingService,
 	guestService *services.GuestService,
 	emailService *services.EmailService,
+	paymentService *services.PaymentService,
+	folioService *services.FolioService,
+	invoiceService *services.InvoiceService,
+	pricing *services.PricingService,
+	taxService *services.TaxService,
+	promoService *services.PromoService,
+	cancellation *services.CancellationService,
+	modifications *services.BookingModificationService,
 	logger *zap.Logger,
 ) *BookingController {
 	return &BookingController{
-		RoomService:   roomService,
-		GuestService:  guestService,
-		EmailService:  emailService,
-		Logger:        logger,
-		MinStayLength: 1,  // Default minimum: 1 night
-		MaxStayLength: 14, // Default maximum: 14 nights
+		RoomService:    roomService,
+		GuestService:   guestService,
+		EmailService:   emailService,
+		PaymentService: paymentService,
+		FolioService:   folioService,
+		InvoiceService: invoiceService,
+		Pricing:        pricing,
+		TaxService:     taxService,
+		PromoService:   promoService,
+		Cancellation:   cancellation,
+		Modifications:  modifications,
+		Logger:         logger,
+		MinStayLength:  1,  // Default minimum: 1 night
+		MaxStayLength:  14, // Default maximum: 14 nights
+		HoldDuration:   15 * time.Minute,
 	}
 }
 
 // CheckAvailability checks if a room is available
-// GET /api/bookings/check?room_id=1&check_in=2023-09-01&check_out=2023-09-05
+// GET /api/bookings/check?room_id=1&check_in=2023-09-01&check_out=2023-09-05&adults=2
 func (ctrl *BookingController) CheckAvailability(c *fiber.Ctx) error {
 	ctrl.Logger.Info("CheckAvailability request received",
 		zap.String("path", c.Path()),
@@ -102,7 +132,7 @@ func (ctrl *BookingController) CheckAvailability(c *fiber.Ctx) error {
 	}
 
 	// Check if room exists first
-	_, err = ctrl.RoomService.GetRoomByID(uint(roomID))
+	room, err := ctrl.RoomService.GetRoomByID(uint(roomID))
 	if err != nil {
 		ctrl.Logger.Warn("Room not found", zap.Uint64("roomID", roomID))
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -111,6 +141,18 @@ func (ctrl *BookingController) CheckAvailability(c *fiber.Ctx) error {
 		})
 	}
 
+	// Check the stay rules for the dates
+	if err := ctrl.Pricing.CheckStay(room, checkIn, checkOut); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrStayRestricted) {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
 	// Check room availability
 	available, err := ctrl.RoomService.IsRoomAvailable(uint(roomID), checkIn, checkOut)
 	if err != nil {
@@ -126,13 +168,20 @@ func (ctrl *BookingController) CheckAvailability(c *fiber.Ctx) error {
 	}
 
 	// Calculate price if available
-	var price float64
-	var nightCount int
+	var price models.Money
+	var nights models.NightRates
 	if available {
 		room, err := ctrl.RoomService.GetRoomByID(uint(roomID))
 		if err == nil {
-			nightCount = int(checkOut.Sub(checkIn).Hours() / 24)
-			price = room.PricePerNight * float64(nightCount)
+			stay, err := ctrl.Pricing.PriceStay(room, checkIn, checkOut, parseOccupancy(c.Query))
+			if err != nil {
+				ctrl.Logger.Error("Failed to price stay", zap.Uint64("roomID", roomID), zap.Error(err))
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"error":   "Failed to price stay: " + err.Error(),
+				})
+			}
+			price, nights = stay.Total, stay.Nights
 		}
 	}
 
@@ -145,13 +194,14 @@ func (ctrl *BookingController) CheckAvailability(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"success":    true,
 		"available":  available,
-		"nightCount": nightCount,
+		"nightCount": len(nights),
+		"nights":     nights,
 		"totalPrice": price,
 	})
 }
 
 // GetAvailableRooms returns all rooms available for the specified dates
-// GET /api/bookings/available?check_in=2023-09-01&check_out=2023-09-05
+// GET /api/bookings/available?check_in=2023-09-01&check_out=2023-09-05&adults=2&children=1
 func (ctrl *BookingController) GetAvailableRooms(c *fiber.Ctx) error {
 	ctrl.Logger.Info("GetAvailableRooms request received",
 		zap.String("path", c.Path()),
@@ -159,7 +209,7 @@ func (ctrl *BookingController) GetAvailableRooms(c *fiber.Ctx) error {
 
 	checkInStr := c.Query("check_in")
 	checkOutStr := c.Query("check_out")
-	guestStr := c.Query("guests")
+	occupancy := parseOccupancy(c.Query)
 
 	// Validate input
 	if checkInStr == "" || checkOutStr == "" {
@@ -202,8 +252,20 @@ func (ctrl *BookingController) GetAvailableRooms(c *fiber.Ctx) error {
 		})
 	}
 
+	// Check the stay rules for every room
+	if err := ctrl.Pricing.CheckStay(nil, checkIn, checkOut); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrStayRestricted) {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
 	// Get available rooms
-	rooms, err := ctrl.RoomService.GetAvailableRooms(checkIn, checkOut, guestStr)
+	rooms, err := ctrl.RoomService.GetAvailableRooms(checkIn, checkOut, strconv.Itoa(occupancy.Guests()))
 	if err != nil {
 		ctrl.Logger.Error("Failed to get available rooms",
 			zap.Time("checkIn", checkIn),
@@ -215,9 +277,28 @@ func (ctrl *BookingController) GetAvailableRooms(c *fiber.Ctx) error {
 		})
 	}
 
+	// Leave out rooms a stay rule for their room type blocks
+	rooms, err = ctrl.Pricing.AllowedRooms(rooms, checkIn, checkOut)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to check stay rules: " + err.Error(),
+		})
+	}
+
 	// Calculate stay length in nights
 	nightCount := int(checkOut.Sub(checkIn).Hours() / 24)
 
+	// Price each room for the stay
+	prices, err := ctrl.Pricing.PriceStays(rooms, checkIn, checkOut, occupancy)
+	if err != nil {
+		ctrl.Logger.Error("Failed to price available rooms", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to price available rooms: " + err.Error(),
+		})
+	}
+
 	// Add total price for the stay to each room
 	var roomsWithPrice []fiber.Map
 	for _, room := range rooms {
@@ -230,7 +311,8 @@ func (ctrl *BookingController) GetAvailableRooms(c *fiber.Ctx) error {
 			"description":     room.Description,
 			"amenities":       room.Amenities,
 			"image_url":       room.ImageURL,
-			"total_price":     room.PricePerNight * float64(nightCount),
+			"total_price":     prices[room.ID].Total,
+			"nights":          prices[room.ID].Nights,
 			"night_count":     nightCount,
 		})
 	}
@@ -294,7 +376,7 @@ func (ctrl *BookingController) CreateBookingFromForm(c *fiber.Ctx) error {
 	// Parse dates
 	checkInStr := c.FormValue("check_in")
 	checkOutStr := c.FormValue("check_out")
-	guestsStr := c.FormValue("guests", "1")
+	occupancy := parseOccupancy(c.FormValue)
 
 	checkIn, err := time.Parse("2006-01-02", checkInStr)
 	if err != nil {
@@ -329,12 +411,6 @@ func (ctrl *BookingController) CreateBookingFromForm(c *fiber.Ctx) error {
 		})
 	}
 
-	// Parse guest count
-	guests, err := strconv.Atoi(guestsStr)
-	if err != nil || guests < 1 {
-		guests = 1
-	}
-
 	// Get room details
 	room, err := ctrl.RoomService.GetRoomByID(uint(roomID))
 	if err != nil {
@@ -346,12 +422,27 @@ func (ctrl *BookingController) CreateBookingFromForm(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if guest count exceeds room capacity
-	if guests > room.Capacity {
+	// Check the guests fit in the room
+	if err := ctrl.Pricing.CheckOccupancy(room, occupancy); err != nil {
 		return c.Status(fiber.StatusBadRequest).Render("booking/error", fiber.Map{
 			"Title":       "Booking Error | Kwangdi Pahuna Ghar",
 			"CurrentYear": time.Now().Year(),
-			"Error":       fmt.Sprintf("The selected room can only accommodate up to %d guests.", room.Capacity),
+			"Error":       fmt.Sprintf("The selected room can only accommodate up to %d guests, including children and infants.", room.Capacity),
+		})
+	}
+
+	// Check the stay rules for the dates
+	if err := ctrl.Pricing.CheckStay(room, checkIn, checkOut); err != nil {
+		status := fiber.StatusInternalServerError
+		message := "Unable to check the dates of your stay. Please try again."
+		if errors.Is(err, services.ErrStayRestricted) {
+			status = fiber.StatusBadRequest
+			message = guestErrorMessage(err)
+		}
+		return c.Status(status).Render("booking/error", fiber.Map{
+			"Title":       "Booking Error | Kwangdi Pahuna Ghar",
+			"CurrentYear": time.Now().Year(),
+			"Error":       message,
 		})
 	}
 
@@ -371,14 +462,20 @@ func (ctrl *BookingController) CreateBookingFromForm(c *fiber.Ctx) error {
 			"Title":       "Booking Error | Kwangdi Pahuna Ghar",
 			"CurrentYear": time.Now().Year(),
 			"Error":       "Sorry, this room is no longer available for the selected dates.",
-			"RedirectURL": fmt.Sprintf("/rooms/availability?check_in=%s&check_out=%s&guests=%d", checkInStr, checkOutStr, guests),
+			"RedirectURL": fmt.Sprintf("/rooms/availability?check_in=%s&check_out=%s&%s", checkInStr, checkOutStr, occupancyQuery(occupancy)),
 		})
 	}
 
-	// Calculate nights and total price
-	nightCount := int(checkOut.Sub(checkIn).Hours() / 24)
-	totalPrice := room.PricePerNight * float64(nightCount)
-
+	// Price the stay night by night and work out the taxes on it
+	stay, err := ctrl.Pricing.PriceStay(room, checkIn, checkOut, occupancy)
+	if err != nil {
+		ctrl.Logger.Error("Failed to price stay", zap.Uint("roomID", room.ID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).Render("booking/error", fiber.Map{
+			"Title":       "Booking Error | Kwangdi Pahuna Ghar",
+			"CurrentYear": time.Now().Year(),
+			"Error":       "Failed to calculate the price of your stay. Please try again.",
+		})
+	}
 	// Create or get guest using your existing guest service
 	guest, err := ctrl.GuestService.CreateOrGetGuest(
 		guestName,
@@ -394,22 +491,40 @@ func (ctrl *BookingController) CreateBookingFromForm(c *fiber.Ctx) error {
 		})
 	}
 
-	// Create a new RoomBooking object
-	booking := models.RoomBooking{
-		GuestID:         guest.ID,
-		RoomID:          room.ID,
-		CheckIn:         checkIn,
-		CheckOut:        checkOut,
-		Status:          models.BookingStatusPending, // Pending until payment is confirmed
-		SpecialRequests: specialRequests,
-		TotalPrice:      totalPrice,
-		GuestCount:      uint(guests),
+	// Take any promo codes off the quoted price before tax
+	discount, err := ctrl.PromoService.Apply(services.ParsePromoCodes(c.FormValue("promo_code")), guest.ID, room, len(stay.Nights), stay.Total)
+	if err != nil {
+		if errors.Is(err, services.ErrPromoNotFound) || errors.Is(err, services.ErrPromoNotUsable) {
+			return c.Status(fiber.StatusBadRequest).Render("booking/error", fiber.Map{
+				"Title":       "Booking Error | Kwangdi Pahuna Ghar",
+				"CurrentYear": time.Now().Year(),
+				"Error":       guestErrorMessage(err),
+			})
+		}
+
+		ctrl.Logger.Error("Failed to apply promo codes", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).Render("booking/error", fiber.Map{
+			"Title":       "Booking Error | Kwangdi Pahuna Ghar",
+			"CurrentYear": time.Now().Year(),
+			"Error":       "Failed to apply your promo code. Please try again.",
+		})
 	}
 
-	// Create booking using your existing service
-	createdBooking, err := ctrl.RoomService.CreateBooking(booking.RoomID, booking.GuestID, booking.CheckIn, booking.CheckOut)
+	quote, err := ctrl.TaxService.Quote(models.FolioCategoryRoomNight, stay.Total.Sub(discount.Total))
 	if err != nil {
-		ctrl.Logger.Error("Failed to create booking", zap.Error(err))
+		ctrl.Logger.Error("Failed to work out booking taxes", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).Render("booking/error", fiber.Map{
+			"Title":       "Booking Error | Kwangdi Pahuna Ghar",
+			"CurrentYear": time.Now().Year(),
+			"Error":       "Failed to calculate the price of your stay. Please try again.",
+		})
+	}
+	totalPrice := quote.Net
+
+	// Work out the cancellation terms the booking is made on
+	cancellationTerms, err := ctrl.Cancellation.BookingTerms(room, checkIn)
+	if err != nil {
+		ctrl.Logger.Error("Failed to get cancellation terms", zap.Uint("roomID", room.ID), zap.Error(err))
 		return c.Status(fiber.StatusInternalServerError).Render("booking/error", fiber.Map{
 			"Title":       "Booking Error | Kwangdi Pahuna Ghar",
 			"CurrentYear": time.Now().Year(),
@@ -417,10 +532,71 @@ func (ctrl *BookingController) CreateBookingFromForm(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update additional booking details if needed
-	if err := ctrl.RoomService.UpdateBookingDetails(createdBooking.ID, models.BookingStatusPending, specialRequests, guests, totalPrice); err != nil {
-		ctrl.Logger.Error("Failed to update booking details", zap.Error(err))
-		// Continue anyway since the core booking was created
+	// The hold is stored fully priced, so it is never seen without its price
+	booking := models.RoomBooking{
+		GuestID:           guest.ID,
+		RoomID:            room.ID,
+		CheckIn:           checkIn,
+		CheckOut:          checkOut,
+		SpecialRequests:   specialRequests,
+		GuestCount:        uint(occupancy.Guests()),
+		Adults:            uint(occupancy.Adults),
+		Children:          uint(occupancy.Children),
+		Infants:           uint(occupancy.Infants),
+		NightlyRates:      stay.Nights,
+		TotalPrice:        totalPrice,
+		TaxAmount:         quote.Taxes.Total(totalPrice.Currency),
+		Taxes:             quote.Taxes,
+		CancellationTerms: cancellationTerms,
+	}
+
+	// Keep today's rate for the guest's display currency on the booking
+	if ctrl.ExchangeRates != nil {
+		display, _ := c.Locals("DisplayCurrency").(string)
+		if err := ctrl.ExchangeRates.LockRate(&booking, display); err != nil {
+			ctrl.Logger.Warn("Failed to lock exchange rate, using base currency",
+				zap.String("currency", display), zap.Error(err))
+			if err := ctrl.ExchangeRates.LockRate(&booking, ""); err != nil {
+				ctrl.Logger.Error("Failed to record booking currency", zap.Error(err))
+				return c.Status(fiber.StatusInternalServerError).Render("booking/error", fiber.Map{
+					"Title":       "Booking Error | Kwangdi Pahuna Ghar",
+					"CurrentYear": time.Now().Year(),
+					"Error":       "Failed to create booking. Please try again.",
+				})
+			}
+		}
+	}
+
+	// Hold the room while the guest completes payment. The promo codes and the
+	// deposit are recorded with it; if a code was used up meanwhile nothing is kept.
+	createdBooking, err := ctrl.RoomService.CreateHold(booking, ctrl.HoldDuration,
+		ctrl.PromoService.RedeemOnHold(guest.ID, discount),
+		ctrl.PaymentService.DepositOnHold())
+	if err != nil {
+		if errors.Is(err, services.ErrRoomUnavailable) {
+			ctrl.Logger.Warn("Room was booked by another guest", zap.Uint("roomID", room.ID))
+			return c.Status(fiber.StatusConflict).Render("booking/error", fiber.Map{
+				"Title":       "Booking Error | Kwangdi Pahuna Ghar",
+				"CurrentYear": time.Now().Year(),
+				"Error":       "Sorry, this room is no longer available for the selected dates.",
+				"RedirectURL": fmt.Sprintf("/rooms/availability?check_in=%s&check_out=%s&%s", checkInStr, checkOutStr, occupancyQuery(occupancy)),
+			})
+		}
+
+		if errors.Is(err, services.ErrPromoNotUsable) {
+			return c.Status(fiber.StatusConflict).Render("booking/error", fiber.Map{
+				"Title":       "Booking Error | Kwangdi Pahuna Ghar",
+				"CurrentYear": time.Now().Year(),
+				"Error":       guestErrorMessage(err),
+			})
+		}
+
+		ctrl.Logger.Error("Failed to create booking", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).Render("booking/error", fiber.Map{
+			"Title":       "Booking Error | Kwangdi Pahuna Ghar",
+			"CurrentYear": time.Now().Year(),
+			"Error":       "Failed to create booking. Please try again.",
+		})
 	}
 
 	ctrl.Logger.Info("Booking created successfully",
@@ -477,21 +653,35 @@ func (ctrl *BookingController) ShowBookingSummary(c *fiber.Ctx) error {
 	nights := int(booking.CheckOut.Sub(booking.CheckIn).Hours() / 24)
 
 	// Calculate fees
-	roomTotal := booking.TotalPrice
-	serviceFee := roomTotal * 0.05 // Example: 5% service fee
-	totalPrice := roomTotal + serviceFee
+	roomTotal, tax, totalPrice := services.BookingTotals(booking)
+
+	// Show the total in the guest's currency at the rate locked on the booking
+	var displayTotal interface{}
+	if converted, ok := services.BookingDisplayAmount(booking, totalPrice); ok {
+		displayTotal = converted
+	}
 
 	return c.Render("booking/summary", fiber.Map{
-		"Title":       "Booking Summary | Kwangdi Pahuna Ghar",
-		"Description": "Review your booking details before confirming",
-		"CurrentYear": time.Now().Year(),
-		"Booking":     booking,
-		"Room":        room,
-		"Guest":       guest,
-		"Nights":      nights,
-		"RoomTotal":   roomTotal,
-		"ServiceFee":  serviceFee,
-		"TotalPrice":  totalPrice,
+		"Title":        "Booking Summary | Kwangdi Pahuna Ghar",
+		"Description":  "Review your booking details before confirming",
+		"CurrentYear":  time.Now().Year(),
+		"Booking":      booking,
+		"Room":         room,
+		"Guest":        guest,
+		"Nights":       nights,
+		"RoomTotal":    roomTotal,
+		"Tax":          tax,
+		"Taxes":        booking.Taxes,
+		"Discount":     booking.DiscountAmount,
+		"PromoCodes":   booking.PromoCodes,
+		"TotalPrice":   totalPrice,
+		"Deposit":      booking.DepositAmount,
+		"BalanceDue":   totalPrice.Sub(booking.DepositAmount),
+		"DisplayTotal": displayTotal,
+		"ExchangeRate": booking.ExchangeRate,
+		"Cancellation": services.BookingCancellationTerms(booking),
+
+		"PaymentMethods": ctrl.PaymentService.Methods(),
 	})
 }
 
@@ -508,7 +698,14 @@ func (ctrl *BookingController) ProcessPayment(c *fiber.Ctx) error {
 	}
 
 	// Get payment method
-	_ = c.FormValue("payment_method", "cash") // Ignoring the value since it's not used
+	paymentMethod := c.FormValue("payment_method", models.PaymentMethodCash)
+	if !ctrl.PaymentService.SupportsMethod(paymentMethod) {
+		return c.Status(fiber.StatusBadRequest).Render("booking/error", fiber.Map{
+			"Title":       "Payment Error | Kwangdi Pahuna Ghar",
+			"CurrentYear": time.Now().Year(),
+			"Error":       "The selected payment method is not available",
+		})
+	}
 
 	// Get booking details
 	booking, err := ctrl.RoomService.GetBookingByID(uint(bookingID))
@@ -521,22 +718,59 @@ func (ctrl *BookingController) ProcessPayment(c *fiber.Ctx) error {
 		})
 	}
 
-	// Here you would process payment based on paymentMethod
-	// For this example, we'll just update the booking status
-
-	// Update booking status to confirmed
-	err = ctrl.RoomService.UpdateBookingStatus(uint(bookingID), models.BookingStatusConfirmed)
+	// Charge the deposit, or the full amount if the guest chose to pay in full;
+	// the booking is confirmed once the payment succeeds or is authorized
+	_, _, amountDue := services.BookingTotals(booking)
+	if c.FormValue("payment_option") != "full" && booking.DepositAmount.IsPositive() {
+		amountDue = booking.DepositAmount
+	}
+	_, err = ctrl.PaymentService.ProcessBookingPayment(booking, amountDue, paymentMethod, c.FormValue("payment_token"))
 	if err != nil {
-		ctrl.Logger.Error("Failed to confirm booking", zap.Int("id", bookingID), zap.Error(err))
+		switch {
+		case errors.Is(err, services.ErrHoldExpired):
+			return c.Status(fiber.StatusConflict).Render("booking/error", fiber.Map{
+				"Title":       "Payment Error | Kwangdi Pahuna Ghar",
+				"CurrentYear": time.Now().Year(),
+				"Error":       "Your reservation hold has expired. Please check availability and book again.",
+				"RedirectURL": fmt.Sprintf("/rooms/availability?check_in=%s&check_out=%s&%s",
+					booking.CheckIn.Format("2006-01-02"), booking.CheckOut.Format("2006-01-02"), occupancyQuery(services.BookingOccupancy(booking))),
+			})
+		case errors.Is(err, services.ErrPaymentDeclined):
+			return c.Status(fiber.StatusPaymentRequired).Render("booking/error", fiber.Map{
+				"Title":       "Payment Error | Kwangdi Pahuna Ghar",
+				"CurrentYear": time.Now().Year(),
+				"Error":       "Your payment could not be completed. Please try again or choose another payment method.",
+				"RedirectURL": fmt.Sprintf("/booking/summary/%d", bookingID),
+			})
+		case errors.Is(err, services.ErrBookingNotPayable):
+			return c.Status(fiber.StatusConflict).Render("booking/error", fiber.Map{
+				"Title":       "Payment Error | Kwangdi Pahuna Ghar",
+				"CurrentYear": time.Now().Year(),
+				"Error":       "This booking is not awaiting payment.",
+			})
+		case errors.Is(err, services.ErrPaymentInProgress):
+			return c.Status(fiber.StatusConflict).Render("booking/error", fiber.Map{
+				"Title":       "Payment Error | Kwangdi Pahuna Ghar",
+				"CurrentYear": time.Now().Year(),
+				"Error":       "A payment for this booking is already being processed.",
+				"RedirectURL": fmt.Sprintf("/booking/confirmation/%d", bookingID),
+			})
+		}
+
+		ctrl.Logger.Error("Failed to process payment", zap.Int("id", bookingID), zap.Error(err))
 		return c.Status(fiber.StatusInternalServerError).Render("booking/error", fiber.Map{
 			"Title":       "Payment Error | Kwangdi Pahuna Ghar",
 			"CurrentYear": time.Now().Year(),
-			"Error":       "Failed to confirm booking: " + err.Error(),
+			"Error":       "Failed to process payment. Please try again.",
 		})
 	}
 
-	// Get updated booking
-	updatedBooking, _ := ctrl.RoomService.GetBookingByID(uint(bookingID))
+	// Get updated booking, falling back to the one loaded before the payment
+	updatedBooking, err := ctrl.RoomService.GetBookingByID(uint(bookingID))
+	if err != nil {
+		ctrl.Logger.Error("Failed to reload paid booking", zap.Int("id", bookingID), zap.Error(err))
+		updatedBooking = booking
+	}
 
 	// Get room details
 	room, err := ctrl.RoomService.GetRoomByID(booking.RoomID)
@@ -552,7 +786,7 @@ func (ctrl *BookingController) ProcessPayment(c *fiber.Ctx) error {
 		// Continue anyway with limited guest info
 	}
 
-	// Send confirmation email asynchronously
+	// Send confirmation email asynchronously; the invoice follows at check-out
 	go func() {
 		if err := ctrl.EmailService.SendBookingConfirmation(updatedBooking, guest, room); err != nil {
 			ctrl.Logger.Error("Failed to send confirmation email",
@@ -610,6 +844,7 @@ func (ctrl *BookingController) ShowConfirmation(c *fiber.Ctx) error {
 		"Room":        room,
 		"Guest":       guest,
 		"BookingID":   bookingID,
+		"Reference":   booking.ReferenceNumber,
 	})
 }
 
@@ -645,7 +880,8 @@ func (ctrl *BookingController) GetBookingByID(c *fiber.Ctx) error {
 	})
 }
 
-// CancelBooking cancels a booking
+// CancelBooking cancels a booking, applying the cancellation fee and queueing
+// a refund of anything paid beyond it. The guest is notified by email.
 // PUT /api/bookings/:id/cancel
 func (ctrl *BookingController) CancelBooking(c *fiber.Ctx) error {
 	bookingID, err := c.ParamsInt("id")
@@ -657,62 +893,43 @@ func (ctrl *BookingController) CancelBooking(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get booking before cancellation for email notification
-	booking, err := ctrl.RoomService.GetBookingByID(uint(bookingID))
-	if err != nil {
-		ctrl.Logger.Error("Failed to get booking for cancellation",
-			zap.Int("bookingID", bookingID),
-			zap.Error(err))
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"error":   "Booking not found: " + err.Error(),
-		})
+	var cancelData struct {
+		Reason string `json:"reason"` // Optional, defaults to a guest request
 	}
 
-	// Get guest and room for email notification
-	guest, err := ctrl.GuestService.GetGuestByID(booking.GuestID)
-	if err != nil {
-		ctrl.Logger.Error("Failed to get guest for cancellation notification",
-			zap.Uint("guestID", booking.GuestID),
-			zap.Error(err))
-		// Continue with cancellation even if guest retrieval fails
-	}
-
-	room, err := ctrl.RoomService.GetRoomByID(booking.RoomID)
-	if err != nil {
-		ctrl.Logger.Error("Failed to get room for cancellation notification",
-			zap.Uint("roomID", booking.RoomID),
-			zap.Error(err))
-		// Continue with cancellation even if room retrieval fails
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&cancelData); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Cannot parse JSON: " + err.Error(),
+			})
+		}
 	}
 
 	// Cancel the booking
-	if err := ctrl.RoomService.CancelBookingByID(uint(bookingID)); err != nil {
+	refunds, err := ctrl.RoomService.CancelBooking(uint(bookingID), cancelData.Reason, changedBy(c))
+	if err != nil {
 		ctrl.Logger.Error("Failed to cancel booking",
 			zap.Int("bookingID", bookingID),
 			zap.Error(err))
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidTransition) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to cancel booking: " + err.Error(),
 		})
 	}
 
-	// Send cancellation email asynchronously
-	if guest != nil && room != nil {
-		go func() {
-			if err := ctrl.EmailService.SendBookingCancellationNotice(booking, guest, room); err != nil {
-				ctrl.Logger.Error("Failed to send cancellation email",
-					zap.Int("bookingID", bookingID),
-					zap.Error(err))
-			}
-		}()
-	}
-
 	ctrl.Logger.Info("Booking cancelled successfully", zap.Int("bookingID", bookingID))
 
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Booking cancelled successfully",
+		"data": fiber.Map{
+			"refunds": refunds,
+		},
 	})
 }
 
@@ -979,88 +1196,72 @@ func (ctrl *BookingController) UpdateBooking(c *fiber.Ctx) error {
 				"error":   err.Error(),
 			})
 		}
+	}
 
-		// Check availability for new dates (excluding current booking)
-		available, err := ctrl.RoomService.IsRoomAvailableForUpdate(
-			currentBooking.RoomID,
-			uint(bookingID),
-			checkIn,
-			checkOut,
-		)
-		if err != nil {
-			ctrl.Logger.Error("Failed to check availability for update",
+	// Handle status change if provided
+	status := currentBooking.Status
+	if updateData.Status != "" && updateData.Status != currentBooking.Status {
+		if err := services.CheckTransition(currentBooking, updateData.Status); err != nil {
+			ctrl.Logger.Warn("Invalid booking status change",
 				zap.Int("bookingID", bookingID),
+				zap.String("status", updateData.Status),
 				zap.Error(err))
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			httpStatus := fiber.StatusBadRequest
+			if errors.Is(err, services.ErrInvalidTransition) {
+				httpStatus = fiber.StatusConflict
+			}
+			return c.Status(httpStatus).JSON(fiber.Map{
 				"success": false,
-				"error":   "Failed to check availability: " + err.Error(),
+				"error":   err.Error(),
 			})
 		}
 
-		if !available {
-			ctrl.Logger.Warn("Room not available for new dates",
-				zap.Int("bookingID", bookingID),
-				zap.Time("checkIn", checkIn),
-				zap.Time("checkOut", checkOut))
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"success": false,
-				"error":   "Room is not available for the new dates",
-			})
-		}
+		status = updateData.Status
 	}
 
-	// Handle status change if provided
-	var status string
-	if updateData.Status != "" {
-		validStatuses := map[string]bool{
-			models.BookingStatusConfirmed: true,
-			models.BookingStatusCancelled: true,
-			models.BookingStatusCheckedIn: true,
-			models.BookingStatusCompleted: true,
+	// Move the stay and reprice it, keeping a record of the change. A new
+	// status is moved to in the same transaction, so either both happen or neither.
+	if datesChanged || updateData.SpecialRequests != "" {
+		modification := services.BookingModification{CheckIn: checkIn, CheckOut: checkOut, Status: status}
+		if updateData.SpecialRequests != "" {
+			modification.SpecialRequests = &updateData.SpecialRequests
 		}
 
-		if !validStatuses[updateData.Status] {
-			ctrl.Logger.Warn("Invalid booking status", zap.String("status", updateData.Status))
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		if _, err := ctrl.Modifications.Modify(uint(bookingID), modification, changedBy(c), ""); err != nil && !errors.Is(err, services.ErrNoBookingChanges) {
+			ctrl.Logger.Warn("Failed to update booking",
+				zap.Int("bookingID", bookingID),
+				zap.Error(err))
+			return c.Status(modificationErrorStatus(err)).JSON(fiber.Map{
 				"success": false,
-				"error":   "Invalid booking status",
+				"error":   "Failed to update booking: " + err.Error(),
 			})
 		}
 
-		status = updateData.Status
-	} else {
-		status = currentBooking.Status
-	}
-
-	// Create updated booking object
-	updatedBooking := models.RoomBooking{
-		ID:              currentBooking.ID,
-		GuestID:         currentBooking.GuestID,
-		RoomID:          currentBooking.RoomID,
-		CheckIn:         checkIn,
-		CheckOut:        checkOut,
-		Status:          status,
-		SpecialRequests: currentBooking.SpecialRequests,
-		TotalPrice:      currentBooking.TotalPrice,
-	}
-
-	if updateData.SpecialRequests != "" {
-		updatedBooking.SpecialRequests = updateData.SpecialRequests
-	}
-
-	// If check-in dates changed, update total price
-	if datesChanged {
-		room, _ := ctrl.RoomService.GetRoomByID(currentBooking.RoomID)
-		if room != nil {
-			nightCount := int(checkOut.Sub(checkIn).Hours() / 24)
-			updatedBooking.TotalPrice = room.PricePerNight * float64(nightCount)
+		if status == models.BookingStatusCheckedIn {
+			ctrl.postRoomNights(bookingID)
+		}
+	} else if status != currentBooking.Status {
+		// Move the booking to its new status, recording the times and fees that go with it
+		if err := ctrl.changeStatus(bookingID, status, changedBy(c), ""); err != nil {
+			ctrl.Logger.Error("Failed to change booking status",
+				zap.Int("bookingID", bookingID),
+				zap.String("status", status),
+				zap.Error(err))
+			httpStatus := fiber.StatusInternalServerError
+			if errors.Is(err, services.ErrInvalidTransition) || errors.Is(err, services.ErrBalanceDue) ||
+				errors.Is(err, services.ErrNoShowTooEarly) {
+				httpStatus = fiber.StatusConflict
+			}
+			return c.Status(httpStatus).JSON(fiber.Map{
+				"success": false,
+				"error":   "Failed to change booking status: " + err.Error(),
+			})
 		}
 	}
 
 	// Update guest name if provided
-	var guest *models.Guest
 	if updateData.GuestName != "" {
-		guest, err = ctrl.GuestService.GetGuestByID(currentBooking.GuestID)
+		guest, err := ctrl.GuestService.GetGuestByID(currentBooking.GuestID)
 		if err != nil {
 			ctrl.Logger.Error("Failed to get guest for name update",
 				zap.Uint("guestID", currentBooking.GuestID),
@@ -1080,42 +1281,19 @@ func (ctrl *BookingController) UpdateBooking(c *fiber.Ctx) error {
 		}
 	}
 
-	// Update booking
-	if err := ctrl.RoomService.UpdateBookingByID(updatedBooking.ID, updatedBooking.CheckIn, updatedBooking.CheckOut); err != nil {
-		ctrl.Logger.Error("Failed to update booking",
-			zap.Int("bookingID", bookingID),
-			zap.Error(err))
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to update booking: " + err.Error(),
-		})
-	}
-
-	// If status changed to checked-in, update actual check-in time
-	if status == models.BookingStatusCheckedIn && currentBooking.Status != models.BookingStatusCheckedIn {
-		if err := ctrl.RoomService.CheckGuestIn(uint(bookingID)); err != nil {
-			ctrl.Logger.Error("Failed to record check-in time",
-				zap.Int("bookingID", bookingID),
-				zap.Error(err))
-			// Continue anyway as the main update succeeded
-		}
-	}
-
-	// If status changed to completed, update actual check-out time
-	if status == models.BookingStatusCompleted && currentBooking.Status != models.BookingStatusCompleted {
-		if err := ctrl.RoomService.CheckGuestOut(uint(bookingID)); err != nil {
-			ctrl.Logger.Error("Failed to record check-out time",
-				zap.Int("bookingID", bookingID),
-				zap.Error(err))
-			// Continue anyway as the main update succeeded
-		}
-	}
-
 	ctrl.Logger.Info("Booking updated successfully",
 		zap.Int("bookingID", bookingID),
 		zap.Bool("datesChanged", datesChanged),
 		zap.String("status", status))
 
+	updatedBooking, err := ctrl.RoomService.GetBookingByID(uint(bookingID))
+	if err != nil {
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": "Booking updated successfully",
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Booking updated successfully",
@@ -1159,16 +1337,22 @@ func (ctrl *BookingController) CheckInGuest(c *fiber.Ctx) error {
 	}
 
 	// Check in the guest
-	if err := ctrl.RoomService.CheckGuestIn(uint(bookingID)); err != nil {
+	if err := ctrl.RoomService.CheckGuestIn(uint(bookingID), changedBy(c)); err != nil {
 		ctrl.Logger.Error("Failed to check in guest",
 			zap.Int("bookingID", bookingID),
 			zap.Error(err))
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidTransition) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to check in guest: " + err.Error(),
 		})
 	}
 
+	ctrl.postRoomNights(bookingID)
+
 	ctrl.Logger.Info("Guest checked in successfully", zap.Int("bookingID", bookingID))
 
 	return c.JSON(fiber.Map{
@@ -1212,12 +1396,28 @@ func (ctrl *BookingController) CheckOutGuest(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check out the guest
-	if err := ctrl.RoomService.CheckGuestOut(uint(bookingID)); err != nil {
+	// Make sure every night of the stay is on the folio before settling up
+	ctrl.postRoomNights(bookingID)
+
+	// Check out the guest; an outstanding balance blocks check-out unless overridden with ?force=true
+	balance, err := ctrl.RoomService.CheckGuestOut(uint(bookingID), c.QueryBool("force"), changedBy(c))
+	if err != nil {
+		if errors.Is(err, services.ErrBalanceDue) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"error":   fmt.Sprintf("Guest still owes %s. Collect the balance or check out with force=true", balance.Outstanding),
+				"data":    balance,
+			})
+		}
+
 		ctrl.Logger.Error("Failed to check out guest",
 			zap.Int("bookingID", bookingID),
 			zap.Error(err))
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidTransition) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to check out guest: " + err.Error(),
 		})
@@ -1225,12 +1425,393 @@ func (ctrl *BookingController) CheckOutGuest(c *fiber.Ctx) error {
 
 	ctrl.Logger.Info("Guest checked out successfully", zap.Int("bookingID", bookingID))
 
+	message := "Guest checked out successfully"
+	if balance.Outstanding.IsPositive() {
+		message = fmt.Sprintf("Guest checked out with %s still due", balance.Outstanding)
+	}
+
+	folio, err := ctrl.FolioService.GetFolio(uint(bookingID))
+	if err != nil {
+		ctrl.Logger.Error("Failed to build final folio", zap.Int("bookingID", bookingID), zap.Error(err))
+	} else {
+		// Send the final folio and invoice asynchronously
+		go func() {
+			checkedOut, err := ctrl.RoomService.GetBookingByID(uint(bookingID))
+			if err != nil {
+				return
+			}
+			if err := ctrl.EmailService.SendCheckoutReceipt(checkedOut, &checkedOut.Guest, folio, ctrl.invoiceAttachments(checkedOut.ID)...); err != nil {
+				ctrl.Logger.Error("Failed to send checkout email",
+					zap.Int("bookingID", bookingID),
+					zap.Error(err))
+			}
+		}()
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": message,
+		"data": fiber.Map{
+			"balance": balance,
+			"folio":   folio,
+		},
+	})
+}
+
+// bookingChangeRequest is the JSON body of a booking modification. Fields left
+// out stay as they are.
+type bookingChangeRequest struct {
+	RoomID          uint    `json:"room_id"`
+	CheckIn         string  `json:"check_in"`  // YYYY-MM-DD
+	CheckOut        string  `json:"check_out"` // YYYY-MM-DD
+	Adults          *int    `json:"adults"`
+	Children        *int    `json:"children"`
+	Infants         *int    `json:"infants"`
+	SpecialRequests *string `json:"special_requests"`
+	Reason          string  `json:"reason"`
+}
+
+// bookingChange parses the request body into a modification of booking
+func (ctrl *BookingController) bookingChange(c *fiber.Ctx, booking *models.RoomBooking) (services.BookingModification, string, error) {
+	var changeData bookingChangeRequest
+	if err := c.BodyParser(&changeData); err != nil {
+		return services.BookingModification{}, "", errors.New("Cannot parse JSON: " + err.Error())
+	}
+
+	modification := services.BookingModification{
+		RoomID:          changeData.RoomID,
+		SpecialRequests: changeData.SpecialRequests,
+	}
+
+	var err error
+	if changeData.CheckIn != "" {
+		if modification.CheckIn, err = time.Parse("2006-01-02", changeData.CheckIn); err != nil {
+			return modification, "", errors.New("Invalid check-in date format. Use YYYY-MM-DD")
+		}
+	}
+	if changeData.CheckOut != "" {
+		if modification.CheckOut, err = time.Parse("2006-01-02", changeData.CheckOut); err != nil {
+			return modification, "", errors.New("Invalid check-out date format. Use YYYY-MM-DD")
+		}
+	}
+
+	if changeData.CheckIn != "" || changeData.CheckOut != "" {
+		checkIn, checkOut := booking.CheckIn, booking.CheckOut
+		if !modification.CheckIn.IsZero() {
+			checkIn = modification.CheckIn
+		}
+		if !modification.CheckOut.IsZero() {
+			checkOut = modification.CheckOut
+		}
+		if err := ctrl.validateBookingDates(checkIn, checkOut); err != nil {
+			return modification, "", err
+		}
+	}
+
+	if changeData.Adults != nil || changeData.Children != nil || changeData.Infants != nil {
+		occupancy := services.BookingOccupancy(booking)
+		if changeData.Adults != nil {
+			occupancy.Adults = *changeData.Adults
+		}
+		if changeData.Children != nil {
+			occupancy.Children = *changeData.Children
+		}
+		if changeData.Infants != nil {
+			occupancy.Infants = *changeData.Infants
+		}
+		modification.Occupancy = &occupancy
+	}
+
+	return modification, changeData.Reason, nil
+}
+
+// modificationErrorStatus picks the HTTP status for a failed booking modification
+func modificationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRoomUnavailable), errors.Is(err, services.ErrBookingNotModifiable),
+		errors.Is(err, services.ErrInvalidTransition), errors.Is(err, services.ErrBalanceDue),
+		errors.Is(err, services.ErrNoShowTooEarly):
+		return fiber.StatusConflict
+	case errors.Is(err, services.ErrInvalidBookingChange), errors.Is(err, services.ErrNoBookingChanges),
+		errors.Is(err, services.ErrOverCapacity), errors.Is(err, services.ErrStayRestricted),
+		errors.Is(err, services.ErrUnknownBookingStatus):
+		return fiber.StatusBadRequest
+	case strings.Contains(err.Error(), "not found"):
+		return fiber.StatusNotFound
+	}
+	return fiber.StatusInternalServerError
+}
+
+// PreviewBookingChange shows what a booking would cost after a change of
+// room, dates, guests or requests, and the difference, without making it
+// POST /api/admin/bookings/:id/changes/preview
+func (ctrl *BookingController) PreviewBookingChange(c *fiber.Ctx) error {
+	bookingID, err := c.ParamsInt("id")
+	if err != nil || bookingID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid booking ID",
+		})
+	}
+
+	booking, err := ctrl.RoomService.GetBookingByID(uint(bookingID))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "Booking not found: " + err.Error(),
+		})
+	}
+
+	modification, _, err := ctrl.bookingChange(c, booking)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	quote, err := ctrl.Modifications.Preview(uint(bookingID), modification)
+	if err != nil {
+		return c.Status(modificationErrorStatus(err)).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot change booking: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    quote,
+	})
+}
+
+// ChangeBooking changes the room, dates, guests or requests of a booking,
+// repricing it and recording the change. The guest is emailed what changed.
+// POST /api/admin/bookings/:id/changes
+func (ctrl *BookingController) ChangeBooking(c *fiber.Ctx) error {
+	bookingID, err := c.ParamsInt("id")
+	if err != nil || bookingID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid booking ID",
+		})
+	}
+
+	booking, err := ctrl.RoomService.GetBookingByID(uint(bookingID))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "Booking not found: " + err.Error(),
+		})
+	}
+
+	modification, reason, err := ctrl.bookingChange(c, booking)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	change, err := ctrl.Modifications.Modify(uint(bookingID), modification, changedBy(c), reason)
+	if err != nil {
+		return c.Status(modificationErrorStatus(err)).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to change booking: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Booking changed",
+		"data":    change,
+	})
+}
+
+// GetBookingChanges returns every change made to a booking, oldest first
+// GET /api/admin/bookings/:id/changes
+func (ctrl *BookingController) GetBookingChanges(c *fiber.Ctx) error {
+	bookingID, err := c.ParamsInt("id")
+	if err != nil || bookingID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid booking ID",
+		})
+	}
+
+	changes, err := ctrl.Modifications.GetChanges(uint(bookingID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get booking changes: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    changes,
+	})
+}
+
+// bookingStatusRequest is the JSON body of a booking status change
+type bookingStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// ChangeBookingStatus moves a booking to a new status. Changes the booking
+// state machine does not allow are refused with 409 Conflict.
+// PUT /api/admin/bookings/:id/status
+func (ctrl *BookingController) ChangeBookingStatus(c *fiber.Ctx) error {
+	bookingID, err := c.ParamsInt("id")
+	if err != nil || bookingID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid booking ID",
+		})
+	}
+
+	var statusData bookingStatusRequest
+	if err := c.BodyParser(&statusData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot parse JSON: " + err.Error(),
+		})
+	}
+
+	if err := ctrl.changeStatus(bookingID, statusData.Status, changedBy(c), statusData.Reason); err != nil {
+		ctrl.Logger.Warn("Failed to change booking status",
+			zap.Int("bookingID", bookingID),
+			zap.String("status", statusData.Status),
+			zap.Error(err))
+		status := fiber.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrInvalidTransition), errors.Is(err, services.ErrBalanceDue),
+			errors.Is(err, services.ErrNoShowTooEarly):
+			status = fiber.StatusConflict
+		case errors.Is(err, services.ErrUnknownBookingStatus):
+			status = fiber.StatusBadRequest
+		case strings.Contains(err.Error(), "not found"):
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to change booking status: " + err.Error(),
+		})
+	}
+
+	booking, err := ctrl.RoomService.GetBookingByID(uint(bookingID))
+	if err != nil {
+		return c.JSON(fiber.Map{
+			"success": true,
+			"message": "Booking status changed",
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
-		"message": "Guest checked out successfully",
+		"message": "Booking status changed",
+		"data":    booking,
 	})
 }
 
+// GetBookingTransitions returns who changed a booking's status and when,
+// oldest first
+// GET /api/admin/bookings/:id/transitions
+func (ctrl *BookingController) GetBookingTransitions(c *fiber.Ctx) error {
+	bookingID, err := c.ParamsInt("id")
+	if err != nil || bookingID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid booking ID",
+		})
+	}
+
+	transitions, err := ctrl.RoomService.GetTransitions(uint(bookingID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get booking status history: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    transitions,
+	})
+}
+
+// invoiceAttachments renders a booking's invoice for an email. Emails still go
+// out without it if the invoice cannot be rendered.
+func (ctrl *BookingController) invoiceAttachments(bookingID uint) []services.EmailAttachment {
+	attachment, err := ctrl.InvoiceService.InvoiceAttachment(bookingID)
+	if err != nil {
+		ctrl.Logger.Error("Failed to render invoice for email",
+			zap.Uint("bookingID", bookingID),
+			zap.Error(err))
+		return nil
+	}
+	return []services.EmailAttachment{attachment}
+}
+
+// postRoomNights puts the nights of a stay on its folio. Failures are logged
+// only: nights already posted are skipped, so a later posting catches up.
+func (ctrl *BookingController) postRoomNights(bookingID int) {
+	if _, err := ctrl.FolioService.PostRoomNights(uint(bookingID)); err != nil {
+		ctrl.Logger.Error("Failed to post room nights to folio",
+			zap.Int("bookingID", bookingID),
+			zap.Error(err))
+	}
+}
+
+// changedBy names who is making a front desk change, for the booking's
+// status history: the signed in user, else ?changed_by=, else staff
+func changedBy(c *fiber.Ctx) string {
+	if email, ok := c.Locals("email").(string); ok && email != "" {
+		return email
+	}
+	if name := strings.TrimSpace(c.Query("changed_by")); name != "" {
+		return name
+	}
+	return models.BookingActorStaff
+}
+
+// changeStatus moves a booking to status through the service method that
+// records what goes with it, e.g. the check-in time or the cancellation or
+// no-show fee
+func (ctrl *BookingController) changeStatus(bookingID int, status, actor, reason string) error {
+	switch status {
+	case models.BookingStatusCheckedIn:
+		if err := ctrl.RoomService.CheckGuestIn(uint(bookingID), actor); err != nil {
+			return err
+		}
+		ctrl.postRoomNights(bookingID)
+	case models.BookingStatusCheckedOut:
+		// Checking out with money owed goes through CheckOutGuest with force=true
+		ctrl.postRoomNights(bookingID)
+		if _, err := ctrl.RoomService.CheckGuestOut(uint(bookingID), false, actor); err != nil {
+			return err
+		}
+	case models.BookingStatusCancelled:
+		if _, err := ctrl.RoomService.CancelBooking(uint(bookingID), reason, actor); err != nil {
+			return err
+		}
+	case models.BookingStatusNoShow:
+		if _, err := ctrl.RoomService.MarkNoShow(uint(bookingID), actor); err != nil {
+			return err
+		}
+	default:
+		return ctrl.RoomService.UpdateBookingStatus(uint(bookingID), status, actor, reason)
+	}
+	return nil
+}
+
+// guestErrorMessage turns a promo code or stay rule error into a message for
+// the guest, e.g. "Promo code cannot be used: DASHAIN10 expired on October 6, 2025."
+func guestErrorMessage(err error) string {
+	message := err.Error()
+	return strings.ToUpper(message[:1]) + message[1:] + "."
+}
+
 // Helper function to validate booking dates
 func (ctrl *BookingController) validateBookingDates(checkIn, checkOut time.Time) error {
 	// Normalize dates to start of day for comparison
@@ -1328,6 +1909,20 @@ func (ctrl *BookingController) CheckRoomAvailability(c *fiber.Ctx) error {
         `)
 	}
 
+	// Check the stay rules for the dates
+	if err := ctrl.Pricing.CheckStay(room, checkIn, checkOut); err != nil {
+		message := "Error checking availability"
+		if errors.Is(err, services.ErrStayRestricted) {
+			message = html.EscapeString(guestErrorMessage(err))
+		}
+		return c.SendString(`
+            <div class="bg-yellow-50 text-yellow-700 p-3 rounded-lg border border-yellow-200 flex items-center">
+                <i class="fas fa-exclamation-triangle mr-2"></i>
+                <span>` + message + `</span>
+            </div>
+        `)
+	}
+
 	// Check availability
 	available, err := ctrl.RoomService.IsRoomAvailable(room.ID, checkIn, checkOut)
 	if err != nil {
@@ -1363,7 +1958,7 @@ func (ctrl *BookingController) LookupBooking(c *fiber.Ctx) error {
 
 	if email == "" || bookingCode == "" {
 		return c.Status(fiber.StatusBadRequest).Render("partials/lookup_error", fiber.Map{
-			"Message": "Please provide both email and booking code",
+			"Message": "Please provide both your email and booking reference",
 		})
 	}
 
@@ -1376,7 +1971,8 @@ func (ctrl *BookingController) LookupBooking(c *fiber.Ctx) error {
 	}
 
 	return c.Render("partials/booking_details", fiber.Map{
-		"Booking": booking,
+		"Booking":      booking,
+		"Cancellation": services.BookingCancellationTerms(booking),
 	})
 }
 
@@ -1430,7 +2026,7 @@ func (ctrl *BookingController) CancelBookingByGuest(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := ctrl.RoomService.CancelBooking(uint(id)); err != nil {
+	if _, err := ctrl.RoomService.CancelBooking(uint(id), "", models.BookingActorGuest); err != nil {
 		ctrl.Logger.Error("Failed to cancel booking", zap.Error(err))
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Unable to cancel booking",
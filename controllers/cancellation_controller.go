@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"github.com/IamMaheshGurung/privateOnsenBooking/services"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// CancellationController handles cancellation policy management
+type CancellationController struct {
+	Service *services.CancellationService
+	Logger  *zap.Logger
+}
+
+// NewCancellationController creates a new instance of CancellationController
+func NewCancellationController(service *services.CancellationService, logger *zap.Logger) *CancellationController {
+	return &CancellationController{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// cancellationPolicyRequest is the JSON body of a cancellation policy
+type cancellationPolicyRequest struct {
+	Name             string                   `json:"name"`
+	Description      string                   `json:"description"`
+	NonRefundable    bool                     `json:"non_refundable"`
+	Tiers            models.CancellationTiers `json:"tiers"` // e.g. [{"hours_before":168,"fee_percent":50},{"hours_before":24,"fee_percent":100}]
+	NoShowFeePercent float64                  `json:"no_show_fee_percent"`
+	Default          bool                     `json:"default"`
+	Active           *bool                    `json:"active"` // Defaults to true
+}
+
+// policy parses the request body into a cancellation policy
+func (ctrl *CancellationController) policy(c *fiber.Ctx) (*models.CancellationPolicy, error) {
+	var policyData cancellationPolicyRequest
+	if err := c.BodyParser(&policyData); err != nil {
+		return nil, errors.New("Cannot parse JSON: " + err.Error())
+	}
+
+	return &models.CancellationPolicy{
+		Name:             policyData.Name,
+		Description:      policyData.Description,
+		NonRefundable:    policyData.NonRefundable,
+		Tiers:            policyData.Tiers,
+		NoShowFeePercent: policyData.NoShowFeePercent,
+		Default:          policyData.Default,
+		Active:           policyData.Active == nil || *policyData.Active,
+	}, nil
+}
+
+// GetPolicies returns every cancellation policy
+// GET /api/admin/cancellation-policies
+func (ctrl *CancellationController) GetPolicies(c *fiber.Ctx) error {
+	policies, err := ctrl.Service.GetPolicies()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get cancellation policies: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    policies,
+	})
+}
+
+// CreatePolicy adds a cancellation policy
+// POST /api/admin/cancellation-policies
+func (ctrl *CancellationController) CreatePolicy(c *fiber.Ctx) error {
+	policy, err := ctrl.policy(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	if err := ctrl.Service.SavePolicy(policy); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to create cancellation policy: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    policy,
+	})
+}
+
+// UpdatePolicy replaces a cancellation policy. Bookings already made keep the
+// terms they were made on.
+// PUT /api/admin/cancellation-policies/:id
+func (ctrl *CancellationController) UpdatePolicy(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid cancellation policy ID",
+		})
+	}
+
+	policy, err := ctrl.policy(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	policy.ID = uint(id)
+
+	if err := ctrl.Service.SavePolicy(policy); err != nil {
+		status := fiber.StatusBadRequest
+		if errors.Is(err, services.ErrCancellationPolicyNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to update cancellation policy: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    policy,
+	})
+}
+
+// DeactivatePolicy stops a cancellation policy being given to new bookings
+// DELETE /api/admin/cancellation-policies/:id
+func (ctrl *CancellationController) DeactivatePolicy(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid cancellation policy ID",
+		})
+	}
+
+	if err := ctrl.Service.DeactivatePolicy(uint(id)); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrCancellationPolicyNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to deactivate cancellation policy: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Cancellation policy deactivated",
+	})
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/services"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// DisplayCurrencyCookie remembers the currency a guest chose to see prices in
+const DisplayCurrencyCookie = "display_currency"
+
+// ExchangeRateController handles the exchange rate table and the guest's
+// display currency
+type ExchangeRateController struct {
+	Service   *services.ExchangeRateService
+	Logger    *zap.Logger
+	RatesFile string // Local file the rates are reloaded from
+}
+
+// NewExchangeRateController creates a new instance of ExchangeRateController
+func NewExchangeRateController(service *services.ExchangeRateService, logger *zap.Logger, ratesFile string) *ExchangeRateController {
+	return &ExchangeRateController{
+		Service:   service,
+		Logger:    logger,
+		RatesFile: ratesFile,
+	}
+}
+
+// DisplayCurrency is middleware that makes the guest's display currency and
+// the currencies on offer available to every page as DisplayCurrency and
+// DisplayCurrencies
+func (ctrl *ExchangeRateController) DisplayCurrency(c *fiber.Ctx) error {
+	currencies := ctrl.Service.Currencies()
+
+	display := ctrl.Service.BaseCurrency()
+	if chosen := c.Cookies(DisplayCurrencyCookie); chosen != "" {
+		for _, currency := range currencies {
+			if currency == chosen {
+				display = chosen
+				break
+			}
+		}
+	}
+
+	c.Locals("DisplayCurrency", display)
+	if err := c.Bind(fiber.Map{
+		"DisplayCurrency":   display,
+		"DisplayCurrencies": currencies,
+	}); err != nil {
+		return err
+	}
+
+	return c.Next()
+}
+
+// SetDisplayCurrency stores the currency the guest wants to see prices in
+// POST /currency
+func (ctrl *ExchangeRateController) SetDisplayCurrency(c *fiber.Ctx) error {
+	currency := c.FormValue("currency")
+
+	supported := false
+	for _, code := range ctrl.Service.Currencies() {
+		if code == currency {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Prices cannot be shown in that currency",
+		})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     DisplayCurrencyCookie,
+		Value:    currency,
+		Path:     "/",
+		Expires:  time.Now().AddDate(1, 0, 0),
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+
+	// Reload the page so every price is shown in the new currency
+	if c.Get("HX-Request") == "true" {
+		c.Set("HX-Refresh", "true")
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	return c.Redirect(c.Get(fiber.HeaderReferer, "/"))
+}
+
+// GetRates returns the exchange rate table, optionally for one currency
+// GET /api/admin/exchange-rates?currency=JPY
+func (ctrl *ExchangeRateController) GetRates(c *fiber.Ctx) error {
+	rates, err := ctrl.Service.GetRates(c.Query("currency"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get exchange rates: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"base_currency": ctrl.Service.BaseCurrency(),
+			"rates":         rates,
+		},
+	})
+}
+
+// SetRate records a rate from a given date
+// POST /api/admin/exchange-rates
+func (ctrl *ExchangeRateController) SetRate(c *fiber.Ctx) error {
+	var rateData struct {
+		Currency      string `json:"currency"`
+		Rate          string `json:"rate"`           // Units of currency per one base currency, e.g. "1.0845"
+		EffectiveDate string `json:"effective_date"` // YYYY-MM-DD, defaults to today
+	}
+
+	if err := c.BodyParser(&rateData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot parse JSON: " + err.Error(),
+		})
+	}
+
+	effective := time.Now()
+	if rateData.EffectiveDate != "" {
+		parsed, err := time.Parse("2006-01-02", rateData.EffectiveDate)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid effective date format. Use YYYY-MM-DD",
+			})
+		}
+		effective = parsed
+	}
+
+	rate, err := ctrl.Service.SetRate(rateData.Currency, rateData.Rate, effective, "admin")
+	if err != nil {
+		ctrl.Logger.Warn("Failed to set exchange rate", zap.String("currency", rateData.Currency), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to set exchange rate: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rate,
+	})
+}
+
+// ReloadRates loads the rates file again after it has been edited
+// POST /api/admin/exchange-rates/reload
+func (ctrl *ExchangeRateController) ReloadRates(c *fiber.Ctx) error {
+	if ctrl.RatesFile == "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   "No exchange rates file is configured",
+		})
+	}
+
+	loaded, err := ctrl.Service.LoadFile(ctrl.RatesFile)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to load exchange rates: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Exchange rates loaded",
+		"data":    fiber.Map{"loaded": loaded},
+	})
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"github.com/IamMaheshGurung/privateOnsenBooking/services"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// FolioController handles guest folio HTTP requests
+type FolioController struct {
+	Service *services.FolioService
+	Logger  *zap.Logger
+}
+
+// NewFolioController creates a new instance of FolioController
+func NewFolioController(service *services.FolioService, logger *zap.Logger) *FolioController {
+	return &FolioController{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// GetFolio returns the charges and payments of a booking
+// GET /api/admin/bookings/:id/folio
+func (ctrl *FolioController) GetFolio(c *fiber.Ctx) error {
+	bookingID, err := c.ParamsInt("id")
+	if err != nil || bookingID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid booking ID",
+		})
+	}
+
+	folio, err := ctrl.Service.GetFolio(uint(bookingID))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get folio: " + err.Error(),
+		})
+	}
+
+	if c.Get("HX-Request") == "true" {
+		return c.Render("partials/folio", folio, "")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    folio,
+	})
+}
+
+// PostCharge posts an incidental charge such as dining or an experience to a booking
+// POST /api/admin/bookings/:id/folio/items
+func (ctrl *FolioController) PostCharge(c *fiber.Ctx) error {
+	bookingID, err := c.ParamsInt("id")
+	if err != nil || bookingID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid booking ID",
+		})
+	}
+
+	var chargeData struct {
+		Category    string      `json:"category" form:"category"` // onsen, dining, experience, minibar
+		Description string      `json:"description" form:"description"`
+		Quantity    int         `json:"quantity" form:"quantity"`
+		UnitPrice   json.Number `json:"unit_price" form:"unit_price"`     // In the booking's currency
+		ServiceDate string      `json:"service_date" form:"service_date"` // YYYY-MM-DD, defaults to today
+	}
+
+	if err := c.BodyParser(&chargeData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot parse request: " + err.Error(),
+		})
+	}
+
+	unitPrice, err := models.ParseMoney(chargeData.UnitPrice.String(), "")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid unit price",
+		})
+	}
+
+	var serviceDate time.Time
+	if chargeData.ServiceDate != "" {
+		serviceDate, err = time.Parse("2006-01-02", chargeData.ServiceDate)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid service date format. Use YYYY-MM-DD",
+			})
+		}
+	}
+
+	item, err := ctrl.Service.PostCharge(uint(bookingID), chargeData.Category, chargeData.Description,
+		chargeData.Quantity, unitPrice, serviceDate)
+	if err != nil {
+		ctrl.Logger.Warn("Failed to post charge", zap.Int("bookingID", bookingID), zap.Error(err))
+		status := fiber.StatusBadRequest
+		if errors.Is(err, services.ErrFolioClosed) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to post charge: " + err.Error(),
+		})
+	}
+
+	if c.Get("HX-Request") == "true" {
+		return ctrl.GetFolio(c)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    item,
+	})
+}
+
+// VoidItem takes a charge off a booking's folio
+// DELETE /api/admin/bookings/:id/folio/items/:itemId
+func (ctrl *FolioController) VoidItem(c *fiber.Ctx) error {
+	bookingID, err := c.ParamsInt("id")
+	if err != nil || bookingID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid booking ID",
+		})
+	}
+
+	itemID, err := c.ParamsInt("itemId")
+	if err != nil || itemID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid item ID",
+		})
+	}
+
+	if err := ctrl.Service.VoidItem(uint(bookingID), uint(itemID)); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrFolioItemNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to void charge: " + err.Error(),
+		})
+	}
+
+	if c.Get("HX-Request") == "true" {
+		return ctrl.GetFolio(c)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Charge removed from folio",
+	})
+}
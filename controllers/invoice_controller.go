@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/services"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// InvoiceController handles invoice downloads
+type InvoiceController struct {
+	Service     *services.InvoiceService
+	RoomService *services.RoomBookingService
+	Logger      *zap.Logger
+}
+
+// NewInvoiceController creates a new instance of InvoiceController
+func NewInvoiceController(service *services.InvoiceService, roomService *services.RoomBookingService, logger *zap.Logger) *InvoiceController {
+	return &InvoiceController{
+		Service:     service,
+		RoomService: roomService,
+		Logger:      logger,
+	}
+}
+
+// DownloadInvoice sends the PDF invoice of a booking
+// GET /api/admin/bookings/:id/invoice
+func (ctrl *InvoiceController) DownloadInvoice(c *fiber.Ctx) error {
+	bookingID, err := c.ParamsInt("id")
+	if err != nil || bookingID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid booking ID",
+		})
+	}
+
+	return ctrl.sendInvoice(c, uint(bookingID))
+}
+
+// DownloadGuestInvoice sends the PDF invoice of a booking to a guest who
+// proves it is theirs with their email and booking reference
+// POST /booking/invoice
+func (ctrl *InvoiceController) DownloadGuestInvoice(c *fiber.Ctx) error {
+	email := c.FormValue("email")
+	bookingCode := c.FormValue("booking_code")
+
+	if email == "" || bookingCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Missing authentication details",
+		})
+	}
+
+	booking, err := ctrl.RoomService.GetBookingByEmailAndCode(email, bookingCode)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Booking not found with the provided details",
+		})
+	}
+
+	return ctrl.sendInvoice(c, booking.ID)
+}
+
+func (ctrl *InvoiceController) sendInvoice(c *fiber.Ctx, bookingID uint) error {
+	pdf, invoice, err := ctrl.Service.RenderInvoicePDF(bookingID)
+	if errors.Is(err, services.ErrInvoiceNotIssued) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   "The invoice is issued at check-out",
+		})
+	}
+	if err != nil {
+		ctrl.Logger.Error("Failed to render invoice", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to generate invoice: " + err.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, services.InvoiceFilename(invoice)))
+	return c.Send(pdf)
+}
@@ -0,0 +1,728 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"github.com/IamMaheshGurung/privateOnsenBooking/services"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// OnsenController handles private onsen booking HTTP requests
+type OnsenController struct {
+	Service         *services.OnsenBookingService
+	ScheduleService *services.OnsenScheduleService
+	RoomService     *services.RoomBookingService
+	Logger          *zap.Logger
+}
+
+// NewOnsenController creates a new instance of OnsenController
+func NewOnsenController(
+	service *services.OnsenBookingService,
+	scheduleService *services.OnsenScheduleService,
+	roomService *services.RoomBookingService,
+	logger *zap.Logger,
+) *OnsenController {
+	return &OnsenController{
+		Service:         service,
+		ScheduleService: scheduleService,
+		RoomService:     roomService,
+		Logger:          logger,
+	}
+}
+
+// onsenBookingRequest is the payload accepted by CreateOnsenBooking, either as
+// form values from the HTMX partials or as a JSON body from the API. Email and
+// BookingCode prove the caller owns the room booking.
+type onsenBookingRequest struct {
+	GuestID     uint   `json:"guest_id" form:"guest_id"`
+	RoomID      uint   `json:"room_id" form:"room_id"`
+	BookingID   uint   `json:"booking_id" form:"booking_id"`
+	OnsenID     uint   `json:"onsen_id" form:"onsen_id"`
+	Date        string `json:"date" form:"date"`
+	TimeSlot    string `json:"time_slot" form:"time_slot"`
+	GuestCount  int    `json:"guest_count" form:"guest_count"`
+	Email       string `json:"email" form:"email"`
+	BookingCode string `json:"booking_code" form:"booking_code"`
+}
+
+// onsenOwnerRequest carries the guest's email and booking reference for
+// requests that act on an existing onsen booking
+type onsenOwnerRequest struct {
+	Email       string `json:"email" form:"email"`
+	BookingCode string `json:"booking_code" form:"booking_code"`
+}
+
+// ShowOnsenBookingForm renders the onsen reservation form for a room booking
+// GET /onsen-booking?booking_id=1&email=guest@example.com&booking_code=ABC123
+func (ctrl *OnsenController) ShowOnsenBookingForm(c *fiber.Ctx) error {
+	bookingID, err := strconv.Atoi(c.Query("booking_id"))
+	if err != nil || bookingID <= 0 {
+		return ctrl.renderError(c, "A valid room booking is required to reserve the onsen")
+	}
+
+	email := c.Query("email")
+	bookingCode := c.Query("booking_code")
+	if !ctrl.ownsBooking(uint(bookingID), email, bookingCode) {
+		return ctrl.renderError(c, "Please enter the email and booking reference of your stay")
+	}
+
+	booking, err := ctrl.RoomService.GetBookingByID(uint(bookingID))
+	if err != nil {
+		ctrl.Logger.Warn("Room booking not found for onsen form", zap.Int("bookingID", bookingID), zap.Error(err))
+		return ctrl.renderError(c, "Room booking not found")
+	}
+
+	if booking.Status != models.BookingStatusConfirmed && booking.Status != models.BookingStatusCheckedIn {
+		return ctrl.renderError(c, "Only confirmed or checked-in guests can reserve the onsen")
+	}
+
+	freeSessionsLeft, err := ctrl.Service.GetRemainingFreeSessions(booking)
+	if err != nil {
+		ctrl.Logger.Error("Failed to get remaining free onsen sessions", zap.Int("bookingID", bookingID), zap.Error(err))
+		return ctrl.renderError(c, "Could not load your onsen allowance")
+	}
+
+	onsens, err := ctrl.Service.GetActiveOnsens()
+	if err != nil {
+		ctrl.Logger.Error("Failed to get onsens for booking form", zap.Error(err))
+		return ctrl.renderError(c, "Could not load the list of baths")
+	}
+
+	return c.Render("partials/onsen_timeslot", fiber.Map{
+		"Onsens":    onsens,
+		"GuestID":   booking.GuestID,
+		"RoomID":    booking.RoomID,
+		"BookingID": booking.ID,
+		"CheckIn":   booking.CheckIn.Format("2006-01-02"),
+		"CheckOut":  booking.CheckOut.Format("2006-01-02"),
+
+		"Email":       email,
+		"BookingCode": bookingCode,
+
+		"FreeSessionsLeft": freeSessionsLeft,
+	}, "")
+}
+
+// ListOnsens returns the baths that can be reserved
+// GET /api/onsen/onsens
+func (ctrl *OnsenController) ListOnsens(c *fiber.Ctx) error {
+	onsens, err := ctrl.Service.GetActiveOnsens()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get onsens: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    onsens,
+	})
+}
+
+// GetDailySchedule returns every session of a bath on a date with its availability
+// GET /api/onsen/onsens/:id/schedule?date=2023-09-01
+func (ctrl *OnsenController) GetDailySchedule(c *fiber.Ctx) error {
+	onsenID, err := c.ParamsInt("id")
+	if err != nil || onsenID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid onsen ID",
+		})
+	}
+
+	dateStr := c.Query("date", time.Now().Format("2006-01-02"))
+	date, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid date format. Use YYYY-MM-DD",
+		})
+	}
+
+	schedule, err := ctrl.Service.GetDailySchedule(uint(onsenID), date)
+	if err != nil {
+		ctrl.Logger.Error("Failed to get onsen schedule", zap.Int("onsenID", onsenID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get schedule: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"date":    dateStr,
+		"data":    schedule,
+	})
+}
+
+// GetAvailableSlots returns the free time slots of a bath for a date
+// GET /api/onsen/slots?onsen_id=1&date=2023-09-01
+func (ctrl *OnsenController) GetAvailableSlots(c *fiber.Ctx) error {
+	dateStr := c.Query("date")
+
+	onsenID, err := strconv.Atoi(c.Query("onsen_id"))
+	if err != nil || onsenID <= 0 {
+		if c.Get("HX-Request") == "true" {
+			return c.Render("partials/onsen_slot_options", fiber.Map{
+				"Message": "Select a bath first",
+			}, "")
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "A valid onsen_id is required",
+		})
+	}
+
+	date, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		ctrl.Logger.Warn("Invalid onsen date", zap.String("date", dateStr))
+		if c.Get("HX-Request") == "true" {
+			return c.Render("partials/onsen_slot_options", fiber.Map{
+				"Message": "Select a date first",
+			}, "")
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid date format. Use YYYY-MM-DD",
+		})
+	}
+
+	schedule, err := ctrl.Service.GetDailySchedule(uint(onsenID), date)
+	if err != nil {
+		ctrl.Logger.Error("Failed to get onsen slots", zap.String("date", dateStr), zap.Error(err))
+		if c.Get("HX-Request") == "true" {
+			return c.Render("partials/onsen_slot_options", fiber.Map{
+				"Message": "Could not load time slots",
+			}, "")
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get time slots: " + err.Error(),
+		})
+	}
+
+	slots := schedule.AvailableSlots()
+
+	if c.Get("HX-Request") == "true" {
+		message := ""
+		if schedule.Hours.Closed {
+			message = schedule.Hours.Reason
+		} else if len(slots) == 0 {
+			message = "No sessions left on this date"
+		}
+		return c.Render("partials/onsen_slot_options", fiber.Map{
+			"Date":        dateStr,
+			"Slots":       slots,
+			"Message":     message,
+			"SlotMinutes": schedule.Hours.SlotMinutes,
+		}, "")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"date":    dateStr,
+		"hours":   schedule.Hours,
+		"data":    slots,
+	})
+}
+
+// CreateOnsenBooking reserves a private onsen session
+// POST /api/onsen/bookings
+func (ctrl *OnsenController) CreateOnsenBooking(c *fiber.Ctx) error {
+	var req onsenBookingRequest
+	if err := c.BodyParser(&req); err != nil {
+		ctrl.Logger.Warn("Cannot parse onsen booking request", zap.Error(err))
+		return ctrl.respondError(c, fiber.StatusBadRequest, "Invalid request data: "+err.Error())
+	}
+
+	if req.GuestID == 0 || req.RoomID == 0 || req.BookingID == 0 {
+		return ctrl.respondError(c, fiber.StatusBadRequest, "Guest, room and booking are required")
+	}
+
+	if !ctrl.ownsBooking(req.BookingID, req.Email, req.BookingCode) {
+		return ctrl.respondError(c, fiber.StatusUnauthorized, "Not authorized to reserve the onsen for this booking")
+	}
+
+	if req.OnsenID == 0 {
+		return ctrl.respondError(c, fiber.StatusBadRequest, "Please select a bath")
+	}
+
+	if req.TimeSlot == "" {
+		return ctrl.respondError(c, fiber.StatusBadRequest, "Please select a time slot")
+	}
+
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		ctrl.Logger.Warn("Invalid onsen date", zap.String("date", req.Date))
+		return ctrl.respondError(c, fiber.StatusBadRequest, "Invalid date format. Use YYYY-MM-DD")
+	}
+
+	booking, err := ctrl.Service.CreateOnsenBooking(req.GuestID, req.RoomID, req.BookingID, req.OnsenID, date, req.TimeSlot, req.GuestCount)
+	if err != nil {
+		if errors.Is(err, services.ErrOnsenSlotTaken) {
+			return ctrl.respondSlotTaken(c, req.OnsenID, date)
+		}
+
+		ctrl.Logger.Error("Failed to create onsen booking",
+			zap.Uint("bookingID", req.BookingID),
+			zap.String("date", req.Date),
+			zap.String("timeSlot", req.TimeSlot),
+			zap.Error(err))
+		return ctrl.respondError(c, fiber.StatusConflict, "Failed to book onsen: "+err.Error())
+	}
+
+	ctrl.Logger.Info("Onsen booking created",
+		zap.Uint("onsenBookingID", booking.ID),
+		zap.Uint("onsenID", req.OnsenID),
+		zap.Uint("bookingID", req.BookingID))
+
+	if c.Get("HX-Request") == "true" {
+		return c.Render("partials/onsen_book_confirm", fiber.Map{
+			"OnsenName":      booking.Onsen.Name,
+			"Price":          booking.Price,
+			"Complimentary":  booking.Complimentary,
+			"Date":           booking.Date.Format("Monday, January 2, 2006"),
+			"TimeSlot":       booking.TimeSlot,
+			"OnsenBookingID": booking.ID,
+			"Email":          req.Email,
+			"BookingCode":    req.BookingCode,
+		}, "")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Onsen booked successfully",
+		"data":    booking,
+	})
+}
+
+// GetOnsenBooking returns a single onsen booking
+// GET /api/admin/onsen/bookings/:id
+func (ctrl *OnsenController) GetOnsenBooking(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		ctrl.Logger.Warn("Invalid onsen booking ID", zap.String("id", c.Params("id")))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid onsen booking ID",
+		})
+	}
+
+	booking, err := ctrl.Service.GetOnsenBookingByID(uint(id))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "Onsen booking not found: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    booking,
+	})
+}
+
+// GetOnsenBookingsByDate returns the onsen bookings for a date, optionally for one bath
+// GET /api/admin/onsen/bookings?date=2023-09-01&onsen_id=1
+func (ctrl *OnsenController) GetOnsenBookingsByDate(c *fiber.Ctx) error {
+	onsenID := c.QueryInt("onsen_id", 0)
+	if onsenID < 0 {
+		onsenID = 0
+	}
+
+	dateStr := c.Query("date", time.Now().Format("2006-01-02"))
+
+	date, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		ctrl.Logger.Warn("Invalid date format", zap.String("date", dateStr))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid date format. Use YYYY-MM-DD",
+		})
+	}
+
+	bookings, err := ctrl.Service.GetOnsenBookingsByDate(uint(onsenID), date)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get onsen bookings: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    bookings,
+	})
+}
+
+// CancelOnsenBooking cancels a private onsen session
+// PUT /api/onsen/bookings/:id/cancel, POST /onsen-booking/cancel/:id
+func (ctrl *OnsenController) CancelOnsenBooking(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		ctrl.Logger.Warn("Invalid onsen booking ID", zap.String("id", c.Params("id")))
+		return ctrl.respondError(c, fiber.StatusBadRequest, "Invalid onsen booking ID")
+	}
+
+	var owner onsenOwnerRequest
+	if err := c.BodyParser(&owner); err != nil {
+		return ctrl.respondError(c, fiber.StatusBadRequest, "Invalid request data: "+err.Error())
+	}
+
+	session, err := ctrl.Service.GetOnsenBookingByID(uint(id))
+	if err != nil {
+		return ctrl.respondError(c, fiber.StatusNotFound, "Onsen booking not found")
+	}
+
+	if !ctrl.ownsBooking(session.BookingID, owner.Email, owner.BookingCode) {
+		return ctrl.respondError(c, fiber.StatusUnauthorized, "Not authorized to cancel this onsen booking")
+	}
+
+	if err := ctrl.Service.CancelOnsenBooking(uint(id)); err != nil {
+		ctrl.Logger.Error("Failed to cancel onsen booking", zap.Int("id", id), zap.Error(err))
+		if errors.Is(err, services.ErrOnsenSessionClosed) {
+			return ctrl.respondError(c, fiber.StatusConflict, "This onsen session can no longer be cancelled")
+		}
+		return ctrl.respondError(c, fiber.StatusInternalServerError, "Failed to cancel onsen booking: "+err.Error())
+	}
+
+	if c.Get("HX-Request") == "true" {
+		return c.Render("partials/onsen_cancelled", fiber.Map{
+			"OnsenBookingID": id,
+		}, "")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Onsen booking cancelled successfully",
+	})
+}
+
+// Admin Routes
+
+// UpdateSessionLayout changes a bath's default hours, session length and cleaning buffer
+// PUT /api/admin/onsen/:id/layout
+func (ctrl *OnsenController) UpdateSessionLayout(c *fiber.Ctx) error {
+	onsenID, err := c.ParamsInt("id")
+	if err != nil || onsenID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid onsen ID",
+		})
+	}
+
+	var layout struct {
+		OpenTime      string `json:"open_time"`
+		CloseTime     string `json:"close_time"`
+		SlotMinutes   int    `json:"slot_minutes"`
+		BufferMinutes int    `json:"buffer_minutes"`
+	}
+
+	if err := c.BodyParser(&layout); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot parse JSON: " + err.Error(),
+		})
+	}
+
+	onsen, err := ctrl.ScheduleService.UpdateSessionLayout(uint(onsenID), layout.OpenTime, layout.CloseTime, layout.SlotMinutes, layout.BufferMinutes)
+	if err != nil {
+		ctrl.Logger.Warn("Failed to update onsen session layout", zap.Int("onsenID", onsenID), zap.Error(err))
+		return c.Status(scheduleErrorStatus(err, fiber.StatusBadRequest)).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to update session layout: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    onsen,
+	})
+}
+
+// GetOpeningHours returns the weekday overrides of a bath
+// GET /api/admin/onsen/:id/hours
+func (ctrl *OnsenController) GetOpeningHours(c *fiber.Ctx) error {
+	onsenID, err := c.ParamsInt("id")
+	if err != nil || onsenID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid onsen ID",
+		})
+	}
+
+	hours, err := ctrl.ScheduleService.GetOpeningHours(uint(onsenID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get opening hours: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    hours,
+	})
+}
+
+// SetOpeningHours sets a bath's hours for one day of the week
+// PUT /api/admin/onsen/:id/hours/:weekday
+func (ctrl *OnsenController) SetOpeningHours(c *fiber.Ctx) error {
+	onsenID, err := c.ParamsInt("id")
+	if err != nil || onsenID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid onsen ID",
+		})
+	}
+
+	weekday, err := c.ParamsInt("weekday")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid weekday. Use 0 (Sunday) to 6 (Saturday)",
+		})
+	}
+
+	var hoursData struct {
+		OpenTime  string `json:"open_time"`
+		CloseTime string `json:"close_time"`
+		Closed    bool   `json:"closed"`
+	}
+
+	if err := c.BodyParser(&hoursData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot parse JSON: " + err.Error(),
+		})
+	}
+
+	hours, err := ctrl.ScheduleService.SetOpeningHours(uint(onsenID), time.Weekday(weekday), hoursData.OpenTime, hoursData.CloseTime, hoursData.Closed)
+	if err != nil {
+		ctrl.Logger.Warn("Failed to set opening hours", zap.Int("onsenID", onsenID), zap.Error(err))
+		return c.Status(scheduleErrorStatus(err, fiber.StatusBadRequest)).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to set opening hours: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    hours,
+	})
+}
+
+// GetClosures returns closures in a date range
+// GET /api/admin/onsen/closures?start=2023-09-01&end=2023-09-30
+func (ctrl *OnsenController) GetClosures(c *fiber.Ctx) error {
+	start, err := time.Parse("2006-01-02", c.Query("start", time.Now().Format("2006-01-02")))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid start date format. Use YYYY-MM-DD",
+		})
+	}
+
+	end, err := time.Parse("2006-01-02", c.Query("end", start.AddDate(0, 1, 0).Format("2006-01-02")))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid end date format. Use YYYY-MM-DD",
+		})
+	}
+
+	closures, err := ctrl.ScheduleService.GetClosures(start, end)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get closures: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    closures,
+	})
+}
+
+// AddClosure closes one bath, or all of them when onsen_id is 0, for a date
+// POST /api/admin/onsen/closures
+func (ctrl *OnsenController) AddClosure(c *fiber.Ctx) error {
+	var closureData struct {
+		OnsenID uint   `json:"onsen_id"`
+		Date    string `json:"date"`
+		Reason  string `json:"reason"`
+	}
+
+	if err := c.BodyParser(&closureData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot parse JSON: " + err.Error(),
+		})
+	}
+
+	date, err := time.Parse("2006-01-02", closureData.Date)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid date format. Use YYYY-MM-DD",
+		})
+	}
+
+	closure, err := ctrl.ScheduleService.AddClosure(closureData.OnsenID, date, closureData.Reason)
+	if err != nil {
+		return c.Status(scheduleErrorStatus(err, fiber.StatusInternalServerError)).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to add closure: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    closure,
+	})
+}
+
+// RemoveClosure reopens a bath on a previously closed date
+// DELETE /api/admin/onsen/closures/:id
+func (ctrl *OnsenController) RemoveClosure(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid closure ID",
+		})
+	}
+
+	if err := ctrl.ScheduleService.RemoveClosure(uint(id)); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to remove closure: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Closure removed successfully",
+	})
+}
+
+// GetEntitlements returns the free onsen sessions included with each room type
+// GET /api/admin/onsen/entitlements
+func (ctrl *OnsenController) GetEntitlements(c *fiber.Ctx) error {
+	entitlements, err := ctrl.Service.GetEntitlements()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get onsen entitlements: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    entitlements,
+	})
+}
+
+// SetEntitlement sets the free onsen sessions included with a room type
+// PUT /api/admin/onsen/entitlements/:roomType
+func (ctrl *OnsenController) SetEntitlement(c *fiber.Ctx) error {
+	var entitlementData struct {
+		FreeSessions int `json:"free_sessions"`
+	}
+
+	if err := c.BodyParser(&entitlementData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot parse JSON: " + err.Error(),
+		})
+	}
+
+	entitlement, err := ctrl.Service.SetFreeSessions(c.Params("roomType"), entitlementData.FreeSessions)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to set onsen entitlement: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    entitlement,
+	})
+}
+
+// respondSlotTaken tells the guest their session was taken by someone else. HTMX
+// requests get a refreshed slot picker instead of losing the whole form.
+func (ctrl *OnsenController) respondSlotTaken(c *fiber.Ctx, onsenID uint, date time.Time) error {
+	const message = "That session was just taken, please pick another."
+
+	if c.Get("HX-Request") != "true" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   message,
+		})
+	}
+
+	schedule, err := ctrl.Service.GetDailySchedule(onsenID, date)
+	if err != nil {
+		return ctrl.renderError(c, message)
+	}
+
+	c.Set("HX-Retarget", "#time-slots-container")
+	return c.Render("partials/onsen_slot_options", fiber.Map{
+		"Date":        date.Format("2006-01-02"),
+		"Slots":       schedule.AvailableSlots(),
+		"Message":     "No sessions left on this date",
+		"Notice":      message,
+		"SlotMinutes": schedule.Hours.SlotMinutes,
+	}, "")
+}
+
+// respondError writes an error as an HTMX fragment or a JSON body
+func (ctrl *OnsenController) respondError(c *fiber.Ctx, status int, message string) error {
+	if c.Get("HX-Request") == "true" {
+		return ctrl.renderError(c, message)
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"success": false,
+		"error":   message,
+	})
+}
+
+// scheduleErrorStatus maps a schedule change error to its HTTP status: 409 when
+// booked sessions are in the way, otherwise fallback
+func scheduleErrorStatus(err error, fallback int) int {
+	if errors.Is(err, services.ErrOnsenScheduleConflict) {
+		return fiber.StatusConflict
+	}
+	return fallback
+}
+
+// ownsBooking reports whether email and bookingCode match the guest and
+// reference of a room booking
+func (ctrl *OnsenController) ownsBooking(bookingID uint, email, bookingCode string) bool {
+	if bookingID == 0 || email == "" || bookingCode == "" {
+		return false
+	}
+
+	authorized, err := ctrl.RoomService.VerifyBookingOwnership(bookingID, email, bookingCode)
+	if err != nil || !authorized {
+		ctrl.Logger.Warn("Unauthorized onsen request", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// renderError renders the onsen error fragment. HTMX only swaps 2xx
+// responses, so the fragment is always sent with a 200 status.
+func (ctrl *OnsenController) renderError(c *fiber.Ctx, message string) error {
+	return c.Render("partials/onsen_error", fiber.Map{
+		"Message": message,
+	}, "")
+}
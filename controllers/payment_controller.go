@@ -0,0 +1,349 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"github.com/IamMaheshGurung/privateOnsenBooking/services"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// WebhookSignatureHeader carries the hex HMAC-SHA256 of the raw webhook body
+const WebhookSignatureHeader = "X-Webhook-Signature"
+
+// PaymentController handles payment related HTTP requests
+type PaymentController struct {
+	Service *services.PaymentService
+	Logger  *zap.Logger
+}
+
+// NewPaymentController creates a new instance of PaymentController
+func NewPaymentController(service *services.PaymentService, logger *zap.Logger) *PaymentController {
+	return &PaymentController{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// HandleWebhook receives payment events from a provider. Redelivered events
+// are acknowledged without being applied again.
+// POST /api/v1/payments/webhook/:provider
+//
+// A sample signed with the secret whsec_local_fake lives in testdata/webhooks.
+// With ENABLE_FAKE_GATEWAY=true and FAKE_WEBHOOK_SECRET=whsec_local_fake set:
+//
+//	curl -X POST localhost:3000/api/v1/payments/webhook/fake \
+//	  -H "X-Webhook-Signature: $(cat testdata/webhooks/fake_payment_succeeded.sig)" \
+//	  --data-binary @testdata/webhooks/fake_payment_succeeded.json
+func (ctrl *PaymentController) HandleWebhook(c *fiber.Ctx) error {
+	provider := c.Params("provider")
+	body := c.Body()
+
+	if err := ctrl.Service.VerifyWebhookSignature(provider, body, c.Get(WebhookSignatureHeader)); err != nil {
+		ctrl.Logger.Warn("Rejected payment webhook",
+			zap.String("provider", provider),
+			zap.String("ip", c.IP()),
+			zap.Error(err))
+
+		status := fiber.StatusUnauthorized
+		if errors.Is(err, services.ErrUnknownWebhookProvider) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	var event services.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot parse event: " + err.Error(),
+		})
+	}
+
+	duplicate, err := ctrl.Service.HandleWebhookEvent(provider, event)
+	if err != nil {
+		// A non-2xx answer makes the provider retry later
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrPaymentNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to process event: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":   true,
+		"duplicate": duplicate,
+	})
+}
+
+// GetBalance returns the paid and outstanding amounts of a booking
+// GET /api/admin/bookings/:id/balance
+func (ctrl *PaymentController) GetBalance(c *fiber.Ctx) error {
+	bookingID, err := c.ParamsInt("id")
+	if err != nil || bookingID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid booking ID",
+		})
+	}
+
+	balance, err := ctrl.Service.GetBalance(uint(bookingID))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get balance: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    balance,
+	})
+}
+
+// RecordPayment records a payment collected at the front desk
+// POST /api/admin/bookings/:id/payments
+func (ctrl *PaymentController) RecordPayment(c *fiber.Ctx) error {
+	bookingID, err := c.ParamsInt("id")
+	if err != nil || bookingID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid booking ID",
+		})
+	}
+
+	var paymentData struct {
+		Amount    json.Number `json:"amount"` // In the booking's currency
+		Method    string      `json:"method"`
+		Reference string      `json:"reference"` // Card terminal slip or receipt number
+	}
+
+	if err := c.BodyParser(&paymentData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot parse JSON: " + err.Error(),
+		})
+	}
+
+	amount, err := models.ParseMoney(paymentData.Amount.String(), "")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid amount",
+		})
+	}
+
+	payment, err := ctrl.Service.RecordCollectedPayment(uint(bookingID), amount, paymentData.Method, paymentData.Reference)
+	if err != nil {
+		ctrl.Logger.Warn("Failed to record payment", zap.Int("bookingID", bookingID), zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to record payment: " + err.Error(),
+		})
+	}
+
+	balance, err := ctrl.Service.GetBalance(uint(bookingID))
+	if err != nil {
+		ctrl.Logger.Error("Failed to get balance after payment", zap.Int("bookingID", bookingID), zap.Error(err))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"payment": payment,
+			"balance": balance,
+		},
+	})
+}
+
+// GetDepositRules returns the deposit rule of every room type
+// GET /api/admin/deposit-rules
+func (ctrl *PaymentController) GetDepositRules(c *fiber.Ctx) error {
+	rules, err := ctrl.Service.GetDepositRules()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get deposit rules: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rules,
+	})
+}
+
+// SetDepositRule sets the deposit required for a room type
+// PUT /api/admin/deposit-rules/:roomType
+func (ctrl *PaymentController) SetDepositRule(c *fiber.Ctx) error {
+	var ruleData struct {
+		Type  string  `json:"type"` // percentage or fixed
+		Value float64 `json:"value"`
+	}
+
+	if err := c.BodyParser(&ruleData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot parse JSON: " + err.Error(),
+		})
+	}
+
+	rule, err := ctrl.Service.SetDepositRule(c.Params("roomType"), ruleData.Type, ruleData.Value)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to set deposit rule: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// ShowRefundQueue renders the refund queue for staff. Pending refunds are
+// shown unless another status is asked for.
+// GET /admin/refunds?status=pending
+func (ctrl *PaymentController) ShowRefundQueue(c *fiber.Ctx) error {
+	status := c.Query("status", models.RefundStatusPending)
+	if status == "all" {
+		status = ""
+	}
+
+	refunds, err := ctrl.Service.GetRefunds(status)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Render("error/error", fiber.Map{
+			"Title":     "Error",
+			"ErrorCode": fiber.StatusInternalServerError,
+			"Message":   "Failed to load refunds",
+		})
+	}
+
+	return c.Render("admin/refunds", fiber.Map{
+		"Title":       "Refund Queue | Admin | Kwangdi Pahuna Ghar",
+		"Refunds":     refunds,
+		"Status":      c.Query("status", models.RefundStatusPending),
+		"CurrentYear": time.Now().Year(),
+	})
+}
+
+// GetRefunds returns refunds, optionally filtered by status
+// GET /api/admin/refunds?status=pending
+func (ctrl *PaymentController) GetRefunds(c *fiber.Ctx) error {
+	refunds, err := ctrl.Service.GetRefunds(c.Query("status"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get refunds: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    refunds,
+	})
+}
+
+// ProcessRefund approves a refund and sends it through the payment gateway
+// POST /api/admin/refunds/:id/process
+func (ctrl *PaymentController) ProcessRefund(c *fiber.Ctx) error {
+	refundID, err := c.ParamsInt("id")
+	if err != nil || refundID <= 0 {
+		return ctrl.refundError(c, fiber.StatusBadRequest, "Invalid refund ID")
+	}
+
+	var refundData struct {
+		ApprovedBy string `json:"approved_by" form:"approved_by"`
+	}
+
+	if err := c.BodyParser(&refundData); err != nil {
+		return ctrl.refundError(c, fiber.StatusBadRequest, "Cannot parse request: "+err.Error())
+	}
+
+	refund, err := ctrl.Service.ProcessRefund(uint(refundID), refundData.ApprovedBy)
+	if err != nil {
+		ctrl.Logger.Warn("Failed to process refund", zap.Int("refundID", refundID), zap.Error(err))
+		return ctrl.refundError(c, refundErrorStatus(err), "Failed to process refund: "+err.Error())
+	}
+
+	return ctrl.renderRefund(c, refund)
+}
+
+// MarkRefundManual records a refund as paid out in cash at the front desk
+// POST /api/admin/refunds/:id/manual
+func (ctrl *PaymentController) MarkRefundManual(c *fiber.Ctx) error {
+	refundID, err := c.ParamsInt("id")
+	if err != nil || refundID <= 0 {
+		return ctrl.refundError(c, fiber.StatusBadRequest, "Invalid refund ID")
+	}
+
+	var refundData struct {
+		ApprovedBy string `json:"approved_by" form:"approved_by"`
+		Reference  string `json:"reference" form:"reference"` // Cash receipt number
+	}
+
+	if err := c.BodyParser(&refundData); err != nil {
+		return ctrl.refundError(c, fiber.StatusBadRequest, "Cannot parse request: "+err.Error())
+	}
+
+	refund, err := ctrl.Service.MarkRefundManual(uint(refundID), refundData.ApprovedBy, refundData.Reference)
+	if err != nil {
+		ctrl.Logger.Warn("Failed to record manual refund", zap.Int("refundID", refundID), zap.Error(err))
+		return ctrl.refundError(c, refundErrorStatus(err), "Failed to record refund: "+err.Error())
+	}
+
+	return ctrl.renderRefund(c, refund)
+}
+
+// renderRefund answers with the updated queue row for HTMX, JSON otherwise
+func (ctrl *PaymentController) renderRefund(c *fiber.Ctx, refund *models.Refund) error {
+	if c.Get("HX-Request") == "true" {
+		return c.Render("partials/refund_row", refund, "")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    refund,
+	})
+}
+
+// refundError answers with an error fragment for HTMX, which only swaps 2xx
+// responses, and a JSON error with the given status otherwise
+func (ctrl *PaymentController) refundError(c *fiber.Ctx, status int, message string) error {
+	if c.Get("HX-Request") == "true" {
+		c.Set("HX-Retarget", "#refund-errors")
+		c.Set("HX-Reswap", "innerHTML")
+		return c.Render("partials/onsen_error", fiber.Map{
+			"Message": message,
+		}, "")
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"success": false,
+		"error":   message,
+	})
+}
+
+// refundErrorStatus maps refund errors to HTTP statuses
+func refundErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRefundNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, services.ErrRefundApproverRequired):
+		return fiber.StatusBadRequest
+	case errors.Is(err, services.ErrRefundNotPending), errors.Is(err, services.ErrManualRefundRequired):
+		return fiber.StatusConflict
+	default:
+		return fiber.StatusBadGateway
+	}
+}
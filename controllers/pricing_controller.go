@@ -0,0 +1,467 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"github.com/IamMaheshGurung/privateOnsenBooking/services"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// PricingController handles room price quotes, rate plans and stay rules
+type PricingController struct {
+	Service     *services.PricingService
+	RoomService *services.RoomBookingService
+	TaxService  *services.TaxService
+	Promos      *services.PromoService
+	Logger      *zap.Logger
+}
+
+// NewPricingController creates a new instance of PricingController
+func NewPricingController(service *services.PricingService, roomService *services.RoomBookingService, taxService *services.TaxService, promos *services.PromoService, logger *zap.Logger) *PricingController {
+	return &PricingController{
+		Service:     service,
+		RoomService: roomService,
+		TaxService:  taxService,
+		Promos:      promos,
+		Logger:      logger,
+	}
+}
+
+// parseOccupancy reads the adults, children and infants staying from a query
+// or form. Links made before occupancy pricing only carry guests, which are
+// taken as adults.
+func parseOccupancy(value func(key string, defaultValue ...string) string) models.Occupancy {
+	count := func(key string) int {
+		n, err := strconv.Atoi(value(key))
+		if err != nil || n < 0 {
+			return 0
+		}
+		return n
+	}
+
+	occupancy := models.Occupancy{
+		Adults:   count("adults"),
+		Children: count("children"),
+		Infants:  count("infants"),
+	}
+	if occupancy.Adults == 0 {
+		occupancy.Adults = count("guests") - occupancy.Children - occupancy.Infants
+	}
+	if occupancy.Adults < 1 {
+		occupancy.Adults = 1
+	}
+	return occupancy
+}
+
+// occupancyQuery returns the query string parseOccupancy reads back
+func occupancyQuery(occupancy models.Occupancy) string {
+	return fmt.Sprintf("adults=%d&children=%d&infants=%d", occupancy.Adults, occupancy.Children, occupancy.Infants)
+}
+
+// GetRoomPrice returns the night by night price of a room for a stay, the
+// discount of any promo codes and the taxes on it
+// GET /api/rooms/:id/price?check_in=2024-10-10&check_out=2024-10-13&adults=2&children=1&promo=DASHAIN10
+func (ctrl *PricingController) GetRoomPrice(c *fiber.Ctx) error {
+	roomID, err := c.ParamsInt("id")
+	if err != nil || roomID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid room ID",
+		})
+	}
+
+	checkIn, err := time.Parse("2006-01-02", c.Query("check_in"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid check-in date format. Use YYYY-MM-DD",
+		})
+	}
+
+	checkOut, err := time.Parse("2006-01-02", c.Query("check_out"))
+	if err != nil || !checkOut.After(checkIn) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Check-out date must be a YYYY-MM-DD date after check-in",
+		})
+	}
+
+	room, err := ctrl.RoomService.GetRoomByID(uint(roomID))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "Room not found",
+		})
+	}
+
+	occupancy := parseOccupancy(c.Query)
+	if err := ctrl.Service.CheckOccupancy(room, occupancy); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	if err := ctrl.Service.CheckStay(room, checkIn, checkOut); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrStayRestricted) {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	stay, err := ctrl.Service.PriceStay(room, checkIn, checkOut, occupancy)
+	if err != nil {
+		ctrl.Logger.Error("Failed to price stay", zap.Int("roomID", roomID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to price stay: " + err.Error(),
+		})
+	}
+
+	discount, err := ctrl.Promos.Apply(services.ParsePromoCodes(c.Query("promo")), 0, room, len(stay.Nights), stay.Total)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrPromoNotFound) || errors.Is(err, services.ErrPromoNotUsable) {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	quote, err := ctrl.TaxService.Quote(models.FolioCategoryRoomNight, stay.Total.Sub(discount.Total))
+	if err != nil {
+		ctrl.Logger.Error("Failed to work out taxes", zap.Int("roomID", roomID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to work out taxes: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"stay":     stay,
+			"discount": discount,
+			"quote":    quote,
+		},
+	})
+}
+
+// ratePlanRequest is the JSON body of a rate plan
+type ratePlanRequest struct {
+	Name                 string       `json:"name"`
+	RoomType             string       `json:"room_type"`  // Empty for every room
+	Kind                 string       `json:"kind"`       // rate, premium or discount
+	Rate                 models.Money `json:"rate"`       // Nightly rate of a rate plan
+	Percent              float64      `json:"percent"`    // Premium or discount on the rate
+	MinNights            int          `json:"min_nights"` // Shortest stay a discount plan applies to
+	StartDate            string       `json:"start_date"`
+	EndDate              string       `json:"end_date"`
+	Recurring            bool         `json:"recurring"`
+	Weekdays             string       `json:"weekdays"` // e.g. fri,sat
+	Priority             int          `json:"priority"`
+	CancellationPolicyID *uint        `json:"cancellation_policy_id"` // Policy for stays arriving on a covered night
+	Active               *bool        `json:"active"`                 // Defaults to true
+}
+
+// ratePlan parses the request body into a rate plan
+func (ctrl *PricingController) ratePlan(c *fiber.Ctx) (*models.RatePlan, error) {
+	var planData ratePlanRequest
+	if err := c.BodyParser(&planData); err != nil {
+		return nil, errors.New("Cannot parse JSON: " + err.Error())
+	}
+
+	startDate, err := time.Parse("2006-01-02", planData.StartDate)
+	if err != nil {
+		return nil, errors.New("Invalid start date format. Use YYYY-MM-DD")
+	}
+	endDate, err := time.Parse("2006-01-02", planData.EndDate)
+	if err != nil {
+		return nil, errors.New("Invalid end date format. Use YYYY-MM-DD")
+	}
+
+	return &models.RatePlan{
+		Name:                 planData.Name,
+		RoomType:             planData.RoomType,
+		Kind:                 planData.Kind,
+		Rate:                 planData.Rate,
+		Percent:              planData.Percent,
+		MinNights:            planData.MinNights,
+		StartDate:            startDate,
+		EndDate:              endDate,
+		Recurring:            planData.Recurring,
+		Weekdays:             planData.Weekdays,
+		Priority:             planData.Priority,
+		CancellationPolicyID: planData.CancellationPolicyID,
+		Active:               planData.Active == nil || *planData.Active,
+	}, nil
+}
+
+// GetRatePlans returns every rate plan
+// GET /api/admin/rate-plans
+func (ctrl *PricingController) GetRatePlans(c *fiber.Ctx) error {
+	plans, err := ctrl.Service.GetRatePlans()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get rate plans: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    plans,
+	})
+}
+
+// CreateRatePlan adds a rate plan
+// POST /api/admin/rate-plans
+func (ctrl *PricingController) CreateRatePlan(c *fiber.Ctx) error {
+	plan, err := ctrl.ratePlan(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	if err := ctrl.Service.SaveRatePlan(plan); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to create rate plan: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    plan,
+	})
+}
+
+// UpdateRatePlan replaces a rate plan
+// PUT /api/admin/rate-plans/:id
+func (ctrl *PricingController) UpdateRatePlan(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid rate plan ID",
+		})
+	}
+
+	plan, err := ctrl.ratePlan(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	plan.ID = uint(id)
+
+	if err := ctrl.Service.SaveRatePlan(plan); err != nil {
+		status := fiber.StatusBadRequest
+		if errors.Is(err, services.ErrRatePlanNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to update rate plan: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    plan,
+	})
+}
+
+// DeleteRatePlan removes a rate plan
+// DELETE /api/admin/rate-plans/:id
+func (ctrl *PricingController) DeleteRatePlan(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid rate plan ID",
+		})
+	}
+
+	if err := ctrl.Service.DeleteRatePlan(uint(id)); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrRatePlanNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to delete rate plan: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Rate plan deleted",
+	})
+}
+
+// stayRuleRequest is the JSON body of a stay rule
+type stayRuleRequest struct {
+	Name              string `json:"name"`
+	RoomType          string `json:"room_type"` // Empty for every room
+	StartDate         string `json:"start_date"`
+	EndDate           string `json:"end_date"`
+	Recurring         bool   `json:"recurring"`
+	Weekdays          string `json:"weekdays"`   // e.g. fri,sat
+	MinNights         int    `json:"min_nights"` // 0 for no minimum
+	MaxNights         int    `json:"max_nights"` // 0 for no maximum
+	ClosedToArrival   bool   `json:"closed_to_arrival"`
+	ClosedToDeparture bool   `json:"closed_to_departure"`
+	Active            *bool  `json:"active"` // Defaults to true
+}
+
+// stayRule parses the request body into a stay rule
+func (ctrl *PricingController) stayRule(c *fiber.Ctx) (*models.StayRule, error) {
+	var ruleData stayRuleRequest
+	if err := c.BodyParser(&ruleData); err != nil {
+		return nil, errors.New("Cannot parse JSON: " + err.Error())
+	}
+
+	startDate, err := time.Parse("2006-01-02", ruleData.StartDate)
+	if err != nil {
+		return nil, errors.New("Invalid start date format. Use YYYY-MM-DD")
+	}
+	endDate, err := time.Parse("2006-01-02", ruleData.EndDate)
+	if err != nil {
+		return nil, errors.New("Invalid end date format. Use YYYY-MM-DD")
+	}
+
+	return &models.StayRule{
+		Name:              ruleData.Name,
+		RoomType:          ruleData.RoomType,
+		StartDate:         startDate,
+		EndDate:           endDate,
+		Recurring:         ruleData.Recurring,
+		Weekdays:          ruleData.Weekdays,
+		MinNights:         ruleData.MinNights,
+		MaxNights:         ruleData.MaxNights,
+		ClosedToArrival:   ruleData.ClosedToArrival,
+		ClosedToDeparture: ruleData.ClosedToDeparture,
+		Active:            ruleData.Active == nil || *ruleData.Active,
+	}, nil
+}
+
+// GetStayRules returns every stay rule
+// GET /api/admin/stay-rules
+func (ctrl *PricingController) GetStayRules(c *fiber.Ctx) error {
+	rules, err := ctrl.Service.GetStayRules()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get stay rules: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rules,
+	})
+}
+
+// CreateStayRule adds a stay rule
+// POST /api/admin/stay-rules
+func (ctrl *PricingController) CreateStayRule(c *fiber.Ctx) error {
+	rule, err := ctrl.stayRule(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	if err := ctrl.Service.SaveStayRule(rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to create stay rule: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// UpdateStayRule replaces a stay rule
+// PUT /api/admin/stay-rules/:id
+func (ctrl *PricingController) UpdateStayRule(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid stay rule ID",
+		})
+	}
+
+	rule, err := ctrl.stayRule(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	rule.ID = uint(id)
+
+	if err := ctrl.Service.SaveStayRule(rule); err != nil {
+		status := fiber.StatusBadRequest
+		if errors.Is(err, services.ErrStayRuleNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to update stay rule: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// DeleteStayRule removes a stay rule
+// DELETE /api/admin/stay-rules/:id
+func (ctrl *PricingController) DeleteStayRule(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid stay rule ID",
+		})
+	}
+
+	if err := ctrl.Service.DeleteStayRule(uint(id)); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrStayRuleNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to delete stay rule: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Stay rule deleted",
+	})
+}
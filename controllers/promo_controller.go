@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"github.com/IamMaheshGurung/privateOnsenBooking/services"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// PromoController handles promo code management
+type PromoController struct {
+	Service *services.PromoService
+	Logger  *zap.Logger
+}
+
+// NewPromoController creates a new instance of PromoController
+func NewPromoController(service *services.PromoService, logger *zap.Logger) *PromoController {
+	return &PromoController{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// promoCodeRequest is the JSON body of a promo code
+type promoCodeRequest struct {
+	Code            string       `json:"code"`
+	Description     string       `json:"description"`
+	Kind            string       `json:"kind"`    // percent or fixed
+	Percent         float64      `json:"percent"` // Off the room price of a percent code
+	Amount          models.Money `json:"amount"`  // Off the room price of a fixed code
+	ValidFrom       string       `json:"valid_from"`
+	ValidUntil      string       `json:"valid_until"`
+	MinNights       int          `json:"min_nights"`
+	RoomTypes       string       `json:"room_types"` // e.g. Family,Deluxe; empty for every room
+	MaxUses         int          `json:"max_uses"`
+	MaxUsesPerGuest int          `json:"max_uses_per_guest"`
+	Stackable       bool         `json:"stackable"`
+	Active          *bool        `json:"active"` // Defaults to true
+}
+
+// promoCode parses the request body into a promo code
+func (ctrl *PromoController) promoCode(c *fiber.Ctx) (*models.PromoCode, error) {
+	var promoData promoCodeRequest
+	if err := c.BodyParser(&promoData); err != nil {
+		return nil, errors.New("Cannot parse JSON: " + err.Error())
+	}
+
+	validFrom, err := time.Parse("2006-01-02", promoData.ValidFrom)
+	if err != nil {
+		return nil, errors.New("Invalid valid from date format. Use YYYY-MM-DD")
+	}
+	validUntil, err := time.Parse("2006-01-02", promoData.ValidUntil)
+	if err != nil {
+		return nil, errors.New("Invalid valid until date format. Use YYYY-MM-DD")
+	}
+
+	return &models.PromoCode{
+		Code:            promoData.Code,
+		Description:     promoData.Description,
+		Kind:            promoData.Kind,
+		Percent:         promoData.Percent,
+		Amount:          promoData.Amount,
+		ValidFrom:       validFrom,
+		ValidUntil:      validUntil,
+		MinNights:       promoData.MinNights,
+		RoomTypes:       promoData.RoomTypes,
+		MaxUses:         promoData.MaxUses,
+		MaxUsesPerGuest: promoData.MaxUsesPerGuest,
+		Stackable:       promoData.Stackable,
+		Active:          promoData.Active == nil || *promoData.Active,
+	}, nil
+}
+
+// GetPromoCodes returns every promo code
+// GET /api/admin/promo-codes
+func (ctrl *PromoController) GetPromoCodes(c *fiber.Ctx) error {
+	promos, err := ctrl.Service.GetPromoCodes()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get promo codes: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    promos,
+	})
+}
+
+// CreatePromoCode adds a promo code
+// POST /api/admin/promo-codes
+func (ctrl *PromoController) CreatePromoCode(c *fiber.Ctx) error {
+	promo, err := ctrl.promoCode(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	if err := ctrl.Service.SavePromoCode(promo); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to create promo code: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    promo,
+	})
+}
+
+// UpdatePromoCode replaces a promo code. Bookings it was already redeemed on
+// keep their discount.
+// PUT /api/admin/promo-codes/:id
+func (ctrl *PromoController) UpdatePromoCode(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid promo code ID",
+		})
+	}
+
+	promo, err := ctrl.promoCode(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	promo.ID = uint(id)
+
+	if err := ctrl.Service.SavePromoCode(promo); err != nil {
+		status := fiber.StatusBadRequest
+		if errors.Is(err, services.ErrPromoNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to update promo code: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    promo,
+	})
+}
+
+// DeactivatePromoCode stops a promo code being redeemed
+// DELETE /api/admin/promo-codes/:id
+func (ctrl *PromoController) DeactivatePromoCode(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid promo code ID",
+		})
+	}
+
+	if err := ctrl.Service.DeactivatePromoCode(uint(id)); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrPromoNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to deactivate promo code: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Promo code deactivated",
+	})
+}
+
+// GetRedemptions returns the bookings a promo code was redeemed on
+// GET /api/admin/promo-codes/:id/redemptions
+func (ctrl *PromoController) GetRedemptions(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid promo code ID",
+		})
+	}
+
+	redemptions, err := ctrl.Service.GetRedemptions(uint(id))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get promo code redemptions: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    redemptions,
+	})
+}
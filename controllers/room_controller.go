@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
@@ -14,13 +15,15 @@ import (
 // RoomController handles room-related HTTP requests
 type RoomController struct {
 	Service *services.RoomBookingService
+	Pricing *services.PricingService
 	Logger  *zap.Logger
 }
 
 // NewRoomController creates a new instance of RoomController
-func NewRoomController(service *services.RoomBookingService, logger *zap.Logger) *RoomController {
+func NewRoomController(service *services.RoomBookingService, pricing *services.PricingService, logger *zap.Logger) *RoomController {
 	return &RoomController{
 		Service: service,
+		Pricing: pricing,
 		Logger:  logger,
 	}
 }
@@ -127,12 +130,7 @@ func (rc *RoomController) GetRoomByID(c *fiber.Ctx) error {
 	// Get any query parameters that might have been passed
 	checkIn := c.Query("check_in", "")
 	checkOut := c.Query("check_out", "")
-	guests := 1
-
-	guestsStr := c.Query("guests", "1")
-	if guestsVal, err := strconv.Atoi(guestsStr); err == nil && guestsVal > 0 {
-		guests = guestsVal
-	}
+	occupancy := parseOccupancy(c.Query)
 
 	// Ensure we have today's date if no check-in is specified
 	if checkIn == "" {
@@ -154,7 +152,8 @@ func (rc *RoomController) GetRoomByID(c *fiber.Ctx) error {
 		"SimilarRooms": similarRooms,
 		"CheckIn":      checkIn,
 		"CheckOut":     checkOut,
-		"Guests":       guests,
+		"Guests":       occupancy.Guests(),
+		"Occupancy":    occupancy,
 	})
 }
 
@@ -164,12 +163,15 @@ func (rc *RoomController) GetAvailableRooms(c *fiber.Ctx) error {
 	// Parse request parameters
 	checkIn := c.Query("check_in")
 	checkOut := c.Query("check_out")
-	guestsStr := c.Query("guests")
+	occupancy := parseOccupancy(c.Query)
+	guests := occupancy.Guests()
 
 	rc.Logger.Info("Checking room availability",
 		zap.String("check_in", checkIn),
 		zap.String("check_out", checkOut),
-		zap.String("guests", guestsStr))
+		zap.Int("adults", occupancy.Adults),
+		zap.Int("children", occupancy.Children),
+		zap.Int("infants", occupancy.Infants))
 
 	// Validate check-in and check-out dates
 	if checkIn == "" || checkOut == "" {
@@ -218,17 +220,28 @@ func (rc *RoomController) GetAvailableRooms(c *fiber.Ctx) error {
 		})
 	}
 
-	// Parse guest count (default to 1 if not provided or invalid)
-	guests := 1
-	if guestsStr != "" {
-		guests, err = strconv.Atoi(guestsStr)
-		if err != nil || guests < 1 {
-			guests = 1
+	// Check the stay rules for every room
+	if err := rc.Pricing.CheckStay(nil, checkInDate, checkOutDate); err != nil {
+		status := fiber.StatusInternalServerError
+		message := "Error finding available rooms"
+		if errors.Is(err, services.ErrStayRestricted) {
+			status = fiber.StatusBadRequest
+			message = guestErrorMessage(err)
 		}
+
+		if c.Get("HX-Request") == "true" {
+			return c.Render("partials/rooms_grid_error", fiber.Map{
+				"Message": message,
+			}, "")
+		}
+
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
 	}
 
 	// Get available rooms from service
-	rooms, err := rc.Service.GetAvailableRooms(checkInDate, checkOutDate, guestsStr)
+	rooms, err := rc.Service.GetAvailableRooms(checkInDate, checkOutDate, strconv.Itoa(guests))
 	if err != nil {
 		rc.Logger.Error("Failed to get available rooms", zap.Error(err))
 
@@ -243,15 +256,31 @@ func (rc *RoomController) GetAvailableRooms(c *fiber.Ctx) error {
 		})
 	}
 
+	// Leave out rooms a stay rule for their room type blocks
+	if allowed, err := rc.Pricing.AllowedRooms(rooms, checkInDate, checkOutDate); err != nil {
+		rc.Logger.Error("Failed to check stay rules", zap.Error(err))
+	} else {
+		rooms = allowed
+	}
+
+	// Price each room for the stay
+	prices, err := rc.Pricing.PriceStays(rooms, checkInDate, checkOutDate, occupancy)
+	if err != nil {
+		rc.Logger.Error("Failed to price available rooms", zap.Error(err))
+		// Continue without stay prices; the nightly base rates are still shown
+	}
+
 	// If it's an HTMX request, return just the room grid
 	if c.Get("HX-Request") == "true" {
 		return c.Render("partials/rooms_grid", fiber.Map{
 			"Rooms":      rooms,
+			"Prices":     prices,
 			"CheckIn":    checkIn,
 			"CheckOut":   checkOut,
 			"IsFiltered": true,
 			"FilterType": "Availability",
 			"Guests":     guests,
+			"Occupancy":  occupancy,
 		}, "")
 	}
 
@@ -261,9 +290,11 @@ func (rc *RoomController) GetAvailableRooms(c *fiber.Ctx) error {
 		"Description": "Available rooms for your selected dates",
 		"CurrentYear": time.Now().Year(),
 		"Rooms":       rooms,
+		"Prices":      prices,
 		"CheckIn":     checkIn,
 		"CheckOut":    checkOut,
 		"Guests":      guests,
+		"Occupancy":   occupancy,
 		"IsFiltered":  true,                                       // Indicate these are filtered rooms
 		"FilterType":  "availability",                             // Used in the template to show filtering state
 		"FilterDates": fmt.Sprintf("%s to %s", checkIn, checkOut), //
@@ -284,11 +315,16 @@ func (ctrl *RoomController) CreateRoom(c *fiber.Ctx) error {
 	}
 
 	// Validate room data
-	if room.RoomNo == "" || room.Type == "" || room.PricePerNight <= 0 {
+	if room.RoomNo == "" || room.Type == "" || !room.PricePerNight.IsPositive() {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Room number, type, and price are required",
 		})
 	}
+	if room.BaseOccupancy < 0 || room.BaseOccupancy > room.Capacity {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Base occupancy cannot be more than the room's capacity",
+		})
+	}
 
 	err := ctrl.Service.CreateRoom(room)
 	if err != nil {
@@ -322,6 +358,12 @@ func (ctrl *RoomController) UpdateRoom(c *fiber.Ctx) error {
 		})
 	}
 
+	if room.BaseOccupancy < 1 || room.BaseOccupancy > room.Capacity {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Base occupancy must be between 1 and the room's capacity",
+		})
+	}
+
 	room.ID = uint(id)
 	updatedRoom, err := ctrl.Service.UpdateRoom(room)
 	if err != nil {
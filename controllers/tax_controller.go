@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/services"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// TaxController handles the service charge and VAT rules and tax reports
+type TaxController struct {
+	Service *services.TaxService
+	Logger  *zap.Logger
+}
+
+// NewTaxController creates a new instance of TaxController
+func NewTaxController(service *services.TaxService, logger *zap.Logger) *TaxController {
+	return &TaxController{
+		Service: service,
+		Logger:  logger,
+	}
+}
+
+// GetRules returns every tax rule in the order they are applied
+// GET /api/admin/tax-rules
+func (ctrl *TaxController) GetRules(c *fiber.Ctx) error {
+	rules, err := ctrl.Service.GetRules()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to get tax rules: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"prices_include_tax": ctrl.Service.PricesIncludeTax(),
+			"rules":              rules,
+		},
+	})
+}
+
+// SetRule creates or updates a tax rule
+// PUT /api/admin/tax-rules/:code
+func (ctrl *TaxController) SetRule(c *fiber.Ctx) error {
+	ruleData := struct {
+		Name       string   `json:"name"`
+		Rate       float64  `json:"rate"` // Percent
+		Sequence   int      `json:"sequence"`
+		Compound   bool     `json:"compound"`
+		Categories []string `json:"categories"` // Folio categories, e.g. ["room_night", "onsen"]
+		Active     *bool    `json:"active"`     // Defaults to true
+	}{}
+
+	if err := c.BodyParser(&ruleData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Cannot parse JSON: " + err.Error(),
+		})
+	}
+
+	active := ruleData.Active == nil || *ruleData.Active
+	rule, err := ctrl.Service.SetRule(c.Params("code"), ruleData.Name, ruleData.Rate, ruleData.Sequence,
+		ruleData.Compound, ruleData.Categories, active)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to set tax rule: " + err.Error(),
+		})
+	}
+
+	ctrl.Logger.Info("Tax rule updated", zap.String("code", rule.Code), zap.Float64("rate", rule.Rate), zap.Bool("active", rule.Active))
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// GetReport returns the charges and taxes posted over a period, by tax
+// GET /api/admin/reports/tax?from=2024-07-16&to=2024-08-15
+func (ctrl *TaxController) GetReport(c *fiber.Ctx) error {
+	to := time.Now()
+	from := to.AddDate(0, -1, 0)
+
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse("2006-01-02", value); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid from date format. Use YYYY-MM-DD",
+			})
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse("2006-01-02", value); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "Invalid to date format. Use YYYY-MM-DD",
+			})
+		}
+	}
+
+	if to.Before(from) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "The to date must not be before the from date",
+		})
+	}
+
+	report, err := ctrl.Service.Report(from, to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to build tax report: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    report,
+	})
+}
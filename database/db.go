@@ -1,6 +1,12 @@
 package database
 
 import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/IamMaheshGurung/privateOnsenBooking/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -11,26 +17,118 @@ var DB *gorm.DB
 func ConnectDB() (*gorm.DB, error) {
 	var err error
 	dsn := "host=localhost user=postgres password=Gurung67 dbname=privateonsen sslmode=disable"
-	DB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		// Report unique violations as gorm.ErrDuplicatedKey so services can tell them apart
+		TranslateError: true,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	// Migrate the schema
-	err = DB.AutoMigrate(&models.Guest{}, &models.Room{}, &models.RoomBooking{})
+	err = DB.AutoMigrate(&models.Guest{}, &models.Room{}, &models.RoomBooking{}, &models.FolioItem{}, &models.Onsen{}, &models.OnsenOpeningHours{}, &models.OnsenClosure{}, &models.OnsenEntitlement{}, &models.OnsenBooking{}, &models.DepositRule{}, &models.Payment{}, &models.PaymentEvent{}, &models.Refund{}, &models.Invoice{}, &models.InvoiceSequence{}, &models.ExchangeRate{}, &models.TaxRule{}, &models.RatePlan{}, &models.StayRule{}, &models.PromoCode{}, &models.PromoRedemption{}, &models.CancellationPolicy{}, &models.BookingTransition{}, &models.BookingChange{})
 	if err != nil {
 		return nil, err
 	}
+
+	if err := MigrateMoneyColumns(DB); err != nil {
+		return nil, err
+	}
 	return DB, nil
 }
 
+// moneyColumns lists the float columns that were replaced by models.Money
+// fields, with the prefix of the columns that replace them
+var moneyColumns = []struct {
+	model  interface{}
+	column string
+	prefix string
+}{
+	{&models.Room{}, "price_per_night", "price_per_night_"},
+	{&models.RoomBooking{}, "total_price", "total_price_"},
+	{&models.RoomBooking{}, "cancellation_fee", "cancellation_fee_"},
+	{&models.RoomBooking{}, "deposit_amount", "deposit_amount_"},
+	{&models.FolioItem{}, "unit_price", "unit_price_"},
+	{&models.FolioItem{}, "tax_amount", "tax_amount_"},
+	{&models.FolioItem{}, "amount", "amount_"},
+	{&models.Onsen{}, "price_per_slot", "price_per_slot_"},
+	{&models.OnsenBooking{}, "price", "price_"},
+	{&models.Payment{}, "amount", "amount_"},
+	{&models.Refund{}, "amount", "amount_"},
+}
+
+// MigrateMoneyColumns moves amounts stored as floats into the minor unit and
+// currency columns of models.Money, then drops the float columns. Payments
+// and refunds keep the currency they were recorded in; everything else was
+// priced in models.DefaultCurrency. It does nothing once the old columns are gone.
+func MigrateMoneyColumns(db *gorm.DB) error {
+	migrator := db.Migrator()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, money := range moneyColumns {
+			if !migrator.HasColumn(money.model, money.column) {
+				continue
+			}
+
+			stmt := &gorm.Statement{DB: tx}
+			if err := stmt.Parse(money.model); err != nil {
+				return err
+			}
+			table := stmt.Schema.Table
+
+			currency := "'" + models.DefaultCurrency + "'"
+			if migrator.HasColumn(money.model, "currency") {
+				currency = "COALESCE(NULLIF(currency, ''), " + currency + ")"
+			}
+
+			if err := tx.Exec(fmt.Sprintf("UPDATE %s SET %sminor = ROUND(COALESCE(%s, 0) * %s), %scurrency = %s",
+				table, money.prefix, money.column, minorPerMajorSQL(currency), money.prefix, currency)).Error; err != nil {
+				return fmt.Errorf("failed to migrate %s.%s: %w", table, money.column, err)
+			}
+			if err := tx.Migrator().DropColumn(money.model, money.column); err != nil {
+				return fmt.Errorf("failed to drop %s.%s: %w", table, money.column, err)
+			}
+		}
+
+		// The currency now lives with each amount
+		for _, model := range []interface{}{&models.Payment{}, &models.Refund{}} {
+			if migrator.HasColumn(model, "currency") {
+				if err := tx.Migrator().DropColumn(model, "currency"); err != nil {
+					return fmt.Errorf("failed to drop currency column: %w", err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// minorPerMajorSQL is a SQL expression for the minor units in one major unit
+// of the currency the given expression evaluates to
+func minorPerMajorSQL(currency string) string {
+	exponents := models.MinorUnitCurrencies()
+	codes := make([]string, 0, len(exponents))
+	for code := range exponents {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var sql strings.Builder
+	sql.WriteString("CASE UPPER(" + currency + ")")
+	for _, code := range codes {
+		fmt.Fprintf(&sql, " WHEN '%s' THEN %d", code, int64(math.Pow10(exponents[code])))
+	}
+	fmt.Fprintf(&sql, " ELSE %d END", int64(math.Pow10(models.CurrencyExponent(""))))
+	return sql.String()
+}
+
 func SeedRooms(db *gorm.DB) error {
 	rooms := []models.Room{
 		{
 			RoomNo:        "Sakura",
 			Type:          "Traditional",
 			Capacity:      2,
-			PricePerNight: 15000,
+			PricePerNight: models.MoneyFromMajor(15000, models.DefaultCurrency),
+			BaseOccupancy: 2,
 			Description:   "Traditional Japanese style room with tatami flooring and views of the cherry blossom garden.",
 			Amenities:     "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set",
 			ImageURL:      "/static/images/rooms/room1.jpg",
@@ -39,43 +137,52 @@ func SeedRooms(db *gorm.DB) error {
 			RoomNo:        "Fuji",
 			Type:          "Premium",
 			Capacity:      2,
-			PricePerNight: 25000,
+			PricePerNight: models.MoneyFromMajor(25000, models.DefaultCurrency),
+			BaseOccupancy: 2,
 			Description:   "Premium room with a private outdoor bath and mountain views.",
 			Amenities:     "Wi-Fi,Private Bathroom,Private Outdoor Bath,Air Conditioning,Yukata,Tea Set,Mini Fridge,TV",
 			ImageURL:      "/static/images/rooms/room3.jpg",
 		},
 		{
-			RoomNo:        "Koi",
-			Type:          "Deluxe",
-			Capacity:      3,
-			PricePerNight: 18000,
-			Description:   "Spacious room overlooking our koi pond garden with both Western and Japanese-style seating.",
-			Amenities:     "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set,Mini Fridge",
-			ImageURL:      "/static/images/rooms/room1.jpg",
+			RoomNo:         "Koi",
+			Type:           "Deluxe",
+			Capacity:       3,
+			PricePerNight:  models.MoneyFromMajor(18000, models.DefaultCurrency),
+			BaseOccupancy:  2,
+			ExtraAdultRate: models.MoneyFromMajor(3500, models.DefaultCurrency),
+			ChildRate:      models.MoneyFromMajor(2000, models.DefaultCurrency),
+			Description:    "Spacious room overlooking our koi pond garden with both Western and Japanese-style seating.",
+			Amenities:      "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set,Mini Fridge",
+			ImageURL:       "/static/images/rooms/room1.jpg",
 		},
 		{
 			RoomNo:        "Ajisai",
 			Type:          "Traditional",
 			Capacity:      2,
-			PricePerNight: 14000,
+			PricePerNight: models.MoneyFromMajor(14000, models.DefaultCurrency),
+			BaseOccupancy: 2,
 			Description:   "Cozy traditional room with a view of our hydrangea garden.",
 			Amenities:     "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set",
 			ImageURL:      "/static/images/rooms/room2.jpg",
 		},
 		{
-			RoomNo:        "Rhindo",
-			Type:          "Family",
-			Capacity:      4,
-			PricePerNight: 30000,
-			Description:   "Spacious family room with separate sleeping areas and garden access.",
-			Amenities:     "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set,Mini Fridge,TV,Extra Futons",
-			ImageURL:      "/static/images/rooms/room3.jpg",
+			RoomNo:         "Rhindo",
+			Type:           "Family",
+			Capacity:       4,
+			PricePerNight:  models.MoneyFromMajor(30000, models.DefaultCurrency),
+			BaseOccupancy:  2,
+			ExtraAdultRate: models.MoneyFromMajor(4000, models.DefaultCurrency),
+			ChildRate:      models.MoneyFromMajor(2500, models.DefaultCurrency),
+			Description:    "Spacious family room with separate sleeping areas and garden access.",
+			Amenities:      "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set,Mini Fridge,TV,Extra Futons",
+			ImageURL:       "/static/images/rooms/room3.jpg",
 		},
 		{
 			RoomNo:        "Yuki",
 			Type:          "Premium",
 			Capacity:      2,
-			PricePerNight: 28000,
+			PricePerNight: models.MoneyFromMajor(28000, models.DefaultCurrency),
+			BaseOccupancy: 2,
 			Description:   "Premium corner room with panoramic views and a private veranda.",
 			Amenities:     "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set,Mini Fridge,TV,Veranda",
 			ImageURL:      "/static/images/rooms/room1.jpg",
@@ -84,37 +191,45 @@ func SeedRooms(db *gorm.DB) error {
 			RoomNo:        "Kiku",
 			Type:          "Traditional",
 			Capacity:      2,
-			PricePerNight: 16000,
+			PricePerNight: models.MoneyFromMajor(16000, models.DefaultCurrency),
+			BaseOccupancy: 2,
 			Description:   "Traditional room with authentic decor and chrysanthemum garden views.",
 			Amenities:     "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set",
 			ImageURL:      "/static/images/rooms/room3.jpg",
 		},
 		{
-			RoomNo:        "Matsu",
-			Type:          "Deluxe",
-			Capacity:      3,
-			PricePerNight: 20000,
-			Description:   "Deluxe room with a pine tree garden view and upgraded amenities.",
-			Amenities:     "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set,Mini Fridge,TV",
-			ImageURL:      "/static/images/rooms/room2.jpg",
+			RoomNo:         "Matsu",
+			Type:           "Deluxe",
+			Capacity:       3,
+			PricePerNight:  models.MoneyFromMajor(20000, models.DefaultCurrency),
+			BaseOccupancy:  2,
+			ExtraAdultRate: models.MoneyFromMajor(3500, models.DefaultCurrency),
+			ChildRate:      models.MoneyFromMajor(2000, models.DefaultCurrency),
+			Description:    "Deluxe room with a pine tree garden view and upgraded amenities.",
+			Amenities:      "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set,Mini Fridge,TV",
+			ImageURL:       "/static/images/rooms/room2.jpg",
 		},
 		{
 			RoomNo:        "Tsubaki",
 			Type:          "Traditional",
 			Capacity:      2,
-			PricePerNight: 15000,
+			PricePerNight: models.MoneyFromMajor(15000, models.DefaultCurrency),
+			BaseOccupancy: 2,
 			Description:   "Traditional room with camellia flower garden views and morning sunlight.",
 			Amenities:     "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set",
 			ImageURL:      "/static/images/rooms/room2.jpg",
 		},
 		{
-			RoomNo:        "Ume",
-			Type:          "Family",
-			Capacity:      5,
-			PricePerNight: 32000,
-			Description:   "Our largest family room with plum blossom garden views and sitting area.",
-			Amenities:     "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set,Mini Fridge,TV,Extra Futons",
-			ImageURL:      "/static/images/rooms/room1.jpg",
+			RoomNo:         "Ume",
+			Type:           "Family",
+			Capacity:       5,
+			PricePerNight:  models.MoneyFromMajor(32000, models.DefaultCurrency),
+			BaseOccupancy:  2,
+			ExtraAdultRate: models.MoneyFromMajor(4000, models.DefaultCurrency),
+			ChildRate:      models.MoneyFromMajor(2500, models.DefaultCurrency),
+			Description:    "Our largest family room with plum blossom garden views and sitting area.",
+			Amenities:      "Wi-Fi,Private Bathroom,Air Conditioning,Yukata,Tea Set,Mini Fridge,TV,Extra Futons",
+			ImageURL:       "/static/images/rooms/room1.jpg",
 		},
 	}
 
@@ -140,6 +255,9 @@ func SeedRooms(db *gorm.DB) error {
 				existingRoom.Type = room.Type
 				existingRoom.Capacity = room.Capacity
 				existingRoom.PricePerNight = room.PricePerNight
+				existingRoom.BaseOccupancy = room.BaseOccupancy
+				existingRoom.ExtraAdultRate = room.ExtraAdultRate
+				existingRoom.ChildRate = room.ChildRate
 				existingRoom.Description = room.Description
 				existingRoom.Amenities = room.Amenities
 				existingRoom.ImageURL = room.ImageURL
@@ -152,3 +270,303 @@ func SeedRooms(db *gorm.DB) error {
 		return nil
 	})
 }
+
+func SeedOnsens(db *gorm.DB) error {
+	onsens := []models.Onsen{
+		{
+			Name:         "Hinoki",
+			Capacity:     2,
+			PricePerSlot: models.MoneyFromMajor(5000, models.DefaultCurrency),
+			OpenTime:     "09:00",
+			CloseTime:    "22:00",
+			Status:       models.OnsenStatusActive,
+			Description:  "Indoor cypress-wood bath for couples, fed by our natural hot spring.",
+			ImageURL:     "/static/images/onsen/springonsen.jpg",
+		},
+		{
+			Name:         "Rotenburo",
+			Capacity:     4,
+			PricePerSlot: models.MoneyFromMajor(7000, models.DefaultCurrency),
+			OpenTime:     "09:00",
+			CloseTime:    "22:00",
+			Status:       models.OnsenStatusActive,
+			Description:  "Open-air stone bath overlooking the Shantipur valley.",
+			ImageURL:     "/static/images/onsen/springonsen.jpg",
+		},
+		{
+			Name:         "Family Bath",
+			Capacity:     6,
+			PricePerSlot: models.MoneyFromMajor(9000, models.DefaultCurrency),
+			OpenTime:     "15:00",
+			CloseTime:    "21:00",
+			Status:       models.OnsenStatusActive,
+			Description:  "Spacious family bath with shallow seating for children.",
+			ImageURL:     "/static/images/onsen/springonsen.jpg",
+		},
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, onsen := range onsens {
+			var existing models.Onsen
+			result := tx.Where("name = ?", onsen.Name).First(&existing)
+
+			if result.Error != nil {
+				if result.Error == gorm.ErrRecordNotFound {
+					if err := tx.Create(&onsen).Error; err != nil {
+						return err
+					}
+					continue
+				}
+				return result.Error
+			}
+
+			// Onsen exists, refresh its details
+			existing.Capacity = onsen.Capacity
+			existing.PricePerSlot = onsen.PricePerSlot
+			existing.OpenTime = onsen.OpenTime
+			existing.CloseTime = onsen.CloseTime
+			existing.Description = onsen.Description
+			existing.ImageURL = onsen.ImageURL
+
+			if err := tx.Save(&existing).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SeedOnsenEntitlements sets the free onsen sessions included with each room type
+func SeedOnsenEntitlements(db *gorm.DB) error {
+	entitlements := []models.OnsenEntitlement{
+		{RoomType: "Traditional", FreeSessions: 0},
+		{RoomType: "Deluxe", FreeSessions: 1},
+		{RoomType: "Family", FreeSessions: 1},
+		{RoomType: "Premium", FreeSessions: 2},
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, entitlement := range entitlements {
+			var existing models.OnsenEntitlement
+			result := tx.Where("room_type = ?", entitlement.RoomType).First(&existing)
+
+			if result.Error != nil {
+				if result.Error == gorm.ErrRecordNotFound {
+					if err := tx.Create(&entitlement).Error; err != nil {
+						return err
+					}
+					continue
+				}
+				return result.Error
+			}
+
+			existing.FreeSessions = entitlement.FreeSessions
+			if err := tx.Save(&existing).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SeedDepositRules sets the standard 30% advance for every room type
+func SeedDepositRules(db *gorm.DB) error {
+	roomTypes := []string{"Traditional", "Deluxe", "Family", "Premium"}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, roomType := range roomTypes {
+			var existing models.DepositRule
+			result := tx.Where("room_type = ?", roomType).First(&existing)
+
+			if result.Error == nil {
+				continue
+			}
+			if result.Error != gorm.ErrRecordNotFound {
+				return result.Error
+			}
+
+			rule := models.DepositRule{
+				RoomType: roomType,
+				Type:     models.DepositTypePercentage,
+				Value:    30,
+			}
+			if err := tx.Create(&rule).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SeedTaxRules sets up Nepal's 10% service charge and the 13% VAT charged on
+// the price plus service charge
+func SeedTaxRules(db *gorm.DB) error {
+	rules := []models.TaxRule{
+		{
+			Code:       "service_charge",
+			Name:       "Service charge",
+			Rate:       10,
+			Sequence:   1,
+			Categories: "room_night,onsen,dining,minibar",
+			Active:     true,
+		},
+		{
+			Code:       "vat",
+			Name:       "VAT",
+			Rate:       13,
+			Sequence:   2,
+			Compound:   true,
+			Categories: "room_night,onsen,dining,experience,minibar",
+			Active:     true,
+		},
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, rule := range rules {
+			var existing models.TaxRule
+			result := tx.Where("code = ?", rule.Code).First(&existing)
+
+			if result.Error == nil {
+				continue
+			}
+			if result.Error != gorm.ErrRecordNotFound {
+				return result.Error
+			}
+
+			if err := tx.Create(&rule).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SeedRatePlans adds the usual seasonal premiums and long stay discounts.
+// Dashain and Tihar follow the lunar calendar, so their dates have to be
+// entered for each year.
+func SeedRatePlans(db *gorm.DB) error {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	plans := []models.RatePlan{
+		{Name: "Weekend", Kind: models.RatePlanKindPremium, Percent: 10, Weekdays: "fri,sat",
+			StartDate: date(2024, time.January, 1), EndDate: date(2024, time.December, 31), Recurring: true},
+		{Name: "Autumn trekking season", Kind: models.RatePlanKindPremium, Percent: 15,
+			StartDate: date(2024, time.October, 1), EndDate: date(2024, time.November, 30), Recurring: true},
+		{Name: "Spring trekking season", Kind: models.RatePlanKindPremium, Percent: 10,
+			StartDate: date(2024, time.March, 1), EndDate: date(2024, time.May, 31), Recurring: true},
+		{Name: "Dashain 2025", Kind: models.RatePlanKindPremium, Percent: 25,
+			StartDate: date(2025, time.September, 22), EndDate: date(2025, time.October, 6)},
+		{Name: "Tihar 2025", Kind: models.RatePlanKindPremium, Percent: 20,
+			StartDate: date(2025, time.October, 18), EndDate: date(2025, time.October, 23)},
+		{Name: "Dashain 2026", Kind: models.RatePlanKindPremium, Percent: 25,
+			StartDate: date(2026, time.October, 11), EndDate: date(2026, time.October, 25)},
+		{Name: "Tihar 2026", Kind: models.RatePlanKindPremium, Percent: 20,
+			StartDate: date(2026, time.November, 6), EndDate: date(2026, time.November, 11)},
+		{Name: "Long stay 5+ nights", Kind: models.RatePlanKindDiscount, Percent: 10, MinNights: 5,
+			StartDate: date(2024, time.January, 1), EndDate: date(2024, time.December, 31), Recurring: true},
+		{Name: "Long stay 7+ nights", Kind: models.RatePlanKindDiscount, Percent: 15, MinNights: 7,
+			StartDate: date(2024, time.January, 1), EndDate: date(2024, time.December, 31), Recurring: true},
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, plan := range plans {
+			var existing models.RatePlan
+			result := tx.Where("name = ?", plan.Name).First(&existing)
+
+			if result.Error == nil {
+				continue
+			}
+			if result.Error != gorm.ErrRecordNotFound {
+				return result.Error
+			}
+
+			plan.Rate = models.NewMoney(0, models.DefaultCurrency)
+			plan.Active = true
+			if err := tx.Create(&plan).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SeedStayRules adds the minimum stays over Dashain and Tihar, entered for
+// each year like their rate plans
+func SeedStayRules(db *gorm.DB) error {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	rules := []models.StayRule{
+		{Name: "Dashain 2025", MinNights: 2,
+			StartDate: date(2025, time.September, 22), EndDate: date(2025, time.October, 6)},
+		{Name: "Tihar 2025", MinNights: 2,
+			StartDate: date(2025, time.October, 18), EndDate: date(2025, time.October, 23)},
+		{Name: "Dashain 2026", MinNights: 2,
+			StartDate: date(2026, time.October, 11), EndDate: date(2026, time.October, 25)},
+		{Name: "Tihar 2026", MinNights: 2,
+			StartDate: date(2026, time.November, 6), EndDate: date(2026, time.November, 11)},
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, rule := range rules {
+			var existing models.StayRule
+			result := tx.Where("name = ?", rule.Name).First(&existing)
+
+			if result.Error == nil {
+				continue
+			}
+			if result.Error != gorm.ErrRecordNotFound {
+				return result.Error
+			}
+
+			rule.Active = true
+			if err := tx.Create(&rule).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SeedCancellationPolicies adds the usual cancellation policies and gives the
+// Dashain and Tihar rate plans the stricter festival policy
+func SeedCancellationPolicies(db *gorm.DB) error {
+	policies := []models.CancellationPolicy{
+		{Name: "Flexible", Description: "Free cancellation until 24 hours before check-in",
+			Tiers: models.CancellationTiers{{HoursBefore: 24, FeePercent: 50}}, NoShowFeePercent: 100, Default: true},
+		{Name: "Festival", Description: "For stays arriving over Dashain and Tihar",
+			Tiers: models.CancellationTiers{{HoursBefore: 7 * 24, FeePercent: 50}, {HoursBefore: 24, FeePercent: 100}}},
+		{Name: "Non-refundable", Description: "Lower rates that cannot be refunded", NonRefundable: true},
+	}
+	festivalPlans := []string{"Dashain 2025", "Tihar 2025", "Dashain 2026", "Tihar 2026"}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, policy := range policies {
+			var existing models.CancellationPolicy
+			result := tx.Where("name = ?", policy.Name).First(&existing)
+
+			if result.Error == nil {
+				continue
+			}
+			if result.Error != gorm.ErrRecordNotFound {
+				return result.Error
+			}
+
+			policy.Active = true
+			if err := tx.Create(&policy).Error; err != nil {
+				return err
+			}
+		}
+
+		var festival models.CancellationPolicy
+		if err := tx.Where("name = ?", "Festival").First(&festival).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RatePlan{}).
+			Where("name IN ? AND cancellation_policy_id IS NULL", festivalPlans).
+			Update("cancellation_policy_id", festival.ID).Error
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -17,6 +18,7 @@ import (
 	"github.com/IamMaheshGurung/privateOnsenBooking/routes"
 	"github.com/IamMaheshGurung/privateOnsenBooking/services"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/template/html/v2"
 	"go.uber.org/zap"
 )
@@ -46,6 +48,9 @@ func main() {
 
 	config := config.GetConfig()
 
+	// Prices without a currency are in the property's base currency
+	models.DefaultCurrency = strings.ToUpper(config.PropertyCurrency)
+
 	// DATABASE SECTION
 	db, err := database.ConnectDB()
 	if err != nil {
@@ -55,7 +60,7 @@ func main() {
 
 	// AUTO MIGRATING MODELS
 	// This will create the tables, missing foreign keys, constraints, columns and indexes
-	if err := db.AutoMigrate(&models.Room{}, &models.Guest{}, &models.RoomBooking{}); err != nil {
+	if err := db.AutoMigrate(&models.Room{}, &models.Guest{}, &models.RoomBooking{}, &models.FolioItem{}, &models.Onsen{}, &models.OnsenOpeningHours{}, &models.OnsenClosure{}, &models.OnsenEntitlement{}, &models.OnsenBooking{}, &models.DepositRule{}, &models.Payment{}, &models.PaymentEvent{}, &models.Refund{}, &models.Invoice{}, &models.InvoiceSequence{}, &models.ExchangeRate{}, &models.TaxRule{}, &models.RatePlan{}, &models.StayRule{}, &models.PromoCode{}, &models.PromoRedemption{}, &models.CancellationPolicy{}, &models.BookingTransition{}, &models.BookingChange{}); err != nil {
 		logger.Error("Error auto-migrating database:", zap.Error(err))
 		return
 	}
@@ -70,6 +75,87 @@ func main() {
 			// Continuing anyway, as this wont  effect the app
 		}
 	}
+
+	var onsenCount int64
+	db.Model(&models.Onsen{}).Count(&onsenCount)
+	if onsenCount == 0 {
+		logger.Info("No onsens found in database. Seeding initial data...")
+		if err := database.SeedOnsens(db); err != nil {
+			logger.Error("Error seeding onsens:", zap.Error(err))
+		}
+	}
+
+	var entitlementCount int64
+	db.Model(&models.OnsenEntitlement{}).Count(&entitlementCount)
+	if entitlementCount == 0 {
+		logger.Info("No onsen entitlements found in database. Seeding initial data...")
+		if err := database.SeedOnsenEntitlements(db); err != nil {
+			logger.Error("Error seeding onsen entitlements:", zap.Error(err))
+		}
+	}
+
+	var taxRuleCount int64
+	db.Model(&models.TaxRule{}).Count(&taxRuleCount)
+	if taxRuleCount == 0 {
+		logger.Info("No tax rules found in database. Seeding initial data...")
+		if err := database.SeedTaxRules(db); err != nil {
+			logger.Error("Error seeding tax rules:", zap.Error(err))
+		}
+	}
+
+	var ratePlanCount int64
+	db.Model(&models.RatePlan{}).Count(&ratePlanCount)
+	if ratePlanCount == 0 {
+		logger.Info("No rate plans found in database. Seeding initial data...")
+		if err := database.SeedRatePlans(db); err != nil {
+			logger.Error("Error seeding rate plans:", zap.Error(err))
+		}
+	}
+
+	var stayRuleCount int64
+	db.Model(&models.StayRule{}).Count(&stayRuleCount)
+	if stayRuleCount == 0 {
+		logger.Info("No stay rules found in database. Seeding initial data...")
+		if err := database.SeedStayRules(db); err != nil {
+			logger.Error("Error seeding stay rules:", zap.Error(err))
+		}
+	}
+
+	var cancellationPolicyCount int64
+	db.Model(&models.CancellationPolicy{}).Count(&cancellationPolicyCount)
+	if cancellationPolicyCount == 0 {
+		logger.Info("No cancellation policies found in database. Seeding initial data...")
+		if err := database.SeedCancellationPolicies(db); err != nil {
+			logger.Error("Error seeding cancellation policies:", zap.Error(err))
+		}
+	}
+
+	var depositRuleCount int64
+	db.Model(&models.DepositRule{}).Count(&depositRuleCount)
+	if depositRuleCount == 0 {
+		logger.Info("No deposit rules found in database. Seeding initial data...")
+		if err := database.SeedDepositRules(db); err != nil {
+			logger.Error("Error seeding deposit rules:", zap.Error(err))
+		}
+	}
+
+	// Exchange rates are kept in a local file rather than fetched from a live feed
+	exchangeRateService := services.NewExchangeRateService(db, logger, config.PropertyCurrency)
+	if _, err := os.Stat(config.ExchangeRatesFile); err == nil {
+		if _, err := exchangeRateService.LoadFile(config.ExchangeRatesFile); err != nil {
+			logger.Error("Error loading exchange rates:", zap.Error(err))
+		}
+	}
+
+	// Service charge and VAT
+	taxService := services.NewTaxService(db, logger, config.PricesIncludeTax)
+
+	// Nightly rates from rate plans and who is staying
+	pricingService := services.NewPricingService(db, logger, models.AgeBands{
+		InfantMaxAge: config.InfantMaxAge,
+		ChildMaxAge:  config.ChildMaxAge,
+	})
+
 	funcMap := template.FuncMap{
 		"toUpper": strings.ToUpper,
 		"ToUpper": strings.ToUpper,
@@ -131,7 +217,10 @@ func main() {
 		"formatDate": func(t time.Time) string {
 			return t.Format("2006-01-02")
 		},
-		"now": time.Now,
+		"now":          time.Now,
+		"displayPrice": exchangeRateService.DisplayPrice,
+		"taxNote":      taxService.PriceNote,
+		"ageBands":     pricingService.AgeBands,
 	}
 
 	// Initialize template engine
@@ -182,6 +271,9 @@ func main() {
 		},
 	})
 
+	// Turn panics, such as adding amounts in different currencies, into 500s
+	app.Use(recover.New())
+
 	// Setup static file serving
 	app.Static("/static", "./static")
 
@@ -198,16 +290,74 @@ func main() {
 
 	// Initialize services
 	emailService := services.NewEmailService(logger, econfig) // Configure this with your email settings
-	roomBookingService := services.NewRoomBookingService(db, logger, emailService)
 	guestService := services.NewGuestService(db, logger)
+	onsenScheduleService := services.NewOnsenScheduleService(db, logger)
+	folioService := services.NewFolioService(db, logger, taxService)
+	promoService := services.NewPromoService(db, logger)
+	cancellationService := services.NewCancellationService(db, logger)
+	onsenBookingService := services.NewOnsenBookingService(db, logger, onsenScheduleService, folioService)
+	invoiceService := services.NewInvoiceService(db, logger, folioService, services.PropertyDetails{
+		Name:    config.PropertyName,
+		Address: config.PropertyAddress,
+		Phone:   config.PropertyPhone,
+		Email:   config.PropertyEmail,
+		PAN:     config.PropertyPAN,
+	})
+	roomBookingService := services.NewRoomBookingService(db, logger, emailService, onsenBookingService, invoiceService)
+
+	if err := roomBookingService.AssignMissingReferences(); err != nil {
+		logger.Error("Error assigning booking references:", zap.Error(err))
+	}
+
+	// Release unpaid room holds in the background
+	go roomBookingService.RunHoldSweeper(context.Background(), config.HoldSweepInterval)
+
+	// Mark guests who never arrived as no-shows once a day
+	roomBookingService.SetNoShowCutoff(config.NoShowCutoff)
+	go roomBookingService.RunNoShowSweeper(context.Background())
+
+	// Payment gateways: pay at property is always offered, card and fake when configured
+	gateways := []services.PaymentGateway{services.NewCashGateway()}
+	if config.CardGatewayURL != "" {
+		gateways = append(gateways, services.NewCardGateway(services.CardGatewayConfig{
+			Endpoint:       config.CardGatewayURL,
+			RefundEndpoint: config.CardRefundURL,
+			APIKey:         config.CardGatewayAPIKey,
+		}))
+	}
+	if config.EnableFakeGateway {
+		if config.Environment == "production" {
+			logger.Error("The fake payment gateway approves any payment and cannot be enabled in production")
+			return
+		}
+		logger.Warn("Fake payment gateway enabled; it approves any payment")
+		gateways = append(gateways, services.NewFakeGateway())
+	}
+	paymentService := services.NewPaymentService(db, logger, roomBookingService, gateways...)
+	paymentService.RegisterWebhookSecret(models.PaymentMethodCard, config.CardWebhookSecret)
+	if config.EnableFakeGateway {
+		paymentService.RegisterWebhookSecret(models.PaymentMethodFake, config.FakeWebhookSecret)
+	}
 
 	// Initialize controllers
-	roomController := controllers.NewRoomController(roomBookingService, logger)
-	bookingController := controllers.NewBookingController(roomBookingService, guestService, emailService, logger)
+	roomController := controllers.NewRoomController(roomBookingService, pricingService, logger)
+	bookingModificationService := services.NewBookingModificationService(db, logger, roomBookingService, pricingService, taxService, promoService, paymentService, onsenBookingService, emailService)
+	bookingController := controllers.NewBookingController(roomBookingService, guestService, emailService, paymentService, folioService, invoiceService, pricingService, taxService, promoService, cancellationService, bookingModificationService, logger)
+	bookingController.HoldDuration = config.BookingHoldDuration
+	bookingController.ExchangeRates = exchangeRateService
 	guestController := controllers.NewGuestController(guestService, logger)
+	onsenController := controllers.NewOnsenController(onsenBookingService, onsenScheduleService, roomBookingService, logger)
+	paymentController := controllers.NewPaymentController(paymentService, logger)
+	folioController := controllers.NewFolioController(folioService, logger)
+	invoiceController := controllers.NewInvoiceController(invoiceService, roomBookingService, logger)
+	taxController := controllers.NewTaxController(taxService, logger)
+	pricingController := controllers.NewPricingController(pricingService, roomBookingService, taxService, promoService, logger)
+	promoController := controllers.NewPromoController(promoService, logger)
+	cancellationController := controllers.NewCancellationController(cancellationService, logger)
+	exchangeRateController := controllers.NewExchangeRateController(exchangeRateService, logger, config.ExchangeRatesFile)
 
 	// Setup routes
-	routes.SetupRoutes(app, roomController, bookingController, guestController)
+	routes.SetupRoutes(app, roomController, bookingController, guestController, onsenController, paymentController, folioController, invoiceController, taxController, pricingController, promoController, cancellationController, exchangeRateController)
 
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -20,6 +20,11 @@ type TokenClaims struct {
 // AdminAuth middleware checks if request is from admin
 func AdminAuth() fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		// Groups sharing a prefix each run this; verify the token only once
+		if c.Locals("role") == "admin" {
+			return c.Next()
+		}
+
 		// Get token from header or cookie
 		token := extractToken(c)
 		if token == "" {
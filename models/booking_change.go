@@ -0,0 +1,82 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Booking fields a modification can change
+const (
+	BookingFieldRoom            = "room"
+	BookingFieldCheckIn         = "check_in"
+	BookingFieldCheckOut        = "check_out"
+	BookingFieldOccupancy       = "occupancy"
+	BookingFieldSpecialRequests = "special_requests"
+	BookingFieldPromoCodes      = "promo_codes"
+	BookingFieldOnsen           = "onsen" // A private onsen session the change cancelled
+	BookingFieldStatus          = "status"
+	BookingFieldTotal           = "total" // Amount due, room charges and taxes
+)
+
+// bookingFieldLabels names booking fields for guests and staff
+var bookingFieldLabels = map[string]string{
+	BookingFieldRoom:            "Room",
+	BookingFieldCheckIn:         "Check-in",
+	BookingFieldCheckOut:        "Check-out",
+	BookingFieldOccupancy:       "Guests",
+	BookingFieldSpecialRequests: "Special requests",
+	BookingFieldPromoCodes:      "Promo codes",
+	BookingFieldOnsen:           "Private onsen",
+	BookingFieldStatus:          "Status",
+	BookingFieldTotal:           "Total",
+}
+
+// FieldChange is one field of a booking before and after a modification,
+// written out as shown to guests, e.g. 2025-10-02 or 2 adults, 1 child
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Label names the field for guests and staff, e.g. Check-in
+func (c FieldChange) Label() string {
+	if label, ok := bookingFieldLabels[c.Field]; ok {
+		return label
+	}
+	return c.Field
+}
+
+// FieldChanges lists the fields a modification changed. It is stored as a
+// JSON column.
+type FieldChanges []FieldChange
+
+// Value stores the changes as JSON
+func (c FieldChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan reads changes stored by Value
+func (c *FieldChanges) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into FieldChanges", value)
+	}
+	return json.Unmarshal(data, c)
+}
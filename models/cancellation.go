@@ -0,0 +1,172 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// CancellationTier is the fee for cancelling less than HoursBefore hours
+// before check-in, e.g. 50% within 24 hours
+type CancellationTier struct {
+	HoursBefore int     `json:"hours_before"`
+	FeePercent  float64 `json:"fee_percent"` // Of the room charges
+}
+
+// CancellationTiers lists the tiers of a cancellation policy, furthest from
+// check-in first. It is stored as a JSON column.
+type CancellationTiers []CancellationTier
+
+// Value stores the tiers as JSON
+func (t CancellationTiers) Value() (driver.Value, error) {
+	if t == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan reads tiers stored by Value
+func (t *CancellationTiers) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into CancellationTiers", value)
+	}
+	return json.Unmarshal(data, t)
+}
+
+// CancellationTerms are the cancellation terms a booking was made on, copied
+// from its policy so later edits to the policy do not change them
+type CancellationTerms struct {
+	Policy           string            `json:"policy"` // Name of the policy
+	NonRefundable    bool              `json:"non_refundable"`
+	Tiers            CancellationTiers `json:"tiers,omitempty"`
+	NoShowFeePercent float64           `json:"no_show_fee_percent,omitempty"` // Of the room charges, when the guest never arrives
+}
+
+// StandardCancellationTerms are the terms used when no policy applies, and
+// for bookings made before cancellation policies: free until 24 hours
+// before check-in, then 50%
+func StandardCancellationTerms() CancellationTerms {
+	return CancellationTerms{
+		Policy: "Standard",
+		Tiers:  CancellationTiers{{HoursBefore: 24, FeePercent: 50}},
+	}
+}
+
+// IsZero reports whether no terms were recorded
+func (t CancellationTerms) IsZero() bool {
+	return t.Policy == "" && !t.NonRefundable && len(t.Tiers) == 0 && t.NoShowFeePercent == 0
+}
+
+// FeePercent returns the percent of the room charges kept when cancelling
+// hoursBefore hours before check-in
+func (t CancellationTerms) FeePercent(hoursBefore float64) float64 {
+	if t.NonRefundable {
+		return 100
+	}
+
+	fee := 0.0
+	for _, tier := range t.Tiers {
+		if hoursBefore < float64(tier.HoursBefore) && tier.FeePercent > fee {
+			fee = tier.FeePercent
+		}
+	}
+	return fee
+}
+
+// NoShowFee returns the percent of the room charges kept when the guest never
+// arrives: the policy's no-show fee if it sets one, else the fee for
+// cancelling at check-in
+func (t CancellationTerms) NoShowFee() float64 {
+	if t.NonRefundable {
+		return 100
+	}
+	if t.NoShowFeePercent > 0 {
+		return t.NoShowFeePercent
+	}
+	return t.FeePercent(0)
+}
+
+// Lines describes the terms for guests, one sentence per tier, e.g.
+// "Free cancellation until 7 days before check-in."
+func (t CancellationTerms) Lines() []string {
+	if t.NonRefundable {
+		return []string{"Non-refundable: the room charges are kept if the booking is cancelled."}
+	}
+
+	tiers := make(CancellationTiers, len(t.Tiers))
+	copy(tiers, t.Tiers)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].HoursBefore > tiers[j].HoursBefore })
+
+	var lines []string
+	if len(tiers) == 0 {
+		lines = []string{"Free cancellation until check-in."}
+	} else {
+		lines = []string{fmt.Sprintf("Free cancellation until %s before check-in.", hoursText(tiers[0].HoursBefore))}
+	}
+	for _, tier := range tiers {
+		lines = append(lines, fmt.Sprintf("%s%% of the room charges if cancelled within %s of check-in.",
+			strconv.FormatFloat(tier.FeePercent, 'f', -1, 64), hoursText(tier.HoursBefore)))
+	}
+	if t.NoShowFeePercent > 0 {
+		lines = append(lines, fmt.Sprintf("No-show: %s%% of the room charges.",
+			strconv.FormatFloat(t.NoShowFeePercent, 'f', -1, 64)))
+	}
+	return lines
+}
+
+// Value stores the terms as JSON, or NULL when none were recorded
+func (t CancellationTerms) Value() (driver.Value, error) {
+	if t.IsZero() {
+		return nil, nil
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan reads terms stored by Value
+func (t *CancellationTerms) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*t = CancellationTerms{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into CancellationTerms", value)
+	}
+	return json.Unmarshal(data, t)
+}
+
+// hoursText writes hours of two days or more as days where it can, e.g.
+// 7 days, 24 hours or 36 hours
+func hoursText(hours int) string {
+	switch {
+	case hours >= 48 && hours%24 == 0:
+		return fmt.Sprintf("%d days", hours/24)
+	case hours == 1:
+		return "1 hour"
+	default:
+		return fmt.Sprintf("%d hours", hours)
+	}
+}
@@ -15,65 +15,448 @@ type Guest struct {
 
 // Room represents a hotel room
 type Room struct {
-	ID            uint      `json:"id" gorm:"primaryKey"`
-	RoomNo        string    `json:"room_no" gorm:"not null;unique"`
-	Type          string    `json:"typee" gorm:"not null"`     // Standard, Deluxe, Suite, etc.
-	Capacity      int       `json:"capacity" gorm:"default:2"` // Number of guests
-	PricePerNight float64   `json:"price_per_night" gorm:"not null"`
-	Status        string    `json:"status" gorm:"default:'active'"` // Available, Booked, Maintenance
-	Description   string    `json:"description"`                    // Room description
-	Amenities     string    `json:"amenities"`                      // Comma-separated list or JSON
-	ImageURL      string    `json:"image_url"`                      // Main room image URL
-	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	RoomNo         string    `json:"room_no" gorm:"not null;unique"`
+	Type           string    `json:"typee" gorm:"not null"`                                             // Standard, Deluxe, Suite, etc.
+	Capacity       int       `json:"capacity" gorm:"default:2"`                                         // Number of guests
+	PricePerNight  Money     `json:"price_per_night" gorm:"embedded;embeddedPrefix:price_per_night_"`   // Base rate, used on nights no rate plan sets
+	BaseOccupancy  int       `json:"base_occupancy" gorm:"default:2"`                                   // Guests the nightly rate covers
+	ExtraAdultRate Money     `json:"extra_adult_rate" gorm:"embedded;embeddedPrefix:extra_adult_rate_"` // Per night for each adult over BaseOccupancy
+	ChildRate      Money     `json:"child_rate" gorm:"embedded;embeddedPrefix:child_rate_"`             // Per night for each child over BaseOccupancy
+	Status         string    `json:"status" gorm:"default:'active'"`                                    // Available, Booked, Maintenance
+	Description    string    `json:"description"`                                                       // Room description
+	Amenities      string    `json:"amenities"`                                                         // Comma-separated list or JSON
+	ImageURL       string    `json:"image_url"`                                                         // Main room image URL
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
 }
 
 // RoomBooking represents a hotel room booking
 type RoomBooking struct {
-	ID                 uint      `json:"id" gorm:"primaryKey"`
-	GuestID            uint      `json:"guest_id"`
-	Guest              Guest     `json:"guest" gorm:"foreignKey:GuestID"`
-	RoomID             uint      `json:"room_id"`
-	GuestCount         uint      `json:"guestcount"`
-	Room               Room      `json:"room" gorm:"foreignKey:RoomID"`
-	CheckIn            time.Time `json:"check_in" gorm:"not null"`
-	CheckOut           time.Time `json:"check_out" gorm:"not null"`
-	ActualCheckIn      time.Time `json:"actual_check_in"`
-	ActualCheckOut     time.Time `json:"actual_check_out"`
-	CancellationFee    float64   `json:"cancellation_fee"`                  // Cancellation fee if applicable
-	CancellationReason string    `json:"cancellation_reason"`               // Reason for cancellation if applicable
-	CancelledAt        time.Time `json:"cancelled_at"`                      // Timestamp of cancellation
-	ReferenceNumber    string    `json:"reference"`                         // Reference number for the booking
-	Status             string    `json:"status" gorm:"default:'confirmed'"` // Status as string instead of bool
-	SpecialRequests    string    `json:"special_requests"`                  // Any special guest requests
-	TotalPrice         float64   `json:"total_price"`                       // Total price for the stay
-	CreatedAt          time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt          time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	ID                 uint              `json:"id" gorm:"primaryKey"`
+	GuestID            uint              `json:"guest_id"`
+	Guest              Guest             `json:"guest" gorm:"foreignKey:GuestID"`
+	RoomID             uint              `json:"room_id"`
+	GuestCount         uint              `json:"guestcount"`
+	Adults             uint              `json:"adults"`
+	Children           uint              `json:"children"` // Children in the child age band
+	Infants            uint              `json:"infants"`  // Children young enough to stay free
+	Room               Room              `json:"room" gorm:"foreignKey:RoomID"`
+	CheckIn            time.Time         `json:"check_in" gorm:"not null"`
+	CheckOut           time.Time         `json:"check_out" gorm:"not null"`
+	ActualCheckIn      time.Time         `json:"actual_check_in"`
+	ActualCheckOut     time.Time         `json:"actual_check_out"`
+	CancellationFee    Money             `json:"cancellation_fee" gorm:"embedded;embeddedPrefix:cancellation_fee_"`               // Cancellation or no-show fee if applicable
+	CancellationReason string            `json:"cancellation_reason"`                                                             // Reason for cancellation if applicable
+	CancelledAt        time.Time         `json:"cancelled_at"`                                                                    // Timestamp of cancellation
+	CancellationTerms  CancellationTerms `json:"cancellation_terms" gorm:"type:jsonb"`                                            // Terms of the cancellation policy when booked, empty on older bookings
+	ReferenceNumber    string            `json:"reference" gorm:"uniqueIndex:idx_booking_reference,where:reference_number <> ''"` // Guest-facing reference, e.g. KPG-7KX3Q9
+	Status             string            `json:"status" gorm:"default:'confirmed'"`                                               // Status as string instead of bool
+	ExpiresAt          *time.Time        `json:"expires_at,omitempty" gorm:"index"`                                               // When a pending hold is released
+	SpecialRequests    string            `json:"special_requests"`                                                                // Any special guest requests
+	TotalPrice         Money             `json:"total_price" gorm:"embedded;embeddedPrefix:total_price_"`                         // Room charges for the stay before tax, after discounts
+	DiscountAmount     Money             `json:"discount_amount" gorm:"embedded;embeddedPrefix:discount_amount_"`                 // Promo code discounts taken off the quoted room price
+	PromoCodes         string            `json:"promo_codes"`                                                                     // Comma-separated promo codes redeemed
+	NightlyRates       NightRates        `json:"nightly_rates" gorm:"type:jsonb"`                                                 // Rate of each night as priced when booked
+	TaxAmount          Money             `json:"tax_amount" gorm:"embedded;embeddedPrefix:tax_amount_"`                           // Taxes on TotalPrice
+	Taxes              TaxBreakdown      `json:"taxes" gorm:"type:jsonb"`                                                         // TaxAmount by tax, empty for bookings made before tax rules
+	DepositAmount      Money             `json:"deposit_amount" gorm:"embedded;embeddedPrefix:deposit_amount_"`                   // Advance required to secure the booking
+	DisplayCurrency    string            `json:"display_currency" gorm:"size:3"`                                                  // Currency the guest chose to see prices in
+	ExchangeRate       string            `json:"exchange_rate" gorm:"size:32"`                                                    // Display currency per unit of the price currency, locked when booked
+	ExchangeRateDate   *time.Time        `json:"exchange_rate_date,omitempty" gorm:"type:date"`                                   // Effective date of the locked rate
+	CreatedAt          time.Time         `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt          time.Time         `json:"updated_at" gorm:"autoUpdateTime"`
 }
 
-// OnsenBooking represents a private onsen booking
-type OnsenBooking struct {
+// FolioItem is one charge posted to a booking's folio during the stay
+type FolioItem struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	BookingID   uint         `json:"booking_id" gorm:"not null;index;uniqueIndex:idx_folio_source,where:source <> ''"`
+	RoomBooking RoomBooking  `json:"-" gorm:"foreignKey:BookingID"`
+	Category    string       `json:"category" gorm:"not null"` // room_night, onsen, dining, experience, minibar
+	Description string       `json:"description"`
+	ServiceDate time.Time    `json:"service_date" gorm:"type:date"` // Night or day the charge is for
+	Quantity    int          `json:"quantity" gorm:"not null;default:1"`
+	UnitPrice   Money        `json:"unit_price" gorm:"embedded;embeddedPrefix:unit_price_"` // Price of one unit before tax
+	TaxRate     float64      `json:"tax_rate"`                                              // Combined percent of all taxes, e.g. 24.3 for 10% service charge then 13% VAT
+	TaxAmount   Money        `json:"tax_amount" gorm:"embedded;embeddedPrefix:tax_amount_"` // Tax on quantity x unit price
+	Taxes       TaxBreakdown `json:"taxes" gorm:"type:jsonb"`                               // TaxAmount by tax
+	Amount      Money        `json:"amount" gorm:"embedded;embeddedPrefix:amount_"`         // Net amount plus tax
+	Source      string       `json:"source" gorm:"uniqueIndex:idx_folio_source"`            // What posted it automatically, e.g. night:2024-05-01 or onsen:12
+	VoidedAt    *time.Time   `json:"voided_at,omitempty"`                                   // Set when the charge is taken off the folio
+	CreatedAt   time.Time    `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// ExchangeRate is the value of one unit of the property's base currency in
+// another currency, from its effective date until the next rate for that currency
+type ExchangeRate struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	BaseCurrency  string    `json:"base_currency" gorm:"size:3;not null;uniqueIndex:idx_rate_day"`
+	Currency      string    `json:"currency" gorm:"size:3;not null;uniqueIndex:idx_rate_day"`          // Currency the rate converts into
+	Rate          string    `json:"rate" gorm:"size:32;not null"`                                      // Units of Currency per one BaseCurrency, e.g. 1.0845
+	EffectiveDate time.Time `json:"effective_date" gorm:"type:date;not null;uniqueIndex:idx_rate_day"` // First day the rate applies
+	Source        string    `json:"source"`                                                            // Rates file it was loaded from, or admin
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Invoice is the tax invoice issued for a booking. Numbers run sequentially
+// within each Nepali fiscal year and are never reused.
+type Invoice struct {
 	ID          uint        `json:"id" gorm:"primaryKey"`
-	GuestID     uint        `json:"guest_id"`
-	Guest       Guest       `json:"guest" gorm:"foreignKey:GuestID"`
-	RoomID      uint        `json:"room_id" gorm:"not null"`
-	Room        Room        `json:"room" gorm:"foreignKey:RoomID"`
-	BookingID   uint        `json:"booking_id"` // Reference to the related RoomBooking
-	RoomBooking RoomBooking `json:"room_booking" gorm:"foreignKey:BookingID"`
-	Date        time.Time   `json:"date" gorm:"not null"`              // Date of onsen booking
-	TimeSlot    string      `json:"time_slot" gorm:"not null"`         // Time slot (e.g., "18:00-19:00")
-	Status      string      `json:"status" gorm:"default:'confirmed'"` // Status of the onsen booking
-	Price       float64     `json:"price"`                             // Price for onsen booking
+	BookingID   uint        `json:"booking_id" gorm:"not null;uniqueIndex"`
+	RoomBooking RoomBooking `json:"-" gorm:"foreignKey:BookingID"`
+	Number      string      `json:"number" gorm:"not null;uniqueIndex"` // e.g. 2081/82-00042
+	FiscalYear  string      `json:"fiscal_year" gorm:"not null;index"`  // e.g. 2081/82
+	Sequence    int         `json:"sequence" gorm:"not null"`           // Position within the fiscal year
+	IssuedAt    time.Time   `json:"issued_at" gorm:"not null"`
 	CreatedAt   time.Time   `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt   time.Time   `json:"updated_at" gorm:"autoUpdateTime"`
 }
 
+// InvoiceSequence holds the last invoice number used in a fiscal year
+type InvoiceSequence struct {
+	FiscalYear string    `json:"fiscal_year" gorm:"primaryKey"`
+	LastNumber int       `json:"last_number" gorm:"not null;default:0"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// DepositRule sets the advance payment required for bookings of a room type
+type DepositRule struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	RoomType  string    `json:"room_type" gorm:"not null;unique"`          // Matches Room.Type
+	Type      string    `json:"type" gorm:"not null;default:'percentage'"` // percentage or fixed
+	Value     float64   `json:"value" gorm:"not null"`                     // Percent of the total, or a fixed amount
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// RatePlan changes the nightly rate of rooms over a range of dates. A rate
+// plan sets the rate outright, the highest priority one winning where several
+// cover a night; a premium plan adds a percentage on top of whatever rate is
+// in effect, e.g. for Dashain or the trekking season; a discount plan takes a
+// percentage off stays of at least MinNights, the largest discount a stay
+// qualifies for winning, e.g. 10% off 5+ nights and 15% off 7+ nights.
+type RatePlan struct {
+	ID                   uint      `json:"id" gorm:"primaryKey"`
+	Name                 string    `json:"name" gorm:"not null"`
+	RoomType             string    `json:"room_type" gorm:"index"`                    // Matches Room.Type, empty for every room
+	Kind                 string    `json:"kind" gorm:"not null;default:'rate'"`       // rate, premium or discount
+	Rate                 Money     `json:"rate" gorm:"embedded;embeddedPrefix:rate_"` // Nightly rate of a rate plan
+	Percent              float64   `json:"percent"`                                   // Premium or discount on the rate
+	MinNights            int       `json:"min_nights"`                                // Shortest stay a discount plan applies to
+	StartDate            time.Time `json:"start_date" gorm:"type:date;not null"`      // First night covered
+	EndDate              time.Time `json:"end_date" gorm:"type:date;not null"`        // Last night covered
+	Recurring            bool      `json:"recurring"`                                 // Repeats every year on the same dates
+	Weekdays             string    `json:"weekdays"`                                  // Comma-separated days it applies on, e.g. fri,sat; empty for every day
+	Priority             int       `json:"priority" gorm:"not null;default:0"`        // Higher wins between rate plans
+	CancellationPolicyID *uint     `json:"cancellation_policy_id"`                    // Policy for stays arriving on a covered night, nil to leave it to other plans
+	Active               bool      `json:"active" gorm:"not null"`
+	UpdatedAt            time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// CancellationPolicy sets the fee for cancelling a booking by how close to
+// check-in it is cancelled. A booking takes the policy of the rate plan
+// covering its check-in night, or the default policy, and keeps a copy of
+// its terms.
+type CancellationPolicy struct {
+	ID               uint              `json:"id" gorm:"primaryKey"`
+	Name             string            `json:"name" gorm:"not null;unique"` // Shown to guests, e.g. Flexible
+	Description      string            `json:"description"`
+	NonRefundable    bool              `json:"non_refundable"`                        // Keeps all room charges whenever cancelled
+	Tiers            CancellationTiers `json:"tiers" gorm:"type:jsonb"`               // Fees by hours before check-in
+	NoShowFeePercent float64           `json:"no_show_fee_percent"`                   // Of the room charges, kept when the guest never arrives; 0 keeps the fee for cancelling at check-in
+	Default          bool              `json:"default" gorm:"not null;default:false"` // Used when no rate plan sets a policy
+	Active           bool              `json:"active" gorm:"not null"`
+	CreatedAt        time.Time         `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        time.Time         `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Terms returns the terms a booking made on the policy keeps
+func (p CancellationPolicy) Terms() CancellationTerms {
+	terms := CancellationTerms{
+		Policy:        p.Name,
+		NonRefundable: p.NonRefundable,
+	}
+	if !p.NonRefundable {
+		terms.Tiers = append(CancellationTiers{}, p.Tiers...)
+		terms.NoShowFeePercent = p.NoShowFeePercent
+	}
+	return terms
+}
+
+// PromoCode is a discount guests redeem with a code at checkout, e.g. one sent
+// in a special offer email. Percent codes are applied before fixed ones.
+type PromoCode struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	Code            string    `json:"code" gorm:"not null;unique"` // Upper case, e.g. DASHAIN10
+	Description     string    `json:"description"`
+	Kind            string    `json:"kind" gorm:"not null;default:'percent'"`        // percent or fixed
+	Percent         float64   `json:"percent"`                                       // Off the room price of a percent code
+	Amount          Money     `json:"amount" gorm:"embedded;embeddedPrefix:amount_"` // Off the room price of a fixed code
+	ValidFrom       time.Time `json:"valid_from" gorm:"type:date;not null"`          // First day it can be redeemed
+	ValidUntil      time.Time `json:"valid_until" gorm:"type:date;not null"`         // Last day it can be redeemed
+	MinNights       int       `json:"min_nights" gorm:"not null;default:0"`
+	RoomTypes       string    `json:"room_types"`                                   // Comma-separated Room.Type values, empty for every room
+	MaxUses         int       `json:"max_uses" gorm:"not null;default:0"`           // Redemptions across all guests, 0 for no limit
+	MaxUsesPerGuest int       `json:"max_uses_per_guest" gorm:"not null;default:0"` // 0 for no limit
+	Stackable       bool      `json:"stackable"`                                    // Can be combined with other stackable codes
+	Active          bool      `json:"active" gorm:"not null"`
+	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// PromoRedemption records a promo code redeemed on a booking and the discount
+// it gave. Redemptions on cancelled, rejected or expired bookings do not count
+// towards a code's usage limits.
+type PromoRedemption struct {
+	ID          uint        `json:"id" gorm:"primaryKey"`
+	PromoCodeID uint        `json:"promo_code_id" gorm:"not null;index"`
+	BookingID   uint        `json:"booking_id" gorm:"not null;index"`
+	RoomBooking RoomBooking `json:"-" gorm:"foreignKey:BookingID"`
+	GuestID     uint        `json:"guest_id" gorm:"not null;index"`
+	Code        string      `json:"code" gorm:"not null"`
+	Discount    Money       `json:"discount" gorm:"embedded;embeddedPrefix:discount_"`
+	CreatedAt   time.Time   `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// StayRule restricts the stays that can be booked over a range of dates, e.g.
+// a two night minimum over Dashain or no arrivals on Laxmi Puja
+type StayRule struct {
+	ID                uint      `json:"id" gorm:"primaryKey"`
+	Name              string    `json:"name" gorm:"not null"`                 // Named in the error when it blocks a booking
+	RoomType          string    `json:"room_type" gorm:"index"`               // Matches Room.Type, empty for every room
+	StartDate         time.Time `json:"start_date" gorm:"type:date;not null"` // First date covered
+	EndDate           time.Time `json:"end_date" gorm:"type:date;not null"`   // Last date covered
+	Recurring         bool      `json:"recurring"`                            // Repeats every year on the same dates
+	Weekdays          string    `json:"weekdays"`                             // Comma-separated days it applies on, e.g. sat; empty for every day
+	MinNights         int       `json:"min_nights"`                           // Shortest stay with a night covered, 0 for none
+	MaxNights         int       `json:"max_nights"`                           // Longest stay with a night covered, 0 for none
+	ClosedToArrival   bool      `json:"closed_to_arrival"`                    // No check-ins on covered dates
+	ClosedToDeparture bool      `json:"closed_to_departure"`                  // No check-outs on covered dates
+	Active            bool      `json:"active" gorm:"not null"`
+	UpdatedAt         time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TaxRule is a tax or service charge added to the price of some categories of
+// charge. Rules are applied in Sequence order.
+type TaxRule struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Code       string    `json:"code" gorm:"not null;unique"` // e.g. service_charge, vat
+	Name       string    `json:"name" gorm:"not null"`        // Printed on bills and invoices, e.g. VAT
+	Rate       float64   `json:"rate" gorm:"not null"`        // Percent
+	Sequence   int       `json:"sequence" gorm:"not null;default:0"`
+	Compound   bool      `json:"compound"`                   // Charged on the price plus the taxes before it, as VAT is on service charge
+	Categories string    `json:"categories" gorm:"not null"` // Comma-separated folio categories it applies to, e.g. room_night,onsen,dining
+	Active     bool      `json:"active" gorm:"not null"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Payment records one attempt to pay for a room booking
+type Payment struct {
+	ID               uint        `json:"id" gorm:"primaryKey"`
+	BookingID        uint        `json:"booking_id" gorm:"not null;index"`
+	RoomBooking      RoomBooking `json:"-" gorm:"foreignKey:BookingID"`
+	Amount           Money       `json:"amount" gorm:"embedded;embeddedPrefix:amount_"`
+	Method           string      `json:"method" gorm:"not null"`                   // cash, card, fake
+	Status           string      `json:"status" gorm:"not null;default:'pending'"` // pending, authorized, succeeded, failed
+	GatewayReference string      `json:"gateway_reference" gorm:"index"`           // Transaction ID at the payment provider
+	FailureReason    string      `json:"failure_reason,omitempty"`
+	ProcessedAt      *time.Time  `json:"processed_at,omitempty"` // When the gateway answered
+	CreatedAt        time.Time   `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        time.Time   `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// BookingTransition records a change of a booking's status, who made it and why
+type BookingTransition struct {
+	ID          uint        `json:"id" gorm:"primaryKey"`
+	BookingID   uint        `json:"booking_id" gorm:"not null;index"`
+	RoomBooking RoomBooking `json:"-" gorm:"foreignKey:BookingID"`
+	FromStatus  string      `json:"from_status" gorm:"not null"`
+	ToStatus    string      `json:"to_status" gorm:"not null"`
+	Actor       string      `json:"actor" gorm:"not null"` // Staff member, guest or system
+	Reason      string      `json:"reason"`
+	CreatedAt   time.Time   `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// BookingChange records a modification of a booking's room, dates, guests or
+// requests. Version counts the modifications of each booking from 1.
+type BookingChange struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	BookingID   uint         `json:"booking_id" gorm:"not null;uniqueIndex:idx_booking_change_version"`
+	RoomBooking RoomBooking  `json:"-" gorm:"foreignKey:BookingID"`
+	Version     int          `json:"version" gorm:"not null;uniqueIndex:idx_booking_change_version"`
+	Changes     FieldChanges `json:"changes" gorm:"type:jsonb"`                                 // Old and new value of each field changed
+	TotalBefore Money        `json:"total_before" gorm:"embedded;embeddedPrefix:total_before_"` // Amount due before the change, room charges and taxes
+	TotalAfter  Money        `json:"total_after" gorm:"embedded;embeddedPrefix:total_after_"`   // Amount due after it
+	Actor       string       `json:"actor" gorm:"not null"`                                     // Staff member or guest
+	Reason      string       `json:"reason"`
+	CreatedAt   time.Time    `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// Refund returns money paid for a cancelled booking, less the cancellation fee
+type Refund struct {
+	ID               uint        `json:"id" gorm:"primaryKey"`
+	BookingID        uint        `json:"booking_id" gorm:"not null;index"`
+	RoomBooking      RoomBooking `json:"-" gorm:"foreignKey:BookingID"`
+	PaymentID        uint        `json:"payment_id" gorm:"index"` // Payment the money is returned against
+	Amount           Money       `json:"amount" gorm:"embedded;embeddedPrefix:amount_"`
+	Method           string      `json:"method" gorm:"not null"`                   // cash, card, fake
+	Reason           string      `json:"reason"`                                   // Why the booking was cancelled
+	Status           string      `json:"status" gorm:"not null;default:'pending'"` // pending, processed, failed
+	ApprovedBy       string      `json:"approved_by"`                              // Staff member who released the refund
+	GatewayReference string      `json:"gateway_reference"`                        // Refund ID at the provider, or receipt number
+	FailureReason    string      `json:"failure_reason,omitempty"`
+	ProcessedAt      *time.Time  `json:"processed_at,omitempty"`
+	CreatedAt        time.Time   `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        time.Time   `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// PaymentEvent records a webhook event from a payment provider so that
+// redelivered events are only applied once
+type PaymentEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Provider   string    `json:"provider" gorm:"not null;uniqueIndex:idx_provider_event"`
+	EventID    string    `json:"event_id" gorm:"not null;uniqueIndex:idx_provider_event"` // Provider's event ID
+	Type       string    `json:"type"`                                                    // e.g. payment.succeeded
+	PaymentID  uint      `json:"payment_id" gorm:"index"`
+	ReceivedAt time.Time `json:"received_at" gorm:"autoCreateTime"`
+}
+
+// Onsen represents a private bath that guests can reserve by the slot
+type Onsen struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	Name          string    `json:"name" gorm:"not null;unique"`
+	Capacity      int       `json:"capacity" gorm:"default:2"`                                     // Maximum bathers per session
+	PricePerSlot  Money     `json:"price_per_slot" gorm:"embedded;embeddedPrefix:price_per_slot_"` // Price for one private session
+	OpenTime      string    `json:"open_time" gorm:"default:'09:00'"`                              // Default first session start (HH:MM)
+	CloseTime     string    `json:"close_time" gorm:"default:'22:00'"`                             // Default end of the last session (HH:MM)
+	SlotMinutes   int       `json:"slot_minutes" gorm:"default:60"`                                // Length of one private session
+	BufferMinutes int       `json:"buffer_minutes" gorm:"default:30"`                              // Cleaning time between sessions
+	Status        string    `json:"status" gorm:"default:'active'"`                                // active, maintenance, inactive
+	Description   string    `json:"description"`
+	ImageURL      string    `json:"image_url"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// OnsenOpeningHours overrides a bath's default hours on one day of the week
+type OnsenOpeningHours struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	OnsenID   uint         `json:"onsen_id" gorm:"not null;uniqueIndex:idx_onsen_weekday"`
+	Weekday   time.Weekday `json:"weekday" gorm:"not null;uniqueIndex:idx_onsen_weekday"` // 0 = Sunday
+	OpenTime  string       `json:"open_time"`                                             // HH:MM
+	CloseTime string       `json:"close_time"`                                            // HH:MM
+	Closed    bool         `json:"closed"`                                                // Closed all day
+	UpdatedAt time.Time    `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// OnsenClosure closes a bath, or every bath when OnsenID is 0, on a given date
+type OnsenClosure struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	OnsenID   uint      `json:"onsen_id" gorm:"index"` // 0 applies to all baths
+	Date      time.Time `json:"date" gorm:"type:date;not null;index"`
+	Reason    string    `json:"reason"` // Maintenance, holiday, etc.
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// OnsenEntitlement sets how many free onsen sessions a stay in a room type includes
+type OnsenEntitlement struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	RoomType     string    `json:"room_type" gorm:"not null;unique"` // Matches Room.Type
+	FreeSessions int       `json:"free_sessions" gorm:"default:0"`   // Sessions included per stay
+	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// OnsenBooking represents a private onsen booking
+type OnsenBooking struct {
+	ID            uint        `json:"id" gorm:"primaryKey"`
+	GuestID       uint        `json:"guest_id"`
+	Guest         Guest       `json:"guest" gorm:"foreignKey:GuestID"`
+	RoomID        uint        `json:"room_id" gorm:"not null"`
+	Room          Room        `json:"room" gorm:"foreignKey:RoomID"`
+	BookingID     uint        `json:"booking_id"` // Reference to the related RoomBooking
+	RoomBooking   RoomBooking `json:"room_booking" gorm:"foreignKey:BookingID"`
+	OnsenID       uint        `json:"onsen_id" gorm:"index;uniqueIndex:idx_onsen_slot,where:status <> 'cancelled'"` // The bath that was reserved
+	Onsen         Onsen       `json:"onsen" gorm:"foreignKey:OnsenID"`
+	Date          time.Time   `json:"date" gorm:"not null;uniqueIndex:idx_onsen_slot"`      // Date of onsen booking
+	TimeSlot      string      `json:"time_slot" gorm:"not null;uniqueIndex:idx_onsen_slot"` // Time slot (e.g., "18:00-19:00")
+	GuestCount    int         `json:"guest_count" gorm:"default:1"`                         // Number of bathers
+	Status        string      `json:"status" gorm:"default:'confirmed'"`                    // Status of the onsen booking
+	Complimentary bool        `json:"complimentary"`                                        // Covered by the stay's free sessions
+	Price         Money       `json:"price" gorm:"embedded;embeddedPrefix:price_"`          // Price for onsen booking
+	CreatedAt     time.Time   `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time   `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Onsen status constants
+const (
+	OnsenStatusActive      = "active"
+	OnsenStatusMaintenance = "maintenance"
+	OnsenStatusInactive    = "inactive"
+)
+
+// Payment method constants
+const (
+	PaymentMethodCash = "cash" // Pay at the property on arrival
+	PaymentMethodCard = "card"
+	PaymentMethodFake = "fake" // Local gateway for development and tests
+)
+
+// Folio item category constants
+const (
+	FolioCategoryRoomNight  = "room_night"
+	FolioCategoryOnsen      = "onsen"
+	FolioCategoryDining     = "dining"
+	FolioCategoryExperience = "experience"
+	FolioCategoryMinibar    = "minibar"
+)
+
+// Rate plan kind constants
+const (
+	RatePlanKindRate     = "rate"
+	RatePlanKindPremium  = "premium"
+	RatePlanKindDiscount = "discount"
+)
+
+// Promo code kind constants
+const (
+	PromoKindPercent = "percent"
+	PromoKindFixed   = "fixed"
+)
+
+// Deposit rule type constants
+const (
+	DepositTypePercentage = "percentage"
+	DepositTypeFixed      = "fixed"
+)
+
+// Payment status constants
+const (
+	PaymentStatusPending    = "pending"
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusSucceeded  = "succeeded"
+	PaymentStatusFailed     = "failed"
+)
+
+// Refund status constants
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusProcessed = "processed"
+	RefundStatusFailed    = "failed"
+)
+
 // Booking status constants
 const (
 	BookingStatusConfirmed  = "confirmed"
 	BookingStatusCancelled  = "cancelled"
 	BookingStatusCheckedIn  = "checked_in"
-	BookingStatusCheckedOut = "checked_out"
-	BookingStatusCompleted  = "completed"
+	BookingStatusCheckedOut = "checked_out" // Guest has left, money may still be owed
+	BookingStatusCompleted  = "completed"   // Checked out and settled
 	BookingStatusRejected   = "rejected"
 	BookingStatusPending    = "pending"
+	BookingStatusExpired    = "expired" // Pending hold that was never paid
+	BookingStatusNoShow     = "no_show" // Confirmed guest who never arrived
+)
+
+// Booking transition actors for changes no member of staff made
+const (
+	BookingActorSystem = "system" // Background jobs, e.g. releasing expired holds
+	BookingActorGuest  = "guest"
+	BookingActorStaff  = "staff" // Front desk change with no name given
 )
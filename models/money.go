@@ -0,0 +1,399 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the property's base currency: rooms and onsen sessions are
+// priced in it and prices entered without a currency are taken to be in it.
+// It is set from configuration at startup.
+var DefaultCurrency = "NPR"
+
+// currencyExponents lists currencies whose minor unit is not 1/100
+var currencyExponents = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+}
+
+// ErrInvalidAmount is returned when an amount cannot be parsed exactly
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Money is an exact amount of one currency, held as an integer number of
+// minor units (paisa for NPR, cents for USD). Embed it in models with
+// gorm:"embedded;embeddedPrefix:<field>_", which stores <field>_minor and
+// <field>_currency.
+//
+// The zero value is zero in no particular currency and takes the currency of
+// whatever it is combined with. Combining two different currencies is a
+// programming error and panics; convert first. The currency column has no
+// database default, so amounts added to existing rows read back as that zero.
+type Money struct {
+	Minor    int64  `json:"minor" gorm:"column:minor;not null;default:0"` // Amount in minor units
+	Currency string `json:"currency" gorm:"column:currency;size:3"`       // ISO 4217 code
+}
+
+// NewMoney returns minor units of currency
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: strings.ToUpper(currency)}
+}
+
+// MoneyFromMajor converts an amount in major units, e.g. 1500.5 rupees,
+// rounding half away from zero to the nearest minor unit. Use it only at the
+// edges where amounts still arrive as floats; ParseMoney is exact.
+func MoneyFromMajor(amount float64, currency string) Money {
+	currency = strings.ToUpper(currency)
+	return Money{Minor: int64(math.Round(amount * float64(minorPerMajor(currency)))), Currency: currency}
+}
+
+// ParseMoney reads a decimal amount in major units, e.g. "15000" or
+// "1,234.50", without going through floating point. More decimal places than
+// the currency has is an error rather than a silent rounding.
+func ParseMoney(s, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	exponent := CurrencyExponent(currency)
+	if whole == "" && fraction == "" || len(fraction) > exponent {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	digits := whole + fraction
+	if strings.TrimLeft(digits, "0123456789") != "" {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	minor, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if negative {
+		minor = -minor
+	}
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+// CurrencyExponent returns the number of decimal places of a currency
+func CurrencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// MinorUnitCurrencies returns the currencies whose minor unit is not 1/100,
+// with their number of decimal places
+func MinorUnitCurrencies() map[string]int {
+	currencies := make(map[string]int, len(currencyExponents))
+	for currency, exponent := range currencyExponents {
+		currencies[currency] = exponent
+	}
+	return currencies
+}
+
+func minorPerMajor(currency string) int64 {
+	factor := int64(1)
+	for i := 0; i < CurrencyExponent(currency); i++ {
+		factor *= 10
+	}
+	return factor
+}
+
+// currencyWith returns the currency shared by m and o
+func (m Money) currencyWith(o Money) string {
+	switch {
+	case m.Currency == "":
+		return o.Currency
+	case o.Currency == "" || o.Currency == m.Currency:
+		return m.Currency
+	}
+	panic(fmt.Sprintf("money: currency mismatch %s and %s", m.Currency, o.Currency))
+}
+
+// In returns m with currency set when it has none yet
+func (m Money) In(currency string) Money {
+	if m.Currency == "" {
+		m.Currency = strings.ToUpper(currency)
+	}
+	return m
+}
+
+// Add returns m + o
+func (m Money) Add(o Money) Money {
+	return Money{Minor: m.Minor + o.Minor, Currency: m.currencyWith(o)}
+}
+
+// Sub returns m - o
+func (m Money) Sub(o Money) Money {
+	return Money{Minor: m.Minor - o.Minor, Currency: m.currencyWith(o)}
+}
+
+// Neg returns -m
+func (m Money) Neg() Money {
+	return Money{Minor: -m.Minor, Currency: m.Currency}
+}
+
+// Mul returns m times a whole quantity
+func (m Money) Mul(n int64) Money {
+	return Money{Minor: m.Minor * n, Currency: m.Currency}
+}
+
+// MulFrac returns m * num / den, rounded half away from zero to the minor unit
+func (m Money) MulFrac(num, den int64) Money {
+	if den < 0 {
+		num, den = -num, -den
+	}
+	return Money{Minor: divRound(m.Minor*num, den), Currency: m.Currency}
+}
+
+// Percent returns rate percent of m, rounded half away from zero. Rates are
+// taken to two decimal places, so 13 and 12.5 are exact.
+func (m Money) Percent(rate float64) Money {
+	return m.MulFrac(int64(math.Round(rate*100)), 10000)
+}
+
+// Split divides m into n parts that differ by at most one minor unit and add
+// back up to exactly m. Earlier parts take the remainder.
+func (m Money) Split(n int) []Money {
+	if n <= 0 {
+		return nil
+	}
+
+	parts := make([]Money, n)
+	share, remainder := m.Minor/int64(n), m.Minor%int64(n)
+	for i := range parts {
+		parts[i] = Money{Minor: share, Currency: m.Currency}
+		switch {
+		case remainder > 0:
+			parts[i].Minor++
+			remainder--
+		case remainder < 0:
+			parts[i].Minor--
+			remainder++
+		}
+	}
+	return parts
+}
+
+// Allocate divides m into parts in proportion to weights, e.g. the rates of
+// the nights of a stay, that add back up to exactly m. Rounding is spread over
+// the earliest parts one minor unit at a time. Without any weight m is split
+// evenly.
+func (m Money) Allocate(weights []int64) []Money {
+	var total int64
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		return m.Split(len(weights))
+	}
+
+	sign, minor := int64(1), m.Minor
+	if minor < 0 {
+		sign, minor = -1, -minor
+	}
+
+	parts := make([]Money, len(weights))
+	remainder := minor
+	for i, weight := range weights {
+		share := new(big.Int).Mul(big.NewInt(minor), big.NewInt(weight))
+		share.Quo(share, big.NewInt(total))
+		parts[i] = Money{Minor: share.Int64(), Currency: m.Currency}
+		remainder -= parts[i].Minor
+	}
+	for i := 0; remainder > 0; i = (i + 1) % len(parts) {
+		if weights[i] > 0 {
+			parts[i].Minor++
+			remainder--
+		}
+	}
+
+	for i := range parts {
+		parts[i].Minor *= sign
+	}
+	return parts
+}
+
+// divRound divides a by a positive b, rounding half away from zero
+func divRound(a, b int64) int64 {
+	if a < 0 {
+		return -((-a + b/2) / b)
+	}
+	return (a + b/2) / b
+}
+
+// ParseRate reads an exchange rate written as a decimal, e.g. "1.0845"
+func ParseRate(s string) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || strings.Contains(s, "/") || rate.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid exchange rate %q", s)
+	}
+	return rate, nil
+}
+
+// Convert returns m in currency at rate units of currency per unit of m's
+// currency, rounded half away from zero to the minor unit of currency
+func (m Money) Convert(rate *big.Rat, currency string) Money {
+	currency = strings.ToUpper(currency)
+
+	value := new(big.Rat).SetInt64(m.Minor)
+	value.Mul(value, rate)
+	value.Mul(value, new(big.Rat).SetInt64(minorPerMajor(currency)))
+	value.Quo(value, new(big.Rat).SetInt64(minorPerMajor(m.Currency)))
+
+	// Round half away from zero
+	num, den := new(big.Int).Abs(value.Num()), value.Denom()
+	num.Mul(num, big.NewInt(2)).Add(num, den)
+	num.Quo(num, new(big.Int).Mul(den, big.NewInt(2)))
+	if value.Sign() < 0 {
+		num.Neg(num)
+	}
+
+	return Money{Minor: num.Int64(), Currency: currency}
+}
+
+// Cmp compares m and o, returning -1, 0 or 1
+func (m Money) Cmp(o Money) int {
+	m.currencyWith(o)
+	switch {
+	case m.Minor < o.Minor:
+		return -1
+	case m.Minor > o.Minor:
+		return 1
+	}
+	return 0
+}
+
+// Min returns the smaller of m and o
+func (m Money) Min(o Money) Money {
+	if m.Cmp(o) <= 0 {
+		return m.In(o.Currency)
+	}
+	return o.In(m.Currency)
+}
+
+// IsZero reports whether m is zero
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// IsPositive reports whether m is more than zero
+func (m Money) IsPositive() bool {
+	return m.Minor > 0
+}
+
+// IsNegative reports whether m is less than zero
+func (m Money) IsNegative() bool {
+	return m.Minor < 0
+}
+
+// Major formats m in major units without grouping, e.g. 1234.50, as used in
+// form inputs and payment APIs
+func (m Money) Major() string {
+	exponent := CurrencyExponent(m.Currency)
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+
+	factor := minorPerMajor(m.Currency)
+	if exponent == 0 {
+		return sign + strconv.FormatInt(minor, 10)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/factor, exponent, minor%factor)
+}
+
+// Number formats m in major units with thousands separators, e.g. 1,234.50
+func (m Money) Number() string {
+	major := m.Major()
+	sign := ""
+	if strings.HasPrefix(major, "-") {
+		sign, major = "-", major[1:]
+	}
+
+	whole, fraction, hasFraction := strings.Cut(major, ".")
+	var b strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	if hasFraction {
+		b.WriteString("." + fraction)
+	}
+	return sign + b.String()
+}
+
+// String formats m for people, e.g. NPR 1,234.50
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Number()
+	}
+	return m.Currency + " " + m.Number()
+}
+
+// MarshalJSON writes m with its exact minor units and a display amount
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Minor    int64  `json:"minor"`
+		Currency string `json:"currency"`
+		Amount   string `json:"amount"`
+	}{m.Minor, m.Currency, m.Major()})
+}
+
+// UnmarshalJSON reads the object written by MarshalJSON, or a plain amount in
+// major units such as 15000 or "15000.00", which is taken as DefaultCurrency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = []byte(strings.TrimSpace(string(data)))
+	if string(data) == "null" {
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '{' {
+		var raw struct {
+			Minor    *int64 `json:"minor"`
+			Currency string `json:"currency"`
+			Amount   string `json:"amount"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		currency := raw.Currency
+		if currency == "" {
+			currency = DefaultCurrency
+		}
+		if raw.Minor != nil {
+			*m = NewMoney(*raw.Minor, currency)
+			return nil
+		}
+		parsed, err := ParseMoney(raw.Amount, currency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	parsed, err := ParseMoney(strings.Trim(string(data), `"`), DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
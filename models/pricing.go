@@ -0,0 +1,88 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// NightRate is the rate of one night of a stay and the rate plans that set it
+type NightRate struct {
+	Date   time.Time `json:"date"`
+	Rate   Money     `json:"rate"`            // Room rate plus Extras
+	Extras Money     `json:"extras"`          // Extra adult and child charges
+	Plans  []string  `json:"plans,omitempty"` // Names of the rate plans applied, none for the base rate
+}
+
+// Occupancy is who is staying in a room
+type Occupancy struct {
+	Adults   int `json:"adults"`
+	Children int `json:"children"` // Children in the child age band
+	Infants  int `json:"infants"`  // Children young enough to stay free
+}
+
+// Guests returns the number of people staying, infants included
+func (o Occupancy) Guests() int {
+	return o.Adults + o.Children + o.Infants
+}
+
+// AgeBands sets which ages are charged as children and which stay free.
+// Anyone older than ChildMaxAge is charged as an adult.
+type AgeBands struct {
+	InfantMaxAge int `json:"infant_max_age"` // Stay free, e.g. 0 to 3
+	ChildMaxAge  int `json:"child_max_age"`  // Charged the child rate, e.g. 4 to 11
+}
+
+// ChildMinAge returns the youngest age charged as a child
+func (b AgeBands) ChildMinAge() int {
+	return b.InfantMaxAge + 1
+}
+
+// AdultMinAge returns the youngest age charged as an adult
+func (b AgeBands) AdultMinAge() int {
+	return b.ChildMaxAge + 1
+}
+
+// NightRates lists the nights of a stay in order. It is stored as a JSON
+// column so a booking keeps the rates it was priced at.
+type NightRates []NightRate
+
+// Weights returns the rate of each night in minor units, for sharing an
+// amount out over the nights in proportion to their rates
+func (r NightRates) Weights() []int64 {
+	weights := make([]int64, len(r))
+	for i, night := range r {
+		weights[i] = night.Rate.Minor
+	}
+	return weights
+}
+
+// Value stores the rates as JSON
+func (r NightRates) Value() (driver.Value, error) {
+	if r == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan reads rates stored by Value
+func (r *NightRates) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into NightRates", value)
+	}
+	return json.Unmarshal(data, r)
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// TaxLine is one tax charged on an amount, e.g. the 13% VAT on a room night
+type TaxLine struct {
+	Code     string  `json:"code"`     // Code of the TaxRule it came from, e.g. vat
+	Name     string  `json:"name"`     // Name printed on bills, e.g. VAT
+	Rate     float64 `json:"rate"`     // Percent
+	Compound bool    `json:"compound"` // Charged on the amount plus the taxes before it
+	Amount   Money   `json:"amount"`
+}
+
+// TaxBreakdown lists the taxes charged on an amount in the order they were
+// applied. It is stored as a JSON column.
+type TaxBreakdown []TaxLine
+
+// Total returns the sum of the taxes, in currency when there are none
+func (b TaxBreakdown) Total(currency string) Money {
+	total := NewMoney(0, currency)
+	for _, line := range b {
+		total = total.Add(line.Amount)
+	}
+	return total
+}
+
+// Factor returns the gross amount per unit of net amount the taxes add up
+// to, e.g. 1.243 for 10% service charge followed by 13% VAT on top of it
+func (b TaxBreakdown) Factor() *big.Rat {
+	factor := big.NewRat(1, 1)
+	taxes := new(big.Rat)
+	for _, line := range b {
+		taxable := big.NewRat(1, 1)
+		if line.Compound {
+			taxable.Add(taxable, taxes)
+		}
+		tax := new(big.Rat).Mul(taxable, PercentRat(line.Rate))
+		taxes.Add(taxes, tax)
+		factor.Add(factor, tax)
+	}
+	return factor
+}
+
+// EffectiveRate returns the combined percent of the taxes on the net amount,
+// e.g. 24.3 for 10% service charge followed by 13% VAT
+func (b TaxBreakdown) EffectiveRate() float64 {
+	rate, _ := new(big.Rat).Sub(b.Factor(), big.NewRat(1, 1)).Float64()
+	return math.Round(rate*100*100) / 100
+}
+
+// Allocate divides each tax into parts in proportion to weights that add back
+// up to it exactly, for spreading the taxes of a stay over its nights
+func (b TaxBreakdown) Allocate(weights []int64) []TaxBreakdown {
+	parts := make([]TaxBreakdown, len(weights))
+	for _, line := range b {
+		for i, amount := range line.Amount.Allocate(weights) {
+			part := line
+			part.Amount = amount
+			parts[i] = append(parts[i], part)
+		}
+	}
+	return parts
+}
+
+// Value stores the breakdown as JSON
+func (b TaxBreakdown) Value() (driver.Value, error) {
+	if b == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan reads a breakdown stored by Value
+func (b *TaxBreakdown) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*b = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into TaxBreakdown", value)
+	}
+	return json.Unmarshal(data, b)
+}
+
+// PercentRat returns a percent rate as an exact fraction, taking the rate to
+// two decimal places as Money.Percent does
+func PercentRat(rate float64) *big.Rat {
+	return big.NewRat(int64(math.Round(rate*100)), 10000)
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/IamMaheshGurung/privateOnsenBooking/controllers"
+	"github.com/IamMaheshGurung/privateOnsenBooking/middleware"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -14,9 +15,29 @@ func SetupRoutes(
 	roomController *controllers.RoomController,
 	bookingController *controllers.BookingController,
 	guestController *controllers.GuestController,
+	onsenController *controllers.OnsenController,
+	paymentController *controllers.PaymentController,
+	folioController *controllers.FolioController,
+	invoiceController *controllers.InvoiceController,
+	taxController *controllers.TaxController,
+	pricingController *controllers.PricingController,
+	promoController *controllers.PromoController,
+	cancellationController *controllers.CancellationController,
+	exchangeRateController *controllers.ExchangeRateController,
 ) {
+	// Every page needs the guest's display currency, so this goes first
+	SetupExchangeRateRoutes(app, exchangeRateController)
+
 	// Setup routes by category
 	SetupBookingRoutes(app, bookingController)
+	SetupOnsenRoutes(app, onsenController)
+	SetupPaymentRoutes(app, paymentController)
+	SetupFolioRoutes(app, folioController)
+	SetupInvoiceRoutes(app, invoiceController)
+	SetupTaxRoutes(app, taxController)
+	SetupPricingRoutes(app, pricingController)
+	SetupPromoRoutes(app, promoController)
+	SetupCancellationRoutes(app, cancellationController)
 	SetupBasicRoutes(app)
 	SetupPageRoutes(app)
 
@@ -26,7 +47,7 @@ func SetupRoutes(
 	SetupRoomRoutes(app, roomController)
 	SetupDiningRoutes(app)
 	SetupAdminRoutes(app)
-	SetupAPIRoutes(app)
+	SetupAPIRoutes(app, bookingController)
 
 }
 
@@ -312,16 +333,9 @@ func SetupDiningRoutes(app *fiber.App) {
 // setupBookingRoutes configures booking-related routes
 func SetupBookingRoutes(app *fiber.App, bookingController *controllers.BookingController) {
 	app.Get("/booking", func(c *fiber.Ctx) error {
-
-		fmt.Println("Attempting to render booking/index template")
-		err := c.Render("booking/form", fiber.Map{})
-
-		if err != nil {
-			fmt.Println("ERROR rendering template:", err)
-			return c.Status(500).SendString("Template error: " + err.Error())
-		}
-
-		return nil
+		return c.Render("booking/form", fiber.Map{
+			"PromoCode": c.Query("promo"), // Offer emails link here with their code
+		})
 	})
 
 	// Availability check - updated to handle form data
@@ -355,15 +369,156 @@ func SetupBookingRoutes(app *fiber.App, bookingController *controllers.BookingCo
 
 	app.Post("/booking", bookingController.CreateBookingFromForm)
 	app.Get("/booking/check-availability", bookingController.CheckRoomAvailability)
+	// Booking summary and payment
+	app.Get("/booking/summary/:id", bookingController.ShowBookingSummary)
+	app.Post("/booking/payment/:id", bookingController.ProcessPayment)
 	// Booking confirmation
-	app.Get("/booking/confirmation/:id", func(c *fiber.Ctx) error {
-		bookingID := c.Params("id")
-		return c.Render("booking/confirmation", fiber.Map{
-			"Title":       "Booking Confirmation | Kwangdi Pahuna Ghar",
-			"BookingID":   bookingID,
+	app.Get("/booking/confirmation/:id", bookingController.ShowConfirmation)
+
+	// Guest booking lookup
+	app.Get("/booking/lookup", func(c *fiber.Ctx) error {
+		return c.Render("booking/lookup", fiber.Map{
+			"Title":       "Find Your Booking | Kwangdi Pahuna Ghar",
 			"CurrentYear": time.Now().Year(),
 		})
 	})
+	app.Post("/booking/lookup", bookingController.LookupBooking)
+
+	// Front desk
+	admin := app.Group("/api/admin/bookings", middleware.AdminAuth())
+	admin.Put("/:id/check-in", bookingController.CheckInGuest)
+	admin.Put("/:id/check-out", bookingController.CheckOutGuest)
+	admin.Put("/:id/status", bookingController.ChangeBookingStatus)
+	admin.Get("/:id/transitions", bookingController.GetBookingTransitions)
+	admin.Post("/:id/changes/preview", bookingController.PreviewBookingChange)
+	admin.Post("/:id/changes", bookingController.ChangeBooking)
+	admin.Get("/:id/changes", bookingController.GetBookingChanges)
+}
+
+// SetupPaymentRoutes configures payment provider callbacks
+func SetupPaymentRoutes(app *fiber.App, paymentController *controllers.PaymentController) {
+	app.Post("/api/v1/payments/webhook/:provider", paymentController.HandleWebhook)
+
+	// Front desk
+	admin := app.Group("/api/admin", middleware.AdminAuth())
+	admin.Get("/bookings/:id/balance", paymentController.GetBalance)
+	admin.Post("/bookings/:id/payments", paymentController.RecordPayment)
+	admin.Get("/deposit-rules", paymentController.GetDepositRules)
+	admin.Put("/deposit-rules/:roomType", paymentController.SetDepositRule)
+	admin.Get("/refunds", paymentController.GetRefunds)
+	admin.Post("/refunds/:id/process", paymentController.ProcessRefund)
+	admin.Post("/refunds/:id/manual", paymentController.MarkRefundManual)
+
+	// Refund queue screen
+	app.Get("/admin/refunds", middleware.AdminAuth(), paymentController.ShowRefundQueue)
+}
+
+// SetupFolioRoutes configures the guest folio routes
+func SetupFolioRoutes(app *fiber.App, folioController *controllers.FolioController) {
+	// Front desk
+	admin := app.Group("/api/admin/bookings", middleware.AdminAuth())
+	admin.Get("/:id/folio", folioController.GetFolio)
+	admin.Post("/:id/folio/items", folioController.PostCharge)
+	admin.Delete("/:id/folio/items/:itemId", folioController.VoidItem)
+}
+
+// SetupInvoiceRoutes configures invoice download routes
+func SetupInvoiceRoutes(app *fiber.App, invoiceController *controllers.InvoiceController) {
+	// Guests prove ownership with their email and booking reference
+	app.Post("/booking/invoice", invoiceController.DownloadGuestInvoice)
+
+	// Front desk
+	admin := app.Group("/api/admin/bookings", middleware.AdminAuth())
+	admin.Get("/:id/invoice", invoiceController.DownloadInvoice)
+}
+
+// SetupTaxRoutes configures tax rule management and tax reports
+func SetupTaxRoutes(app *fiber.App, taxController *controllers.TaxController) {
+	admin := app.Group("/api/admin", middleware.AdminAuth())
+	admin.Get("/tax-rules", taxController.GetRules)
+	admin.Put("/tax-rules/:code", taxController.SetRule)
+	admin.Get("/reports/tax", taxController.GetReport)
+}
+
+// SetupPricingRoutes configures room price quotes, rate plan and stay rule
+// management
+func SetupPricingRoutes(app *fiber.App, pricingController *controllers.PricingController) {
+	app.Get("/api/rooms/:id/price", pricingController.GetRoomPrice)
+
+	// Rate plan management
+	admin := app.Group("/api/admin/rate-plans", middleware.AdminAuth())
+	admin.Get("/", pricingController.GetRatePlans)
+	admin.Post("/", pricingController.CreateRatePlan)
+	admin.Put("/:id", pricingController.UpdateRatePlan)
+	admin.Delete("/:id", pricingController.DeleteRatePlan)
+
+	// Stay rule management
+	stayRules := app.Group("/api/admin/stay-rules", middleware.AdminAuth())
+	stayRules.Get("/", pricingController.GetStayRules)
+	stayRules.Post("/", pricingController.CreateStayRule)
+	stayRules.Put("/:id", pricingController.UpdateStayRule)
+	stayRules.Delete("/:id", pricingController.DeleteStayRule)
+}
+
+// SetupPromoRoutes configures promo code management
+func SetupPromoRoutes(app *fiber.App, promoController *controllers.PromoController) {
+	admin := app.Group("/api/admin/promo-codes", middleware.AdminAuth())
+	admin.Get("/", promoController.GetPromoCodes)
+	admin.Post("/", promoController.CreatePromoCode)
+	admin.Put("/:id", promoController.UpdatePromoCode)
+	admin.Delete("/:id", promoController.DeactivatePromoCode)
+	admin.Get("/:id/redemptions", promoController.GetRedemptions)
+}
+
+// SetupCancellationRoutes configures cancellation policy management
+func SetupCancellationRoutes(app *fiber.App, cancellationController *controllers.CancellationController) {
+	admin := app.Group("/api/admin/cancellation-policies", middleware.AdminAuth())
+	admin.Get("/", cancellationController.GetPolicies)
+	admin.Post("/", cancellationController.CreatePolicy)
+	admin.Put("/:id", cancellationController.UpdatePolicy)
+	admin.Delete("/:id", cancellationController.DeactivatePolicy)
+}
+
+// SetupExchangeRateRoutes configures the display currency and exchange rate routes
+func SetupExchangeRateRoutes(app *fiber.App, exchangeRateController *controllers.ExchangeRateController) {
+	app.Use(exchangeRateController.DisplayCurrency)
+
+	// Guests pick the currency prices are shown in
+	app.Post("/currency", exchangeRateController.SetDisplayCurrency)
+
+	// Rate table management
+	admin := app.Group("/api/admin/exchange-rates", middleware.AdminAuth())
+	admin.Get("/", exchangeRateController.GetRates)
+	admin.Post("/", exchangeRateController.SetRate)
+	admin.Post("/reload", exchangeRateController.ReloadRates)
+}
+
+// SetupOnsenRoutes configures private onsen booking routes
+func SetupOnsenRoutes(app *fiber.App, onsenController *controllers.OnsenController) {
+	// HTMX pages and fragments
+	app.Get("/onsen-booking", onsenController.ShowOnsenBookingForm)
+	app.Post("/onsen-booking/cancel/:id", onsenController.CancelOnsenBooking)
+
+	// Slot lookup and booking endpoints, shared by HTMX and JSON clients
+	onsen := app.Group("/api/onsen")
+	onsen.Get("/onsens", onsenController.ListOnsens)
+	onsen.Get("/onsens/:id/schedule", onsenController.GetDailySchedule)
+	onsen.Get("/slots", onsenController.GetAvailableSlots)
+	onsen.Post("/bookings", onsenController.CreateOnsenBooking)
+	onsen.Put("/bookings/:id/cancel", onsenController.CancelOnsenBooking)
+
+	// Bookings with guest details and schedule management
+	admin := app.Group("/api/admin/onsen", middleware.AdminAuth())
+	admin.Get("/bookings", onsenController.GetOnsenBookingsByDate)
+	admin.Get("/bookings/:id", onsenController.GetOnsenBooking)
+	admin.Put("/:id/layout", onsenController.UpdateSessionLayout)
+	admin.Get("/:id/hours", onsenController.GetOpeningHours)
+	admin.Put("/:id/hours/:weekday", onsenController.SetOpeningHours)
+	admin.Get("/closures", onsenController.GetClosures)
+	admin.Post("/closures", onsenController.AddClosure)
+	admin.Delete("/closures/:id", onsenController.RemoveClosure)
+	admin.Get("/entitlements", onsenController.GetEntitlements)
+	admin.Put("/entitlements/:roomType", onsenController.SetEntitlement)
 }
 
 // setupGalleryRoutes configures photo gallery routes
@@ -490,24 +645,14 @@ func SetupAdminRoutes(app *fiber.App) {
 }
 
 // setupAPIRoutes configures API endpoints (separate from web routes)
-func SetupAPIRoutes(app *fiber.App) {
+func SetupAPIRoutes(app *fiber.App, bookingController *controllers.BookingController) {
 	api := app.Group("/api")
 
 	// API version group
 	v1 := api.Group("/v1")
 
-	// Room availability API
-	v1.Get("/rooms/available", func(c *fiber.Ctx) error {
-		// In a real app, you would check room availability from a database
-		return c.JSON(fiber.Map{
-			"success": true,
-			"data": []fiber.Map{
-				{"id": "1", "type": "standard", "available": true, "price": 2500},
-				{"id": "2", "type": "deluxe", "available": true, "price": 4000},
-				{"id": "3", "type": "family", "available": false, "price": 6000},
-			},
-		})
-	})
+	// Room availability API, priced for the stay
+	v1.Get("/rooms/available", bookingController.GetAvailableRooms)
 
 	// Room booking API
 	v1.Post("/bookings", func(c *fiber.Ctx) error {
@@ -0,0 +1,483 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Booking modification errors that callers can tell apart
+var (
+	ErrBookingNotModifiable = errors.New("booking cannot be modified")
+	ErrInvalidBookingChange = errors.New("invalid booking change")
+	ErrNoBookingChanges     = errors.New("booking change changes nothing")
+)
+
+// modifiableBookingStatuses are the statuses of bookings that can still be
+// modified: guests who have arrived, left or cancelled cannot move their stay
+var modifiableBookingStatuses = map[string]bool{
+	models.BookingStatusPending:   true,
+	models.BookingStatusConfirmed: true,
+}
+
+// BookingModification is a change to a booking. Zero fields are left as
+// they are.
+type BookingModification struct {
+	RoomID          uint
+	CheckIn         time.Time
+	CheckOut        time.Time
+	Occupancy       *models.Occupancy
+	SpecialRequests *string
+	Status          string // Moved to along with the change, e.g. checked_in
+}
+
+// ModificationQuote is what a booking would be after a modification and how
+// its price would change
+type ModificationQuote struct {
+	BookingID       uint                `json:"booking_id"`
+	RoomID          uint                `json:"room_id"`
+	CheckIn         time.Time           `json:"check_in"`
+	CheckOut        time.Time           `json:"check_out"`
+	Occupancy       models.Occupancy    `json:"occupancy"`
+	SpecialRequests string              `json:"special_requests"`
+	Status          string              `json:"status"`
+	Nights          models.NightRates   `json:"nights"`
+	PromoCodes      string              `json:"promo_codes"` // Codes redeemed when booked that still apply
+	Discount        models.Money        `json:"discount"`    // Discount of those codes on the changed stay
+	RoomTotal       models.Money        `json:"room_total"`  // Room charges before tax, after the discount
+	Taxes           models.TaxBreakdown `json:"taxes"`
+	Tax             models.Money        `json:"tax"`
+	TotalBefore     models.Money        `json:"total_before"` // Amount due now, room charges and taxes
+	TotalAfter      models.Money        `json:"total_after"`  // Amount due after the change
+	Difference      models.Money        `json:"difference"`   // Negative when the stay gets cheaper
+	Changes         models.FieldChanges `json:"changes"`
+
+	// Onsen sessions outside the changed stay, which the change cancels
+	CancelledSessions []models.OnsenBooking `json:"cancelled_onsen_sessions,omitempty"`
+
+	discount *PromoDiscount // Set when the stay is repriced
+}
+
+// BookingModificationService changes the room, dates, guests and requests of
+// bookings, repricing them and keeping a log of each change
+type BookingModificationService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	rooms    *RoomBookingService
+	pricing  *PricingService
+	taxes    *TaxService
+	promos   *PromoService
+	payments *PaymentService
+	onsen    *OnsenBookingService
+	email    *EmailService
+}
+
+// NewBookingModificationService creates a new instance of BookingModificationService
+func NewBookingModificationService(db *gorm.DB, logger *zap.Logger, rooms *RoomBookingService, pricing *PricingService, taxes *TaxService, promos *PromoService, payments *PaymentService, onsen *OnsenBookingService, email *EmailService) *BookingModificationService {
+	return &BookingModificationService{
+		db:       db,
+		logger:   logger,
+		rooms:    rooms,
+		pricing:  pricing,
+		taxes:    taxes,
+		promos:   promos,
+		payments: payments,
+		onsen:    onsen,
+		email:    email,
+	}
+}
+
+// Preview works out what a booking would be after a modification and what it
+// would then cost, without changing it
+func (bms *BookingModificationService) Preview(bookingID uint, modification BookingModification) (*ModificationQuote, error) {
+	var booking models.RoomBooking
+	if err := bms.db.First(&booking, bookingID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("booking not found")
+		}
+		return nil, fmt.Errorf("failed to find booking: %w", err)
+	}
+
+	return bms.quote(bms.db, &booking, modification)
+}
+
+// Modify applies a modification to a booking, repricing it, and records the
+// change with actor and reason. Its promo discount, deposit and onsen sessions
+// follow the change, and a new status is moved to in the same transaction.
+// The guest is emailed what changed.
+func (bms *BookingModificationService) Modify(bookingID uint, modification BookingModification, actor, reason string) (*models.BookingChange, error) {
+	if actor = strings.TrimSpace(actor); actor == "" {
+		actor = models.BookingActorStaff
+	}
+
+	var change models.BookingChange
+	err := bms.db.Transaction(func(tx *gorm.DB) error {
+		var booking models.RoomBooking
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, bookingID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("booking not found")
+			}
+			return fmt.Errorf("failed to find booking: %w", err)
+		}
+
+		// Lock the room moved to so a concurrent booking cannot take the new dates
+		roomID := booking.RoomID
+		if modification.RoomID != 0 {
+			roomID = modification.RoomID
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Room{}, roomID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: room not found", ErrInvalidBookingChange)
+			}
+			return fmt.Errorf("failed to lock room: %w", err)
+		}
+
+		quote, err := bms.quote(tx, &booking, modification)
+		if err != nil {
+			return err
+		}
+		if len(quote.Changes) == 0 {
+			return ErrNoBookingChanges
+		}
+
+		taxAmount := quote.Taxes.Total(quote.RoomTotal.Currency)
+
+		if err := tx.Model(&booking).Updates(map[string]interface{}{
+			"room_id":                  quote.RoomID,
+			"check_in":                 quote.CheckIn,
+			"check_out":                quote.CheckOut,
+			"guest_count":              quote.Occupancy.Guests(),
+			"adults":                   quote.Occupancy.Adults,
+			"children":                 quote.Occupancy.Children,
+			"infants":                  quote.Occupancy.Infants,
+			"special_requests":         quote.SpecialRequests,
+			"nightly_rates":            quote.Nights,
+			"promo_codes":              quote.PromoCodes,
+			"discount_amount_minor":    quote.Discount.Minor,
+			"discount_amount_currency": quote.Discount.Currency,
+			"total_price_minor":        quote.RoomTotal.Minor,
+			"total_price_currency":     quote.RoomTotal.Currency,
+			"tax_amount_minor":         taxAmount.Minor,
+			"tax_amount_currency":      taxAmount.Currency,
+			"taxes":                    quote.Taxes,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update booking: %w", err)
+		}
+
+		if quote.discount != nil {
+			if err := bms.promos.updateRedemptions(tx, bookingID, quote.discount); err != nil {
+				return err
+			}
+		}
+
+		if err := bms.onsen.cancelSessions(tx, quote.CancelledSessions); err != nil {
+			return err
+		}
+		if quote.RoomID != booking.RoomID {
+			// The sessions left go with the guest to the new room
+			if err := tx.Model(&models.OnsenBooking{}).
+				Where("booking_id = ? AND status = ?", bookingID, models.BookingStatusConfirmed).
+				Update("room_id", quote.RoomID).Error; err != nil {
+				return fmt.Errorf("failed to move onsen sessions: %w", err)
+			}
+		}
+
+		if _, err := bms.payments.applyDepositRule(tx, bookingID); err != nil {
+			return err
+		}
+
+		if quote.Status != booking.Status {
+			if err := tx.First(&booking, bookingID).Error; err != nil {
+				return fmt.Errorf("failed to find booking: %w", err)
+			}
+			if _, err := bms.rooms.changeStatus(tx, &booking, quote.Status, actor, reason); err != nil {
+				return err
+			}
+		}
+
+		var version int
+		if err := tx.Model(&models.BookingChange{}).
+			Where("booking_id = ?", bookingID).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&version).Error; err != nil {
+			return fmt.Errorf("failed to number booking change: %w", err)
+		}
+
+		change = models.BookingChange{
+			BookingID:   bookingID,
+			Version:     version + 1,
+			Changes:     quote.Changes,
+			TotalBefore: quote.TotalBefore,
+			TotalAfter:  quote.TotalAfter,
+			Actor:       actor,
+			Reason:      reason,
+		}
+		if err := tx.Create(&change).Error; err != nil {
+			return fmt.Errorf("failed to record booking change: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		bms.logger.Warn("failed to modify booking", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, err
+	}
+
+	bms.logger.Info("booking modified",
+		zap.Uint("bookingID", bookingID),
+		zap.Int("version", change.Version),
+		zap.String("actor", actor))
+
+	// Tell the guest; the booking has been changed whether or not the email goes out
+	if bms.email != nil {
+		if booking, err := bms.rooms.GetBookingByID(bookingID); err == nil {
+			if err := bms.email.SendBookingChangeNotice(booking, &booking.Guest, &booking.Room, &change); err != nil {
+				bms.logger.Warn("failed to send booking change email", zap.Uint("bookingID", bookingID), zap.Error(err))
+			}
+		}
+	}
+
+	return &change, nil
+}
+
+// GetChanges returns the modifications of a booking, oldest first
+func (bms *BookingModificationService) GetChanges(bookingID uint) ([]models.BookingChange, error) {
+	var changes []models.BookingChange
+	if err := bms.db.Where("booking_id = ?", bookingID).
+		Order("version ASC").
+		Find(&changes).Error; err != nil {
+		bms.logger.Error("failed to get booking changes", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get booking changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+// quote checks a modification of booking against db and prices it. The stay
+// is only repriced when the room, dates or guests change, and then the promo
+// codes redeemed when booked are checked and worked out again.
+func (bms *BookingModificationService) quote(db *gorm.DB, booking *models.RoomBooking, modification BookingModification) (*ModificationQuote, error) {
+	if !modifiableBookingStatuses[booking.Status] {
+		return nil, fmt.Errorf("%w: it is %s", ErrBookingNotModifiable, booking.Status)
+	}
+
+	quote := &ModificationQuote{
+		BookingID:       booking.ID,
+		RoomID:          booking.RoomID,
+		CheckIn:         booking.CheckIn,
+		CheckOut:        booking.CheckOut,
+		Occupancy:       BookingOccupancy(booking),
+		SpecialRequests: booking.SpecialRequests,
+		Status:          booking.Status,
+		Nights:          booking.NightlyRates,
+		PromoCodes:      booking.PromoCodes,
+		Discount:        booking.DiscountAmount,
+		RoomTotal:       booking.TotalPrice,
+		Taxes:           booking.Taxes,
+	}
+	if modification.RoomID != 0 {
+		quote.RoomID = modification.RoomID
+	}
+	if !modification.CheckIn.IsZero() {
+		quote.CheckIn = modification.CheckIn
+	}
+	if !modification.CheckOut.IsZero() {
+		quote.CheckOut = modification.CheckOut
+	}
+	if modification.Occupancy != nil {
+		quote.Occupancy = *modification.Occupancy
+	}
+	if modification.SpecialRequests != nil {
+		quote.SpecialRequests = strings.TrimSpace(*modification.SpecialRequests)
+	}
+	if modification.Status != "" && modification.Status != booking.Status {
+		if err := CheckTransition(booking, modification.Status); err != nil {
+			return nil, err
+		}
+		quote.Status = modification.Status
+	}
+
+	var oldRoom, room models.Room
+	if err := db.First(&oldRoom, booking.RoomID).Error; err != nil {
+		return nil, fmt.Errorf("failed to find room: %w", err)
+	}
+	room = oldRoom
+	if quote.RoomID != booking.RoomID {
+		if err := db.First(&room, quote.RoomID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: room not found", ErrInvalidBookingChange)
+			}
+			return nil, fmt.Errorf("failed to find room: %w", err)
+		}
+		if room.Status != "active" {
+			return nil, fmt.Errorf("%w: room %s is not taking bookings", ErrInvalidBookingChange, room.RoomNo)
+		}
+	}
+
+	roomChanged := quote.RoomID != booking.RoomID
+	datesChanged := !quote.CheckIn.Equal(booking.CheckIn) || !quote.CheckOut.Equal(booking.CheckOut)
+	occupancyChanged := quote.Occupancy != BookingOccupancy(booking)
+
+	if !quote.CheckOut.After(quote.CheckIn) {
+		return nil, fmt.Errorf("%w: check-out must be after check-in", ErrInvalidBookingChange)
+	}
+	if !quote.CheckIn.Equal(booking.CheckIn) && quote.CheckIn.Before(today()) {
+		return nil, fmt.Errorf("%w: check-in cannot be in the past", ErrInvalidBookingChange)
+	}
+
+	if roomChanged || occupancyChanged {
+		if err := bms.pricing.CheckOccupancy(&room, quote.Occupancy); err != nil {
+			return nil, err
+		}
+	}
+
+	if roomChanged || datesChanged {
+		if err := bms.pricing.CheckStay(&room, quote.CheckIn, quote.CheckOut); err != nil {
+			return nil, err
+		}
+
+		available, err := bms.rooms.roomAvailableForUpdate(db, quote.RoomID, booking.ID, quote.CheckIn, quote.CheckOut)
+		if err != nil {
+			return nil, err
+		}
+		if !available {
+			return nil, ErrRoomUnavailable
+		}
+	}
+
+	if roomChanged || datesChanged || occupancyChanged {
+		stay, err := bms.pricing.PriceStay(&room, quote.CheckIn, quote.CheckOut, quote.Occupancy)
+		if err != nil {
+			return nil, err
+		}
+
+		discount, err := bms.promos.rediscount(db, booking.ID, &room, len(stay.Nights), stay.Total)
+		if err != nil {
+			return nil, err
+		}
+
+		quote.Nights = stay.Nights
+		quote.PromoCodes = discount.Codes()
+		quote.Discount = discount.Total
+		quote.discount = discount
+		taxQuote, err := bms.taxes.Quote(models.FolioCategoryRoomNight, stay.Total.Sub(quote.Discount))
+		if err != nil {
+			return nil, err
+		}
+		quote.RoomTotal = taxQuote.Net
+		quote.Taxes = taxQuote.Taxes
+	}
+
+	if datesChanged {
+		sessions, err := bms.onsen.staySessions(db, booking.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		quote.CancelledSessions = sessionsOutside(sessions, quote.CheckIn, quote.CheckOut)
+	}
+
+	summarizeQuote(quote, booking, &oldRoom, &room)
+	return quote, nil
+}
+
+// sessionsOutside returns the onsen sessions that fall outside a stay from
+// checkIn to checkOut. Sessions can be booked from the day of arrival to the
+// day of departure.
+func sessionsOutside(sessions []models.OnsenBooking, checkIn, checkOut time.Time) []models.OnsenBooking {
+	var outside []models.OnsenBooking
+	for _, session := range sessions {
+		day := stayDay(session.Date)
+		if day.Before(stayDay(checkIn)) || day.After(stayDay(checkOut)) {
+			outside = append(outside, session)
+		}
+	}
+	return outside
+}
+
+// summarizeQuote works out the totals of a booking before and after a quoted
+// modification and lists what it changes, oldRoom being the booking's room and
+// room the one it moves to
+func summarizeQuote(quote *ModificationQuote, booking *models.RoomBooking, oldRoom, room *models.Room) {
+	roomChanged := quote.RoomID != booking.RoomID
+	occupancyChanged := quote.Occupancy != BookingOccupancy(booking)
+
+	_, _, quote.TotalBefore = BookingTotals(booking)
+	repriced := *booking
+	repriced.TotalPrice = quote.RoomTotal
+	repriced.TaxAmount = quote.Taxes.Total(quote.RoomTotal.Currency)
+	repriced.Taxes = quote.Taxes
+	_, quote.Tax, quote.TotalAfter = BookingTotals(&repriced)
+	quote.Difference = quote.TotalAfter.Sub(quote.TotalBefore)
+
+	if roomChanged {
+		quote.Changes = append(quote.Changes, models.FieldChange{Field: models.BookingFieldRoom, Old: roomText(oldRoom), New: roomText(room)})
+	}
+	if !quote.CheckIn.Equal(booking.CheckIn) {
+		quote.Changes = append(quote.Changes, models.FieldChange{Field: models.BookingFieldCheckIn, Old: booking.CheckIn.Format("2006-01-02"), New: quote.CheckIn.Format("2006-01-02")})
+	}
+	if !quote.CheckOut.Equal(booking.CheckOut) {
+		quote.Changes = append(quote.Changes, models.FieldChange{Field: models.BookingFieldCheckOut, Old: booking.CheckOut.Format("2006-01-02"), New: quote.CheckOut.Format("2006-01-02")})
+	}
+	if occupancyChanged {
+		quote.Changes = append(quote.Changes, models.FieldChange{Field: models.BookingFieldOccupancy, Old: occupancyText(BookingOccupancy(booking)), New: occupancyText(quote.Occupancy)})
+	}
+	if quote.SpecialRequests != booking.SpecialRequests {
+		quote.Changes = append(quote.Changes, models.FieldChange{Field: models.BookingFieldSpecialRequests, Old: booking.SpecialRequests, New: quote.SpecialRequests})
+	}
+	if quote.PromoCodes != booking.PromoCodes {
+		quote.Changes = append(quote.Changes, models.FieldChange{Field: models.BookingFieldPromoCodes, Old: booking.PromoCodes, New: quote.PromoCodes})
+	}
+	for i := range quote.CancelledSessions {
+		quote.Changes = append(quote.Changes, models.FieldChange{Field: models.BookingFieldOnsen, Old: onsenSessionText(&quote.CancelledSessions[i]), New: "Cancelled"})
+	}
+	if quote.Status != booking.Status {
+		quote.Changes = append(quote.Changes, models.FieldChange{Field: models.BookingFieldStatus, Old: booking.Status, New: quote.Status})
+	}
+	if quote.TotalAfter.Cmp(quote.TotalBefore) != 0 {
+		quote.Changes = append(quote.Changes, models.FieldChange{Field: models.BookingFieldTotal, Old: quote.TotalBefore.String(), New: quote.TotalAfter.String()})
+	}
+}
+
+// today returns midnight at the start of the current day in UTC, the zone
+// stay dates are parsed in
+func today() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// stayDay returns midnight at the start of the day of a stay date in UTC
+func stayDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// roomText names a room for a booking change, e.g. 101 (Deluxe)
+func roomText(room *models.Room) string {
+	return fmt.Sprintf("%s (%s)", room.RoomNo, room.Type)
+}
+
+// occupancyText writes who is staying, e.g. 2 adults, 1 child
+func occupancyText(occupancy models.Occupancy) string {
+	parts := []string{plural(occupancy.Adults, "adult", "adults")}
+	if occupancy.Children > 0 {
+		parts = append(parts, plural(occupancy.Children, "child", "children"))
+	}
+	if occupancy.Infants > 0 {
+		parts = append(parts, plural(occupancy.Infants, "infant", "infants"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// plural writes a count with the singular or plural noun
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+)
+
+// taxed returns the service charge and VAT on a room total
+func taxed(total int64) models.TaxBreakdown {
+	return addTax(nepalTaxRules, npr(total)).Taxes
+}
+
+func TestSummarizeQuote(t *testing.T) {
+	standard := &models.Room{ID: 1, RoomNo: "101", Type: "Standard"}
+	deluxe := &models.Room{ID: 2, RoomNo: "201", Type: "Deluxe"}
+
+	// Two nights at 20,000 with 4,860 in taxes
+	booking := &models.RoomBooking{
+		ID:              9,
+		RoomID:          standard.ID,
+		CheckIn:         day("2025-10-10"),
+		CheckOut:        day("2025-10-12"),
+		Adults:          2,
+		GuestCount:      2,
+		SpecialRequests: "Late arrival",
+		Status:          models.BookingStatusConfirmed,
+		TotalPrice:      npr(20000),
+		TaxAmount:       npr(4860),
+		Taxes:           taxed(20000),
+	}
+	// quote starts from the booking as it is, like BookingModificationService.quote
+	quote := func() *ModificationQuote {
+		return &ModificationQuote{
+			BookingID:       booking.ID,
+			RoomID:          booking.RoomID,
+			CheckIn:         booking.CheckIn,
+			CheckOut:        booking.CheckOut,
+			Occupancy:       BookingOccupancy(booking),
+			SpecialRequests: booking.SpecialRequests,
+			Status:          booking.Status,
+			RoomTotal:       booking.TotalPrice,
+			Taxes:           booking.Taxes,
+		}
+	}
+
+	t.Run("moved to a bigger room for longer", func(t *testing.T) {
+		q := quote()
+		q.RoomID = deluxe.ID
+		q.CheckOut = day("2025-10-13")
+		q.Occupancy = models.Occupancy{Adults: 2, Children: 1}
+		q.RoomTotal = npr(36000)
+		q.Taxes = taxed(36000)
+
+		summarizeQuote(q, booking, standard, deluxe)
+
+		if q.TotalBefore != npr(24860) || q.TotalAfter != npr(44748) || q.Difference != npr(19888) {
+			t.Errorf("expected 24,860 to 44,748, a difference of 19,888, got %s to %s, %s", q.TotalBefore, q.TotalAfter, q.Difference)
+		}
+		if q.Tax != npr(8748) {
+			t.Errorf("expected tax 8,748, got %s", q.Tax)
+		}
+		want := models.FieldChanges{
+			{Field: models.BookingFieldRoom, Old: "101 (Standard)", New: "201 (Deluxe)"},
+			{Field: models.BookingFieldCheckOut, Old: "2025-10-12", New: "2025-10-13"},
+			{Field: models.BookingFieldOccupancy, Old: "2 adults", New: "2 adults, 1 child"},
+			{Field: models.BookingFieldTotal, Old: npr(24860).String(), New: npr(44748).String()},
+		}
+		assertChanges(t, q.Changes, want)
+	})
+
+	t.Run("shortened stay is cheaper", func(t *testing.T) {
+		q := quote()
+		q.CheckOut = day("2025-10-11")
+		q.RoomTotal = npr(10000)
+		q.Taxes = taxed(10000)
+
+		summarizeQuote(q, booking, standard, standard)
+
+		if q.Difference != npr(-12430) {
+			t.Errorf("expected a difference of -12,430, got %s", q.Difference)
+		}
+		want := models.FieldChanges{
+			{Field: models.BookingFieldCheckOut, Old: "2025-10-12", New: "2025-10-11"},
+			{Field: models.BookingFieldTotal, Old: npr(24860).String(), New: npr(12430).String()},
+		}
+		assertChanges(t, q.Changes, want)
+	})
+
+	t.Run("requests and cancelled sessions only", func(t *testing.T) {
+		q := quote()
+		q.SpecialRequests = "Early arrival"
+		q.CancelledSessions = []models.OnsenBooking{
+			{Onsen: models.Onsen{Name: "Rotenburo"}, Date: day("2025-10-12"), TimeSlot: "18:00"},
+		}
+
+		summarizeQuote(q, booking, standard, standard)
+
+		if !q.Difference.IsZero() {
+			t.Errorf("expected no difference, got %s", q.Difference)
+		}
+		want := models.FieldChanges{
+			{Field: models.BookingFieldSpecialRequests, Old: "Late arrival", New: "Early arrival"},
+			{Field: models.BookingFieldOnsen, Old: "Rotenburo, 2025-10-12 18:00", New: "Cancelled"},
+		}
+		assertChanges(t, q.Changes, want)
+	})
+}
+
+// assertChanges fails the test unless got lists the want changes in order
+func assertChanges(t *testing.T, got, want models.FieldChanges) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i].Field != want[i].Field || got[i].Old != want[i].Old || got[i].New != want[i].New {
+			t.Errorf("expected %s from %q to %q, got %s from %q to %q",
+				want[i].Field, want[i].Old, want[i].New, got[i].Field, got[i].Old, got[i].New)
+		}
+	}
+}
+
+func TestSessionsOutside(t *testing.T) {
+	sessions := []models.OnsenBooking{
+		{ID: 1, Date: day("2025-10-09")},
+		{ID: 2, Date: day("2025-10-10")},
+		{ID: 3, Date: day("2025-10-12")},
+		{ID: 4, Date: day("2025-10-13")},
+	}
+
+	// Arrival and departure days keep their sessions
+	outside := sessionsOutside(sessions, day("2025-10-10"), day("2025-10-12"))
+	if len(outside) != 2 || outside[0].ID != 1 || outside[1].ID != 4 {
+		t.Fatalf("expected sessions 1 and 4 outside the stay, got %+v", outside)
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Booking status errors that callers can tell apart
+var (
+	ErrInvalidTransition    = errors.New("invalid booking status change")
+	ErrUnknownBookingStatus = errors.New("unknown booking status")
+)
+
+// bookingTransitions lists the statuses a booking may move to from each
+// status. Cancelled, rejected, expired, no-show and completed are final.
+var bookingTransitions = map[string][]string{
+	models.BookingStatusPending:    {models.BookingStatusConfirmed, models.BookingStatusCancelled, models.BookingStatusRejected, models.BookingStatusExpired},
+	models.BookingStatusConfirmed:  {models.BookingStatusCheckedIn, models.BookingStatusCancelled, models.BookingStatusNoShow},
+	models.BookingStatusCheckedIn:  {models.BookingStatusCheckedOut},
+	models.BookingStatusCheckedOut: {models.BookingStatusCompleted},
+}
+
+// bookingStatuses are every status a booking can be in
+var bookingStatuses = []string{
+	models.BookingStatusPending,
+	models.BookingStatusConfirmed,
+	models.BookingStatusCheckedIn,
+	models.BookingStatusCheckedOut,
+	models.BookingStatusCompleted,
+	models.BookingStatusCancelled,
+	models.BookingStatusRejected,
+	models.BookingStatusExpired,
+	models.BookingStatusNoShow,
+}
+
+// TransitionError is returned when a booking cannot move to a status from the
+// one it is in. It matches ErrInvalidTransition with errors.Is.
+type TransitionError struct {
+	BookingID uint
+	From      string
+	To        string
+}
+
+// Error describes the refused change, e.g. "cannot change booking 12 from cancelled to confirmed"
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot change booking %d from %s to %s", e.BookingID, e.From, e.To)
+}
+
+// Is makes errors.Is(err, ErrInvalidTransition) true
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// transitionBooking moves a booking locked in tx to status, along with any
+// other columns in updates, and records who made the change. It refuses
+// changes the booking state machine does not allow.
+func transitionBooking(tx *gorm.DB, booking *models.RoomBooking, status, actor, reason string, updates map[string]interface{}) error {
+	if !canTransitionBooking(booking.Status, status) {
+		return &TransitionError{BookingID: booking.ID, From: booking.Status, To: status}
+	}
+
+	if actor = strings.TrimSpace(actor); actor == "" {
+		actor = models.BookingActorSystem
+	}
+
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	updates["status"] = status
+	if err := tx.Model(booking).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update booking status: %w", err)
+	}
+
+	transition := models.BookingTransition{
+		BookingID:  booking.ID,
+		FromStatus: booking.Status,
+		ToStatus:   status,
+		Actor:      actor,
+		Reason:     reason,
+	}
+	if err := tx.Create(&transition).Error; err != nil {
+		return fmt.Errorf("failed to record booking status change: %w", err)
+	}
+
+	booking.Status = status
+	return nil
+}
+
+// CheckTransition returns an error if booking cannot move to status, for
+// checking a change before making others along with it
+func CheckTransition(booking *models.RoomBooking, status string) error {
+	if !isBookingStatus(status) {
+		return fmt.Errorf("%w: %s", ErrUnknownBookingStatus, status)
+	}
+	if !canTransitionBooking(booking.Status, status) {
+		return &TransitionError{BookingID: booking.ID, From: booking.Status, To: status}
+	}
+	return nil
+}
+
+// UpdateBookingStatus moves a booking to status, recording actor as who made
+// the change. Check-in, check-out and cancellation have their own methods,
+// which also record the times and fees that go with them.
+func (rbs *RoomBookingService) UpdateBookingStatus(bookingID uint, status, actor, reason string) error {
+	if !isBookingStatus(status) {
+		return fmt.Errorf("%w: %s", ErrUnknownBookingStatus, status)
+	}
+
+	err := rbs.db.Transaction(func(tx *gorm.DB) error {
+		var booking models.RoomBooking
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, bookingID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("booking not found")
+			}
+			return fmt.Errorf("failed to find booking: %w", err)
+		}
+
+		return transitionBooking(tx, &booking, status, actor, reason, nil)
+	})
+	if err != nil {
+		rbs.logger.Error("Failed to update booking status",
+			zap.Uint("bookingID", bookingID),
+			zap.String("status", status),
+			zap.Error(err))
+		return err
+	}
+
+	rbs.logger.Info("booking status changed",
+		zap.Uint("bookingID", bookingID),
+		zap.String("status", status),
+		zap.String("actor", actor))
+	return nil
+}
+
+// GetTransitions returns the status changes of a booking, oldest first
+func (rbs *RoomBookingService) GetTransitions(bookingID uint) ([]models.BookingTransition, error) {
+	var transitions []models.BookingTransition
+	if err := rbs.db.Where("booking_id = ?", bookingID).
+		Order("created_at ASC, id ASC").
+		Find(&transitions).Error; err != nil {
+		rbs.logger.Error("failed to get booking transitions", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get booking transitions: %w", err)
+	}
+
+	return transitions, nil
+}
+
+// canTransitionBooking reports whether a booking may move from one status to
+// another
+func canTransitionBooking(from, to string) bool {
+	for _, allowed := range bookingTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// isBookingStatus reports whether status is a known booking status
+func isBookingStatus(status string) bool {
+	for _, known := range bookingStatuses {
+		if known == status {
+			return true
+		}
+	}
+	return false
+}
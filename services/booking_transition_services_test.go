@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+)
+
+func TestBookingTransitions(t *testing.T) {
+	allowed := map[[2]string]bool{
+		{models.BookingStatusPending, models.BookingStatusConfirmed}:    true,
+		{models.BookingStatusPending, models.BookingStatusCancelled}:    true,
+		{models.BookingStatusPending, models.BookingStatusRejected}:     true,
+		{models.BookingStatusPending, models.BookingStatusExpired}:      true,
+		{models.BookingStatusConfirmed, models.BookingStatusCheckedIn}:  true,
+		{models.BookingStatusConfirmed, models.BookingStatusCancelled}:  true,
+		{models.BookingStatusConfirmed, models.BookingStatusNoShow}:     true,
+		{models.BookingStatusCheckedIn, models.BookingStatusCheckedOut}: true,
+		{models.BookingStatusCheckedOut, models.BookingStatusCompleted}: true,
+	}
+
+	// Every pair of statuses, so a change to the table shows up here
+	for _, from := range bookingStatuses {
+		for _, to := range bookingStatuses {
+			want := allowed[[2]string{from, to}]
+			if got := canTransitionBooking(from, to); got != want {
+				t.Errorf("%s to %s: expected allowed=%v, got %v", from, to, want, got)
+			}
+		}
+	}
+}
+
+func TestCheckTransition(t *testing.T) {
+	booking := &models.RoomBooking{ID: 12, Status: models.BookingStatusCancelled}
+
+	err := CheckTransition(booking, models.BookingStatusConfirmed)
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition, got %v", err)
+	}
+	if err.Error() != "cannot change booking 12 from cancelled to confirmed" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+
+	if err := CheckTransition(booking, "archived"); !errors.Is(err, ErrUnknownBookingStatus) {
+		t.Fatalf("expected ErrUnknownBookingStatus, got %v", err)
+	}
+
+	booking.Status = models.BookingStatusPending
+	if err := CheckTransition(booking, models.BookingStatusConfirmed); err != nil {
+		t.Fatalf("expected pending to confirmed to be allowed, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Cancellation policy errors that callers can tell apart
+var (
+	ErrCancellationPolicyNotFound = errors.New("cancellation policy not found")
+	ErrInvalidCancellationPolicy  = errors.New("invalid cancellation policy")
+)
+
+// CancellationService manages cancellation policies and works out which one
+// a booking is made on
+type CancellationService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewCancellationService creates a new instance of CancellationService
+func NewCancellationService(db *gorm.DB, logger *zap.Logger) *CancellationService {
+	return &CancellationService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// BookingTerms returns the cancellation terms for a stay in room arriving on
+// checkIn: the policy of the highest priority rate plan covering the
+// check-in night that sets one, else the default policy, else the standard
+// terms
+func (cs *CancellationService) BookingTerms(room *models.Room, checkIn time.Time) (models.CancellationTerms, error) {
+	night := time.Date(checkIn.Year(), checkIn.Month(), checkIn.Day(), 0, 0, 0, 0, time.UTC)
+
+	var plans []models.RatePlan
+	if err := cs.db.Where("active = ? AND cancellation_policy_id IS NOT NULL", true).
+		Where("(recurring = ? OR (start_date <= ? AND end_date >= ?))", true, night, night).
+		Order("priority DESC, id ASC").
+		Find(&plans).Error; err != nil {
+		cs.logger.Error("failed to get rate plans", zap.Error(err))
+		return models.CancellationTerms{}, fmt.Errorf("failed to get rate plans: %w", err)
+	}
+
+	for i := range plans {
+		if !planCovers(&plans[i], room, night) {
+			continue
+		}
+
+		var policy models.CancellationPolicy
+		err := cs.db.Where("id = ? AND active = ?", *plans[i].CancellationPolicyID, true).First(&policy).Error
+		if err == nil {
+			return policy.Terms(), nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.CancellationTerms{}, fmt.Errorf("failed to get cancellation policy: %w", err)
+		}
+	}
+
+	var policy models.CancellationPolicy
+	err := cs.db.Where("\"default\" = ? AND active = ?", true, true).First(&policy).Error
+	if err == nil {
+		return policy.Terms(), nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.CancellationTerms{}, fmt.Errorf("failed to get default cancellation policy: %w", err)
+	}
+
+	return models.StandardCancellationTerms(), nil
+}
+
+// GetPolicies returns every cancellation policy
+func (cs *CancellationService) GetPolicies() ([]models.CancellationPolicy, error) {
+	var policies []models.CancellationPolicy
+	if err := cs.db.Order("name ASC").Find(&policies).Error; err != nil {
+		cs.logger.Error("failed to get cancellation policies", zap.Error(err))
+		return nil, fmt.Errorf("failed to get cancellation policies: %w", err)
+	}
+
+	return policies, nil
+}
+
+// SavePolicy creates a cancellation policy, or updates it when it has an ID.
+// Bookings already made keep the terms they were made on. Making a policy the
+// default takes that from the previous default.
+func (cs *CancellationService) SavePolicy(policy *models.CancellationPolicy) error {
+	if err := validatePolicy(policy); err != nil {
+		return err
+	}
+
+	err := cs.db.Transaction(func(tx *gorm.DB) error {
+		if policy.ID != 0 {
+			var existing models.CancellationPolicy
+			if err := tx.First(&existing, policy.ID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrCancellationPolicyNotFound
+				}
+				return fmt.Errorf("failed to find cancellation policy: %w", err)
+			}
+			policy.CreatedAt = existing.CreatedAt
+		}
+
+		if policy.Default {
+			if err := tx.Model(&models.CancellationPolicy{}).
+				Where("\"default\" = ? AND id <> ?", true, policy.ID).
+				Update("default", false).Error; err != nil {
+				return fmt.Errorf("failed to clear default cancellation policy: %w", err)
+			}
+		}
+
+		if err := tx.Save(policy).Error; err != nil {
+			return fmt.Errorf("failed to save cancellation policy: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		cs.logger.Error("failed to save cancellation policy", zap.String("name", policy.Name), zap.Error(err))
+		return err
+	}
+
+	cs.logger.Info("cancellation policy saved", zap.Uint("policyID", policy.ID), zap.String("name", policy.Name))
+	return nil
+}
+
+// DeactivatePolicy stops a cancellation policy being given to new bookings.
+// Rate plans that set it fall back to the default policy.
+func (cs *CancellationService) DeactivatePolicy(id uint) error {
+	result := cs.db.Model(&models.CancellationPolicy{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"active": false, "default": false})
+	if result.Error != nil {
+		cs.logger.Error("failed to deactivate cancellation policy", zap.Uint("policyID", id), zap.Error(result.Error))
+		return fmt.Errorf("failed to deactivate cancellation policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrCancellationPolicyNotFound
+	}
+
+	return nil
+}
+
+// validatePolicy checks a cancellation policy and sorts its tiers furthest
+// from check-in first
+func validatePolicy(policy *models.CancellationPolicy) error {
+	policy.Name = strings.TrimSpace(policy.Name)
+	if policy.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidCancellationPolicy)
+	}
+
+	if policy.NonRefundable {
+		if len(policy.Tiers) > 0 || policy.NoShowFeePercent != 0 {
+			return fmt.Errorf("%w: a non-refundable policy has no tiers or no-show fee", ErrInvalidCancellationPolicy)
+		}
+		return nil
+	}
+
+	if policy.NoShowFeePercent < 0 || policy.NoShowFeePercent > 100 {
+		return fmt.Errorf("%w: no-show fee percent must be from 0 to 100", ErrInvalidCancellationPolicy)
+	}
+
+	sort.Slice(policy.Tiers, func(i, j int) bool {
+		return policy.Tiers[i].HoursBefore > policy.Tiers[j].HoursBefore
+	})
+
+	for i, tier := range policy.Tiers {
+		if tier.HoursBefore <= 0 {
+			return fmt.Errorf("%w: hours before check-in must be positive", ErrInvalidCancellationPolicy)
+		}
+		if tier.FeePercent <= 0 || tier.FeePercent > 100 {
+			return fmt.Errorf("%w: fee percent must be more than 0 and at most 100", ErrInvalidCancellationPolicy)
+		}
+		if i > 0 {
+			previous := policy.Tiers[i-1]
+			if tier.HoursBefore == previous.HoursBefore {
+				return fmt.Errorf("%w: two tiers start %d hours before check-in", ErrInvalidCancellationPolicy, tier.HoursBefore)
+			}
+			if tier.FeePercent < previous.FeePercent {
+				return fmt.Errorf("%w: fees cannot go down closer to check-in", ErrInvalidCancellationPolicy)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+)
+
+func TestCancellationFee(t *testing.T) {
+	checkIn := time.Date(2025, 10, 10, 14, 0, 0, 0, time.UTC)
+	tiered := models.CancellationTerms{
+		Policy: "Flexible",
+		Tiers: models.CancellationTiers{
+			{HoursBefore: 168, FeePercent: 25},
+			{HoursBefore: 48, FeePercent: 50},
+			{HoursBefore: 24, FeePercent: 100},
+		},
+	}
+
+	cases := []struct {
+		name        string
+		terms       models.CancellationTerms
+		hoursBefore float64
+		fee         models.Money
+	}{
+		{"well before the first tier", tiered, 240, npr(0)},
+		{"as the first tier starts", tiered, 168, npr(0)},
+		{"in the first tier", tiered, 167, npr(5000)},
+		{"in the middle tier", tiered, 30, npr(10000)},
+		{"in the last tier", tiered, 2, npr(20000)},
+		{"after check-in", tiered, -5, npr(20000)},
+		{"non-refundable", models.CancellationTerms{Policy: "Saver", NonRefundable: true}, 720, npr(20000)},
+		{"standard terms before 24 hours", models.CancellationTerms{}, 25, npr(0)},
+		{"standard terms within 24 hours", models.CancellationTerms{}, 23, npr(10000)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			booking := &models.RoomBooking{
+				CheckIn:           checkIn,
+				TotalPrice:        npr(20000),
+				CancellationTerms: tc.terms,
+			}
+			at := checkIn.Add(-time.Duration(tc.hoursBefore * float64(time.Hour)))
+			if fee := cancellationFee(booking, at); fee != tc.fee {
+				t.Errorf("expected fee %s, got %s", tc.fee, fee)
+			}
+		})
+	}
+}
+
+func TestNoShowFee(t *testing.T) {
+	tiers := models.CancellationTiers{{HoursBefore: 48, FeePercent: 50}, {HoursBefore: 24, FeePercent: 75}}
+
+	cases := []struct {
+		name  string
+		terms models.CancellationTerms
+		fee   float64
+	}{
+		{"policy no-show fee", models.CancellationTerms{Tiers: tiers, NoShowFeePercent: 100}, 100},
+		{"fee at check-in", models.CancellationTerms{Tiers: tiers}, 75},
+		{"standard terms", models.StandardCancellationTerms(), 50},
+		{"non-refundable", models.CancellationTerms{NonRefundable: true}, 100},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if fee := tc.terms.NoShowFee(); fee != tc.fee {
+				t.Errorf("expected %v%%, got %v%%", tc.fee, fee)
+			}
+		})
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy models.CancellationPolicy
+		valid  bool
+	}{
+		{"tiers in any order", models.CancellationPolicy{Name: "Flexible", Tiers: models.CancellationTiers{{HoursBefore: 24, FeePercent: 100}, {HoursBefore: 168, FeePercent: 25}}}, true},
+		{"non-refundable", models.CancellationPolicy{Name: "Saver", NonRefundable: true}, true},
+		{"non-refundable with tiers", models.CancellationPolicy{Name: "Saver", NonRefundable: true, Tiers: models.CancellationTiers{{HoursBefore: 24, FeePercent: 50}}}, false},
+		{"fee goes down closer to check-in", models.CancellationPolicy{Name: "Odd", Tiers: models.CancellationTiers{{HoursBefore: 168, FeePercent: 50}, {HoursBefore: 24, FeePercent: 25}}}, false},
+		{"two tiers at the same time", models.CancellationPolicy{Name: "Odd", Tiers: models.CancellationTiers{{HoursBefore: 24, FeePercent: 50}, {HoursBefore: 24, FeePercent: 75}}}, false},
+		{"fee over 100 percent", models.CancellationPolicy{Name: "Odd", Tiers: models.CancellationTiers{{HoursBefore: 24, FeePercent: 150}}}, false},
+		{"no name", models.CancellationPolicy{Tiers: models.CancellationTiers{{HoursBefore: 24, FeePercent: 50}}}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validatePolicy(&tc.policy)
+			if tc.valid && err != nil {
+				t.Fatalf("expected policy to be valid, got %v", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidCancellationPolicy) {
+				t.Fatalf("expected ErrInvalidCancellationPolicy, got %v", err)
+			}
+		})
+	}
+
+	policy := models.CancellationPolicy{Name: "Flexible", Tiers: models.CancellationTiers{{HoursBefore: 24, FeePercent: 100}, {HoursBefore: 168, FeePercent: 25}}}
+	if err := validatePolicy(&policy); err != nil {
+		t.Fatalf("expected policy to be valid, got %v", err)
+	}
+	if policy.Tiers[0].HoursBefore != 168 {
+		t.Errorf("expected tiers sorted furthest from check-in first, got %+v", policy.Tiers)
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"os"
+	"testing"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// openTestDB connects to the Postgres database named by TEST_DATABASE_DSN and
+// migrates the schema. Tests that need it are skipped when it is not set.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+
+	if err := db.AutoMigrate(&models.Guest{}, &models.Room{}, &models.RoomBooking{}, &models.FolioItem{}, &models.Onsen{}, &models.OnsenOpeningHours{}, &models.OnsenClosure{}, &models.OnsenEntitlement{}, &models.OnsenBooking{}, &models.DepositRule{}, &models.Payment{}, &models.PaymentEvent{}, &models.Refund{}, &models.Invoice{}, &models.InvoiceSequence{}, &models.ExchangeRate{}, &models.TaxRule{}, &models.RatePlan{}, &models.StayRule{}, &models.PromoCode{}, &models.PromoRedemption{}, &models.CancellationPolicy{}, &models.BookingTransition{}, &models.BookingChange{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+// testTx runs a test inside a transaction that is rolled back when it ends
+func testTx(t *testing.T, db *gorm.DB) *gorm.DB {
+	t.Helper()
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Fatalf("failed to begin transaction: %v", tx.Error)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+// createTestRoom stores a guest and a room for a test to book
+func createTestRoom(t *testing.T, db *gorm.DB, roomNo string) (*models.Guest, *models.Room) {
+	t.Helper()
+
+	guest := models.Guest{Name: "Test Guest", Email: roomNo + "@example.com", Phone: "9800000000"}
+	if err := db.Create(&guest).Error; err != nil {
+		t.Fatalf("failed to create guest: %v", err)
+	}
+
+	room := models.Room{
+		RoomNo:        roomNo,
+		Type:          "Standard",
+		Capacity:      2,
+		PricePerNight: models.NewMoney(1000000, models.DefaultCurrency),
+		Status:        "active",
+	}
+	if err := db.Create(&room).Error; err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+
+	return &guest, &room
+}
@@ -2,11 +2,13 @@ package services
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"html/template"
 	"net/smtp"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/IamMaheshGurung/privateOnsenBooking/models"
@@ -25,6 +27,13 @@ type EmailConfig struct {
 	Environment  string // "development", "production", etc.
 }
 
+// EmailAttachment is a file sent along with an email, e.g. an invoice PDF
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
 // EmailService handles sending email notifications
 type EmailService struct {
 	logger *zap.Logger
@@ -49,7 +58,7 @@ func NewEmailService(logger *zap.Logger, config EmailConfig) *EmailService {
 }
 
 // SendEmail sends an email with the given parameters
-func (es *EmailService) SendEmail(to, subject, body string) error {
+func (es *EmailService) SendEmail(to, subject, body string, attachments ...EmailAttachment) error {
 	// Skip sending in development mode if configured to do so
 	if es.config.Environment == "development" && os.Getenv("SEND_EMAILS") != "true" {
 		es.logger.Info("Email sending skipped in development mode",
@@ -82,6 +91,9 @@ func (es *EmailService) SendEmail(to, subject, body string) error {
 
 	// Combine headers and body
 	message := fromHeader + toHeader + subjectHeader + mimeHeader + body
+	if len(attachments) > 0 {
+		message = fromHeader + toHeader + subjectHeader + multipartMessage(body, attachments)
+	}
 
 	// Send email
 	addr := fmt.Sprintf("%s:%d", es.config.SMTPServer, es.config.SMTPPort)
@@ -107,6 +119,37 @@ func (es *EmailService) SendEmail(to, subject, body string) error {
 	return nil
 }
 
+// multipartMessage builds a multipart/mixed MIME body holding the HTML body
+// followed by the attachments
+func multipartMessage(body string, attachments []EmailAttachment) string {
+	boundary := fmt.Sprintf("kwangdi-%d", time.Now().UnixNano())
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "MIME-version: 1.0\r\nContent-Type: multipart/mixed; boundary=\"%s\"\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/html; charset=\"UTF-8\"\r\n\r\n%s\r\n", boundary, body)
+
+	for _, attachment := range attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		fmt.Fprintf(&b, "--%s\r\nContent-Type: %s; name=\"%s\"\r\nContent-Transfer-Encoding: base64\r\nContent-Disposition: attachment; filename=\"%s\"\r\n\r\n",
+			boundary, contentType, attachment.Filename, attachment.Filename)
+
+		// Base64 lines must not exceed 76 characters
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			b.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		b.WriteString(encoded + "\r\n")
+	}
+
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.String()
+}
+
 // renderTemplate parses and renders an email template with the given data
 func (es *EmailService) renderTemplate(templateName string, data interface{}) (string, error) {
 	templatePath := filepath.Join(es.config.TemplatesDir, templateName+".html")
@@ -139,7 +182,8 @@ func (es *EmailService) renderTemplate(templateName string, data interface{}) (s
 }
 
 // SendBookingConfirmation sends a booking confirmation email to the guest
-func (es *EmailService) SendBookingConfirmation(booking *models.RoomBooking, guest *models.Guest, room *models.Room) error {
+// with any attachments given
+func (es *EmailService) SendBookingConfirmation(booking *models.RoomBooking, guest *models.Guest, room *models.Room, attachments ...EmailAttachment) error {
 	// Skip if no guest email
 	if guest == nil || guest.Email == "" {
 		es.logger.Warn("no guest email available for booking confirmation",
@@ -148,19 +192,39 @@ func (es *EmailService) SendBookingConfirmation(booking *models.RoomBooking, gue
 		return fmt.Errorf("no guest email available")
 	}
 
+	_, tax, total := BookingTotals(booking)
+
 	// Prepare template data
 	data := map[string]interface{}{
 		"Booking":      booking,
+		"Reference":    booking.ReferenceNumber,
 		"Guest":        guest,
 		"Room":         room,
 		"HotelName":    es.config.FromName,
 		"CheckInDate":  booking.CheckIn.Format("Monday, January 2, 2006"),
 		"CheckOutDate": booking.CheckOut.Format("Monday, January 2, 2006"),
 		"TotalNights":  int(booking.CheckOut.Sub(booking.CheckIn).Hours() / 24),
-		"TotalPrice":   fmt.Sprintf("%.2f", booking.TotalPrice),
+		"TotalPrice":   total.String(),
+		"TaxAmount":    tax.String(),
 		"Year":         time.Now().Year(),
 	}
 
+	// Show the total in the guest's currency at the rate locked on the booking
+	if displayTotal, ok := BookingDisplayAmount(booking, total); ok {
+		data["DisplayTotal"] = "≈ " + displayTotal.String()
+	}
+
+	// Show the promo codes redeemed and what they took off
+	if booking.DiscountAmount.IsPositive() {
+		data["Discount"] = booking.DiscountAmount.String()
+		data["PromoCodes"] = strings.ReplaceAll(booking.PromoCodes, ",", ", ")
+	}
+
+	// State the cancellation terms the booking was made on
+	cancellation := BookingCancellationTerms(booking)
+	data["CancellationPolicy"] = cancellation.Policy
+	data["CancellationTerms"] = cancellation.Lines()
+
 	// Render email template
 	body, err := es.renderTemplate("booking_confirmation", data)
 	if err != nil {
@@ -168,12 +232,13 @@ func (es *EmailService) SendBookingConfirmation(booking *models.RoomBooking, gue
 	}
 
 	// Send email
-	subject := fmt.Sprintf("Your Booking Confirmation #%s - %s", booking.ReferenceNumber, es.config.FromName)
-	return es.SendEmail(guest.Email, subject, body)
+	subject := fmt.Sprintf("Your Booking Confirmation %s - %s", booking.ReferenceNumber, es.config.FromName)
+	return es.SendEmail(guest.Email, subject, body, attachments...)
 }
 
 // SendBookingCancellationNotice sends a booking cancellation confirmation email
-func (es *EmailService) SendBookingCancellationNotice(booking *models.RoomBooking, guest *models.Guest, room *models.Room) error {
+// stating the fee charged and the amount that will be refunded
+func (es *EmailService) SendBookingCancellationNotice(booking *models.RoomBooking, guest *models.Guest, room *models.Room, refundAmount models.Money) error {
 	// Skip if no guest email
 	if guest == nil || guest.Email == "" {
 		es.logger.Warn("no guest email available for cancellation notice",
@@ -182,19 +247,29 @@ func (es *EmailService) SendBookingCancellationNotice(booking *models.RoomBookin
 	}
 
 	cancellationFeeText := "No cancellation fee has been applied."
-	if booking.CancellationFee > 0 {
-		cancellationFeeText = fmt.Sprintf("A cancellation fee of %.2f has been applied.", booking.CancellationFee)
+	if booking.CancellationFee.IsPositive() {
+		cancellationFeeText = fmt.Sprintf("A cancellation fee of %s has been applied.", booking.CancellationFee)
+	}
+
+	refundText := "No payment is due to be refunded."
+	if refundAmount.IsPositive() {
+		refundText = fmt.Sprintf("A refund of %s will be returned to your original payment method.", refundAmount)
 	}
 
 	// Prepare template data
 	data := map[string]interface{}{
 		"Booking":             booking,
+		"Reference":           booking.ReferenceNumber,
 		"Guest":               guest,
 		"Room":                room,
 		"HotelName":           es.config.FromName,
 		"CancellationDate":    booking.CancelledAt.Format("Monday, January 2, 2006"),
 		"CheckInDate":         booking.CheckIn.Format("Monday, January 2, 2006"),
 		"CancellationFeeText": cancellationFeeText,
+		"RefundAmount":        refundAmount,
+		"RefundText":          refundText,
+		"CancellationPolicy":  BookingCancellationTerms(booking).Policy,
+		"CancellationTerms":   BookingCancellationTerms(booking).Lines(),
 		"Year":                time.Now().Year(),
 	}
 
@@ -205,10 +280,87 @@ func (es *EmailService) SendBookingCancellationNotice(booking *models.RoomBookin
 	}
 
 	// Send email
-	subject := fmt.Sprintf("Booking Cancellation #%s - %s", booking.ReferenceNumber, es.config.FromName)
+	subject := fmt.Sprintf("Booking Cancellation %s - %s", booking.ReferenceNumber, es.config.FromName)
 	return es.SendEmail(guest.Email, subject, body)
 }
 
+// SendBookingChangeNotice emails the guest what a modification of their
+// booking changed and how the amount due changed
+func (es *EmailService) SendBookingChangeNotice(booking *models.RoomBooking, guest *models.Guest, room *models.Room, change *models.BookingChange) error {
+	// Skip if no guest email
+	if guest == nil || guest.Email == "" {
+		es.logger.Warn("no guest email available for booking change notice",
+			zap.Uint("bookingID", booking.ID))
+		return fmt.Errorf("no guest email available")
+	}
+
+	difference := change.TotalAfter.Sub(change.TotalBefore)
+	differenceText := "The amount due for your stay is unchanged."
+	switch {
+	case difference.IsPositive():
+		differenceText = fmt.Sprintf("The amount due for your stay has gone up by %s.", difference)
+	case difference.IsNegative():
+		differenceText = fmt.Sprintf("The amount due for your stay has gone down by %s.", difference.Neg())
+	}
+
+	// Prepare template data
+	data := map[string]interface{}{
+		"Booking":        booking,
+		"Reference":      booking.ReferenceNumber,
+		"Guest":          guest,
+		"Room":           room,
+		"HotelName":      es.config.FromName,
+		"CheckInDate":    booking.CheckIn.Format("Monday, January 2, 2006"),
+		"CheckOutDate":   booking.CheckOut.Format("Monday, January 2, 2006"),
+		"Changes":        change.Changes,
+		"TotalPrice":     change.TotalAfter.String(),
+		"DifferenceText": differenceText,
+		"Year":           time.Now().Year(),
+	}
+
+	// Render email template
+	body, err := es.renderTemplate("booking_changed", data)
+	if err != nil {
+		return err
+	}
+
+	// Send email
+	subject := fmt.Sprintf("Your Booking %s Has Changed - %s", booking.ReferenceNumber, es.config.FromName)
+	return es.SendEmail(guest.Email, subject, body)
+}
+
+// SendCheckoutReceipt thanks the guest after check-out, with the final folio
+// totals and the invoice attached
+func (es *EmailService) SendCheckoutReceipt(booking *models.RoomBooking, guest *models.Guest, folio *Folio, attachments ...EmailAttachment) error {
+	// Skip if no guest email
+	if guest == nil || guest.Email == "" {
+		es.logger.Warn("no guest email available for checkout receipt",
+			zap.Uint("bookingID", booking.ID))
+		return fmt.Errorf("no guest email available")
+	}
+
+	// Prepare template data
+	data := map[string]interface{}{
+		"Booking":      booking,
+		"Reference":    booking.ReferenceNumber,
+		"Guest":        guest,
+		"Folio":        folio,
+		"HotelName":    es.config.FromName,
+		"CheckOutDate": booking.ActualCheckOut.Format("Monday, January 2, 2006"),
+		"Year":         time.Now().Year(),
+	}
+
+	// Render email template
+	body, err := es.renderTemplate("checkout_receipt", data)
+	if err != nil {
+		return err
+	}
+
+	// Send email
+	subject := fmt.Sprintf("Thank you for staying with us %s - %s", booking.ReferenceNumber, es.config.FromName)
+	return es.SendEmail(guest.Email, subject, body, attachments...)
+}
+
 // SendCheckInReminder sends a reminder email before check-in date
 func (es *EmailService) SendCheckInReminder(booking *models.RoomBooking, guest *models.Guest, room *models.Room) error {
 	// Skip if no guest email
@@ -224,6 +376,7 @@ func (es *EmailService) SendCheckInReminder(booking *models.RoomBooking, guest *
 	// Prepare template data
 	data := map[string]interface{}{
 		"Booking":          booking,
+		"Reference":        booking.ReferenceNumber,
 		"Guest":            guest,
 		"Room":             room,
 		"HotelName":        es.config.FromName,
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Exchange rate errors that callers can tell apart
+var (
+	ErrRateNotFound    = errors.New("no exchange rate for this currency")
+	ErrInvalidCurrency = errors.New("invalid currency code")
+)
+
+// ExchangeRateService keeps the table of exchange rates from the property's
+// base currency and converts prices for display. Rates are maintained by
+// staff or loaded from a local file; nothing is fetched from a live feed.
+type ExchangeRateService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	base   string
+
+	mu       sync.Mutex
+	cacheDay string                         // Day the cached rates are for
+	cache    map[string]models.ExchangeRate // Rates in effect on cacheDay by currency
+}
+
+// NewExchangeRateService creates a new instance of ExchangeRateService
+func NewExchangeRateService(db *gorm.DB, logger *zap.Logger, baseCurrency string) *ExchangeRateService {
+	if baseCurrency == "" {
+		baseCurrency = models.DefaultCurrency
+	}
+
+	return &ExchangeRateService{
+		db:     db,
+		logger: logger,
+		base:   strings.ToUpper(baseCurrency),
+	}
+}
+
+// BaseCurrency returns the currency prices are kept in
+func (ers *ExchangeRateService) BaseCurrency() string {
+	return ers.base
+}
+
+// normalizeCurrency upper-cases an ISO 4217 code and checks its shape
+func normalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, currency)
+	}
+	return currency, nil
+}
+
+// SetRate records the rate of currency from the effective date on, replacing
+// any rate already recorded for that day
+func (ers *ExchangeRateService) SetRate(currency, rate string, effective time.Time, source string) (*models.ExchangeRate, error) {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	if currency == ers.base {
+		return nil, fmt.Errorf("%s is the base currency", currency)
+	}
+
+	if _, err := models.ParseRate(rate); err != nil {
+		return nil, err
+	}
+
+	exchangeRate := models.ExchangeRate{
+		BaseCurrency:  ers.base,
+		Currency:      currency,
+		Rate:          strings.TrimSpace(rate),
+		EffectiveDate: time.Date(effective.Year(), effective.Month(), effective.Day(), 0, 0, 0, 0, time.UTC),
+		Source:        source,
+	}
+
+	if err := ers.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base_currency"}, {Name: "currency"}, {Name: "effective_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "updated_at"}),
+	}).Create(&exchangeRate).Error; err != nil {
+		ers.logger.Error("failed to save exchange rate", zap.String("currency", currency), zap.Error(err))
+		return nil, fmt.Errorf("failed to save exchange rate: %w", err)
+	}
+
+	ers.invalidate()
+	return &exchangeRate, nil
+}
+
+// LoadFile loads rates from a CSV file with the header
+// currency,rate,effective_date, for example:
+//
+//	currency,rate,effective_date
+//	JPY,1.0845,2024-07-16
+//
+// Rates are units of the currency per one unit of the base currency. The
+// whole file is loaded or nothing is. Returns the number of rates loaded.
+func (ers *ExchangeRateService) LoadFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open rates file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read rates file header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"currency", "rate", "effective_date"} {
+		if _, ok := columns[name]; !ok {
+			return 0, fmt.Errorf("rates file is missing the %s column", name)
+		}
+	}
+
+	type row struct {
+		currency, rate string
+		effective      time.Time
+	}
+	var rows []row
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read rates file: %w", err)
+		}
+
+		effective, err := time.Parse("2006-01-02", strings.TrimSpace(record[columns["effective_date"]]))
+		if err != nil {
+			return 0, fmt.Errorf("line %d: invalid effective date, use YYYY-MM-DD", line)
+		}
+		rows = append(rows, row{record[columns["currency"]], record[columns["rate"]], effective})
+	}
+
+	source := "file:" + filepath.Base(path)
+	err = ers.db.Transaction(func(tx *gorm.DB) error {
+		scoped := &ExchangeRateService{db: tx, logger: ers.logger, base: ers.base}
+		for i, r := range rows {
+			if _, err := scoped.SetRate(r.currency, r.rate, r.effective, source); err != nil {
+				return fmt.Errorf("line %d: %w", i+2, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		ers.logger.Error("failed to load exchange rates", zap.String("path", path), zap.Error(err))
+		return 0, err
+	}
+
+	ers.invalidate()
+	ers.logger.Info("exchange rates loaded", zap.String("path", path), zap.Int("rates", len(rows)))
+
+	return len(rows), nil
+}
+
+// GetRates returns every recorded rate, newest first, optionally for one currency
+func (ers *ExchangeRateService) GetRates(currency string) ([]models.ExchangeRate, error) {
+	query := ers.db.Where("base_currency = ?", ers.base)
+	if currency != "" {
+		query = query.Where("currency = ?", strings.ToUpper(currency))
+	}
+
+	var rates []models.ExchangeRate
+	if err := query.Order("currency ASC, effective_date DESC").Find(&rates).Error; err != nil {
+		ers.logger.Error("failed to get exchange rates", zap.Error(err))
+		return nil, fmt.Errorf("failed to get exchange rates: %w", err)
+	}
+
+	return rates, nil
+}
+
+// RateOn returns the rate of currency in effect on day. The base currency
+// always converts at 1.
+func (ers *ExchangeRateService) RateOn(currency string, day time.Time) (*models.ExchangeRate, error) {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	if currency == ers.base {
+		return &models.ExchangeRate{BaseCurrency: ers.base, Currency: ers.base, Rate: "1", EffectiveDate: day}, nil
+	}
+
+	rates, err := ers.ratesOn(day)
+	if err != nil {
+		return nil, err
+	}
+
+	rate, ok := rates[currency]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrRateNotFound, currency)
+	}
+	return &rate, nil
+}
+
+// Currencies returns the currencies prices can be shown in today: the base
+// currency first, then every currency with a rate in effect
+func (ers *ExchangeRateService) Currencies() []string {
+	currencies := []string{ers.base}
+
+	rates, err := ers.ratesOn(time.Now())
+	if err != nil {
+		return currencies
+	}
+
+	others := make([]string, 0, len(rates))
+	for currency := range rates {
+		others = append(others, currency)
+	}
+	sort.Strings(others)
+
+	return append(currencies, others...)
+}
+
+// Convert converts an amount in the base currency at today's rate
+func (ers *ExchangeRateService) Convert(amount models.Money, currency string) (models.Money, *models.ExchangeRate, error) {
+	rate, err := ers.RateOn(currency, time.Now())
+	if err != nil {
+		return models.Money{}, nil, err
+	}
+
+	value, err := models.ParseRate(rate.Rate)
+	if err != nil {
+		return models.Money{}, nil, err
+	}
+
+	return amount.In(ers.base).Convert(value, rate.Currency), rate, nil
+}
+
+// DisplayPrice formats amount in the guest's display currency for showing
+// next to the base price, e.g. "≈ JPY 16,268". It returns "" when the display
+// currency is the base currency or has no rate.
+func (ers *ExchangeRateService) DisplayPrice(amount models.Money, currency interface{}) string {
+	code, _ := currency.(string)
+	if code == "" || strings.EqualFold(code, ers.base) || amount.Currency != "" && amount.Currency != ers.base {
+		return ""
+	}
+
+	converted, _, err := ers.Convert(amount, code)
+	if err != nil {
+		return ""
+	}
+	return "≈ " + converted.String()
+}
+
+// LockRate records on a booking that is yet to be stored the display currency
+// the guest chose and today's rate for it, so the booking keeps that rate
+// whatever happens to the table later
+func (ers *ExchangeRateService) LockRate(booking *models.RoomBooking, currency string) error {
+	if currency == "" {
+		currency = ers.base
+	}
+
+	rate, err := ers.RateOn(currency, time.Now())
+	if err != nil {
+		return err
+	}
+
+	effective := rate.EffectiveDate
+	booking.DisplayCurrency = rate.Currency
+	booking.ExchangeRate = rate.Rate
+	booking.ExchangeRateDate = &effective
+	return nil
+}
+
+// BookingDisplayAmount converts an amount of a booking into the guest's
+// display currency at the rate locked on the booking. ok is false when the
+// booking has no display currency other than its own.
+func BookingDisplayAmount(booking *models.RoomBooking, amount models.Money) (converted models.Money, ok bool) {
+	if booking.DisplayCurrency == "" || booking.DisplayCurrency == amount.Currency || booking.ExchangeRate == "" {
+		return models.Money{}, false
+	}
+
+	rate, err := models.ParseRate(booking.ExchangeRate)
+	if err != nil {
+		return models.Money{}, false
+	}
+	return amount.Convert(rate, booking.DisplayCurrency), true
+}
+
+// ratesOn returns the latest rate of each currency effective on or before day
+func (ers *ExchangeRateService) ratesOn(day time.Time) (map[string]models.ExchangeRate, error) {
+	key := day.Format("2006-01-02")
+
+	ers.mu.Lock()
+	defer ers.mu.Unlock()
+
+	if ers.cache != nil && ers.cacheDay == key {
+		return ers.cache, nil
+	}
+
+	var rates []models.ExchangeRate
+	if err := ers.db.Where("base_currency = ? AND effective_date <= ?", ers.base, key).
+		Order("effective_date ASC").
+		Find(&rates).Error; err != nil {
+		ers.logger.Error("failed to get exchange rates", zap.Error(err))
+		return nil, fmt.Errorf("failed to get exchange rates: %w", err)
+	}
+
+	current := make(map[string]models.ExchangeRate, len(rates))
+	for _, rate := range rates {
+		current[rate.Currency] = rate // Later dates overwrite earlier ones
+	}
+
+	ers.cache, ers.cacheDay = current, key
+	return current, nil
+}
+
+// invalidate drops the cached rates after the table changes
+func (ers *ExchangeRateService) invalidate() {
+	ers.mu.Lock()
+	ers.cache = nil
+	ers.mu.Unlock()
+}
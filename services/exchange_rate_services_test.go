@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"go.uber.org/zap"
+)
+
+// rateTable returns an ExchangeRateService whose rates for today are rates,
+// without a database behind it
+func rateTable(rates ...models.ExchangeRate) *ExchangeRateService {
+	ers := NewExchangeRateService(nil, zap.NewNop(), "NPR")
+	ers.cache = make(map[string]models.ExchangeRate, len(rates))
+	for _, rate := range rates {
+		ers.cache[rate.Currency] = rate
+	}
+	ers.cacheDay = time.Now().Format("2006-01-02")
+	return ers
+}
+
+func TestLockRateKeepsBookingRate(t *testing.T) {
+	ers := rateTable(models.ExchangeRate{BaseCurrency: "NPR", Currency: "JPY", Rate: "1.0845", EffectiveDate: day("2025-10-01")})
+
+	booking := &models.RoomBooking{TotalPrice: npr(15000)}
+	if err := ers.LockRate(booking, "jpy"); err != nil {
+		t.Fatalf("failed to lock rate: %v", err)
+	}
+	if booking.DisplayCurrency != "JPY" || booking.ExchangeRate != "1.0845" {
+		t.Fatalf("expected JPY at 1.0845 on the booking, got %s at %s", booking.DisplayCurrency, booking.ExchangeRate)
+	}
+	if booking.ExchangeRateDate == nil || !booking.ExchangeRateDate.Equal(day("2025-10-01")) {
+		t.Errorf("expected the rate's effective date on the booking, got %v", booking.ExchangeRateDate)
+	}
+
+	// 15,000 rupees at 1.0845 is 16,267.5 yen, rounded half away from zero
+	want := models.NewMoney(16268, "JPY")
+	if converted, ok := BookingDisplayAmount(booking, booking.TotalPrice); !ok || converted != want {
+		t.Fatalf("expected %s, got %s (ok=%v)", want, converted, ok)
+	}
+
+	// A new rate in the table does not change what the booking shows
+	ers.cache["JPY"] = models.ExchangeRate{BaseCurrency: "NPR", Currency: "JPY", Rate: "1.2", EffectiveDate: day("2025-10-02")}
+	if converted, _ := BookingDisplayAmount(booking, booking.TotalPrice); converted != want {
+		t.Errorf("expected the locked rate to give %s, got %s", want, converted)
+	}
+	if converted, _, err := ers.Convert(booking.TotalPrice, "JPY"); err != nil || converted != models.NewMoney(18000, "JPY") {
+		t.Errorf("expected today's rate to give JPY 18,000, got %s (%v)", converted, err)
+	}
+}
+
+func TestLockRateErrors(t *testing.T) {
+	ers := rateTable()
+
+	if err := ers.LockRate(&models.RoomBooking{}, "JPY"); !errors.Is(err, ErrRateNotFound) {
+		t.Errorf("expected ErrRateNotFound, got %v", err)
+	}
+	if err := ers.LockRate(&models.RoomBooking{}, "US$"); !errors.Is(err, ErrInvalidCurrency) {
+		t.Errorf("expected ErrInvalidCurrency, got %v", err)
+	}
+
+	// The base currency needs no rate and shows nothing extra
+	booking := &models.RoomBooking{TotalPrice: npr(15000)}
+	if err := ers.LockRate(booking, ""); err != nil {
+		t.Fatalf("expected the base currency to lock, got %v", err)
+	}
+	if _, ok := BookingDisplayAmount(booking, booking.TotalPrice); ok {
+		t.Errorf("expected no display amount in the base currency")
+	}
+}
+
+func TestBookingDisplayAmountWithoutLockedRate(t *testing.T) {
+	cases := []struct {
+		name    string
+		booking models.RoomBooking
+	}{
+		{"no display currency", models.RoomBooking{}},
+		{"rate missing", models.RoomBooking{DisplayCurrency: "USD"}},
+		{"rate unreadable", models.RoomBooking{DisplayCurrency: "USD", ExchangeRate: "abc"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if converted, ok := BookingDisplayAmount(&tc.booking, npr(20000)); ok {
+				t.Errorf("expected no display amount, got %s", converted)
+			}
+		})
+	}
+}
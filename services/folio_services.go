@@ -0,0 +1,424 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Folio errors that callers can tell apart
+var (
+	ErrInvalidFolioCategory = errors.New("invalid folio category")
+	ErrFolioClosed          = errors.New("folio is closed for this booking")
+	ErrFolioItemNotFound    = errors.New("folio item not found")
+)
+
+// Folio is the bill of a booking: every charge posted to it and what has been paid
+type Folio struct {
+	BookingID uint                `json:"booking_id"`
+	Reference string              `json:"reference"`
+	GuestName string              `json:"guest_name"`
+	RoomNo    string              `json:"room_no"`
+	CheckIn   time.Time           `json:"check_in"`
+	CheckOut  time.Time           `json:"check_out"`
+	Items     []models.FolioItem  `json:"items"`
+	Subtotal  models.Money        `json:"subtotal"`
+	Tax       models.Money        `json:"tax"`
+	Taxes     models.TaxBreakdown `json:"taxes"` // Tax by tax and rate
+	Total     models.Money        `json:"total"`
+	Paid      models.Money        `json:"paid"`
+	Balance   models.Money        `json:"balance"`
+	Final     bool                `json:"final"` // The guest has checked out
+}
+
+// FolioService posts charges to bookings and builds their folios
+type FolioService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	taxes  *TaxService
+}
+
+// NewFolioService creates a new instance of FolioService
+func NewFolioService(db *gorm.DB, logger *zap.Logger, taxes *TaxService) *FolioService {
+	return &FolioService{
+		db:     db,
+		logger: logger,
+		taxes:  taxes,
+	}
+}
+
+// isFolioCategory reports whether category is one of the models.FolioCategory* constants
+func isFolioCategory(category string) bool {
+	switch category {
+	case models.FolioCategoryRoomNight, models.FolioCategoryOnsen, models.FolioCategoryDining,
+		models.FolioCategoryExperience, models.FolioCategoryMinibar:
+		return true
+	}
+	return false
+}
+
+// priceItem works out the taxes and total of a folio item from the tax rules
+// of its category
+func (fs *FolioService) priceItem(item *models.FolioItem) error {
+	if item.Quantity < 1 {
+		item.Quantity = 1
+	}
+
+	quote, err := fs.taxes.Quote(item.Category, item.UnitPrice.Mul(int64(item.Quantity)))
+	if err != nil {
+		return err
+	}
+
+	item.Taxes = quote.Taxes
+	item.TaxRate = quote.Taxes.EffectiveRate()
+	item.TaxAmount = quote.Tax
+	item.Amount = quote.Gross
+	return nil
+}
+
+// sumTaxes totals the taxes of folio items by tax and rate, in the order they
+// first appear. Items posted before tax rules count under a plain "Tax".
+func sumTaxes(items []models.FolioItem) models.TaxBreakdown {
+	totals := models.TaxBreakdown{}
+	index := make(map[string]int)
+	add := func(line models.TaxLine) {
+		key := fmt.Sprintf("%s@%g", line.Code, line.Rate)
+		if i, ok := index[key]; ok {
+			totals[i].Amount = totals[i].Amount.Add(line.Amount)
+			return
+		}
+		index[key] = len(totals)
+		totals = append(totals, line)
+	}
+
+	for _, item := range items {
+		for _, line := range item.Taxes {
+			add(line)
+		}
+		if item.Taxes == nil && !item.TaxAmount.IsZero() {
+			add(models.TaxLine{Code: "tax", Name: "Tax", Rate: item.TaxRate, Amount: item.TaxAmount})
+		}
+	}
+
+	return totals
+}
+
+// postItem saves a priced folio item. Items with a Source are only posted
+// once per booking, so automatic postings can safely be repeated.
+func postItem(tx *gorm.DB, item *models.FolioItem) error {
+	db := tx
+	if item.Source != "" {
+		db = db.Clauses(clause.OnConflict{DoNothing: true})
+	}
+
+	return db.Omit(clause.Associations).Create(item).Error
+}
+
+// roomNightItems returns one priced, unsaved room night item per night of the
+// stay. booking must have its Room loaded.
+func roomNightItems(booking *models.RoomBooking) ([]models.FolioItem, error) {
+	checkIn := time.Date(booking.CheckIn.Year(), booking.CheckIn.Month(), booking.CheckIn.Day(), 0, 0, 0, 0, time.UTC)
+	checkOut := time.Date(booking.CheckOut.Year(), booking.CheckOut.Month(), booking.CheckOut.Day(), 0, 0, 0, 0, time.UTC)
+	nights := int(checkOut.Sub(checkIn).Hours() / 24)
+	if nights < 1 {
+		return nil, fmt.Errorf("booking %d has no nights to post", booking.ID)
+	}
+
+	// The booked price and its taxes are shared over the nights in proportion
+	// to the rate of each night, to the paisa, so the nights add up to exactly
+	// what the guest was quoted. Bookings priced before rate plans share evenly.
+	weights := booking.NightlyRates.Weights()
+	if len(weights) != nights {
+		weights = make([]int64, nights)
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+
+	roomTotal, tax, _ := BookingTotals(booking)
+	rates := roomTotal.Allocate(weights)
+	taxAmounts := tax.Allocate(weights)
+	taxes := booking.Taxes.Allocate(weights)
+	taxRate := booking.Taxes.EffectiveRate()
+	if booking.Taxes == nil {
+		taxRate = legacyServiceFeeRate
+	}
+
+	items := make([]models.FolioItem, 0, nights)
+	for i, night := 0, checkIn; night.Before(checkOut); i, night = i+1, night.AddDate(0, 0, 1) {
+		item := models.FolioItem{
+			BookingID:   booking.ID,
+			Category:    models.FolioCategoryRoomNight,
+			Description: fmt.Sprintf("Room %s - %s", booking.Room.RoomNo, booking.Room.Type),
+			ServiceDate: night,
+			Quantity:    1,
+			UnitPrice:   rates[i],
+			TaxRate:     taxRate,
+			TaxAmount:   taxAmounts[i],
+			Amount:      rates[i].Add(taxAmounts[i]),
+			Source:      "night:" + night.Format("2006-01-02"),
+		}
+		if booking.Taxes != nil {
+			// Each night's tax is the sum of its share of each tax
+			item.Taxes = taxes[i]
+			item.TaxAmount = taxes[i].Total(rates[i].Currency)
+			item.Amount = rates[i].Add(item.TaxAmount)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// PostRoomNights posts one room night per night of the stay. Nights already
+// on the folio are skipped. Returns the number of nights posted.
+func (fs *FolioService) PostRoomNights(bookingID uint) (int, error) {
+	var booking models.RoomBooking
+	if err := fs.db.Preload("Room").First(&booking, bookingID).Error; err != nil {
+		return 0, fmt.Errorf("failed to find booking: %w", err)
+	}
+
+	items, err := roomNightItems(&booking)
+	if err != nil {
+		return 0, err
+	}
+
+	posted := 0
+	err = fs.db.Transaction(func(tx *gorm.DB) error {
+		for i := range items {
+			if err := postItem(tx, &items[i]); err != nil {
+				return fmt.Errorf("failed to post room night: %w", err)
+			}
+			if items[i].ID != 0 {
+				posted++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fs.logger.Error("failed to post room nights", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return 0, err
+	}
+
+	if posted > 0 {
+		fs.logger.Info("room nights posted", zap.Uint("bookingID", bookingID), zap.Int("nights", posted))
+	}
+
+	return posted, nil
+}
+
+// PostOnsenBooking posts an onsen session to the folio of the stay it was
+// booked under. Complimentary sessions are posted at no charge so they still
+// show on the bill.
+func (fs *FolioService) PostOnsenBooking(tx *gorm.DB, booking *models.OnsenBooking, onsen *models.Onsen) error {
+	if booking.BookingID == 0 {
+		return nil
+	}
+
+	description := fmt.Sprintf("Private onsen - %s %s", onsen.Name, booking.TimeSlot)
+	if booking.Complimentary {
+		description += " (included)"
+	}
+
+	item := models.FolioItem{
+		BookingID:   booking.BookingID,
+		Category:    models.FolioCategoryOnsen,
+		Description: description,
+		ServiceDate: booking.Date,
+		Quantity:    1,
+		UnitPrice:   booking.Price,
+		Source:      fmt.Sprintf("onsen:%d", booking.ID),
+	}
+	if err := fs.priceItem(&item); err != nil {
+		return fmt.Errorf("failed to price onsen session: %w", err)
+	}
+
+	if err := postItem(tx, &item); err != nil {
+		fs.logger.Error("failed to post onsen session", zap.Uint("onsenBookingID", booking.ID), zap.Error(err))
+		return fmt.Errorf("failed to post onsen session to folio: %w", err)
+	}
+
+	return nil
+}
+
+// VoidOnsenBooking takes a cancelled onsen session off the folio
+func (fs *FolioService) VoidOnsenBooking(tx *gorm.DB, booking *models.OnsenBooking) error {
+	if err := tx.Model(&models.FolioItem{}).
+		Where("booking_id = ? AND source = ? AND voided_at IS NULL", booking.BookingID, fmt.Sprintf("onsen:%d", booking.ID)).
+		Update("voided_at", time.Now()).Error; err != nil {
+		fs.logger.Error("failed to void onsen session", zap.Uint("onsenBookingID", booking.ID), zap.Error(err))
+		return fmt.Errorf("failed to void onsen session on folio: %w", err)
+	}
+
+	return nil
+}
+
+// PostCharge posts an incidental charge, e.g. dinner or a cooking class, to a
+// booking, taxed by the tax rules of its category
+func (fs *FolioService) PostCharge(bookingID uint, category, description string, quantity int, unitPrice models.Money, serviceDate time.Time) (*models.FolioItem, error) {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if !isFolioCategory(category) || category == models.FolioCategoryRoomNight {
+		return nil, ErrInvalidFolioCategory
+	}
+
+	if unitPrice.IsNegative() {
+		return nil, fmt.Errorf("price cannot be negative")
+	}
+
+	var booking models.RoomBooking
+	if err := fs.db.First(&booking, bookingID).Error; err != nil {
+		return nil, fmt.Errorf("failed to find booking: %w", err)
+	}
+
+	if booking.Status != models.BookingStatusConfirmed && booking.Status != models.BookingStatusCheckedIn {
+		return nil, ErrFolioClosed
+	}
+
+	unitPrice = unitPrice.In(booking.TotalPrice.Currency)
+	if unitPrice.Currency != booking.TotalPrice.Currency {
+		return nil, fmt.Errorf("charges must be in %s", booking.TotalPrice.Currency)
+	}
+
+	if serviceDate.IsZero() {
+		serviceDate = time.Now()
+	}
+
+	item := models.FolioItem{
+		BookingID:   bookingID,
+		Category:    category,
+		Description: strings.TrimSpace(description),
+		ServiceDate: serviceDate,
+		Quantity:    quantity,
+		UnitPrice:   unitPrice,
+	}
+	if err := fs.priceItem(&item); err != nil {
+		return nil, fmt.Errorf("failed to price charge: %w", err)
+	}
+
+	if err := postItem(fs.db, &item); err != nil {
+		fs.logger.Error("failed to post charge", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, fmt.Errorf("failed to post charge: %w", err)
+	}
+
+	fs.logger.Info("charge posted to folio",
+		zap.Uint("bookingID", bookingID),
+		zap.String("category", category),
+		zap.Stringer("amount", item.Amount))
+
+	return &item, nil
+}
+
+// VoidItem takes a charge posted by mistake off a booking's folio
+func (fs *FolioService) VoidItem(bookingID, itemID uint) error {
+	result := fs.db.Model(&models.FolioItem{}).
+		Where("id = ? AND booking_id = ? AND voided_at IS NULL", itemID, bookingID).
+		Update("voided_at", time.Now())
+
+	if result.Error != nil {
+		fs.logger.Error("failed to void folio item", zap.Uint("itemID", itemID), zap.Error(result.Error))
+		return fmt.Errorf("failed to void folio item: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrFolioItemNotFound
+	}
+
+	return nil
+}
+
+// GetFolio returns the posted charges and payments of a booking. Once the
+// guest has checked out this is the final folio.
+func (fs *FolioService) GetFolio(bookingID uint) (*Folio, error) {
+	return fs.buildFolio(bookingID, false)
+}
+
+// GetFolioWithStay is GetFolio with the nights of the stay included even if
+// they are not posted yet, so a folio taken before check-in shows what the
+// guest will be charged. Cancelled bookings only show what was posted.
+func (fs *FolioService) GetFolioWithStay(bookingID uint) (*Folio, error) {
+	return fs.buildFolio(bookingID, true)
+}
+
+func (fs *FolioService) buildFolio(bookingID uint, includeStay bool) (*Folio, error) {
+	var booking models.RoomBooking
+	if err := fs.db.Preload("Guest").Preload("Room").First(&booking, bookingID).Error; err != nil {
+		return nil, fmt.Errorf("failed to find booking: %w", err)
+	}
+
+	folio := &Folio{
+		BookingID: booking.ID,
+		Reference: booking.ReferenceNumber,
+		GuestName: booking.Guest.Name,
+		RoomNo:    booking.Room.RoomNo,
+		CheckIn:   booking.CheckIn,
+		CheckOut:  booking.CheckOut,
+		Final:     booking.Status == models.BookingStatusCompleted || booking.Status == models.BookingStatusCheckedOut,
+	}
+
+	if err := fs.db.Where("booking_id = ? AND voided_at IS NULL", bookingID).
+		Order("service_date ASC, id ASC").
+		Find(&folio.Items).Error; err != nil {
+		fs.logger.Error("failed to get folio items", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get folio items: %w", err)
+	}
+
+	if includeStay && booking.Status != models.BookingStatusCancelled && booking.Status != models.BookingStatusExpired && booking.Status != models.BookingStatusNoShow {
+		nights, err := roomNightItems(&booking)
+		if err != nil {
+			return nil, err
+		}
+
+		posted := make(map[string]bool, len(folio.Items))
+		for _, item := range folio.Items {
+			posted[item.Source] = true
+		}
+
+		var unposted []models.FolioItem
+		for _, night := range nights {
+			if !posted[night.Source] {
+				unposted = append(unposted, night)
+			}
+		}
+
+		if len(unposted) > 0 {
+			folio.Items = append(unposted, folio.Items...)
+			sort.SliceStable(folio.Items, func(i, j int) bool {
+				return folio.Items[i].ServiceDate.Before(folio.Items[j].ServiceDate)
+			})
+		}
+	}
+
+	currency := booking.TotalPrice.Currency
+	folio.Subtotal = models.NewMoney(0, currency)
+	folio.Tax = models.NewMoney(0, currency)
+	folio.Total = models.NewMoney(0, currency)
+	for _, item := range folio.Items {
+		folio.Subtotal = folio.Subtotal.Add(item.Amount.Sub(item.TaxAmount))
+		folio.Tax = folio.Tax.Add(item.TaxAmount)
+		folio.Total = folio.Total.Add(item.Amount)
+	}
+	folio.Taxes = sumTaxes(folio.Items)
+
+	var payments []models.Payment
+	if err := fs.db.Where("booking_id = ? AND status = ?", bookingID, models.PaymentStatusSucceeded).
+		Find(&payments).Error; err != nil {
+		fs.logger.Error("failed to sum booking payments", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, fmt.Errorf("failed to sum booking payments: %w", err)
+	}
+
+	folio.Paid = models.NewMoney(0, currency)
+	for _, payment := range payments {
+		folio.Paid = folio.Paid.Add(payment.Amount)
+	}
+	folio.Balance = folio.Total.Sub(folio.Paid)
+
+	return folio, nil
+}
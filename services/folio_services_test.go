@@ -0,0 +1,97 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+)
+
+func TestRoomNightItems(t *testing.T) {
+	booking := &models.RoomBooking{
+		ID:       5,
+		Room:     models.Room{RoomNo: "101", Type: "Standard"},
+		CheckIn:  day("2025-10-10"),
+		CheckOut: day("2025-10-13"),
+		NightlyRates: models.NightRates{
+			{Date: day("2025-10-10"), Rate: npr(10000)},
+			{Date: day("2025-10-11"), Rate: npr(10000)},
+			{Date: day("2025-10-12"), Rate: npr(15000)},
+		},
+		TotalPrice: npr(35000),
+		TaxAmount:  npr(8505),
+		Taxes: models.TaxBreakdown{
+			{Code: "service", Name: "Service charge", Rate: 10, Amount: npr(3500)},
+			{Code: "vat", Name: "VAT", Rate: 13, Compound: true, Amount: npr(5005)},
+		},
+	}
+
+	items, err := roomNightItems(booking)
+	if err != nil {
+		t.Fatalf("failed to build room nights: %v", err)
+	}
+
+	// Shared 2:2:3 by the rate of each night
+	want := []struct {
+		source  string
+		rate    models.Money
+		service models.Money
+		vat     models.Money
+		amount  models.Money
+	}{
+		{"night:2025-10-10", npr(10000), npr(1000), npr(1430), npr(12430)},
+		{"night:2025-10-11", npr(10000), npr(1000), npr(1430), npr(12430)},
+		{"night:2025-10-12", npr(15000), npr(1500), npr(2145), npr(18645)},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("expected %d nights, got %d", len(want), len(items))
+	}
+
+	total := npr(0)
+	for i, item := range items {
+		if item.Source != want[i].source || item.Category != models.FolioCategoryRoomNight {
+			t.Errorf("expected a room night from %s, got %s from %s", want[i].source, item.Category, item.Source)
+		}
+		if item.UnitPrice != want[i].rate || item.Amount != want[i].amount {
+			t.Errorf("%s: expected %s with taxes %s, got %s and %s", want[i].source, want[i].rate, want[i].amount, item.UnitPrice, item.Amount)
+		}
+		if item.Taxes[0].Amount != want[i].service || item.Taxes[1].Amount != want[i].vat {
+			t.Errorf("%s: expected service charge %s and VAT %s, got %+v", want[i].source, want[i].service, want[i].vat, item.Taxes)
+		}
+		total = total.Add(item.Amount)
+	}
+	if total != npr(43505) {
+		t.Errorf("expected the nights to add up to the booking's 43,505, got %s", total)
+	}
+}
+
+func TestRoomNightItemsBeforeRatePlansAndTaxRules(t *testing.T) {
+	booking := &models.RoomBooking{
+		Room:       models.Room{RoomNo: "101", Type: "Standard"},
+		CheckIn:    day("2025-10-10"),
+		CheckOut:   day("2025-10-13"),
+		TotalPrice: models.NewMoney(1000001, "NPR"),
+	}
+
+	items, err := roomNightItems(booking)
+	if err != nil {
+		t.Fatalf("failed to build room nights: %v", err)
+	}
+
+	// Shared evenly, the extra paisa going to the first nights, with the
+	// legacy service fee of 5%
+	rates := []int64{333334, 333334, 333333}
+	taxes := []int64{16667, 16667, 16666}
+	for i, item := range items {
+		if item.UnitPrice.Minor != rates[i] || item.TaxAmount.Minor != taxes[i] {
+			t.Errorf("night %d: expected %d and tax %d paisa, got %d and %d", i+1, rates[i], taxes[i], item.UnitPrice.Minor, item.TaxAmount.Minor)
+		}
+		if item.TaxRate != legacyServiceFeeRate {
+			t.Errorf("night %d: expected tax rate %d%%, got %v%%", i+1, legacyServiceFeeRate, item.TaxRate)
+		}
+	}
+
+	booking.CheckOut = booking.CheckIn
+	if _, err := roomNightItems(booking); err == nil {
+		t.Fatalf("expected an error for a booking without nights")
+	}
+}
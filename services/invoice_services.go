@@ -0,0 +1,294 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"github.com/IamMaheshGurung/privateOnsenBooking/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PropertyDetails are printed at the top of every invoice
+type PropertyDetails struct {
+	Name    string
+	Address string
+	Phone   string
+	Email   string
+	PAN     string // PAN/VAT registration number
+}
+
+// ErrInvoiceNotIssued is returned for bookings that have not checked out, as
+// invoices are only issued at check-out
+var ErrInvoiceNotIssued = errors.New("invoice is issued at check-out")
+
+// InvoiceService numbers and renders booking invoices
+type InvoiceService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	folio    *FolioService
+	property PropertyDetails
+}
+
+// NewInvoiceService creates a new instance of InvoiceService
+func NewInvoiceService(db *gorm.DB, logger *zap.Logger, folio *FolioService, property PropertyDetails) *InvoiceService {
+	return &InvoiceService{
+		db:       db,
+		logger:   logger,
+		folio:    folio,
+		property: property,
+	}
+}
+
+// GetInvoice returns the invoice issued for a booking at check-out
+func (is *InvoiceService) GetInvoice(bookingID uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := is.db.Where("booking_id = ?", bookingID).First(&invoice).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvoiceNotIssued
+		}
+		return nil, fmt.Errorf("failed to find invoice: %w", err)
+	}
+
+	return &invoice, nil
+}
+
+// issueInvoice numbers the invoice of a booking checking out in tx. Numbers are
+// taken from a per fiscal year counter locked in the same transaction, so they
+// are gapless and never handed out twice; a booking keeps the number it was
+// first given.
+func (is *InvoiceService) issueInvoice(tx *gorm.DB, bookingID uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := tx.Where("booking_id = ?", bookingID).First(&invoice).Error; err == nil {
+		return &invoice, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to find invoice: %w", err)
+	}
+
+	now := time.Now()
+	fiscalYear, _, err := utils.NepaliFiscalYear(now)
+	if err != nil {
+		is.logger.Error("failed to find fiscal year for invoice", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, err
+	}
+
+	// Make sure the year's counter exists, then lock it
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.InvoiceSequence{FiscalYear: fiscalYear}).Error; err != nil {
+		return nil, fmt.Errorf("failed to create invoice sequence: %w", err)
+	}
+
+	var sequence models.InvoiceSequence
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&sequence, "fiscal_year = ?", fiscalYear).Error; err != nil {
+		return nil, fmt.Errorf("failed to lock invoice sequence: %w", err)
+	}
+
+	sequence.LastNumber++
+	if err := tx.Save(&sequence).Error; err != nil {
+		return nil, fmt.Errorf("failed to advance invoice sequence: %w", err)
+	}
+
+	invoice = models.Invoice{
+		BookingID:  bookingID,
+		Number:     fmt.Sprintf("%s-%05d", fiscalYear, sequence.LastNumber),
+		FiscalYear: fiscalYear,
+		Sequence:   sequence.LastNumber,
+		IssuedAt:   now,
+	}
+	if err := tx.Omit(clause.Associations).Create(&invoice).Error; err != nil {
+		is.logger.Error("failed to issue invoice", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, fmt.Errorf("failed to issue invoice: %w", err)
+	}
+
+	is.logger.Info("invoice issued",
+		zap.Uint("bookingID", bookingID),
+		zap.String("number", invoice.Number))
+
+	return &invoice, nil
+}
+
+// RenderInvoicePDF renders the invoice issued at check-out with the folio, tax
+// breakdown, payments and balance. Bookings that have not checked out get
+// ErrInvoiceNotIssued.
+func (is *InvoiceService) RenderInvoicePDF(bookingID uint) ([]byte, *models.Invoice, error) {
+	invoice, err := is.GetInvoice(bookingID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	folio, err := is.folio.GetFolioWithStay(bookingID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var payments []models.Payment
+	if err := is.db.Where("booking_id = ? AND status = ?", bookingID, models.PaymentStatusSucceeded).
+		Order("created_at ASC").
+		Find(&payments).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to get booking payments: %w", err)
+	}
+
+	return is.renderPDF(invoice, folio, payments), invoice, nil
+}
+
+// Column positions of the invoice line table
+const (
+	invoiceMargin     = 50.0
+	invoiceColDesc    = 120.0
+	invoiceColQty     = 360.0
+	invoiceColRate    = 430.0
+	invoiceColTax     = 485.0
+	invoiceColAmount  = 545.0
+	invoicePageBottom = 780.0
+)
+
+func (is *InvoiceService) renderPDF(invoice *models.Invoice, folio *Folio, payments []models.Payment) []byte {
+	doc := utils.NewPDF()
+	doc.AddPage()
+	right := utils.PDFPageWidth - invoiceMargin
+
+	// Property
+	y := 60.0
+	doc.Text(invoiceMargin, y, 18, true, is.property.Name)
+	for _, line := range []string{is.property.Address, is.property.Phone, is.property.Email} {
+		if line != "" {
+			y += 14
+			doc.Text(invoiceMargin, y, 9, false, line)
+		}
+	}
+	if is.property.PAN != "" {
+		y += 14
+		doc.Text(invoiceMargin, y, 9, false, "PAN/VAT No: "+is.property.PAN)
+	}
+
+	title := "TAX INVOICE"
+	if !folio.Balance.IsPositive() && folio.Total.IsPositive() {
+		title = "TAX INVOICE / RECEIPT"
+	}
+	doc.TextRight(right, 60, 14, true, title)
+	doc.TextRight(right, 78, 9, false, "Invoice No: "+invoice.Number)
+	doc.TextRight(right, 92, 9, false, "Fiscal year: "+invoice.FiscalYear)
+	doc.TextRight(right, 106, 9, false, "Issued: "+invoice.IssuedAt.Format("Jan 2, 2006"))
+
+	// Guest and stay
+	y = max(y, 106) + 30
+	doc.Text(invoiceMargin, y, 10, true, "Bill to")
+	doc.Text(invoiceMargin, y+14, 10, false, folio.GuestName)
+	doc.Text(300, y, 10, true, "Booking "+folio.Reference)
+	doc.Text(300, y+14, 10, false, fmt.Sprintf("Room %s, %s to %s", folio.RoomNo,
+		folio.CheckIn.Format("Jan 2, 2006"), folio.CheckOut.Format("Jan 2, 2006")))
+	y += 44
+
+	// Lines
+	header := func() {
+		doc.Text(invoiceMargin, y, 9, true, "Date")
+		doc.Text(invoiceColDesc, y, 9, true, "Description")
+		doc.TextRight(invoiceColQty, y, 9, true, "Qty")
+		doc.TextRight(invoiceColRate, y, 9, true, "Rate")
+		doc.TextRight(invoiceColTax, y, 9, true, "Tax")
+		doc.TextRight(invoiceColAmount, y, 9, true, "Amount ("+folio.Total.Currency+")")
+		doc.Line(invoiceMargin, y+5, right, y+5)
+		y += 18
+	}
+	newLine := func(height float64) {
+		y += height
+		if y > invoicePageBottom {
+			doc.AddPage()
+			y = 60
+			header()
+		}
+	}
+
+	header()
+	for _, item := range folio.Items {
+		doc.Text(invoiceMargin, y, 9, false, item.ServiceDate.Format("Jan 2"))
+		doc.Text(invoiceColDesc, y, 9, false, fitText(item.Description, invoiceColQty-invoiceColDesc-40, 9))
+		doc.TextRight(invoiceColQty, y, 9, false, fmt.Sprintf("%d", item.Quantity))
+		doc.TextRight(invoiceColRate, y, 9, false, item.UnitPrice.Number())
+		doc.TextRight(invoiceColTax, y, 9, false, item.TaxAmount.Number())
+		doc.TextRight(invoiceColAmount, y, 9, false, item.Amount.Number())
+		newLine(14)
+	}
+	doc.Line(invoiceMargin, y-8, right, y-8)
+
+	// Totals with the tax breakdown
+	total := func(label string, amount models.Money, bold bool) {
+		doc.TextRight(invoiceColTax, y, 9, bold, label)
+		doc.TextRight(invoiceColAmount, y, 9, bold, amount.Number())
+		newLine(14)
+	}
+
+	newLine(6)
+	total("Subtotal", folio.Subtotal, false)
+	for _, tax := range folio.Taxes {
+		total(fmt.Sprintf("%s @ %g%%", tax.Name, tax.Rate), tax.Amount, false)
+	}
+	total("Total", folio.Total, true)
+
+	// Payments
+	newLine(10)
+	doc.Text(invoiceMargin, y, 10, true, "Payments")
+	newLine(16)
+	if len(payments) == 0 {
+		doc.Text(invoiceMargin, y, 9, false, "No payments received")
+		newLine(14)
+	}
+	for _, payment := range payments {
+		doc.Text(invoiceMargin, y, 9, false, payment.CreatedAt.Format("Jan 2, 2006"))
+		doc.Text(invoiceColDesc, y, 9, false, fitText(fmt.Sprintf("%s %s", payment.Method, payment.GatewayReference),
+			invoiceColTax-invoiceColDesc, 9))
+		doc.TextRight(invoiceColAmount, y, 9, false, payment.Amount.Number())
+		newLine(14)
+	}
+
+	newLine(6)
+	total("Paid", folio.Paid, false)
+	if folio.Balance.IsPositive() {
+		total("Balance due", folio.Balance, true)
+	} else {
+		total("Balance", models.NewMoney(0, folio.Balance.Currency), true)
+	}
+
+	newLine(20)
+	doc.Text(invoiceMargin, y, 9, false, "Thank you for staying with us.")
+
+	return doc.Bytes()
+}
+
+// fitText shortens s with an ellipsis so that it fits in width points
+func fitText(s string, width, size float64) string {
+	if utils.TextWidth(s, size) <= width {
+		return s
+	}
+
+	runes := []rune(s)
+	for len(runes) > 0 && utils.TextWidth(string(runes)+"...", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// InvoiceAttachment renders the booking's invoice as an email attachment
+func (is *InvoiceService) InvoiceAttachment(bookingID uint) (EmailAttachment, error) {
+	pdf, invoice, err := is.RenderInvoicePDF(bookingID)
+	if err != nil {
+		return EmailAttachment{}, err
+	}
+
+	return EmailAttachment{
+		Filename:    InvoiceFilename(invoice),
+		ContentType: "application/pdf",
+		Data:        pdf,
+	}, nil
+}
+
+// InvoiceFilename returns the download name of an invoice, e.g. invoice-2081-82-00042.pdf
+func InvoiceFilename(invoice *models.Invoice) string {
+	return "invoice-" + strings.ReplaceAll(invoice.Number, "/", "-") + ".pdf"
+}
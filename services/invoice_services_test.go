@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"go.uber.org/zap"
+)
+
+func TestInvoiceIssuedOnceAtCheckOut(t *testing.T) {
+	tx := testTx(t, openTestDB(t))
+	guest, room := createTestRoom(t, tx, "INV-1")
+
+	checkIn := time.Now().AddDate(0, 0, -2).Truncate(24 * time.Hour)
+	booking := models.RoomBooking{
+		GuestID:    guest.ID,
+		RoomID:     room.ID,
+		CheckIn:    checkIn,
+		CheckOut:   checkIn.AddDate(0, 0, 2),
+		TotalPrice: room.PricePerNight.Mul(2),
+		Status:     models.BookingStatusCheckedIn,
+	}
+	if err := tx.Create(&booking).Error; err != nil {
+		t.Fatalf("failed to create booking: %v", err)
+	}
+
+	invoices := NewInvoiceService(tx, zap.NewNop(), nil, PropertyDetails{})
+	rooms := NewRoomBookingService(tx, zap.NewNop(), nil, nil, invoices)
+
+	if _, err := invoices.GetInvoice(booking.ID); !errors.Is(err, ErrInvoiceNotIssued) {
+		t.Fatalf("expected no invoice before check-out, got %v", err)
+	}
+
+	if _, err := rooms.CheckGuestOut(booking.ID, true, models.BookingActorStaff); err != nil {
+		t.Fatalf("failed to check guest out: %v", err)
+	}
+
+	invoice, err := invoices.GetInvoice(booking.ID)
+	if err != nil {
+		t.Fatalf("expected an invoice after check-out, got %v", err)
+	}
+	if !strings.HasPrefix(invoice.Number, invoice.FiscalYear+"-") {
+		t.Errorf("expected number %s to start with fiscal year %s", invoice.Number, invoice.FiscalYear)
+	}
+}
@@ -3,71 +3,148 @@ package services
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/IamMaheshGurung/privateOnsenBooking/models"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var (
+	// ErrOnsenSlotTaken is returned when another guest already holds the requested session
+	ErrOnsenSlotTaken = errors.New("time slot has just been taken")
+	// ErrOnsenSessionClosed is returned when a session is already cancelled or has started
+	ErrOnsenSessionClosed = errors.New("onsen session can no longer be cancelled")
+)
+
+// OnsenSlot is a single session in a bath's daily schedule
+type OnsenSlot struct {
+	TimeSlot  string `json:"time_slot"`
+	Available bool   `json:"available"`
+}
+
+// OnsenDaySchedule is a bath's hours on a date together with its sessions
+type OnsenDaySchedule struct {
+	Hours OnsenDayHours `json:"hours"`
+	Slots []OnsenSlot   `json:"slots"`
+}
+
 // OnsenBookingService handles all onsen booking related operations
 type OnsenBookingService struct {
-	db     *gorm.DB
-	logger *zap.Logger
+	db       *gorm.DB
+	logger   *zap.Logger
+	schedule *OnsenScheduleService
+	folio    *FolioService
 }
 
 // NewOnsenBookingService creates a new instance of OnsenBookingService
-func NewOnsenBookingService(db *gorm.DB, logger *zap.Logger) *OnsenBookingService {
+func NewOnsenBookingService(db *gorm.DB, logger *zap.Logger, schedule *OnsenScheduleService, folio *FolioService) *OnsenBookingService {
 	return &OnsenBookingService{
-		db:     db,
-		logger: logger,
+		db:       db,
+		logger:   logger,
+		schedule: schedule,
+		folio:    folio,
+	}
+}
+
+// GetActiveOnsens returns all baths that can currently be reserved
+func (obs *OnsenBookingService) GetActiveOnsens() ([]models.Onsen, error) {
+	var onsens []models.Onsen
+	if err := obs.db.Where("status = ?", models.OnsenStatusActive).Order("name").Find(&onsens).Error; err != nil {
+		obs.logger.Error("failed to fetch onsens", zap.Error(err))
+		return nil, fmt.Errorf("failed to fetch onsens: %w", err)
+	}
+
+	return onsens, nil
+}
+
+// GetOnsenByID retrieves a bath by ID
+func (obs *OnsenBookingService) GetOnsenByID(onsenID uint) (*models.Onsen, error) {
+	var onsen models.Onsen
+	if err := obs.db.First(&onsen, onsenID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			obs.logger.Warn("Onsen not found", zap.Uint("onsenID", onsenID))
+			return nil, fmt.Errorf("onsen with ID %d not found", onsenID)
+		}
+		obs.logger.Error("Database error when fetching onsen", zap.Error(err))
+		return nil, fmt.Errorf("failed to fetch onsen: %w", err)
 	}
+
+	return &onsen, nil
 }
 
-// GetAvailableTimeSlots returns available time slots for a specific date
-func (obs *OnsenBookingService) GetAvailableTimeSlots(date time.Time) ([]string, error) {
-	// Define all possible time slots
-	allTimeSlots := []string{
-		"09:00-10:00", "10:30-11:30", "12:00-13:00",
-		"13:30-14:30", "15:00-16:00", "16:30-17:30",
-		"18:00-19:00", "19:30-20:30", "21:00-22:00",
+// GetDailySchedule returns every session of a bath on a date with its availability
+func (obs *OnsenBookingService) GetDailySchedule(onsenID uint, date time.Time) (*OnsenDaySchedule, error) {
+	onsen, err := obs.GetOnsenByID(onsenID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get booked time slots for the date
+	allTimeSlots, hours, err := obs.schedule.GetTimeSlots(onsen, date)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get booked time slots for this bath on the date
 	var bookedSlots []string
 	if err := obs.db.Model(&models.OnsenBooking{}).
-		Where("date = ? AND status != ?", date, models.BookingStatusCancelled).
+		Where("onsen_id = ? AND date = ? AND status != ?", onsenID, date, models.BookingStatusCancelled).
 		Pluck("time_slot", &bookedSlots).Error; err != nil {
 		obs.logger.Error("failed to get booked time slots", zap.Error(err))
 		return nil, fmt.Errorf("failed to get booked time slots: %w", err)
 	}
 
-	// Find available slots
-	availableSlots := []string{}
+	booked := make(map[string]bool, len(bookedSlots))
+	for _, slot := range bookedSlots {
+		booked[slot] = true
+	}
+
+	schedule := &OnsenDaySchedule{
+		Hours: *hours,
+		Slots: make([]OnsenSlot, 0, len(allTimeSlots)),
+	}
 	for _, slot := range allTimeSlots {
-		isBooked := false
-		for _, bookedSlot := range bookedSlots {
-			if slot == bookedSlot {
-				isBooked = true
-				break
-			}
-		}
-		if !isBooked {
-			availableSlots = append(availableSlots, slot)
+		schedule.Slots = append(schedule.Slots, OnsenSlot{
+			TimeSlot:  slot,
+			Available: onsen.Status == models.OnsenStatusActive && !booked[slot],
+		})
+	}
+
+	return schedule, nil
+}
+
+// GetAvailableTimeSlots returns available time slots of a bath for a specific date
+func (obs *OnsenBookingService) GetAvailableTimeSlots(onsenID uint, date time.Time) ([]string, error) {
+	schedule, err := obs.GetDailySchedule(onsenID, date)
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule.AvailableSlots(), nil
+}
+
+// AvailableSlots returns the sessions of the schedule that can still be booked
+func (ds *OnsenDaySchedule) AvailableSlots() []string {
+	availableSlots := []string{}
+	for _, slot := range ds.Slots {
+		if slot.Available {
+			availableSlots = append(availableSlots, slot.TimeSlot)
 		}
 	}
 
-	return availableSlots, nil
+	return availableSlots
 }
 
-// IsTimeSlotAvailable checks if a time slot is available for a specific date
-func (obs *OnsenBookingService) IsTimeSlotAvailable(date time.Time, timeSlot string) (bool, error) {
+// IsTimeSlotAvailable checks if a time slot of a bath is available for a specific date
+func (obs *OnsenBookingService) IsTimeSlotAvailable(onsenID uint, date time.Time, timeSlot string) (bool, error) {
 	var count int64
 
 	if err := obs.db.Model(&models.OnsenBooking{}).
-		Where("date = ? AND time_slot = ? AND status != ?",
-			date, timeSlot, models.BookingStatusCancelled).
+		Where("onsen_id = ? AND date = ? AND time_slot = ? AND status != ?",
+			onsenID, date, timeSlot, models.BookingStatusCancelled).
 		Count(&count).Error; err != nil {
 		obs.logger.Error("failed to check time slot availability", zap.Error(err))
 		return false, fmt.Errorf("failed to check time slot availability: %w", err)
@@ -76,51 +153,266 @@ func (obs *OnsenBookingService) IsTimeSlotAvailable(date time.Time, timeSlot str
 	return count == 0, nil
 }
 
-// CreateOnsenBooking creates a new onsen booking
-func (obs *OnsenBookingService) CreateOnsenBooking(guestID, roomID uint, bookingID uint, date time.Time, timeSlot string) (*models.OnsenBooking, error) {
+// GetEligibleStay loads the room booking an onsen session is attached to and checks
+// that it belongs to the guest and room, is confirmed or checked in, and covers the date
+func (obs *OnsenBookingService) GetEligibleStay(bookingID, guestID, roomID uint, date time.Time) (*models.RoomBooking, error) {
+	return obs.eligibleStay(obs.db, bookingID, guestID, roomID, date)
+}
+
+// eligibleStay is GetEligibleStay as seen by db
+func (obs *OnsenBookingService) eligibleStay(db *gorm.DB, bookingID, guestID, roomID uint, date time.Time) (*models.RoomBooking, error) {
+	var stay models.RoomBooking
+	if err := db.Preload("Room").First(&stay, bookingID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("room booking %d not found", bookingID)
+		}
+		obs.logger.Error("failed to load room booking for onsen", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, fmt.Errorf("failed to load room booking: %w", err)
+	}
+
+	if stay.GuestID != guestID || stay.RoomID != roomID {
+		obs.logger.Warn("onsen request does not match room booking",
+			zap.Uint("bookingID", bookingID),
+			zap.Uint("guestID", guestID),
+			zap.Uint("roomID", roomID))
+		return nil, errors.New("the guest and room do not match this booking")
+	}
+
+	if stay.Status != models.BookingStatusConfirmed && stay.Status != models.BookingStatusCheckedIn {
+		return nil, fmt.Errorf("only confirmed or checked-in guests can reserve the onsen (booking is %s)", stay.Status)
+	}
+
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	first := time.Date(stay.CheckIn.Year(), stay.CheckIn.Month(), stay.CheckIn.Day(), 0, 0, 0, 0, time.UTC)
+	last := time.Date(stay.CheckOut.Year(), stay.CheckOut.Month(), stay.CheckOut.Day(), 0, 0, 0, 0, time.UTC)
+	if day.Before(first) || day.After(last) {
+		return nil, fmt.Errorf("onsen date must be between %s and %s",
+			first.Format("2006-01-02"), last.Format("2006-01-02"))
+	}
+
+	return &stay, nil
+}
+
+// GetFreeSessions returns the number of onsen sessions included with a room type
+func (obs *OnsenBookingService) GetFreeSessions(roomType string) (int, error) {
+	var entitlement models.OnsenEntitlement
+	err := obs.db.Where("room_type = ?", roomType).First(&entitlement).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		obs.logger.Error("failed to load onsen entitlement", zap.String("roomType", roomType), zap.Error(err))
+		return 0, fmt.Errorf("failed to load onsen entitlement: %w", err)
+	}
+
+	return entitlement.FreeSessions, nil
+}
+
+// GetRemainingFreeSessions returns how many included sessions a stay has not used yet
+func (obs *OnsenBookingService) GetRemainingFreeSessions(stay *models.RoomBooking) (int, error) {
+	return obs.remainingFreeSessions(obs.db, stay)
+}
+
+// remainingFreeSessions is GetRemainingFreeSessions as seen by db
+func (obs *OnsenBookingService) remainingFreeSessions(db *gorm.DB, stay *models.RoomBooking) (int, error) {
+	freeSessions, err := obs.GetFreeSessions(stay.Room.Type)
+	if err != nil {
+		return 0, err
+	}
+
+	var used int64
+	if err := db.Model(&models.OnsenBooking{}).
+		Where("booking_id = ? AND complimentary = ? AND status != ?", stay.ID, true, models.BookingStatusCancelled).
+		Count(&used).Error; err != nil {
+		obs.logger.Error("failed to count used onsen sessions", zap.Uint("bookingID", stay.ID), zap.Error(err))
+		return 0, fmt.Errorf("failed to count used onsen sessions: %w", err)
+	}
+
+	if remaining := freeSessions - int(used); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+// GetEntitlements returns the free session allowance of every room type
+func (obs *OnsenBookingService) GetEntitlements() ([]models.OnsenEntitlement, error) {
+	var entitlements []models.OnsenEntitlement
+	if err := obs.db.Order("room_type").Find(&entitlements).Error; err != nil {
+		obs.logger.Error("failed to get onsen entitlements", zap.Error(err))
+		return nil, fmt.Errorf("failed to get onsen entitlements: %w", err)
+	}
+
+	return entitlements, nil
+}
+
+// SetFreeSessions creates or updates the free session allowance of a room type
+func (obs *OnsenBookingService) SetFreeSessions(roomType string, freeSessions int) (*models.OnsenEntitlement, error) {
+	if roomType == "" {
+		return nil, errors.New("room type is required")
+	}
+
+	if freeSessions < 0 {
+		return nil, errors.New("free sessions cannot be negative")
+	}
+
+	var entitlement models.OnsenEntitlement
+	err := obs.db.Where("room_type = ?", roomType).First(&entitlement).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load onsen entitlement: %w", err)
+	}
+
+	entitlement.RoomType = roomType
+	entitlement.FreeSessions = freeSessions
+
+	if err := obs.db.Save(&entitlement).Error; err != nil {
+		obs.logger.Error("failed to save onsen entitlement", zap.String("roomType", roomType), zap.Error(err))
+		return nil, fmt.Errorf("failed to save onsen entitlement: %w", err)
+	}
+
+	return &entitlement, nil
+}
+
+// CreateOnsenBooking creates a new onsen booking for a guest with an active stay.
+// Sessions are free while the stay has included sessions left, otherwise they are
+// charged at the bath's price.
+func (obs *OnsenBookingService) CreateOnsenBooking(guestID, roomID uint, bookingID uint, onsenID uint, date time.Time, timeSlot string, guestCount int) (*models.OnsenBooking, error) {
+	if _, err := obs.GetEligibleStay(bookingID, guestID, roomID, date); err != nil {
+		return nil, err
+	}
+
+	onsen, err := obs.GetOnsenByID(onsenID)
+	if err != nil {
+		return nil, err
+	}
+
+	if onsen.Status != models.OnsenStatusActive {
+		obs.logger.Warn("onsen is not open for bookings", zap.Uint("onsenID", onsenID), zap.String("status", onsen.Status))
+		return nil, fmt.Errorf("%s is not open for bookings", onsen.Name)
+	}
+
+	if guestCount < 1 {
+		guestCount = 1
+	}
+
+	if guestCount > onsen.Capacity {
+		return nil, fmt.Errorf("%s can only accommodate up to %d guests", onsen.Name, onsen.Capacity)
+	}
+
+	if err := obs.checkSlot(obs.db, onsen, date, timeSlot); err != nil {
+		return nil, err
+	}
+
 	// Check if the time slot is available
-	available, err := obs.IsTimeSlotAvailable(date, timeSlot)
+	available, err := obs.IsTimeSlotAvailable(onsenID, date, timeSlot)
 	if err != nil {
 		return nil, err
 	}
 
 	if !available {
-		obs.logger.Warn("time slot is not available", zap.Time("date", date), zap.String("timeSlot", timeSlot))
-		return nil, errors.New("time slot is not available")
+		obs.logger.Warn("time slot is not available",
+			zap.Uint("onsenID", onsenID),
+			zap.Time("date", date),
+			zap.String("timeSlot", timeSlot))
+		return nil, ErrOnsenSlotTaken
 	}
 
-	// Set default onsen price
-	const onsenPrice = 5000.0 // 5000 JPY
-
-	// Create booking
 	booking := models.OnsenBooking{
-		GuestID:   guestID,
-		RoomID:    roomID,
-		BookingID: bookingID,
-		Date:      date,
-		TimeSlot:  timeSlot,
-		Status:    models.BookingStatusConfirmed,
-		Price:     onsenPrice,
+		GuestID:    guestID,
+		RoomID:     roomID,
+		BookingID:  bookingID,
+		OnsenID:    onsenID,
+		Date:       date,
+		TimeSlot:   timeSlot,
+		GuestCount: guestCount,
+		Status:     models.BookingStatusConfirmed,
 	}
 
-	if err := obs.db.Create(&booking).Error; err != nil {
+	// The partial unique index on (onsen_id, date, time_slot) rejects a concurrent
+	// booking that got past the availability check above. The stay is locked so
+	// concurrent requests count its free sessions one after the other, and the
+	// bath is share-locked and the slot checked again so a schedule change cannot
+	// drop it before the session is created and posted to the stay's folio.
+	err = obs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.RoomBooking{}, bookingID).Error; err != nil {
+			return fmt.Errorf("failed to lock room booking: %w", err)
+		}
+		stay, err := obs.eligibleStay(tx, bookingID, guestID, roomID, date)
+		if err != nil {
+			return err
+		}
+
+		var locked models.Onsen
+		if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&locked, onsenID).Error; err != nil {
+			return fmt.Errorf("failed to find onsen: %w", err)
+		}
+		if err := obs.checkSlot(tx, &locked, date, timeSlot); err != nil {
+			return err
+		}
+
+		remaining, err := obs.remainingFreeSessions(tx, stay)
+		if err != nil {
+			return err
+		}
+		booking.Complimentary = remaining > 0
+		booking.Price = locked.PricePerSlot
+		if booking.Complimentary {
+			booking.Price = models.NewMoney(0, booking.Price.Currency)
+		}
+
+		if err := tx.Create(&booking).Error; err != nil {
+			return err
+		}
+		return obs.folio.PostOnsenBooking(tx, &booking, &locked)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			obs.logger.Warn("time slot was taken concurrently",
+				zap.Uint("onsenID", onsenID),
+				zap.Time("date", date),
+				zap.String("timeSlot", timeSlot))
+			return nil, ErrOnsenSlotTaken
+		}
 		obs.logger.Error("failed to create onsen booking", zap.Error(err))
 		return nil, fmt.Errorf("failed to create onsen booking: %w", err)
 	}
 
+	booking.Onsen = *onsen
+
 	obs.logger.Info("onsen booking created",
 		zap.Uint("id", booking.ID),
+		zap.Uint("onsenID", onsenID),
 		zap.Time("date", date),
-		zap.String("timeSlot", timeSlot))
+		zap.String("timeSlot", timeSlot),
+		zap.Bool("complimentary", booking.Complimentary))
 
 	return &booking, nil
 }
 
+// checkSlot checks that timeSlot is one of a bath's sessions on date, as seen by db
+func (obs *OnsenBookingService) checkSlot(db *gorm.DB, onsen *models.Onsen, date time.Time, timeSlot string) error {
+	slots, hours, err := obs.schedule.timeSlots(db, onsen, date)
+	if err != nil {
+		return err
+	}
+
+	if hours.Closed {
+		return fmt.Errorf("%s is closed on %s: %s", onsen.Name, date.Format("2006-01-02"), hours.Reason)
+	}
+
+	for _, slot := range slots {
+		if slot == timeSlot {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s is not a valid time slot for %s", timeSlot, onsen.Name)
+}
+
 // GetOnsenBookingByID retrieves an onsen booking by ID
 func (obs *OnsenBookingService) GetOnsenBookingByID(id uint) (*models.OnsenBooking, error) {
 	var booking models.OnsenBooking
 
-	if err := obs.db.Preload("Guest").Preload("Room").First(&booking, id).Error; err != nil {
+	if err := obs.db.Preload("Guest").Preload("Room").Preload("Onsen").First(&booking, id).Error; err != nil {
 		obs.logger.Error("failed to get onsen booking", zap.Uint("id", id), zap.Error(err))
 		return nil, fmt.Errorf("failed to get onsen booking: %w", err)
 	}
@@ -128,16 +420,33 @@ func (obs *OnsenBookingService) GetOnsenBookingByID(id uint) (*models.OnsenBooki
 	return &booking, nil
 }
 
-// CancelOnsenBooking cancels an onsen booking
+// CancelOnsenBooking cancels an onsen booking that has not started yet. The row is
+// locked so a concurrent cancellation cannot void the folio charge twice.
 func (obs *OnsenBookingService) CancelOnsenBooking(id uint) error {
-	booking, err := obs.GetOnsenBookingByID(id)
-	if err != nil {
-		return err
-	}
+	err := obs.db.Transaction(func(tx *gorm.DB) error {
+		var booking models.OnsenBooking
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("onsen booking %d not found", id)
+			}
+			return err
+		}
+
+		if booking.Status != models.BookingStatusConfirmed {
+			return fmt.Errorf("%w: it is %s", ErrOnsenSessionClosed, booking.Status)
+		}
 
-	booking.Status = models.BookingStatusCancelled
+		start, err := sessionStart(&booking)
+		if err != nil {
+			return err
+		}
+		if !time.Now().Before(start) {
+			return fmt.Errorf("%w: it started at %s", ErrOnsenSessionClosed, start.Format("2006-01-02 15:04"))
+		}
 
-	if err := obs.db.Save(booking).Error; err != nil {
+		return obs.cancelSessions(tx, []models.OnsenBooking{booking})
+	})
+	if err != nil {
 		obs.logger.Error("failed to cancel onsen booking", zap.Uint("id", id), zap.Error(err))
 		return fmt.Errorf("failed to cancel onsen booking: %w", err)
 	}
@@ -146,18 +455,70 @@ func (obs *OnsenBookingService) CancelOnsenBooking(id uint) error {
 	return nil
 }
 
-// GetOnsenBookingsByDate retrieves all onsen bookings for a specific date
-func (obs *OnsenBookingService) GetOnsenBookingsByDate(date time.Time) ([]models.OnsenBooking, error) {
+// sessionStart returns when an onsen session begins in the property's local time,
+// taken from the start of its time slot, e.g. 18:00 for "18:00-19:00"
+func sessionStart(session *models.OnsenBooking) (time.Time, error) {
+	from, _, _ := strings.Cut(session.TimeSlot, "-")
+	clock, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid onsen time slot %q: %w", session.TimeSlot, err)
+	}
+
+	d := session.Date
+	return time.Date(d.Year(), d.Month(), d.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local), nil
+}
+
+// staySessions returns the onsen sessions of a stay that are still booked
+func (obs *OnsenBookingService) staySessions(db *gorm.DB, stayID uint) ([]models.OnsenBooking, error) {
+	var sessions []models.OnsenBooking
+	if err := db.Preload("Onsen").
+		Where("booking_id = ? AND status = ?", stayID, models.BookingStatusConfirmed).
+		Order("date, time_slot").
+		Find(&sessions).Error; err != nil {
+		obs.logger.Error("failed to get stay onsen sessions", zap.Uint("bookingID", stayID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get onsen sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// cancelSessions cancels onsen sessions within tx and takes them off the folio
+func (obs *OnsenBookingService) cancelSessions(tx *gorm.DB, sessions []models.OnsenBooking) error {
+	for i := range sessions {
+		if err := tx.Model(&sessions[i]).Update("status", models.BookingStatusCancelled).Error; err != nil {
+			return fmt.Errorf("failed to cancel onsen session: %w", err)
+		}
+		if err := obs.folio.VoidOnsenBooking(tx, &sessions[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// onsenSessionText describes an onsen session for guests, e.g.
+// Cedar bath, 2025-10-02 18:00-19:00
+func onsenSessionText(session *models.OnsenBooking) string {
+	return fmt.Sprintf("%s, %s %s", session.Onsen.Name, session.Date.Format("2006-01-02"), session.TimeSlot)
+}
+
+// GetOnsenBookingsByDate retrieves all onsen bookings for a specific date,
+// optionally restricted to one bath when onsenID is non-zero
+func (obs *OnsenBookingService) GetOnsenBookingsByDate(onsenID uint, date time.Time) ([]models.OnsenBooking, error) {
 	var bookings []models.OnsenBooking
 
 	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
 	endOfDay := startOfDay.Add(24 * time.Hour)
 
-	if err := obs.db.Preload("Guest").Preload("Room").
+	query := obs.db.Preload("Guest").Preload("Room").Preload("Onsen").
 		Where("date >= ? AND date < ? AND status != ?",
-			startOfDay, endOfDay, models.BookingStatusCancelled).
-		Order("time_slot").
-		Find(&bookings).Error; err != nil {
+			startOfDay, endOfDay, models.BookingStatusCancelled)
+
+	if onsenID != 0 {
+		query = query.Where("onsen_id = ?", onsenID)
+	}
+
+	if err := query.Order("onsen_id, time_slot").Find(&bookings).Error; err != nil {
 		obs.logger.Error("failed to get onsen bookings by date", zap.Time("date", date), zap.Error(err))
 		return nil, fmt.Errorf("failed to get onsen bookings by date: %w", err)
 	}
@@ -171,7 +532,7 @@ func (obs *OnsenBookingService) GetUpcomingOnsenBookings() ([]models.OnsenBookin
 
 	now := time.Now()
 
-	if err := obs.db.Preload("Guest").Preload("Room").
+	if err := obs.db.Preload("Guest").Preload("Room").Preload("Onsen").
 		Where("date > ? AND status = ?",
 			now, models.BookingStatusConfirmed).
 		Order("date, time_slot").
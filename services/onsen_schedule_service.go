@@ -0,0 +1,346 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"github.com/IamMaheshGurung/privateOnsenBooking/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrOnsenScheduleConflict is returned when a schedule change would drop sessions
+// guests have already booked
+var ErrOnsenScheduleConflict = errors.New("schedule change conflicts with booked onsen sessions")
+
+// OnsenDayHours describes how a bath operates on one particular date
+type OnsenDayHours struct {
+	OpenTime      string `json:"open_time"`
+	CloseTime     string `json:"close_time"`
+	SlotMinutes   int    `json:"slot_minutes"`
+	BufferMinutes int    `json:"buffer_minutes"`
+	Closed        bool   `json:"closed"`
+	Reason        string `json:"reason,omitempty"` // Why the bath is closed, if it is
+}
+
+// OnsenScheduleService manages opening hours, session layout and closures of the baths
+type OnsenScheduleService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewOnsenScheduleService creates a new instance of OnsenScheduleService
+func NewOnsenScheduleService(db *gorm.DB, logger *zap.Logger) *OnsenScheduleService {
+	return &OnsenScheduleService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// GetDayHours resolves a bath's hours for a date. Closures take precedence over
+// weekday overrides, which take precedence over the bath's default hours.
+func (oss *OnsenScheduleService) GetDayHours(onsen *models.Onsen, date time.Time) (*OnsenDayHours, error) {
+	return oss.dayHours(oss.db, onsen, date)
+}
+
+// dayHours resolves a bath's hours for a date as seen by db
+func (oss *OnsenScheduleService) dayHours(db *gorm.DB, onsen *models.Onsen, date time.Time) (*OnsenDayHours, error) {
+	hours := &OnsenDayHours{
+		OpenTime:      onsen.OpenTime,
+		CloseTime:     onsen.CloseTime,
+		SlotMinutes:   onsen.SlotMinutes,
+		BufferMinutes: onsen.BufferMinutes,
+	}
+
+	var closure models.OnsenClosure
+	err := db.Where("(onsen_id = ? OR onsen_id = 0) AND date = ?", onsen.ID, date.Format("2006-01-02")).
+		First(&closure).Error
+	if err == nil {
+		hours.Closed = true
+		hours.Reason = closure.Reason
+		if hours.Reason == "" {
+			hours.Reason = "Closed"
+		}
+		return hours, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		oss.logger.Error("failed to check onsen closures", zap.Uint("onsenID", onsen.ID), zap.Error(err))
+		return nil, fmt.Errorf("failed to check onsen closures: %w", err)
+	}
+
+	var override models.OnsenOpeningHours
+	err = db.Where("onsen_id = ? AND weekday = ?", onsen.ID, date.Weekday()).First(&override).Error
+	if err == nil {
+		if override.Closed {
+			hours.Closed = true
+			hours.Reason = fmt.Sprintf("Closed on %ss", date.Weekday())
+			return hours, nil
+		}
+		hours.OpenTime = override.OpenTime
+		hours.CloseTime = override.CloseTime
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		oss.logger.Error("failed to load opening hours", zap.Uint("onsenID", onsen.ID), zap.Error(err))
+		return nil, fmt.Errorf("failed to load opening hours: %w", err)
+	}
+
+	return hours, nil
+}
+
+// GetTimeSlots returns the session slots of a bath on a date, or none if it is closed
+func (oss *OnsenScheduleService) GetTimeSlots(onsen *models.Onsen, date time.Time) ([]string, *OnsenDayHours, error) {
+	return oss.timeSlots(oss.db, onsen, date)
+}
+
+// timeSlots returns the session slots of a bath on a date as seen by db
+func (oss *OnsenScheduleService) timeSlots(db *gorm.DB, onsen *models.Onsen, date time.Time) ([]string, *OnsenDayHours, error) {
+	hours, err := oss.dayHours(db, onsen, date)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if hours.Closed {
+		return []string{}, hours, nil
+	}
+
+	slots, err := utils.GetTimeSlots(
+		hours.OpenTime,
+		hours.CloseTime,
+		time.Duration(hours.SlotMinutes)*time.Minute,
+		time.Duration(hours.BufferMinutes)*time.Minute,
+	)
+	if err != nil {
+		oss.logger.Error("failed to build onsen time slots", zap.Uint("onsenID", onsen.ID), zap.Error(err))
+		return nil, nil, fmt.Errorf("invalid schedule for %s: %w", onsen.Name, err)
+	}
+
+	return slots, hours, nil
+}
+
+// UpdateSessionLayout changes a bath's default hours, session length and cleaning
+// buffer. It is refused while booked sessions would fall outside the new layout.
+func (oss *OnsenScheduleService) UpdateSessionLayout(onsenID uint, open, close string, slotMinutes, bufferMinutes int) (*models.Onsen, error) {
+	if slotMinutes <= 0 || bufferMinutes < 0 {
+		return nil, fmt.Errorf("slot length must be positive and buffer cannot be negative")
+	}
+
+	if _, err := utils.GetTimeSlots(open, close, time.Duration(slotMinutes)*time.Minute, 0); err != nil {
+		return nil, err
+	}
+
+	var onsen models.Onsen
+	err := oss.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&onsen, onsenID).Error; err != nil {
+			return fmt.Errorf("failed to find onsen: %w", err)
+		}
+
+		onsen.OpenTime = open
+		onsen.CloseTime = close
+		onsen.SlotMinutes = slotMinutes
+		onsen.BufferMinutes = bufferMinutes
+
+		if err := tx.Save(&onsen).Error; err != nil {
+			oss.logger.Error("failed to update onsen session layout", zap.Uint("onsenID", onsenID), zap.Error(err))
+			return fmt.Errorf("failed to update onsen: %w", err)
+		}
+
+		return oss.checkBookedSessions(tx, onsenID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &onsen, nil
+}
+
+// GetOpeningHours returns the weekday overrides configured for a bath
+func (oss *OnsenScheduleService) GetOpeningHours(onsenID uint) ([]models.OnsenOpeningHours, error) {
+	var hours []models.OnsenOpeningHours
+	if err := oss.db.Where("onsen_id = ?", onsenID).Order("weekday").Find(&hours).Error; err != nil {
+		oss.logger.Error("failed to get opening hours", zap.Uint("onsenID", onsenID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get opening hours: %w", err)
+	}
+
+	return hours, nil
+}
+
+// SetOpeningHours creates or replaces a bath's hours for one day of the week. It is
+// refused while booked sessions would fall outside the new hours.
+func (oss *OnsenScheduleService) SetOpeningHours(onsenID uint, weekday time.Weekday, open, close string, closed bool) (*models.OnsenOpeningHours, error) {
+	if weekday < time.Sunday || weekday > time.Saturday {
+		return nil, fmt.Errorf("invalid weekday %d", weekday)
+	}
+
+	if !closed {
+		if _, err := utils.GetTimeSlots(open, close, time.Minute, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	var hours models.OnsenOpeningHours
+	err := oss.db.Transaction(func(tx *gorm.DB) error {
+		if err := oss.lockOnsens(tx, onsenID); err != nil {
+			return err
+		}
+
+		err := tx.Where("onsen_id = ? AND weekday = ?", onsenID, weekday).First(&hours).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to load opening hours: %w", err)
+		}
+
+		hours.OnsenID = onsenID
+		hours.Weekday = weekday
+		hours.OpenTime = open
+		hours.CloseTime = close
+		hours.Closed = closed
+
+		if err := tx.Save(&hours).Error; err != nil {
+			oss.logger.Error("failed to save opening hours", zap.Uint("onsenID", onsenID), zap.Error(err))
+			return fmt.Errorf("failed to save opening hours: %w", err)
+		}
+
+		return oss.checkBookedSessions(tx, onsenID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &hours, nil
+}
+
+// GetClosures returns closures between two dates, inclusive
+func (oss *OnsenScheduleService) GetClosures(from, to time.Time) ([]models.OnsenClosure, error) {
+	var closures []models.OnsenClosure
+	if err := oss.db.Where("date >= ? AND date <= ?", from.Format("2006-01-02"), to.Format("2006-01-02")).
+		Order("date, onsen_id").
+		Find(&closures).Error; err != nil {
+		oss.logger.Error("failed to get onsen closures", zap.Error(err))
+		return nil, fmt.Errorf("failed to get onsen closures: %w", err)
+	}
+
+	return closures, nil
+}
+
+// AddClosure closes a bath (or all baths when onsenID is 0) for a date. It is
+// refused while guests have sessions booked on that date.
+func (oss *OnsenScheduleService) AddClosure(onsenID uint, date time.Time, reason string) (*models.OnsenClosure, error) {
+	closure := models.OnsenClosure{
+		OnsenID: onsenID,
+		Date:    time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+		Reason:  reason,
+	}
+
+	err := oss.db.Transaction(func(tx *gorm.DB) error {
+		if err := oss.lockOnsens(tx, onsenID); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&closure).Error; err != nil {
+			oss.logger.Error("failed to add onsen closure", zap.Uint("onsenID", onsenID), zap.Error(err))
+			return fmt.Errorf("failed to add onsen closure: %w", err)
+		}
+
+		return oss.checkBookedSessions(tx, onsenID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	oss.logger.Info("onsen closure added",
+		zap.Uint("onsenID", onsenID),
+		zap.Time("date", closure.Date),
+		zap.String("reason", reason))
+
+	return &closure, nil
+}
+
+// lockOnsens locks a bath, or every bath when onsenID is 0, so no session can be
+// booked on it until a schedule change in tx commits
+func (oss *OnsenScheduleService) lockOnsens(tx *gorm.DB, onsenID uint) error {
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&models.Onsen{})
+	if onsenID != 0 {
+		query = query.Where("id = ?", onsenID)
+	}
+
+	var ids []uint
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return fmt.Errorf("failed to lock onsen: %w", err)
+	}
+	if onsenID != 0 && len(ids) == 0 {
+		return fmt.Errorf("failed to find onsen: %w", gorm.ErrRecordNotFound)
+	}
+
+	return nil
+}
+
+// checkBookedSessions checks, against the schedule as changed in tx, that every
+// session still to come on a bath (or on every bath when onsenID is 0) falls on
+// one of its slots, and returns ErrOnsenScheduleConflict listing those that do not
+func (oss *OnsenScheduleService) checkBookedSessions(tx *gorm.DB, onsenID uint) error {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	query := tx.Preload("Onsen").
+		Where("status = ? AND date >= ?", models.BookingStatusConfirmed, today)
+	if onsenID != 0 {
+		query = query.Where("onsen_id = ?", onsenID)
+	}
+
+	var sessions []models.OnsenBooking
+	if err := query.Order("date, onsen_id, time_slot").Find(&sessions).Error; err != nil {
+		oss.logger.Error("failed to load booked onsen sessions", zap.Uint("onsenID", onsenID), zap.Error(err))
+		return fmt.Errorf("failed to load booked onsen sessions: %w", err)
+	}
+
+	var conflicts []string
+	for i := range sessions {
+		session := &sessions[i]
+		if start, err := sessionStart(session); err == nil && start.Before(now) {
+			continue
+		}
+
+		slots, _, err := oss.timeSlots(tx, &session.Onsen, session.Date)
+		if err != nil {
+			return err
+		}
+
+		kept := false
+		for _, slot := range slots {
+			if slot == session.TimeSlot {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			conflicts = append(conflicts, fmt.Sprintf("#%d %s", session.ID, onsenSessionText(session)))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		oss.logger.Warn("onsen schedule change conflicts with booked sessions",
+			zap.Uint("onsenID", onsenID),
+			zap.Strings("sessions", conflicts))
+		return fmt.Errorf("%w: cancel or move %s first", ErrOnsenScheduleConflict, strings.Join(conflicts, "; "))
+	}
+
+	return nil
+}
+
+// RemoveClosure deletes a closure so the bath reopens on that date
+func (oss *OnsenScheduleService) RemoveClosure(id uint) error {
+	result := oss.db.Delete(&models.OnsenClosure{}, id)
+	if result.Error != nil {
+		oss.logger.Error("failed to remove onsen closure", zap.Uint("id", id), zap.Error(result.Error))
+		return fmt.Errorf("failed to remove onsen closure: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("closure not found")
+	}
+
+	return nil
+}
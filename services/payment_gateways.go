@@ -0,0 +1,323 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+)
+
+// PaymentRequest is what a gateway needs to take a payment for a booking
+type PaymentRequest struct {
+	BookingID   uint
+	Reference   string // Booking reference shown on the guest's statement
+	Amount      models.Money
+	Token       string // Card token from the provider's checkout, if any
+	GuestEmail  string
+	Description string
+}
+
+// PaymentResult is the gateway's answer to a PaymentRequest
+type PaymentResult struct {
+	Status           string // One of the models.PaymentStatus* constants
+	GatewayReference string
+	FailureReason    string
+}
+
+// PaymentGateway takes payments through one payment method
+type PaymentGateway interface {
+	// Method returns the payment method handled, e.g. models.PaymentMethodCard
+	Method() string
+	// Charge attempts the payment. A declined payment is a result with
+	// PaymentStatusFailed, an error means the gateway could not be reached.
+	Charge(req PaymentRequest) (*PaymentResult, error)
+}
+
+// RefundRequest is what a gateway needs to return money for a payment
+type RefundRequest struct {
+	RefundID         uint
+	BookingID        uint
+	GatewayReference string // Reference of the original payment
+	Amount           models.Money
+	Reason           string
+}
+
+// RefundResult is the gateway's answer to a RefundRequest
+type RefundResult struct {
+	Status           string // One of the models.RefundStatus* constants
+	GatewayReference string
+	FailureReason    string
+}
+
+// RefundGateway is implemented by gateways that can send money back to the
+// guest. Cash refunds are paid out at the front desk and recorded by hand.
+type RefundGateway interface {
+	PaymentGateway
+	// Refund returns money for an earlier payment. A rejected refund is a
+	// result with RefundStatusFailed, an error means the gateway could not be reached.
+	Refund(req RefundRequest) (*RefundResult, error)
+}
+
+// CashGateway handles pay-at-property bookings. Nothing is collected online,
+// the booking is guaranteed and the balance is settled at the front desk.
+type CashGateway struct{}
+
+// NewCashGateway creates a new pay-at-property gateway
+func NewCashGateway() *CashGateway {
+	return &CashGateway{}
+}
+
+// Method returns models.PaymentMethodCash
+func (g *CashGateway) Method() string {
+	return models.PaymentMethodCash
+}
+
+// Charge authorizes the payment to be collected on arrival
+func (g *CashGateway) Charge(req PaymentRequest) (*PaymentResult, error) {
+	return &PaymentResult{
+		Status:           models.PaymentStatusAuthorized,
+		GatewayReference: "CASH-" + req.Reference,
+	}, nil
+}
+
+// CardGatewayConfig contains the settings of the card payment provider
+type CardGatewayConfig struct {
+	Endpoint       string // Charge endpoint of the provider's API
+	RefundEndpoint string // Refund endpoint of the provider's API
+	APIKey         string
+	Timeout        time.Duration
+}
+
+// CardGateway adapts a card payment provider's REST API to PaymentGateway
+type CardGateway struct {
+	config CardGatewayConfig
+	client *http.Client
+}
+
+// NewCardGateway creates a new card gateway adapter
+func NewCardGateway(config CardGatewayConfig) *CardGateway {
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	return &CardGateway{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// Method returns models.PaymentMethodCard
+func (g *CardGateway) Method() string {
+	return models.PaymentMethodCard
+}
+
+// cardChargeRequest is the body sent to the provider
+type cardChargeRequest struct {
+	Amount      int64  `json:"amount"` // Minor units
+	Currency    string `json:"currency"`
+	Source      string `json:"source"`
+	Description string `json:"description"`
+	Metadata    struct {
+		BookingID uint   `json:"booking_id"`
+		Reference string `json:"reference"`
+	} `json:"metadata"`
+}
+
+// cardChargeResponse is the part of the provider's answer that is used
+type cardChargeResponse struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"` // succeeded, requires_capture, failed
+	FailureMessage string `json:"failure_message"`
+}
+
+// Charge sends the card token to the provider
+func (g *CardGateway) Charge(req PaymentRequest) (*PaymentResult, error) {
+	if req.Token == "" {
+		return &PaymentResult{
+			Status:        models.PaymentStatusFailed,
+			FailureReason: "card details are missing",
+		}, nil
+	}
+
+	body := cardChargeRequest{
+		Amount:      req.Amount.Minor,
+		Currency:    strings.ToLower(req.Amount.Currency),
+		Source:      req.Token,
+		Description: req.Description,
+	}
+	body.Metadata.BookingID = req.BookingID
+	body.Metadata.Reference = req.Reference
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode card charge: %w", err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, g.config.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create card charge request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+g.config.APIKey)
+	httpReq.Header.Set("Idempotency-Key", fmt.Sprintf("booking-%d-%s", req.BookingID, req.Token))
+
+	resp, err := g.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("card gateway unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var charge cardChargeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&charge); err != nil {
+		return nil, fmt.Errorf("invalid card gateway response (HTTP %d): %w", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("card gateway error (HTTP %d)", resp.StatusCode)
+	}
+
+	result := &PaymentResult{GatewayReference: charge.ID}
+	switch charge.Status {
+	case "succeeded":
+		result.Status = models.PaymentStatusSucceeded
+	case "requires_capture":
+		result.Status = models.PaymentStatusAuthorized
+	default:
+		result.Status = models.PaymentStatusFailed
+		result.FailureReason = charge.FailureMessage
+		if result.FailureReason == "" {
+			result.FailureReason = "card was declined"
+		}
+	}
+
+	return result, nil
+}
+
+// cardRefundRequest is the refund body sent to the provider
+type cardRefundRequest struct {
+	Charge   string `json:"charge"`
+	Amount   int64  `json:"amount"` // Minor units
+	Currency string `json:"currency"`
+	Reason   string `json:"reason"`
+}
+
+// cardRefundResponse is the part of the provider's refund answer that is used
+type cardRefundResponse struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"` // succeeded, pending, failed
+	FailureMessage string `json:"failure_message"`
+}
+
+// Refund asks the provider to return money to the card that was charged
+func (g *CardGateway) Refund(req RefundRequest) (*RefundResult, error) {
+	if g.config.RefundEndpoint == "" {
+		return nil, errors.New("card refund endpoint is not configured")
+	}
+	if req.GatewayReference == "" {
+		return &RefundResult{
+			Status:        models.RefundStatusFailed,
+			FailureReason: "original charge reference is missing",
+		}, nil
+	}
+
+	payload, err := json.Marshal(cardRefundRequest{
+		Charge:   req.GatewayReference,
+		Amount:   req.Amount.Minor,
+		Currency: strings.ToLower(req.Amount.Currency),
+		Reason:   req.Reason,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode card refund: %w", err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, g.config.RefundEndpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create card refund request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+g.config.APIKey)
+	httpReq.Header.Set("Idempotency-Key", fmt.Sprintf("refund-%d", req.RefundID))
+
+	resp, err := g.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("card gateway unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var refund cardRefundResponse
+	if err := json.NewDecoder(resp.Body).Decode(&refund); err != nil {
+		return nil, fmt.Errorf("invalid card gateway response (HTTP %d): %w", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("card gateway error (HTTP %d)", resp.StatusCode)
+	}
+
+	result := &RefundResult{GatewayReference: refund.ID}
+	switch refund.Status {
+	case "succeeded", "pending":
+		// A pending refund has been accepted and will reach the card in a few days
+		result.Status = models.RefundStatusProcessed
+	default:
+		result.Status = models.RefundStatusFailed
+		result.FailureReason = refund.FailureMessage
+		if result.FailureReason == "" {
+			result.FailureReason = "refund was rejected"
+		}
+	}
+
+	return result, nil
+}
+
+// FakeGateway is a local gateway for development and tests. It approves
+// every payment except those made with one of the decline tokens.
+type FakeGateway struct {
+	now func() time.Time
+}
+
+// Tokens that make the FakeGateway decline or fail
+const (
+	FakeTokenDecline = "tok_decline"
+	FakeTokenError   = "tok_error"
+)
+
+// NewFakeGateway creates a new fake gateway
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{now: time.Now}
+}
+
+// Method returns models.PaymentMethodFake
+func (g *FakeGateway) Method() string {
+	return models.PaymentMethodFake
+}
+
+// Charge approves the payment unless a decline token is used
+func (g *FakeGateway) Charge(req PaymentRequest) (*PaymentResult, error) {
+	switch req.Token {
+	case FakeTokenError:
+		return nil, errors.New("fake gateway unavailable")
+	case FakeTokenDecline:
+		return &PaymentResult{
+			Status:        models.PaymentStatusFailed,
+			FailureReason: "card was declined",
+		}, nil
+	}
+
+	return &PaymentResult{
+		Status:           models.PaymentStatusSucceeded,
+		GatewayReference: fmt.Sprintf("fake_%d_%d", req.BookingID, g.now().UnixNano()),
+	}, nil
+}
+
+// Refund approves every refund of a fake payment
+func (g *FakeGateway) Refund(req RefundRequest) (*RefundResult, error) {
+	return &RefundResult{
+		Status:           models.RefundStatusProcessed,
+		GatewayReference: fmt.Sprintf("fake_refund_%d_%d", req.RefundID, g.now().UnixNano()),
+	}, nil
+}
@@ -0,0 +1,748 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Payment errors that callers can tell apart
+var (
+	ErrUnsupportedPaymentMethod = errors.New("payment method is not supported")
+	ErrPaymentDeclined          = errors.New("payment was declined")
+	ErrBookingNotPayable        = errors.New("booking is not awaiting payment")
+	ErrPaymentInProgress        = errors.New("booking already has a payment in progress or taken")
+	ErrUnknownWebhookProvider   = errors.New("unknown payment provider")
+	ErrInvalidWebhookSignature  = errors.New("invalid webhook signature")
+	ErrPaymentNotFound          = errors.New("payment not found")
+	ErrRefundNotFound           = errors.New("refund not found")
+	ErrRefundNotPending         = errors.New("refund has already been processed")
+	ErrRefundApproverRequired   = errors.New("refund needs an approver")
+	ErrManualRefundRequired     = errors.New("payment method cannot refund automatically, refund by hand")
+)
+
+// Webhook event types sent by payment providers
+const (
+	WebhookPaymentAuthorized = "payment.authorized"
+	WebhookPaymentSucceeded  = "payment.succeeded"
+	WebhookPaymentFailed     = "payment.failed"
+)
+
+// WebhookEvent is the body of a payment provider webhook
+type WebhookEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		GatewayReference string `json:"gateway_reference"`
+		FailureMessage   string `json:"failure_message"`
+	} `json:"data"`
+}
+
+// paymentTransitions lists the statuses a payment may move to from each status.
+// Succeeded is final; refunds are recorded separately.
+var paymentTransitions = map[string][]string{
+	models.PaymentStatusPending:    {models.PaymentStatusAuthorized, models.PaymentStatusSucceeded, models.PaymentStatusFailed},
+	models.PaymentStatusAuthorized: {models.PaymentStatusSucceeded, models.PaymentStatusFailed},
+	models.PaymentStatusFailed:     {models.PaymentStatusSucceeded},
+}
+
+// PaymentService takes payments for room bookings through the configured gateways
+type PaymentService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	rooms    *RoomBookingService
+	gateways map[string]PaymentGateway
+	methods  []string          // Payment methods in the order their gateways were given
+	secrets  map[string]string // Webhook signing secret per provider
+}
+
+// NewPaymentService creates a new instance of PaymentService
+func NewPaymentService(db *gorm.DB, logger *zap.Logger, rooms *RoomBookingService, gateways ...PaymentGateway) *PaymentService {
+	ps := &PaymentService{
+		db:       db,
+		logger:   logger,
+		rooms:    rooms,
+		gateways: make(map[string]PaymentGateway, len(gateways)),
+		secrets:  make(map[string]string),
+	}
+	for _, gateway := range gateways {
+		if _, ok := ps.gateways[gateway.Method()]; !ok {
+			ps.methods = append(ps.methods, gateway.Method())
+		}
+		ps.gateways[gateway.Method()] = gateway
+	}
+
+	return ps
+}
+
+// SupportsMethod reports whether a gateway is configured for the payment method
+func (ps *PaymentService) SupportsMethod(method string) bool {
+	_, ok := ps.gateways[method]
+	return ok
+}
+
+// Methods returns the payment methods guests can choose from
+func (ps *PaymentService) Methods() []string {
+	return ps.methods
+}
+
+// ProcessBookingPayment charges a pending booking through the gateway of the
+// chosen method. The booking is confirmed only when the payment succeeds or is
+// authorized; a declined payment is recorded and ErrPaymentDeclined returned.
+//
+// The booking is locked while the pending payment is recorded, so a second
+// request for the same booking sees that payment and gets ErrPaymentInProgress
+// instead of charging the guest twice. Only after a failed payment may the guest
+// pay again.
+func (ps *PaymentService) ProcessBookingPayment(booking *models.RoomBooking, amount models.Money, method, token string) (*models.Payment, error) {
+	gateway, ok := ps.gateways[method]
+	if !ok {
+		return nil, ErrUnsupportedPaymentMethod
+	}
+
+	var payment models.Payment
+	err := ps.db.Transaction(func(tx *gorm.DB) error {
+		var locked models.RoomBooking
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, booking.ID).Error; err != nil {
+			return fmt.Errorf("failed to lock booking: %w", err)
+		}
+		if locked.Status != models.BookingStatusPending {
+			return ErrBookingNotPayable
+		}
+		if locked.ExpiresAt != nil && !locked.ExpiresAt.After(time.Now()) {
+			return ErrHoldExpired
+		}
+
+		var open int64
+		if err := tx.Model(&models.Payment{}).
+			Where("booking_id = ? AND status IN ?", locked.ID, []string{
+				models.PaymentStatusPending,
+				models.PaymentStatusAuthorized,
+				models.PaymentStatusSucceeded,
+			}).
+			Count(&open).Error; err != nil {
+			return fmt.Errorf("failed to check payments: %w", err)
+		}
+		if open > 0 {
+			return ErrPaymentInProgress
+		}
+
+		payment = models.Payment{
+			BookingID: locked.ID,
+			Amount:    amount.In(locked.TotalPrice.Currency),
+			Method:    method,
+			Status:    models.PaymentStatusPending,
+		}
+		if err := tx.Create(&payment).Error; err != nil {
+			return fmt.Errorf("failed to record payment: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrBookingNotPayable) || errors.Is(err, ErrHoldExpired) || errors.Is(err, ErrPaymentInProgress) {
+			return nil, err
+		}
+		ps.logger.Error("failed to record payment", zap.Uint("bookingID", booking.ID), zap.Error(err))
+		return nil, err
+	}
+	amount = payment.Amount
+
+	result, err := gateway.Charge(PaymentRequest{
+		BookingID:   booking.ID,
+		Reference:   booking.ReferenceNumber,
+		Amount:      amount,
+		Token:       token,
+		GuestEmail:  booking.Guest.Email,
+		Description: "Room booking " + booking.ReferenceNumber,
+	})
+	if err != nil {
+		ps.logger.Error("payment gateway error",
+			zap.Uint("paymentID", payment.ID),
+			zap.String("method", method),
+			zap.Error(err))
+		result = &PaymentResult{
+			Status:        models.PaymentStatusFailed,
+			FailureReason: err.Error(),
+		}
+	}
+
+	now := time.Now()
+	payment.Status = result.Status
+	payment.GatewayReference = result.GatewayReference
+	payment.FailureReason = result.FailureReason
+	payment.ProcessedAt = &now
+
+	if err := ps.db.Save(&payment).Error; err != nil {
+		ps.logger.Error("failed to update payment", zap.Uint("paymentID", payment.ID), zap.Error(err))
+		return nil, fmt.Errorf("failed to update payment: %w", err)
+	}
+
+	if payment.Status != models.PaymentStatusSucceeded && payment.Status != models.PaymentStatusAuthorized {
+		ps.logger.Warn("payment declined",
+			zap.Uint("bookingID", booking.ID),
+			zap.String("method", method),
+			zap.String("reason", payment.FailureReason))
+		return &payment, fmt.Errorf("%w: %s", ErrPaymentDeclined, payment.FailureReason)
+	}
+
+	if err := ps.rooms.ConfirmHold(booking.ID); err != nil {
+		ps.logger.Error("payment taken but booking could not be confirmed",
+			zap.Uint("bookingID", booking.ID),
+			zap.Uint("paymentID", payment.ID),
+			zap.Error(err))
+
+		// The charge stays recorded; give the money back since the booking is gone
+		if errors.Is(err, ErrHoldExpired) || errors.Is(err, ErrInvalidTransition) {
+			if settleErr := ps.db.Transaction(func(tx *gorm.DB) error {
+				return ps.settleUnconfirmedPayment(tx, &payment, unconfirmedReason(err))
+			}); settleErr != nil {
+				ps.logger.Error("failed to refund payment for an unconfirmed booking",
+					zap.Uint("paymentID", payment.ID),
+					zap.Error(settleErr))
+			}
+		}
+		return &payment, err
+	}
+
+	ps.logger.Info("booking paid",
+		zap.Uint("bookingID", booking.ID),
+		zap.Uint("paymentID", payment.ID),
+		zap.String("method", method),
+		zap.String("status", payment.Status))
+
+	return &payment, nil
+}
+
+// GetDepositRules returns the deposit rule of every room type
+func (ps *PaymentService) GetDepositRules() ([]models.DepositRule, error) {
+	var rules []models.DepositRule
+	if err := ps.db.Order("room_type").Find(&rules).Error; err != nil {
+		ps.logger.Error("failed to get deposit rules", zap.Error(err))
+		return nil, fmt.Errorf("failed to get deposit rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// SetDepositRule creates or updates the deposit rule of a room type
+func (ps *PaymentService) SetDepositRule(roomType, ruleType string, value float64) (*models.DepositRule, error) {
+	if roomType == "" {
+		return nil, errors.New("room type is required")
+	}
+
+	switch ruleType {
+	case models.DepositTypePercentage:
+		if value < 0 || value > 100 {
+			return nil, errors.New("deposit percentage must be between 0 and 100")
+		}
+	case models.DepositTypeFixed:
+		if value < 0 {
+			return nil, errors.New("deposit amount cannot be negative")
+		}
+	default:
+		return nil, fmt.Errorf("unknown deposit type %q", ruleType)
+	}
+
+	var rule models.DepositRule
+	err := ps.db.Where("room_type = ?", roomType).First(&rule).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load deposit rule: %w", err)
+	}
+
+	rule.RoomType = roomType
+	rule.Type = ruleType
+	rule.Value = value
+
+	if err := ps.db.Save(&rule).Error; err != nil {
+		ps.logger.Error("failed to save deposit rule", zap.String("roomType", roomType), zap.Error(err))
+		return nil, fmt.Errorf("failed to save deposit rule: %w", err)
+	}
+
+	return &rule, nil
+}
+
+// ApplyDepositRule works out the advance a booking requires from the rule of
+// its room type and stores it on the booking. Without a rule the full amount
+// is due up front.
+func (ps *PaymentService) ApplyDepositRule(bookingID uint) (models.Money, error) {
+	return ps.applyDepositRule(ps.db, bookingID)
+}
+
+// DepositOnHold is ApplyDepositRule as a step of creating a hold
+func (ps *PaymentService) DepositOnHold() HoldStep {
+	return func(tx *gorm.DB, booking *models.RoomBooking) error {
+		deposit, err := ps.applyDepositRule(tx, booking.ID)
+		if err != nil {
+			return err
+		}
+		booking.DepositAmount = deposit
+		return nil
+	}
+}
+
+// applyDepositRule is ApplyDepositRule within the caller's transaction
+func (ps *PaymentService) applyDepositRule(tx *gorm.DB, bookingID uint) (models.Money, error) {
+	var booking models.RoomBooking
+	if err := tx.Preload("Room").First(&booking, bookingID).Error; err != nil {
+		return models.Money{}, fmt.Errorf("failed to find booking: %w", err)
+	}
+
+	_, _, total := BookingTotals(&booking)
+	deposit := total
+
+	var rule models.DepositRule
+	err := tx.Where("room_type = ?", booking.Room.Type).First(&rule).Error
+	switch {
+	case err == nil && rule.Type == models.DepositTypePercentage:
+		deposit = total.Percent(rule.Value)
+	case err == nil && rule.Type == models.DepositTypeFixed:
+		deposit = models.MoneyFromMajor(rule.Value, total.Currency).Min(total)
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		return models.Money{}, fmt.Errorf("failed to load deposit rule: %w", err)
+	}
+
+	if err := tx.Model(&booking).Updates(map[string]interface{}{
+		"deposit_amount_minor":    deposit.Minor,
+		"deposit_amount_currency": deposit.Currency,
+	}).Error; err != nil {
+		ps.logger.Error("failed to store booking deposit", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return models.Money{}, fmt.Errorf("failed to store booking deposit: %w", err)
+	}
+
+	return deposit, nil
+}
+
+// GetBalance returns what has been paid and what is still owed on a booking
+func (ps *PaymentService) GetBalance(bookingID uint) (*BookingBalance, error) {
+	return ps.rooms.GetBalance(bookingID)
+}
+
+// RecordCollectedPayment records money taken at the front desk, such as the
+// balance paid in cash at check-in
+func (ps *PaymentService) RecordCollectedPayment(bookingID uint, amount models.Money, method, reference string) (*models.Payment, error) {
+	if !amount.IsPositive() {
+		return nil, errors.New("amount must be positive")
+	}
+
+	if method != models.PaymentMethodCash && method != models.PaymentMethodCard {
+		return nil, ErrUnsupportedPaymentMethod
+	}
+
+	var booking models.RoomBooking
+	if err := ps.db.First(&booking, bookingID).Error; err != nil {
+		return nil, fmt.Errorf("failed to find booking: %w", err)
+	}
+
+	amount = amount.In(booking.TotalPrice.Currency)
+	if amount.Currency != booking.TotalPrice.Currency {
+		return nil, fmt.Errorf("payments for this booking must be in %s", booking.TotalPrice.Currency)
+	}
+
+	now := time.Now()
+	payment := models.Payment{
+		BookingID:        bookingID,
+		Amount:           amount,
+		Method:           method,
+		Status:           models.PaymentStatusSucceeded,
+		GatewayReference: reference,
+		ProcessedAt:      &now,
+	}
+
+	if err := ps.db.Create(&payment).Error; err != nil {
+		ps.logger.Error("failed to record collected payment", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, fmt.Errorf("failed to record payment: %w", err)
+	}
+
+	ps.logger.Info("payment collected at front desk",
+		zap.Uint("bookingID", bookingID),
+		zap.Stringer("amount", amount),
+		zap.String("method", method))
+
+	return &payment, nil
+}
+
+// GetPaymentsByBookingID returns every payment attempt of a booking
+func (ps *PaymentService) GetPaymentsByBookingID(bookingID uint) ([]models.Payment, error) {
+	var payments []models.Payment
+	if err := ps.db.Where("booking_id = ?", bookingID).Order("created_at").Find(&payments).Error; err != nil {
+		ps.logger.Error("failed to get payments", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get payments: %w", err)
+	}
+
+	return payments, nil
+}
+
+// RegisterWebhookSecret sets the secret a provider signs its webhooks with.
+// The provider name is the payment method its gateway handles.
+func (ps *PaymentService) RegisterWebhookSecret(provider, secret string) {
+	ps.secrets[provider] = secret
+}
+
+// VerifyWebhookSignature checks the hex encoded HMAC-SHA256 of the raw body,
+// optionally prefixed with "sha256=", against the provider's secret
+func (ps *PaymentService) VerifyWebhookSignature(provider string, body []byte, signature string) error {
+	secret, ok := ps.secrets[provider]
+	if !ok || secret == "" {
+		return ErrUnknownWebhookProvider
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(signature), "sha256="))
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return ErrInvalidWebhookSignature
+	}
+
+	return nil
+}
+
+// HandleWebhookEvent applies a verified provider event to its payment and
+// booking. Events already seen are skipped and reported as duplicates, so
+// providers can safely redeliver them. Money received for a booking that can no
+// longer be confirmed is kept on record and queued for refund. When the
+// authorization that confirmed a booking fails, the booking keeps its room with
+// the amount still owed and the admin is told to collect it.
+func (ps *PaymentService) HandleWebhookEvent(provider string, event WebhookEvent) (bool, error) {
+	if event.ID == "" || event.Data.GatewayReference == "" {
+		return false, errors.New("event ID and gateway reference are required")
+	}
+
+	var newStatus string
+	switch event.Type {
+	case WebhookPaymentAuthorized:
+		newStatus = models.PaymentStatusAuthorized
+	case WebhookPaymentSucceeded:
+		newStatus = models.PaymentStatusSucceeded
+	case WebhookPaymentFailed:
+		newStatus = models.PaymentStatusFailed
+	}
+
+	duplicate := false
+	var holdExpiredBooking uint
+	var lapsedBooking uint // Confirmed booking left unpaid by a failed authorization
+	err := ps.db.Transaction(func(tx *gorm.DB) error {
+		var seen int64
+		if err := tx.Model(&models.PaymentEvent{}).
+			Where("provider = ? AND event_id = ?", provider, event.ID).
+			Count(&seen).Error; err != nil {
+			return fmt.Errorf("failed to check webhook event: %w", err)
+		}
+		if seen > 0 {
+			duplicate = true
+			return nil
+		}
+
+		var payment models.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("method = ? AND gateway_reference = ?", provider, event.Data.GatewayReference).
+			First(&payment).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPaymentNotFound
+			}
+			return fmt.Errorf("failed to find payment: %w", err)
+		}
+
+		record := models.PaymentEvent{
+			Provider:  provider,
+			EventID:   event.ID,
+			Type:      event.Type,
+			PaymentID: payment.ID,
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				duplicate = true
+				return nil
+			}
+			return fmt.Errorf("failed to record webhook event: %w", err)
+		}
+
+		// Unknown event types are recorded but change nothing
+		if newStatus == "" || !canTransition(payment.Status, newStatus) {
+			ps.logger.Info("webhook event does not change payment",
+				zap.String("eventID", event.ID),
+				zap.String("type", event.Type),
+				zap.String("paymentStatus", payment.Status))
+			return nil
+		}
+
+		now := time.Now()
+		payment.Status = newStatus
+		payment.ProcessedAt = &now
+		if newStatus == models.PaymentStatusFailed {
+			payment.FailureReason = event.Data.FailureMessage
+		}
+		if err := tx.Save(&payment).Error; err != nil {
+			return fmt.Errorf("failed to update payment: %w", err)
+		}
+
+		if newStatus == models.PaymentStatusFailed {
+			lapsed, err := ps.lapsedConfirmation(tx, &payment)
+			if lapsed {
+				lapsedBooking = payment.BookingID
+			}
+			return err
+		}
+
+		err := ps.rooms.confirmHold(tx, payment.BookingID)
+		if errors.Is(err, ErrHoldExpired) || errors.Is(err, ErrInvalidTransition) {
+			// Keep the payment and give the money back, since the booking is gone
+			if errors.Is(err, ErrHoldExpired) {
+				holdExpiredBooking = payment.BookingID
+			}
+			return ps.settleUnconfirmedPayment(tx, &payment, unconfirmedReason(err))
+		}
+		return err
+	})
+	if err != nil {
+		ps.logger.Error("failed to handle payment webhook",
+			zap.String("provider", provider),
+			zap.String("eventID", event.ID),
+			zap.Error(err))
+		return false, err
+	}
+
+	if holdExpiredBooking != 0 {
+		ps.rooms.expireHold(holdExpiredBooking)
+		ps.logger.Error("payment received for an expired hold",
+			zap.Uint("bookingID", holdExpiredBooking),
+			zap.String("eventID", event.ID))
+	}
+
+	if lapsedBooking != 0 {
+		ps.rooms.notifyUnpaidConfirmation(lapsedBooking, event.Data.FailureMessage)
+	}
+
+	if duplicate {
+		ps.logger.Info("duplicate webhook event ignored",
+			zap.String("provider", provider),
+			zap.String("eventID", event.ID))
+	}
+
+	return duplicate, nil
+}
+
+// lapsedConfirmation reports whether payment, just failed, was what confirmed
+// its booking: the booking is confirmed and no other payment for it is
+// authorized or succeeded. The booking stays confirmed with its balance due.
+func (ps *PaymentService) lapsedConfirmation(tx *gorm.DB, payment *models.Payment) (bool, error) {
+	var booking models.RoomBooking
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, payment.BookingID).Error; err != nil {
+		return false, fmt.Errorf("failed to find booking: %w", err)
+	}
+	if booking.Status != models.BookingStatusConfirmed {
+		return false, nil
+	}
+
+	var held int64
+	if err := tx.Model(&models.Payment{}).
+		Where("booking_id = ? AND id <> ? AND status IN ?", booking.ID, payment.ID, []string{
+			models.PaymentStatusAuthorized,
+			models.PaymentStatusSucceeded,
+		}).
+		Count(&held).Error; err != nil {
+		return false, fmt.Errorf("failed to check payments: %w", err)
+	}
+
+	return held == 0, nil
+}
+
+// settleUnconfirmedPayment deals with a payment for a booking that can no
+// longer be confirmed. An authorization is dropped, since nothing was
+// captured; money taken is queued to be refunded.
+func (ps *PaymentService) settleUnconfirmedPayment(tx *gorm.DB, payment *models.Payment, reason string) error {
+	if payment.Status == models.PaymentStatusAuthorized {
+		payment.Status = models.PaymentStatusFailed
+		payment.FailureReason = reason
+		if err := tx.Save(payment).Error; err != nil {
+			return fmt.Errorf("failed to update payment: %w", err)
+		}
+		return nil
+	}
+
+	if payment.Status != models.PaymentStatusSucceeded {
+		return nil
+	}
+
+	_, err := ps.rooms.refundLatePayment(tx, payment.BookingID, reason)
+	return err
+}
+
+// unconfirmedReason explains why a paid booking could not be confirmed
+func unconfirmedReason(err error) string {
+	if errors.Is(err, ErrHoldExpired) {
+		return "Payment received after the booking hold expired"
+	}
+	return "Payment received after the booking was closed"
+}
+
+// GetRefunds returns refunds with the given status, oldest first, or every
+// refund when status is empty
+func (ps *PaymentService) GetRefunds(status string) ([]models.Refund, error) {
+	var refunds []models.Refund
+
+	db := ps.db.Preload("RoomBooking.Guest").Order("created_at ASC")
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+
+	if err := db.Find(&refunds).Error; err != nil {
+		ps.logger.Error("failed to get refunds", zap.String("status", status), zap.Error(err))
+		return nil, fmt.Errorf("failed to get refunds: %w", err)
+	}
+
+	return refunds, nil
+}
+
+// ProcessRefund approves a pending refund and sends it through the gateway of
+// the original payment. A rejected refund is saved as failed and can then be
+// paid out by hand with MarkRefundManual.
+func (ps *PaymentService) ProcessRefund(refundID uint, approvedBy string) (*models.Refund, error) {
+	approvedBy = strings.TrimSpace(approvedBy)
+	if approvedBy == "" {
+		return nil, ErrRefundApproverRequired
+	}
+
+	var refund models.Refund
+	err := ps.db.Transaction(func(tx *gorm.DB) error {
+		// The lock is held while the gateway is called so a refund is only sent once
+		if err := lockRefund(tx, refundID, &refund); err != nil {
+			return err
+		}
+		if refund.Status != models.RefundStatusPending {
+			return ErrRefundNotPending
+		}
+
+		gateway, ok := ps.gateways[refund.Method].(RefundGateway)
+		if !ok {
+			return ErrManualRefundRequired
+		}
+
+		var payment models.Payment
+		if err := tx.First(&payment, refund.PaymentID).Error; err != nil {
+			return fmt.Errorf("failed to find refunded payment: %w", err)
+		}
+
+		result, err := gateway.Refund(RefundRequest{
+			RefundID:         refund.ID,
+			BookingID:        refund.BookingID,
+			GatewayReference: payment.GatewayReference,
+			Amount:           refund.Amount,
+			Reason:           refund.Reason,
+		})
+		if err != nil {
+			// Left pending so it can be tried again once the gateway is back
+			ps.logger.Error("refund gateway error",
+				zap.Uint("refundID", refund.ID),
+				zap.String("method", refund.Method),
+				zap.Error(err))
+			return fmt.Errorf("failed to send refund: %w", err)
+		}
+
+		now := time.Now()
+		refund.Status = result.Status
+		refund.GatewayReference = result.GatewayReference
+		refund.FailureReason = result.FailureReason
+		refund.ApprovedBy = approvedBy
+		refund.ProcessedAt = &now
+
+		if err := tx.Omit(clause.Associations).Save(&refund).Error; err != nil {
+			return fmt.Errorf("failed to save refund: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ps.logger.Info("refund processed",
+		zap.Uint("refundID", refund.ID),
+		zap.Uint("bookingID", refund.BookingID),
+		zap.String("status", refund.Status),
+		zap.Stringer("amount", refund.Amount),
+		zap.String("approvedBy", approvedBy))
+
+	return &refund, nil
+}
+
+// MarkRefundManual records a pending or failed refund as paid out in cash at
+// the front desk. reference is the receipt number, if any.
+func (ps *PaymentService) MarkRefundManual(refundID uint, approvedBy, reference string) (*models.Refund, error) {
+	approvedBy = strings.TrimSpace(approvedBy)
+	if approvedBy == "" {
+		return nil, ErrRefundApproverRequired
+	}
+
+	var refund models.Refund
+	err := ps.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockRefund(tx, refundID, &refund); err != nil {
+			return err
+		}
+		if refund.Status == models.RefundStatusProcessed {
+			return ErrRefundNotPending
+		}
+
+		now := time.Now()
+		refund.Method = models.PaymentMethodCash
+		refund.Status = models.RefundStatusProcessed
+		refund.GatewayReference = strings.TrimSpace(reference)
+		refund.FailureReason = ""
+		refund.ApprovedBy = approvedBy
+		refund.ProcessedAt = &now
+
+		if err := tx.Omit(clause.Associations).Save(&refund).Error; err != nil {
+			return fmt.Errorf("failed to save refund: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ps.logger.Info("refund paid out by hand",
+		zap.Uint("refundID", refund.ID),
+		zap.Uint("bookingID", refund.BookingID),
+		zap.Stringer("amount", refund.Amount),
+		zap.String("approvedBy", approvedBy))
+
+	return &refund, nil
+}
+
+// lockRefund loads a refund with its booking and locks the refund row
+func lockRefund(tx *gorm.DB, refundID uint, refund *models.Refund) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(refund, refundID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRefundNotFound
+		}
+		return fmt.Errorf("failed to find refund: %w", err)
+	}
+
+	if err := tx.Preload("Guest").First(&refund.RoomBooking, refund.BookingID).Error; err != nil {
+		return fmt.Errorf("failed to find refunded booking: %w", err)
+	}
+
+	return nil
+}
+
+// canTransition reports whether a payment may move from one status to another
+func canTransition(from, to string) bool {
+	for _, allowed := range paymentTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// fakeWebhookSecret is the secret testdata/webhooks was signed with
+const fakeWebhookSecret = "whsec_local_fake"
+
+// loadWebhookFixture reads a signed sample event from testdata/webhooks
+func loadWebhookFixture(t *testing.T, name string) ([]byte, string) {
+	t.Helper()
+
+	body, err := os.ReadFile("../testdata/webhooks/" + name + ".json")
+	if err != nil {
+		t.Fatalf("failed to read webhook body: %v", err)
+	}
+	signature, err := os.ReadFile("../testdata/webhooks/" + name + ".sig")
+	if err != nil {
+		t.Fatalf("failed to read webhook signature: %v", err)
+	}
+
+	return body, string(signature)
+}
+
+// replayWebhook verifies and applies a fixture the way the webhook handler does
+func replayWebhook(t *testing.T, ps *PaymentService, name string) (bool, error) {
+	t.Helper()
+
+	body, signature := loadWebhookFixture(t, name)
+	if err := ps.VerifyWebhookSignature("fake", body, signature); err != nil {
+		t.Fatalf("fixture signature rejected: %v", err)
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("failed to decode fixture: %v", err)
+	}
+
+	return ps.HandleWebhookEvent("fake", event)
+}
+
+func TestVerifyWebhookSignatureFixture(t *testing.T) {
+	ps := NewPaymentService(nil, zap.NewNop(), nil)
+	ps.RegisterWebhookSecret("fake", fakeWebhookSecret)
+
+	body, signature := loadWebhookFixture(t, "fake_payment_succeeded")
+	if err := ps.VerifyWebhookSignature("fake", body, signature); err != nil {
+		t.Fatalf("expected fixture signature to verify, got %v", err)
+	}
+
+	tampered := append([]byte{}, body...)
+	tampered[len(tampered)-2] = ' '
+	if err := ps.VerifyWebhookSignature("fake", tampered, signature); err != ErrInvalidWebhookSignature {
+		t.Fatalf("expected ErrInvalidWebhookSignature for a changed body, got %v", err)
+	}
+
+	ps.RegisterWebhookSecret("fake", "whsec_other")
+	if err := ps.VerifyWebhookSignature("fake", body, signature); err != ErrInvalidWebhookSignature {
+		t.Fatalf("expected ErrInvalidWebhookSignature for another secret, got %v", err)
+	}
+}
+
+// setupWebhookPayment stores a pending fake payment matching the fixture for a
+// hold that runs out at expiresAt
+func setupWebhookPayment(t *testing.T, tx *gorm.DB, expiresAt time.Time) (*PaymentService, *models.RoomBooking, *models.Payment) {
+	t.Helper()
+
+	guest, room := createTestRoom(t, tx, "WH-101")
+	checkIn := time.Now().AddDate(0, 0, 30).Truncate(24 * time.Hour)
+	booking := models.RoomBooking{
+		GuestID:    guest.ID,
+		RoomID:     room.ID,
+		CheckIn:    checkIn,
+		CheckOut:   checkIn.AddDate(0, 0, 2),
+		Status:     models.BookingStatusPending,
+		ExpiresAt:  &expiresAt,
+		TotalPrice: models.NewMoney(2000000, models.DefaultCurrency),
+	}
+	if err := tx.Create(&booking).Error; err != nil {
+		t.Fatalf("failed to create booking: %v", err)
+	}
+
+	payment := models.Payment{
+		BookingID:        booking.ID,
+		Amount:           booking.TotalPrice,
+		Method:           "fake",
+		Status:           models.PaymentStatusPending,
+		GatewayReference: "fake_1_1700000000000000000",
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+
+	rooms := NewRoomBookingService(tx, zap.NewNop(), nil, nil, nil)
+	ps := NewPaymentService(tx, zap.NewNop(), rooms)
+	ps.RegisterWebhookSecret("fake", fakeWebhookSecret)
+
+	return ps, &booking, &payment
+}
+
+func TestHandleWebhookEventConfirmsHold(t *testing.T) {
+	tx := testTx(t, openTestDB(t))
+	ps, booking, payment := setupWebhookPayment(t, tx, time.Now().Add(15*time.Minute))
+
+	duplicate, err := replayWebhook(t, ps, "fake_payment_succeeded")
+	if err != nil || duplicate {
+		t.Fatalf("expected the event to apply, got duplicate=%v err=%v", duplicate, err)
+	}
+
+	tx.First(payment, payment.ID)
+	tx.First(booking, booking.ID)
+	if payment.Status != models.PaymentStatusSucceeded {
+		t.Errorf("expected payment succeeded, got %s", payment.Status)
+	}
+	if booking.Status != models.BookingStatusConfirmed {
+		t.Errorf("expected booking confirmed, got %s", booking.Status)
+	}
+
+	duplicate, err = replayWebhook(t, ps, "fake_payment_succeeded")
+	if err != nil || !duplicate {
+		t.Fatalf("expected a redelivery to be reported as duplicate, got duplicate=%v err=%v", duplicate, err)
+	}
+}
+
+func TestHandleWebhookEventRefundsUnconfirmableBooking(t *testing.T) {
+	cases := []struct {
+		name   string
+		status string
+		expiry time.Duration
+		want   string
+	}{
+		{"expired hold", models.BookingStatusPending, -time.Minute, models.BookingStatusExpired},
+		{"cancelled booking", models.BookingStatusCancelled, 15 * time.Minute, models.BookingStatusCancelled},
+		{"rejected booking", models.BookingStatusRejected, 15 * time.Minute, models.BookingStatusRejected},
+	}
+
+	db := openTestDB(t)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tx := testTx(t, db)
+			ps, booking, payment := setupWebhookPayment(t, tx, time.Now().Add(tc.expiry))
+			if err := tx.Model(booking).Update("status", tc.status).Error; err != nil {
+				t.Fatalf("failed to set booking status: %v", err)
+			}
+
+			if _, err := replayWebhook(t, ps, "fake_payment_succeeded"); err != nil {
+				t.Fatalf("expected the event to be accepted, got %v", err)
+			}
+
+			tx.First(payment, payment.ID)
+			tx.First(booking, booking.ID)
+			if payment.Status != models.PaymentStatusSucceeded {
+				t.Errorf("expected payment succeeded, got %s", payment.Status)
+			}
+			if booking.Status != tc.want {
+				t.Errorf("expected booking %s, got %s", tc.want, booking.Status)
+			}
+
+			var refunds []models.Refund
+			tx.Where("booking_id = ?", booking.ID).Find(&refunds)
+			if len(refunds) != 1 || refunds[0].PaymentID != payment.ID || refunds[0].Amount != payment.Amount {
+				t.Fatalf("expected one refund of %s for the payment, got %+v", payment.Amount, refunds)
+			}
+			if refunds[0].Status != models.RefundStatusPending {
+				t.Errorf("expected refund pending, got %s", refunds[0].Status)
+			}
+		})
+	}
+}
+
+func TestProcessBookingPaymentRefusesSecondCharge(t *testing.T) {
+	tx := testTx(t, openTestDB(t))
+	_, booking, payment := setupWebhookPayment(t, tx, time.Now().Add(15*time.Minute))
+	ps := NewPaymentService(tx, zap.NewNop(), NewRoomBookingService(tx, zap.NewNop(), nil, nil, nil), NewFakeGateway())
+
+	if _, err := ps.ProcessBookingPayment(booking, booking.TotalPrice, models.PaymentMethodFake, ""); !errors.Is(err, ErrPaymentInProgress) {
+		t.Fatalf("expected ErrPaymentInProgress with a pending payment, got %v", err)
+	}
+
+	// A failed payment does not stop the guest from trying again
+	if err := tx.Model(payment).Update("status", models.PaymentStatusFailed).Error; err != nil {
+		t.Fatalf("failed to fail payment: %v", err)
+	}
+	if _, err := ps.ProcessBookingPayment(booking, booking.TotalPrice, models.PaymentMethodFake, ""); err != nil {
+		t.Fatalf("expected a retry after a failed payment to succeed, got %v", err)
+	}
+	if _, err := ps.ProcessBookingPayment(booking, booking.TotalPrice, models.PaymentMethodFake, ""); !errors.Is(err, ErrBookingNotPayable) {
+		t.Fatalf("expected ErrBookingNotPayable once confirmed, got %v", err)
+	}
+}
+
+func TestHandleWebhookEventFailedAuthorizationLeavesBalanceDue(t *testing.T) {
+	tx := testTx(t, openTestDB(t))
+	ps, booking, payment := setupWebhookPayment(t, tx, time.Now().Add(15*time.Minute))
+	if err := tx.Model(payment).Update("status", models.PaymentStatusAuthorized).Error; err != nil {
+		t.Fatalf("failed to authorize payment: %v", err)
+	}
+	if err := ps.rooms.ConfirmHold(booking.ID); err != nil {
+		t.Fatalf("failed to confirm booking: %v", err)
+	}
+
+	if _, err := replayWebhook(t, ps, "fake_payment_failed"); err != nil {
+		t.Fatalf("expected the event to apply, got %v", err)
+	}
+
+	tx.First(payment, payment.ID)
+	tx.First(booking, booking.ID)
+	if payment.Status != models.PaymentStatusFailed {
+		t.Errorf("expected payment failed, got %s", payment.Status)
+	}
+	if booking.Status != models.BookingStatusConfirmed {
+		t.Errorf("expected booking to stay confirmed, got %s", booking.Status)
+	}
+
+	lapsed, err := ps.lapsedConfirmation(tx, payment)
+	if err != nil || !lapsed {
+		t.Fatalf("expected the booking to be reported unpaid, got lapsed=%v err=%v", lapsed, err)
+	}
+	balance, err := ps.rooms.balance(tx, booking)
+	if err != nil {
+		t.Fatalf("failed to get balance: %v", err)
+	}
+	if balance.Outstanding != balance.Total {
+		t.Errorf("expected the whole total %s due, got %s", balance.Total, balance.Outstanding)
+	}
+
+	// Another payment that holds the booking means nothing lapsed
+	other := models.Payment{
+		BookingID: booking.ID,
+		Amount:    booking.TotalPrice,
+		Method:    "fake",
+		Status:    models.PaymentStatusSucceeded,
+	}
+	if err := tx.Create(&other).Error; err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+	if lapsed, err := ps.lapsedConfirmation(tx, payment); err != nil || lapsed {
+		t.Fatalf("expected a paid booking not to be reported, got lapsed=%v err=%v", lapsed, err)
+	}
+}
+
+func TestPaymentTransitions(t *testing.T) {
+	statuses := []string{
+		models.PaymentStatusPending,
+		models.PaymentStatusAuthorized,
+		models.PaymentStatusSucceeded,
+		models.PaymentStatusFailed,
+	}
+	allowed := map[[2]string]bool{
+		{models.PaymentStatusPending, models.PaymentStatusAuthorized}:   true,
+		{models.PaymentStatusPending, models.PaymentStatusSucceeded}:    true,
+		{models.PaymentStatusPending, models.PaymentStatusFailed}:       true,
+		{models.PaymentStatusAuthorized, models.PaymentStatusSucceeded}: true,
+		{models.PaymentStatusAuthorized, models.PaymentStatusFailed}:    true,
+		{models.PaymentStatusFailed, models.PaymentStatusSucceeded}:     true,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]string{from, to}]
+			if got := canTransition(from, to); got != want {
+				t.Errorf("%s to %s: expected allowed=%v, got %v", from, to, want, got)
+			}
+		}
+	}
+}
+
+func TestFakeGatewayCharge(t *testing.T) {
+	gateway := NewFakeGateway()
+	req := PaymentRequest{BookingID: 7, Amount: npr(5000)}
+
+	cases := []struct {
+		token  string
+		status string
+		err    bool
+	}{
+		{"", models.PaymentStatusSucceeded, false},
+		{FakeTokenDecline, models.PaymentStatusFailed, false},
+		{FakeTokenError, "", true},
+	}
+
+	for _, tc := range cases {
+		req.Token = tc.token
+		result, err := gateway.Charge(req)
+		if tc.err {
+			if err == nil {
+				t.Errorf("token %q: expected a gateway error", tc.token)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("token %q: unexpected error %v", tc.token, err)
+		}
+		if result.Status != tc.status {
+			t.Errorf("token %q: expected %s, got %s", tc.token, tc.status, result.Status)
+		}
+	}
+}
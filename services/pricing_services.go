@@ -0,0 +1,558 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Pricing errors that callers can tell apart
+var (
+	ErrInvalidRatePlan  = errors.New("invalid rate plan")
+	ErrRatePlanNotFound = errors.New("rate plan not found")
+	ErrOverCapacity     = errors.New("too many guests for the room")
+	ErrStayRestricted   = errors.New("stay not allowed")
+	ErrInvalidStayRule  = errors.New("invalid stay rule")
+	ErrStayRuleNotFound = errors.New("stay rule not found")
+)
+
+// StayPrice is the price of a room for a stay, night by night, before tax
+type StayPrice struct {
+	RoomID    uint              `json:"room_id"`
+	CheckIn   time.Time         `json:"check_in"`
+	CheckOut  time.Time         `json:"check_out"`
+	Occupancy models.Occupancy  `json:"occupancy"`
+	Nights    models.NightRates `json:"nights"`
+	Total     models.Money      `json:"total"`
+}
+
+// PricingService works out nightly room rates from the base rate of each room,
+// the rate plans in effect and who is staying
+type PricingService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	ageBands models.AgeBands
+}
+
+// NewPricingService creates a new instance of PricingService. ageBands sets
+// which children are charged the child rate and which stay free.
+func NewPricingService(db *gorm.DB, logger *zap.Logger, ageBands models.AgeBands) *PricingService {
+	return &PricingService{
+		db:       db,
+		logger:   logger,
+		ageBands: ageBands,
+	}
+}
+
+// AgeBands returns the ages charged as infants, children and adults
+func (ps *PricingService) AgeBands() models.AgeBands {
+	return ps.ageBands
+}
+
+// CheckOccupancy checks that a room can take the guests. Every guest counts
+// against the room's capacity, infants included.
+func (ps *PricingService) CheckOccupancy(room *models.Room, occupancy models.Occupancy) error {
+	if occupancy.Adults < 1 {
+		return fmt.Errorf("%w: at least one adult is required", ErrOverCapacity)
+	}
+	if occupancy.Children < 0 || occupancy.Infants < 0 {
+		return fmt.Errorf("%w: guest counts cannot be negative", ErrOverCapacity)
+	}
+	if occupancy.Guests() > room.Capacity {
+		return fmt.Errorf("%w: room %s sleeps up to %d", ErrOverCapacity, room.RoomNo, room.Capacity)
+	}
+	return nil
+}
+
+// BookingOccupancy returns who is staying on a booking. Bookings made before
+// occupancy pricing only have a guest count, which is taken as adults.
+func BookingOccupancy(booking *models.RoomBooking) models.Occupancy {
+	occupancy := models.Occupancy{
+		Adults:   int(booking.Adults),
+		Children: int(booking.Children),
+		Infants:  int(booking.Infants),
+	}
+	if occupancy.Adults == 0 {
+		occupancy.Adults = int(booking.GuestCount)
+	}
+	if occupancy.Adults < 1 {
+		occupancy.Adults = 1
+	}
+	return occupancy
+}
+
+// PriceStay prices a room for the nights from checkIn up to checkOut
+func (ps *PricingService) PriceStay(room *models.Room, checkIn, checkOut time.Time, occupancy models.Occupancy) (*StayPrice, error) {
+	prices, err := ps.PriceStays([]models.Room{*room}, checkIn, checkOut, occupancy)
+	if err != nil {
+		return nil, err
+	}
+	return prices[room.ID], nil
+}
+
+// PriceStays prices several rooms for the same stay and guests, keyed by room ID
+func (ps *PricingService) PriceStays(rooms []models.Room, checkIn, checkOut time.Time, occupancy models.Occupancy) (map[uint]*StayPrice, error) {
+	checkIn = time.Date(checkIn.Year(), checkIn.Month(), checkIn.Day(), 0, 0, 0, 0, time.UTC)
+	checkOut = time.Date(checkOut.Year(), checkOut.Month(), checkOut.Day(), 0, 0, 0, 0, time.UTC)
+	if !checkOut.After(checkIn) {
+		return nil, errors.New("check-out must be after check-in")
+	}
+
+	var plans []models.RatePlan
+	if err := ps.db.Where("active = ?", true).
+		Where("(recurring = ? OR (start_date < ? AND end_date >= ?))", true, checkOut, checkIn).
+		Order("priority DESC, id ASC").
+		Find(&plans).Error; err != nil {
+		ps.logger.Error("failed to get rate plans", zap.Error(err))
+		return nil, fmt.Errorf("failed to get rate plans: %w", err)
+	}
+
+	prices := make(map[uint]*StayPrice, len(rooms))
+	for _, room := range rooms {
+		stay := &StayPrice{
+			RoomID:    room.ID,
+			CheckIn:   checkIn,
+			CheckOut:  checkOut,
+			Occupancy: occupancy,
+			Total:     models.NewMoney(0, room.PricePerNight.Currency),
+		}
+
+		extras := occupancyExtras(&room, occupancy)
+		nights := int(checkOut.Sub(checkIn).Hours() / 24)
+		for night := checkIn; night.Before(checkOut); night = night.AddDate(0, 0, 1) {
+			price := priceNight(&room, plans, night, nights, extras)
+			stay.Nights = append(stay.Nights, price)
+			stay.Total = stay.Total.Add(price.Rate)
+		}
+
+		prices[room.ID] = stay
+	}
+
+	return prices, nil
+}
+
+// occupancyExtras works out the nightly charge for guests over a room's base
+// occupancy. Adults take up the base occupancy first, then children; infants
+// are free and do not take it up.
+func occupancyExtras(room *models.Room, occupancy models.Occupancy) models.Money {
+	currency := room.PricePerNight.Currency
+	extras := models.NewMoney(0, currency)
+
+	base := room.BaseOccupancy
+	extraAdults := occupancy.Adults - base
+	if rate := room.ExtraAdultRate.In(currency); extraAdults > 0 && rate.Currency == currency {
+		extras = extras.Add(rate.Mul(int64(extraAdults)))
+	}
+
+	base -= occupancy.Adults
+	if base < 0 {
+		base = 0
+	}
+	extraChildren := occupancy.Children - base
+	if rate := room.ChildRate.In(currency); extraChildren > 0 && rate.Currency == currency {
+		extras = extras.Add(rate.Mul(int64(extraChildren)))
+	}
+
+	return extras
+}
+
+// priceNight works out the rate of a room for one night of a stay of nights
+// nights, extras being the charge for guests over the base occupancy. plans
+// must be in priority order.
+func priceNight(room *models.Room, plans []models.RatePlan, night time.Time, nights int, extras models.Money) models.NightRate {
+	price := models.NightRate{Date: night, Rate: room.PricePerNight, Extras: extras}
+
+	// The highest priority rate plan sets the rate
+	for _, plan := range plans {
+		if plan.Kind == models.RatePlanKindRate && planCovers(&plan, room, night) &&
+			plan.Rate.Currency == room.PricePerNight.Currency {
+			price.Rate = plan.Rate
+			price.Plans = append(price.Plans, plan.Name)
+			break
+		}
+	}
+
+	// Every premium covering the night is added on top
+	var premium float64
+	for _, plan := range plans {
+		if plan.Kind == models.RatePlanKindPremium && planCovers(&plan, room, night) {
+			premium += plan.Percent
+			price.Plans = append(price.Plans, plan.Name)
+		}
+	}
+	if premium != 0 {
+		price.Rate = price.Rate.Add(price.Rate.Percent(premium))
+	}
+	price.Rate = price.Rate.Add(extras)
+
+	// The largest discount the length of stay qualifies for comes off last
+	var discount *models.RatePlan
+	for i, plan := range plans {
+		if plan.Kind == models.RatePlanKindDiscount && nights >= plan.MinNights && planCovers(&plan, room, night) &&
+			(discount == nil || plan.Percent > discount.Percent) {
+			discount = &plans[i]
+		}
+	}
+	if discount != nil {
+		price.Rate = price.Rate.Sub(price.Rate.Percent(discount.Percent))
+		price.Plans = append(price.Plans, discount.Name)
+	}
+
+	return price
+}
+
+// planCovers reports whether a rate plan applies to a room on a night
+func planCovers(plan *models.RatePlan, room *models.Room, night time.Time) bool {
+	return datesCover(plan.RoomType, plan.Weekdays, plan.StartDate, plan.EndDate, plan.Recurring, room, night)
+}
+
+// datesCover reports whether a plan or rule for roomType on weekdays from
+// start to end applies to a room on a date. A nil room only matches plans and
+// rules for every room.
+func datesCover(roomType, weekdays string, start, end time.Time, recurring bool, room *models.Room, date time.Time) bool {
+	if roomType != "" && (room == nil || !strings.EqualFold(roomType, room.Type)) {
+		return false
+	}
+
+	if weekdays != "" {
+		day := strings.ToLower(date.Weekday().String()[:3])
+		found := false
+		for _, weekday := range strings.Split(weekdays, ",") {
+			if strings.TrimSpace(weekday) == day {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if !recurring {
+		day := date.Format("2006-01-02")
+		return day >= start.Format("2006-01-02") && day <= end.Format("2006-01-02")
+	}
+
+	// Recurring plans compare month and day only; a range such as Dec 20 to
+	// Jan 5 runs over the new year
+	from := start.Format("01-02")
+	to := end.Format("01-02")
+	day := date.Format("01-02")
+	if from <= to {
+		return day >= from && day <= to
+	}
+	return day >= from || day <= to
+}
+
+// GetRatePlans returns every rate plan, the latest first
+func (ps *PricingService) GetRatePlans() ([]models.RatePlan, error) {
+	var plans []models.RatePlan
+	if err := ps.db.Order("start_date DESC, priority DESC, id ASC").Find(&plans).Error; err != nil {
+		ps.logger.Error("failed to get rate plans", zap.Error(err))
+		return nil, fmt.Errorf("failed to get rate plans: %w", err)
+	}
+
+	return plans, nil
+}
+
+// SaveRatePlan creates a rate plan, or updates it when it has an ID
+func (ps *PricingService) SaveRatePlan(plan *models.RatePlan) error {
+	if err := validateRatePlan(plan); err != nil {
+		return err
+	}
+
+	if plan.CancellationPolicyID != nil {
+		var policy models.CancellationPolicy
+		if err := ps.db.First(&policy, *plan.CancellationPolicyID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: cancellation policy %d not found", ErrInvalidRatePlan, *plan.CancellationPolicyID)
+			}
+			return fmt.Errorf("failed to find cancellation policy: %w", err)
+		}
+	}
+
+	if plan.ID != 0 {
+		var existing models.RatePlan
+		if err := ps.db.First(&existing, plan.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRatePlanNotFound
+			}
+			return fmt.Errorf("failed to find rate plan: %w", err)
+		}
+	}
+
+	if err := ps.db.Save(plan).Error; err != nil {
+		ps.logger.Error("failed to save rate plan", zap.String("name", plan.Name), zap.Error(err))
+		return fmt.Errorf("failed to save rate plan: %w", err)
+	}
+
+	ps.logger.Info("rate plan saved", zap.Uint("ratePlanID", plan.ID), zap.String("name", plan.Name))
+	return nil
+}
+
+// DeleteRatePlan removes a rate plan. Bookings already made keep their price.
+func (ps *PricingService) DeleteRatePlan(id uint) error {
+	result := ps.db.Delete(&models.RatePlan{}, id)
+	if result.Error != nil {
+		ps.logger.Error("failed to delete rate plan", zap.Uint("ratePlanID", id), zap.Error(result.Error))
+		return fmt.Errorf("failed to delete rate plan: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrRatePlanNotFound
+	}
+
+	return nil
+}
+
+// validateRatePlan checks a rate plan and tidies its fields
+func validateRatePlan(plan *models.RatePlan) error {
+	plan.Name = strings.TrimSpace(plan.Name)
+	if plan.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRatePlan)
+	}
+
+	switch plan.Kind {
+	case models.RatePlanKindRate:
+		plan.Rate = plan.Rate.In(models.DefaultCurrency)
+		if !plan.Rate.IsPositive() {
+			return fmt.Errorf("%w: rate must be more than zero", ErrInvalidRatePlan)
+		}
+		plan.Percent = 0
+		plan.MinNights = 0
+	case models.RatePlanKindPremium:
+		if plan.Percent <= -100 {
+			return fmt.Errorf("%w: premium must be more than -100%%", ErrInvalidRatePlan)
+		}
+		plan.Rate = models.NewMoney(0, models.DefaultCurrency)
+		plan.MinNights = 0
+	case models.RatePlanKindDiscount:
+		if plan.Percent <= 0 || plan.Percent >= 100 {
+			return fmt.Errorf("%w: discount must be between 0 and 100%%", ErrInvalidRatePlan)
+		}
+		if plan.MinNights < 1 {
+			return fmt.Errorf("%w: a discount needs a minimum number of nights", ErrInvalidRatePlan)
+		}
+		plan.Rate = models.NewMoney(0, models.DefaultCurrency)
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidRatePlan, plan.Kind)
+	}
+
+	if plan.StartDate.IsZero() || plan.EndDate.IsZero() {
+		return fmt.Errorf("%w: start and end dates are required", ErrInvalidRatePlan)
+	}
+	if !plan.Recurring && plan.EndDate.Before(plan.StartDate) {
+		return fmt.Errorf("%w: end date is before start date", ErrInvalidRatePlan)
+	}
+
+	weekdays, err := normalizeWeekdays(plan.Weekdays)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRatePlan, err)
+	}
+	plan.Weekdays = weekdays
+
+	return nil
+}
+
+// normalizeWeekdays turns a comma-separated list of days, e.g. "Friday, sat",
+// into the three letter form dates are matched against, e.g. "fri,sat"
+func normalizeWeekdays(weekdays string) (string, error) {
+	if weekdays == "" {
+		return "", nil
+	}
+
+	days := strings.Split(strings.ToLower(weekdays), ",")
+	for i, day := range days {
+		day = strings.TrimSpace(day)
+		if len(day) > 3 {
+			day = day[:3]
+		}
+		switch day {
+		case "mon", "tue", "wed", "thu", "fri", "sat", "sun":
+		default:
+			return "", fmt.Errorf("unknown weekday %q", days[i])
+		}
+		days[i] = day
+	}
+	return strings.Join(days, ","), nil
+}
+
+// CheckStay checks a stay in room from checkIn to checkOut against the stay
+// rules. The error names the rule that blocks it. A nil room is only checked
+// against rules for every room.
+func (ps *PricingService) CheckStay(room *models.Room, checkIn, checkOut time.Time) error {
+	rules, err := ps.stayRules(checkIn, checkOut)
+	if err != nil {
+		return err
+	}
+
+	return checkStayRules(rules, room, checkIn, checkOut)
+}
+
+// AllowedRooms returns the rooms no stay rule blocks a stay in from checkIn
+// to checkOut
+func (ps *PricingService) AllowedRooms(rooms []models.Room, checkIn, checkOut time.Time) ([]models.Room, error) {
+	rules, err := ps.stayRules(checkIn, checkOut)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make([]models.Room, 0, len(rooms))
+	for i := range rooms {
+		if checkStayRules(rules, &rooms[i], checkIn, checkOut) == nil {
+			allowed = append(allowed, rooms[i])
+		}
+	}
+
+	return allowed, nil
+}
+
+// stayRules loads the active stay rules that may touch a stay from checkIn to
+// checkOut
+func (ps *PricingService) stayRules(checkIn, checkOut time.Time) ([]models.StayRule, error) {
+	var rules []models.StayRule
+	if err := ps.db.Where("active = ?", true).
+		Where("(recurring = ? OR (start_date <= ? AND end_date >= ?))", true, checkOut, checkIn).
+		Order("id ASC").
+		Find(&rules).Error; err != nil {
+		ps.logger.Error("failed to get stay rules", zap.Error(err))
+		return nil, fmt.Errorf("failed to get stay rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// checkStayRules returns an error naming the first of rules that blocks the
+// stay. Minimum and maximum nights apply when any night of the stay falls in
+// a rule; closed to arrival and departure apply on the check-in and check-out
+// day.
+func checkStayRules(rules []models.StayRule, room *models.Room, checkIn, checkOut time.Time) error {
+	checkIn = time.Date(checkIn.Year(), checkIn.Month(), checkIn.Day(), 0, 0, 0, 0, time.UTC)
+	checkOut = time.Date(checkOut.Year(), checkOut.Month(), checkOut.Day(), 0, 0, 0, 0, time.UTC)
+	nights := int(checkOut.Sub(checkIn).Hours() / 24)
+
+	for _, rule := range rules {
+		covers := func(date time.Time) bool {
+			return datesCover(rule.RoomType, rule.Weekdays, rule.StartDate, rule.EndDate, rule.Recurring, room, date)
+		}
+
+		if rule.ClosedToArrival && covers(checkIn) {
+			return fmt.Errorf("%w: %s is closed to arrivals on %s", ErrStayRestricted, rule.Name, checkIn.Format("January 2, 2006"))
+		}
+		if rule.ClosedToDeparture && covers(checkOut) {
+			return fmt.Errorf("%w: %s is closed to departures on %s", ErrStayRestricted, rule.Name, checkOut.Format("January 2, 2006"))
+		}
+
+		if rule.MinNights == 0 && rule.MaxNights == 0 {
+			continue
+		}
+		covered := false
+		for night := checkIn; night.Before(checkOut); night = night.AddDate(0, 0, 1) {
+			if covers(night) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			continue
+		}
+
+		if rule.MinNights > 0 && nights < rule.MinNights {
+			return fmt.Errorf("%w: %s needs a stay of at least %d nights", ErrStayRestricted, rule.Name, rule.MinNights)
+		}
+		if rule.MaxNights > 0 && nights > rule.MaxNights {
+			return fmt.Errorf("%w: %s allows stays of at most %d nights", ErrStayRestricted, rule.Name, rule.MaxNights)
+		}
+	}
+
+	return nil
+}
+
+// GetStayRules returns every stay rule, the latest first
+func (ps *PricingService) GetStayRules() ([]models.StayRule, error) {
+	var rules []models.StayRule
+	if err := ps.db.Order("start_date DESC, id ASC").Find(&rules).Error; err != nil {
+		ps.logger.Error("failed to get stay rules", zap.Error(err))
+		return nil, fmt.Errorf("failed to get stay rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// SaveStayRule creates a stay rule, or updates it when it has an ID. Bookings
+// already made are not checked again.
+func (ps *PricingService) SaveStayRule(rule *models.StayRule) error {
+	if err := validateStayRule(rule); err != nil {
+		return err
+	}
+
+	if rule.ID != 0 {
+		var existing models.StayRule
+		if err := ps.db.First(&existing, rule.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrStayRuleNotFound
+			}
+			return fmt.Errorf("failed to find stay rule: %w", err)
+		}
+	}
+
+	if err := ps.db.Save(rule).Error; err != nil {
+		ps.logger.Error("failed to save stay rule", zap.String("name", rule.Name), zap.Error(err))
+		return fmt.Errorf("failed to save stay rule: %w", err)
+	}
+
+	ps.logger.Info("stay rule saved", zap.Uint("stayRuleID", rule.ID), zap.String("name", rule.Name))
+	return nil
+}
+
+// DeleteStayRule removes a stay rule
+func (ps *PricingService) DeleteStayRule(id uint) error {
+	result := ps.db.Delete(&models.StayRule{}, id)
+	if result.Error != nil {
+		ps.logger.Error("failed to delete stay rule", zap.Uint("stayRuleID", id), zap.Error(result.Error))
+		return fmt.Errorf("failed to delete stay rule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrStayRuleNotFound
+	}
+
+	return nil
+}
+
+// validateStayRule checks a stay rule and tidies its fields
+func validateStayRule(rule *models.StayRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidStayRule)
+	}
+
+	if rule.StartDate.IsZero() || rule.EndDate.IsZero() {
+		return fmt.Errorf("%w: start and end dates are required", ErrInvalidStayRule)
+	}
+	if !rule.Recurring && rule.EndDate.Before(rule.StartDate) {
+		return fmt.Errorf("%w: end date is before start date", ErrInvalidStayRule)
+	}
+
+	if rule.MinNights < 0 || rule.MaxNights < 0 {
+		return fmt.Errorf("%w: minimum and maximum nights cannot be negative", ErrInvalidStayRule)
+	}
+	if rule.MaxNights > 0 && rule.MaxNights < rule.MinNights {
+		return fmt.Errorf("%w: maximum nights is less than minimum nights", ErrInvalidStayRule)
+	}
+	if rule.MinNights == 0 && rule.MaxNights == 0 && !rule.ClosedToArrival && !rule.ClosedToDeparture {
+		return fmt.Errorf("%w: the rule does not restrict anything", ErrInvalidStayRule)
+	}
+
+	weekdays, err := normalizeWeekdays(rule.Weekdays)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidStayRule, err)
+	}
+	rule.Weekdays = weekdays
+
+	return nil
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+)
+
+// day parses a date in the form 2006-01-02 for table tests
+func day(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// npr returns a whole number of rupees
+func npr(rupees int64) models.Money {
+	return models.NewMoney(rupees*100, "NPR")
+}
+
+func TestPriceNight(t *testing.T) {
+	room := &models.Room{RoomNo: "101", Type: "Standard", PricePerNight: npr(10000)}
+
+	// In priority order, as PriceStays loads them
+	plans := []models.RatePlan{
+		{Name: "Suite peak", Kind: models.RatePlanKindRate, RoomType: "Suite", Rate: npr(30000), StartDate: day("2000-12-20"), EndDate: day("2000-01-05"), Recurring: true},
+		{Name: "Peak", Kind: models.RatePlanKindRate, Rate: npr(15000), StartDate: day("2000-12-20"), EndDate: day("2000-01-05"), Recurring: true},
+		{Name: "Winter", Kind: models.RatePlanKindRate, Rate: npr(12000), StartDate: day("2000-12-01"), EndDate: day("2000-02-28"), Recurring: true},
+		{Name: "Weekend", Kind: models.RatePlanKindPremium, Percent: 10, Weekdays: "fri,sat", StartDate: day("2024-01-01"), EndDate: day("2030-12-31")},
+		{Name: "Week stay", Kind: models.RatePlanKindDiscount, Percent: 10, MinNights: 7, StartDate: day("2024-01-01"), EndDate: day("2030-12-31")},
+		{Name: "Long stay", Kind: models.RatePlanKindDiscount, Percent: 20, MinNights: 14, StartDate: day("2024-01-01"), EndDate: day("2030-12-31")},
+	}
+
+	cases := []struct {
+		name   string
+		night  string
+		nights int
+		extras models.Money
+		rate   models.Money
+		plans  []string
+	}{
+		{"base rate", "2025-06-10", 2, npr(0), npr(10000), nil},
+		{"season rate", "2025-12-02", 2, npr(0), npr(12000), []string{"Winter"}},
+		{"higher priority wins", "2025-12-31", 2, npr(0), npr(15000), []string{"Peak"}},
+		{"recurring over new year", "2026-01-04", 2, npr(0), npr(15000), []string{"Peak"}},
+		{"premium on the plan rate", "2026-01-02", 2, npr(0), npr(16500), []string{"Peak", "Weekend"}},
+		{"discount for a week", "2025-06-10", 7, npr(0), npr(9000), []string{"Week stay"}},
+		{"largest discount qualified for", "2025-06-10", 14, npr(0), npr(8000), []string{"Long stay"}},
+		{"extras after the premium", "2026-01-02", 2, npr(1500), npr(18000), []string{"Peak", "Weekend"}},
+		{"discount after the extras", "2025-06-10", 7, npr(1500), npr(10350), []string{"Week stay"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			price := priceNight(room, plans, day(tc.night), tc.nights, tc.extras)
+			if price.Rate != tc.rate {
+				t.Errorf("expected rate %s, got %s", tc.rate, price.Rate)
+			}
+			if price.Extras != tc.extras {
+				t.Errorf("expected extras %s, got %s", tc.extras, price.Extras)
+			}
+			if !reflect.DeepEqual(price.Plans, tc.plans) {
+				t.Errorf("expected plans %v, got %v", tc.plans, price.Plans)
+			}
+		})
+	}
+}
+
+func TestPriceNightSkipsPlanInOtherCurrency(t *testing.T) {
+	room := &models.Room{RoomNo: "101", Type: "Standard", PricePerNight: npr(10000)}
+	plans := []models.RatePlan{
+		{Name: "Dollar rate", Kind: models.RatePlanKindRate, Rate: models.NewMoney(9000, "USD"), StartDate: day("2025-01-01"), EndDate: day("2025-12-31")},
+	}
+
+	price := priceNight(room, plans, day("2025-06-10"), 1, npr(0))
+	if price.Rate != npr(10000) || len(price.Plans) != 0 {
+		t.Fatalf("expected the base rate, got %s from %v", price.Rate, price.Plans)
+	}
+}
+
+func TestValidateRatePlan(t *testing.T) {
+	cases := []struct {
+		name  string
+		plan  models.RatePlan
+		valid bool
+	}{
+		{"rate", models.RatePlan{Name: "Peak", Kind: models.RatePlanKindRate, Rate: npr(15000), StartDate: day("2025-12-20"), EndDate: day("2026-01-05")}, true},
+		{"rate without amount", models.RatePlan{Name: "Peak", Kind: models.RatePlanKindRate, StartDate: day("2025-12-20"), EndDate: day("2026-01-05")}, false},
+		{"recurring over new year", models.RatePlan{Name: "Peak", Kind: models.RatePlanKindRate, Rate: npr(15000), StartDate: day("2025-12-20"), EndDate: day("2025-01-05"), Recurring: true}, true},
+		{"end before start", models.RatePlan{Name: "Peak", Kind: models.RatePlanKindRate, Rate: npr(15000), StartDate: day("2025-12-20"), EndDate: day("2025-01-05")}, false},
+		{"discount without nights", models.RatePlan{Name: "Long stay", Kind: models.RatePlanKindDiscount, Percent: 10, StartDate: day("2025-01-01"), EndDate: day("2025-12-31")}, false},
+		{"discount of everything", models.RatePlan{Name: "Long stay", Kind: models.RatePlanKindDiscount, Percent: 100, MinNights: 7, StartDate: day("2025-01-01"), EndDate: day("2025-12-31")}, false},
+		{"unknown weekday", models.RatePlan{Name: "Weekend", Kind: models.RatePlanKindPremium, Percent: 10, Weekdays: "fri,someday", StartDate: day("2025-01-01"), EndDate: day("2025-12-31")}, false},
+		{"unknown kind", models.RatePlan{Name: "Other", Kind: "surcharge", StartDate: day("2025-01-01"), EndDate: day("2025-12-31")}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateRatePlan(&tc.plan)
+			if tc.valid && err != nil {
+				t.Fatalf("expected plan to be valid, got %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatalf("expected plan to be refused")
+			}
+		})
+	}
+
+	plan := models.RatePlan{Name: " Weekend ", Kind: models.RatePlanKindPremium, Percent: 10, Weekdays: "Friday, SAT", StartDate: day("2025-01-01"), EndDate: day("2025-12-31")}
+	if err := validateRatePlan(&plan); err != nil {
+		t.Fatalf("expected plan to be valid, got %v", err)
+	}
+	if plan.Name != "Weekend" || plan.Weekdays != "fri,sat" {
+		t.Errorf("expected name and weekdays tidied, got %q and %q", plan.Name, plan.Weekdays)
+	}
+}
+
+func TestOccupancyExtras(t *testing.T) {
+	room := &models.Room{
+		RoomNo:         "101",
+		PricePerNight:  npr(10000),
+		BaseOccupancy:  2,
+		ExtraAdultRate: npr(2000),
+		ChildRate:      npr(1000),
+	}
+
+	cases := []struct {
+		name      string
+		occupancy models.Occupancy
+		extras    models.Money
+	}{
+		{"base occupancy", models.Occupancy{Adults: 2}, npr(0)},
+		{"extra adult", models.Occupancy{Adults: 3}, npr(2000)},
+		{"extra adult and children", models.Occupancy{Adults: 3, Children: 2}, npr(4000)},
+		{"child within base occupancy", models.Occupancy{Adults: 1, Children: 1}, npr(0)},
+		{"child over base occupancy", models.Occupancy{Adults: 1, Children: 2}, npr(1000)},
+		{"infants are free", models.Occupancy{Adults: 2, Children: 1, Infants: 2}, npr(1000)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if extras := occupancyExtras(room, tc.occupancy); extras != tc.extras {
+				t.Errorf("expected extras %s, got %s", tc.extras, extras)
+			}
+		})
+	}
+
+	// A room without a child rate charges nothing for children
+	room.ChildRate = models.Money{}
+	if extras := occupancyExtras(room, models.Occupancy{Adults: 2, Children: 2}); extras != npr(0) {
+		t.Errorf("expected no extras without a child rate, got %s", extras)
+	}
+}
+
+func TestCheckOccupancy(t *testing.T) {
+	ps := NewPricingService(nil, nil, models.AgeBands{})
+	room := &models.Room{RoomNo: "101", Capacity: 4}
+
+	cases := []struct {
+		name      string
+		occupancy models.Occupancy
+		valid     bool
+	}{
+		{"full room", models.Occupancy{Adults: 2, Children: 1, Infants: 1}, true},
+		{"no adult", models.Occupancy{Children: 2}, false},
+		{"infants count against capacity", models.Occupancy{Adults: 2, Children: 2, Infants: 1}, false},
+		{"negative children", models.Occupancy{Adults: 2, Children: -1}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ps.CheckOccupancy(room, tc.occupancy)
+			if tc.valid && err != nil {
+				t.Fatalf("expected occupancy to fit, got %v", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrOverCapacity) {
+				t.Fatalf("expected ErrOverCapacity, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBookingOccupancy(t *testing.T) {
+	cases := []struct {
+		name    string
+		booking models.RoomBooking
+		want    models.Occupancy
+	}{
+		{"priced by occupancy", models.RoomBooking{GuestCount: 4, Adults: 2, Children: 1, Infants: 1}, models.Occupancy{Adults: 2, Children: 1, Infants: 1}},
+		{"guest count only", models.RoomBooking{GuestCount: 3}, models.Occupancy{Adults: 3}},
+		{"no guests recorded", models.RoomBooking{}, models.Occupancy{Adults: 1}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := BookingOccupancy(&tc.booking); got != tc.want {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckStayRules(t *testing.T) {
+	rules := []models.StayRule{
+		{Name: "Dashain", MinNights: 2, StartDate: day("2025-10-01"), EndDate: day("2025-10-05")},
+		{Name: "Laxmi Puja", ClosedToArrival: true, StartDate: day("2025-10-20"), EndDate: day("2025-10-20")},
+		{Name: "Saturday departures", ClosedToDeparture: true, Weekdays: "sat", StartDate: day("2025-01-01"), EndDate: day("2025-12-31")},
+		{Name: "Deluxe", RoomType: "Deluxe", MaxNights: 5, StartDate: day("2000-01-01"), EndDate: day("2000-12-31"), Recurring: true},
+	}
+	standard := &models.Room{Type: "Standard"}
+	deluxe := &models.Room{Type: "Deluxe"}
+
+	cases := []struct {
+		name     string
+		room     *models.Room
+		checkIn  string
+		checkOut string
+		blocked  string // Name of the rule expected to block the stay
+	}{
+		{"too short in the season", standard, "2025-10-02", "2025-10-03", "Dashain"},
+		{"long enough in the season", standard, "2025-09-30", "2025-10-02", ""},
+		{"leaves as the season starts", standard, "2025-09-30", "2025-10-01", ""},
+		{"closed to arrival", standard, "2025-10-20", "2025-10-22", "Laxmi Puja"},
+		{"stays over a closed arrival", standard, "2025-10-19", "2025-10-21", ""},
+		{"closed to departure", standard, "2025-10-22", "2025-10-25", "Saturday departures"},
+		{"too long for the room type", deluxe, "2025-06-02", "2025-06-08", "Deluxe"},
+		{"other room type", standard, "2025-06-02", "2025-06-08", ""},
+		{"no room only checks rules for every room", nil, "2025-06-02", "2025-06-08", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkStayRules(rules, tc.room, day(tc.checkIn), day(tc.checkOut))
+			if tc.blocked == "" {
+				if err != nil {
+					t.Fatalf("expected stay to be allowed, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrStayRestricted) || !strings.Contains(err.Error(), tc.blocked) {
+				t.Fatalf("expected %s to block the stay, got %v", tc.blocked, err)
+			}
+		})
+	}
+}
+
+func TestValidateStayRule(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  models.StayRule
+		valid bool
+	}{
+		{"minimum stay", models.StayRule{Name: "Dashain", MinNights: 2, StartDate: day("2025-10-01"), EndDate: day("2025-10-05")}, true},
+		{"closed to arrival", models.StayRule{Name: "Laxmi Puja", ClosedToArrival: true, StartDate: day("2025-10-20"), EndDate: day("2025-10-20")}, true},
+		{"restricts nothing", models.StayRule{Name: "Empty", StartDate: day("2025-10-01"), EndDate: day("2025-10-05")}, false},
+		{"maximum under minimum", models.StayRule{Name: "Odd", MinNights: 3, MaxNights: 2, StartDate: day("2025-10-01"), EndDate: day("2025-10-05")}, false},
+		{"end before start", models.StayRule{Name: "Dashain", MinNights: 2, StartDate: day("2025-10-05"), EndDate: day("2025-10-01")}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateStayRule(&tc.rule)
+			if tc.valid && err != nil {
+				t.Fatalf("expected rule to be valid, got %v", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidStayRule) {
+				t.Fatalf("expected ErrInvalidStayRule, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,465 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Promo code errors that callers can tell apart
+var (
+	ErrPromoNotFound    = errors.New("promo code not found")
+	ErrPromoNotUsable   = errors.New("promo code cannot be used")
+	ErrInvalidPromoCode = errors.New("invalid promo code")
+)
+
+// releasedBookingStatuses are the statuses of bookings whose promo codes no
+// longer count towards usage limits
+var releasedBookingStatuses = []string{
+	models.BookingStatusCancelled,
+	models.BookingStatusRejected,
+	models.BookingStatusExpired,
+}
+
+// AppliedPromo is the discount one promo code gives a stay
+type AppliedPromo struct {
+	PromoCodeID uint         `json:"promo_code_id"`
+	Code        string       `json:"code"`
+	Description string       `json:"description"`
+	Discount    models.Money `json:"discount"`
+}
+
+// PromoDiscount is the discount a set of promo codes gives a stay
+type PromoDiscount struct {
+	Promos []AppliedPromo `json:"promos"`
+	Total  models.Money   `json:"total"`
+}
+
+// Codes returns the codes applied, comma-separated
+func (d *PromoDiscount) Codes() string {
+	codes := make([]string, len(d.Promos))
+	for i, promo := range d.Promos {
+		codes[i] = promo.Code
+	}
+	return strings.Join(codes, ",")
+}
+
+// PromoService checks, applies and redeems promo codes
+type PromoService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewPromoService creates a new instance of PromoService
+func NewPromoService(db *gorm.DB, logger *zap.Logger) *PromoService {
+	return &PromoService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ParsePromoCodes splits what a guest typed into promo codes, upper case and
+// without repeats. Codes may be separated by commas or spaces.
+func ParsePromoCodes(input string) []string {
+	var codes []string
+	seen := make(map[string]bool)
+	for _, code := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == ' ' }) {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code != "" && !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// Apply works out the discount codes give a stay in room booked today, off
+// its quoted price. It does not redeem them. guestID may be 0 before the guest
+// is known, in which case the per-guest limit is not checked.
+func (ps *PromoService) Apply(codes []string, guestID uint, room *models.Room, nights int, price models.Money) (*PromoDiscount, error) {
+	discount := &PromoDiscount{Total: models.NewMoney(0, price.Currency)}
+	if len(codes) == 0 {
+		return discount, nil
+	}
+
+	var found []models.PromoCode
+	if err := ps.db.Where("code IN ?", codes).Find(&found).Error; err != nil {
+		ps.logger.Error("failed to get promo codes", zap.Strings("codes", codes), zap.Error(err))
+		return nil, fmt.Errorf("failed to get promo codes: %w", err)
+	}
+
+	byCode := make(map[string]*models.PromoCode, len(found))
+	for i := range found {
+		byCode[found[i].Code] = &found[i]
+	}
+
+	var promos []*models.PromoCode
+	for _, code := range codes {
+		promo, ok := byCode[code]
+		if !ok || !promo.Active {
+			return nil, fmt.Errorf("%w: %s", ErrPromoNotFound, code)
+		}
+		if len(codes) > 1 && !promo.Stackable {
+			return nil, fmt.Errorf("%w: %s cannot be combined with other codes", ErrPromoNotUsable, code)
+		}
+		if err := checkPromo(promo, room, nights, time.Now()); err != nil {
+			return nil, err
+		}
+		if err := ps.checkUsage(ps.db, promo, guestID); err != nil {
+			return nil, err
+		}
+
+		promos = append(promos, promo)
+	}
+
+	return promoDiscount(promos, price)
+}
+
+// rediscount works out the discount the codes redeemed on a booking give it
+// once its room, nights or price change. Codes whose room type or minimum stay
+// the changed booking no longer meets are dropped; validity dates and usage
+// limits were checked when they were redeemed.
+func (ps *PromoService) rediscount(db *gorm.DB, bookingID uint, room *models.Room, nights int, price models.Money) (*PromoDiscount, error) {
+	var redemptions []models.PromoRedemption
+	if err := db.Where("booking_id = ?", bookingID).Order("id").Find(&redemptions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get promo redemptions: %w", err)
+	}
+
+	var promos []*models.PromoCode
+	for _, redemption := range redemptions {
+		var promo models.PromoCode
+		if err := db.First(&promo, redemption.PromoCodeID).Error; err != nil {
+			return nil, fmt.Errorf("failed to find promo code %s: %w", redemption.Code, err)
+		}
+		if err := checkPromoStay(&promo, room, nights); err != nil {
+			ps.logger.Info("promo code dropped from changed booking", zap.Uint("bookingID", bookingID), zap.Error(err))
+			continue
+		}
+		promos = append(promos, &promo)
+	}
+
+	return promoDiscount(promos, price)
+}
+
+// updateRedemptions brings the redemptions of a booking in line with a
+// discount worked out by rediscount, removing those of dropped codes
+func (ps *PromoService) updateRedemptions(tx *gorm.DB, bookingID uint, discount *PromoDiscount) error {
+	kept := make([]uint, 0, len(discount.Promos))
+	for _, applied := range discount.Promos {
+		kept = append(kept, applied.PromoCodeID)
+		if err := tx.Model(&models.PromoRedemption{}).
+			Where("booking_id = ? AND promo_code_id = ?", bookingID, applied.PromoCodeID).
+			Updates(map[string]interface{}{
+				"discount_minor":    applied.Discount.Minor,
+				"discount_currency": applied.Discount.Currency,
+			}).Error; err != nil {
+			return fmt.Errorf("failed to update promo code %s: %w", applied.Code, err)
+		}
+	}
+
+	query := tx.Where("booking_id = ?", bookingID)
+	if len(kept) > 0 {
+		query = query.Where("promo_code_id NOT IN ?", kept)
+	}
+	if err := query.Delete(&models.PromoRedemption{}).Error; err != nil {
+		return fmt.Errorf("failed to remove dropped promo codes: %w", err)
+	}
+	return nil
+}
+
+// promoDiscount works out the discount promo codes give a price. Percent codes
+// come off the price first, then fixed amounts.
+func promoDiscount(promos []*models.PromoCode, price models.Money) (*PromoDiscount, error) {
+	discount := &PromoDiscount{Total: models.NewMoney(0, price.Currency)}
+
+	var percent, fixed []*models.PromoCode
+	for _, promo := range promos {
+		if promo.Kind == models.PromoKindPercent {
+			percent = append(percent, promo)
+		} else {
+			fixed = append(fixed, promo)
+		}
+	}
+
+	remaining := price
+	for _, promo := range append(percent, fixed...) {
+		var amount models.Money
+		if promo.Kind == models.PromoKindPercent {
+			amount = remaining.Percent(promo.Percent)
+		} else {
+			if promo.Amount.Currency != price.Currency {
+				return nil, fmt.Errorf("%w: %s is only valid for prices in %s", ErrPromoNotUsable, promo.Code, promo.Amount.Currency)
+			}
+			amount = promo.Amount
+		}
+		amount = amount.Min(remaining)
+
+		remaining = remaining.Sub(amount)
+		discount.Total = discount.Total.Add(amount)
+		discount.Promos = append(discount.Promos, AppliedPromo{
+			PromoCodeID: promo.ID,
+			Code:        promo.Code,
+			Description: promo.Description,
+			Discount:    amount,
+		})
+	}
+
+	return discount, nil
+}
+
+// checkPromo checks the conditions of a promo code other than its usage limits
+func checkPromo(promo *models.PromoCode, room *models.Room, nights int, today time.Time) error {
+	date := today.Format("2006-01-02")
+	if date < promo.ValidFrom.Format("2006-01-02") {
+		return fmt.Errorf("%w: %s is valid from %s", ErrPromoNotUsable, promo.Code, promo.ValidFrom.Format("January 2, 2006"))
+	}
+	if date > promo.ValidUntil.Format("2006-01-02") {
+		return fmt.Errorf("%w: %s expired on %s", ErrPromoNotUsable, promo.Code, promo.ValidUntil.Format("January 2, 2006"))
+	}
+
+	return checkPromoStay(promo, room, nights)
+}
+
+// checkPromoStay checks that a stay of nights in room meets a promo code's
+// minimum stay and room types
+func checkPromoStay(promo *models.PromoCode, room *models.Room, nights int) error {
+	if nights < promo.MinNights {
+		return fmt.Errorf("%w: %s needs a stay of at least %d nights", ErrPromoNotUsable, promo.Code, promo.MinNights)
+	}
+
+	if promo.RoomTypes != "" {
+		found := false
+		for _, roomType := range strings.Split(promo.RoomTypes, ",") {
+			if strings.EqualFold(strings.TrimSpace(roomType), room.Type) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %s is only valid for %s rooms", ErrPromoNotUsable, promo.Code, promo.RoomTypes)
+		}
+	}
+
+	return nil
+}
+
+// checkUsage checks that a promo code has uses left, overall and for a guest
+func (ps *PromoService) checkUsage(tx *gorm.DB, promo *models.PromoCode, guestID uint) error {
+	if promo.MaxUses > 0 {
+		uses, err := promoUses(tx, promo.ID, 0)
+		if err != nil {
+			return err
+		}
+		if uses >= int64(promo.MaxUses) {
+			return fmt.Errorf("%w: %s has been fully redeemed", ErrPromoNotUsable, promo.Code)
+		}
+	}
+
+	if promo.MaxUsesPerGuest > 0 && guestID != 0 {
+		uses, err := promoUses(tx, promo.ID, guestID)
+		if err != nil {
+			return err
+		}
+		if uses >= int64(promo.MaxUsesPerGuest) {
+			return fmt.Errorf("%w: you have already used %s", ErrPromoNotUsable, promo.Code)
+		}
+	}
+
+	return nil
+}
+
+// promoUses counts the redemptions of a promo code on live bookings, by one
+// guest when guestID is not 0
+func promoUses(tx *gorm.DB, promoID, guestID uint) (int64, error) {
+	query := tx.Model(&models.PromoRedemption{}).
+		Joins("JOIN room_bookings ON room_bookings.id = promo_redemptions.booking_id").
+		Where("promo_redemptions.promo_code_id = ?", promoID).
+		Where("room_bookings.status NOT IN ?", releasedBookingStatuses)
+	if guestID != 0 {
+		query = query.Where("promo_redemptions.guest_id = ?", guestID)
+	}
+
+	var uses int64
+	if err := query.Count(&uses).Error; err != nil {
+		return 0, fmt.Errorf("failed to count promo code uses: %w", err)
+	}
+	return uses, nil
+}
+
+// RedeemOnHold records the codes of a discount against a new hold, as a step
+// of creating it. The usage limits are checked again with each code locked,
+// so two guests cannot both take the last use of a code.
+func (ps *PromoService) RedeemOnHold(guestID uint, discount *PromoDiscount) HoldStep {
+	return func(tx *gorm.DB, booking *models.RoomBooking) error {
+		if err := ps.redeem(tx, booking.ID, guestID, discount); err != nil {
+			return err
+		}
+		if discount != nil {
+			booking.DiscountAmount = discount.Total
+			booking.PromoCodes = discount.Codes()
+		}
+		return nil
+	}
+}
+
+// redeem records the codes of a discount against a booking
+func (ps *PromoService) redeem(tx *gorm.DB, bookingID, guestID uint, discount *PromoDiscount) error {
+	if discount == nil || len(discount.Promos) == 0 {
+		return nil
+	}
+
+	if err := ps.recordRedemptions(tx, bookingID, guestID, discount); err != nil {
+		ps.logger.Warn("failed to redeem promo codes", zap.Uint("bookingID", bookingID), zap.String("codes", discount.Codes()), zap.Error(err))
+		return err
+	}
+
+	ps.logger.Info("promo codes redeemed", zap.Uint("bookingID", bookingID), zap.String("codes", discount.Codes()),
+		zap.String("discount", discount.Total.String()))
+	return nil
+}
+
+// recordRedemptions stores a redemption of each code and the discount on the booking
+func (ps *PromoService) recordRedemptions(tx *gorm.DB, bookingID, guestID uint, discount *PromoDiscount) error {
+	for _, applied := range discount.Promos {
+		var promo models.PromoCode
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&promo, applied.PromoCodeID).Error; err != nil {
+			return fmt.Errorf("failed to find promo code %s: %w", applied.Code, err)
+		}
+		if err := ps.checkUsage(tx, &promo, guestID); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&models.PromoRedemption{
+			PromoCodeID: promo.ID,
+			BookingID:   bookingID,
+			GuestID:     guestID,
+			Code:        promo.Code,
+			Discount:    applied.Discount,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to record promo code %s: %w", applied.Code, err)
+		}
+	}
+
+	return tx.Model(&models.RoomBooking{}).Where("id = ?", bookingID).Updates(map[string]interface{}{
+		"discount_amount_minor":    discount.Total.Minor,
+		"discount_amount_currency": discount.Total.Currency,
+		"promo_codes":              discount.Codes(),
+	}).Error
+}
+
+// GetPromoCodes returns every promo code, the newest first
+func (ps *PromoService) GetPromoCodes() ([]models.PromoCode, error) {
+	var promos []models.PromoCode
+	if err := ps.db.Order("created_at DESC, id DESC").Find(&promos).Error; err != nil {
+		ps.logger.Error("failed to get promo codes", zap.Error(err))
+		return nil, fmt.Errorf("failed to get promo codes: %w", err)
+	}
+
+	return promos, nil
+}
+
+// GetRedemptions returns the redemptions of a promo code, the latest first
+func (ps *PromoService) GetRedemptions(promoID uint) ([]models.PromoRedemption, error) {
+	var redemptions []models.PromoRedemption
+	if err := ps.db.Where("promo_code_id = ?", promoID).Order("created_at DESC").Find(&redemptions).Error; err != nil {
+		ps.logger.Error("failed to get promo redemptions", zap.Uint("promoCodeID", promoID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get promo redemptions: %w", err)
+	}
+
+	return redemptions, nil
+}
+
+// SavePromoCode creates a promo code, or updates it when it has an ID
+func (ps *PromoService) SavePromoCode(promo *models.PromoCode) error {
+	if err := validatePromoCode(promo); err != nil {
+		return err
+	}
+
+	if promo.ID != 0 {
+		var existing models.PromoCode
+		if err := ps.db.First(&existing, promo.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPromoNotFound
+			}
+			return fmt.Errorf("failed to find promo code: %w", err)
+		}
+		promo.CreatedAt = existing.CreatedAt
+	}
+
+	if err := ps.db.Save(promo).Error; err != nil {
+		ps.logger.Error("failed to save promo code", zap.String("code", promo.Code), zap.Error(err))
+		return fmt.Errorf("failed to save promo code: %w", err)
+	}
+
+	ps.logger.Info("promo code saved", zap.Uint("promoCodeID", promo.ID), zap.String("code", promo.Code))
+	return nil
+}
+
+// DeactivatePromoCode stops a promo code being redeemed. It is kept for the
+// bookings it was redeemed on.
+func (ps *PromoService) DeactivatePromoCode(id uint) error {
+	result := ps.db.Model(&models.PromoCode{}).Where("id = ?", id).Update("active", false)
+	if result.Error != nil {
+		ps.logger.Error("failed to deactivate promo code", zap.Uint("promoCodeID", id), zap.Error(result.Error))
+		return fmt.Errorf("failed to deactivate promo code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrPromoNotFound
+	}
+
+	return nil
+}
+
+// validatePromoCode checks a promo code and tidies its fields
+func validatePromoCode(promo *models.PromoCode) error {
+	promo.Code = strings.ToUpper(strings.TrimSpace(promo.Code))
+	if promo.Code == "" || strings.ContainsAny(promo.Code, ", ") {
+		return fmt.Errorf("%w: code is required and cannot contain commas or spaces", ErrInvalidPromoCode)
+	}
+
+	switch promo.Kind {
+	case models.PromoKindPercent:
+		if promo.Percent <= 0 || promo.Percent > 100 {
+			return fmt.Errorf("%w: percent must be more than 0 and at most 100", ErrInvalidPromoCode)
+		}
+		promo.Amount = models.NewMoney(0, models.DefaultCurrency)
+	case models.PromoKindFixed:
+		promo.Amount = promo.Amount.In(models.DefaultCurrency)
+		if !promo.Amount.IsPositive() {
+			return fmt.Errorf("%w: amount must be more than zero", ErrInvalidPromoCode)
+		}
+		promo.Percent = 0
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidPromoCode, promo.Kind)
+	}
+
+	if promo.ValidFrom.IsZero() || promo.ValidUntil.IsZero() {
+		return fmt.Errorf("%w: valid from and until dates are required", ErrInvalidPromoCode)
+	}
+	if promo.ValidUntil.Before(promo.ValidFrom) {
+		return fmt.Errorf("%w: valid until is before valid from", ErrInvalidPromoCode)
+	}
+
+	if promo.MinNights < 0 || promo.MaxUses < 0 || promo.MaxUsesPerGuest < 0 {
+		return fmt.Errorf("%w: minimum nights and usage limits cannot be negative", ErrInvalidPromoCode)
+	}
+
+	if promo.RoomTypes != "" {
+		var roomTypes []string
+		for _, roomType := range strings.Split(promo.RoomTypes, ",") {
+			if roomType = strings.TrimSpace(roomType); roomType != "" {
+				roomTypes = append(roomTypes, roomType)
+			}
+		}
+		promo.RoomTypes = strings.Join(roomTypes, ",")
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"go.uber.org/zap"
+)
+
+func TestParsePromoCodes(t *testing.T) {
+	got := ParsePromoCodes(" dashain10, welcome  DASHAIN10,,tihar ")
+	want := []string{"DASHAIN10", "WELCOME", "TIHAR"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestCheckPromo(t *testing.T) {
+	promo := &models.PromoCode{
+		Code:       "DASHAIN10",
+		ValidFrom:  day("2025-10-01"),
+		ValidUntil: day("2025-10-31"),
+		MinNights:  2,
+		RoomTypes:  "Deluxe,Suite",
+	}
+	deluxe := &models.Room{Type: "deluxe"}
+
+	cases := []struct {
+		name   string
+		room   *models.Room
+		nights int
+		today  string
+		usable bool
+	}{
+		{"first day", deluxe, 2, "2025-10-01", true},
+		{"last day", deluxe, 2, "2025-10-31", true},
+		{"before it starts", deluxe, 2, "2025-09-30", false},
+		{"after it ends", deluxe, 2, "2025-11-01", false},
+		{"stay too short", deluxe, 1, "2025-10-15", false},
+		{"other room type", &models.Room{Type: "Standard"}, 3, "2025-10-15", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkPromo(promo, tc.room, tc.nights, day(tc.today))
+			if tc.usable && err != nil {
+				t.Fatalf("expected code to be usable, got %v", err)
+			}
+			if !tc.usable && !errors.Is(err, ErrPromoNotUsable) {
+				t.Fatalf("expected ErrPromoNotUsable, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPromoDiscount(t *testing.T) {
+	percent := &models.PromoCode{ID: 1, Code: "TEN", Kind: models.PromoKindPercent, Percent: 10}
+	fixed := &models.PromoCode{ID: 2, Code: "THOUSAND", Kind: models.PromoKindFixed, Amount: npr(1000)}
+	large := &models.PromoCode{ID: 3, Code: "BIG", Kind: models.PromoKindFixed, Amount: npr(50000)}
+
+	cases := []struct {
+		name      string
+		promos    []*models.PromoCode
+		total     models.Money
+		discounts []models.Money
+	}{
+		{"percent", []*models.PromoCode{percent}, npr(2000), []models.Money{npr(2000)}},
+		{"fixed", []*models.PromoCode{fixed}, npr(1000), []models.Money{npr(1000)}},
+		// 10% of 20000 is 2000, then 1000 off what is left
+		{"percent before fixed", []*models.PromoCode{fixed, percent}, npr(3000), []models.Money{npr(2000), npr(1000)}},
+		// 1000 off 20000 first would make the percent 1900
+		{"fixed does not lower the percent", []*models.PromoCode{percent, fixed}, npr(3000), []models.Money{npr(2000), npr(1000)}},
+		{"capped at the price", []*models.PromoCode{percent, large}, npr(20000), []models.Money{npr(2000), npr(18000)}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			discount, err := promoDiscount(tc.promos, npr(20000))
+			if err != nil {
+				t.Fatalf("failed to work out discount: %v", err)
+			}
+			if discount.Total != tc.total {
+				t.Errorf("expected total %s, got %s", tc.total, discount.Total)
+			}
+			if len(discount.Promos) != len(tc.discounts) {
+				t.Fatalf("expected %d codes applied, got %d", len(tc.discounts), len(discount.Promos))
+			}
+			for i, applied := range discount.Promos {
+				if applied.Discount != tc.discounts[i] {
+					t.Errorf("expected %s off from %s, got %s", tc.discounts[i], applied.Code, applied.Discount)
+				}
+			}
+		})
+	}
+
+	dollars := &models.PromoCode{Code: "USD10", Kind: models.PromoKindFixed, Amount: models.NewMoney(1000, "USD")}
+	if _, err := promoDiscount([]*models.PromoCode{dollars}, npr(20000)); !errors.Is(err, ErrPromoNotUsable) {
+		t.Fatalf("expected ErrPromoNotUsable for a code in another currency, got %v", err)
+	}
+}
+
+func TestValidatePromoCode(t *testing.T) {
+	cases := []struct {
+		name  string
+		promo models.PromoCode
+		valid bool
+	}{
+		{"percent", models.PromoCode{Code: "ten", Kind: models.PromoKindPercent, Percent: 10, ValidFrom: day("2025-10-01"), ValidUntil: day("2025-10-31")}, true},
+		{"code with a space", models.PromoCode{Code: "TEN OFF", Kind: models.PromoKindPercent, Percent: 10, ValidFrom: day("2025-10-01"), ValidUntil: day("2025-10-31")}, false},
+		{"over 100 percent", models.PromoCode{Code: "ALL", Kind: models.PromoKindPercent, Percent: 101, ValidFrom: day("2025-10-01"), ValidUntil: day("2025-10-31")}, false},
+		{"fixed without amount", models.PromoCode{Code: "FREE", Kind: models.PromoKindFixed, ValidFrom: day("2025-10-01"), ValidUntil: day("2025-10-31")}, false},
+		{"ends before it starts", models.PromoCode{Code: "TEN", Kind: models.PromoKindPercent, Percent: 10, ValidFrom: day("2025-10-31"), ValidUntil: day("2025-10-01")}, false},
+		{"negative limit", models.PromoCode{Code: "TEN", Kind: models.PromoKindPercent, Percent: 10, ValidFrom: day("2025-10-01"), ValidUntil: day("2025-10-31"), MaxUsesPerGuest: -1}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validatePromoCode(&tc.promo)
+			if tc.valid && err != nil {
+				t.Fatalf("expected code to be valid, got %v", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidPromoCode) {
+				t.Fatalf("expected ErrInvalidPromoCode, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckUsageCountsLiveBookingsOnly(t *testing.T) {
+	tx := testTx(t, openTestDB(t))
+	guest, room := createTestRoom(t, tx, "PROMO-1")
+
+	promo := models.PromoCode{
+		Code:            "ONCE",
+		Kind:            models.PromoKindPercent,
+		Percent:         10,
+		ValidFrom:       day("2025-01-01"),
+		ValidUntil:      day("2030-12-31"),
+		MaxUsesPerGuest: 1,
+		Active:          true,
+	}
+	if err := tx.Create(&promo).Error; err != nil {
+		t.Fatalf("failed to create promo code: %v", err)
+	}
+
+	booking := models.RoomBooking{
+		GuestID:    guest.ID,
+		RoomID:     room.ID,
+		CheckIn:    day("2030-01-10"),
+		CheckOut:   day("2030-01-12"),
+		TotalPrice: room.PricePerNight.Mul(2),
+		Status:     models.BookingStatusConfirmed,
+	}
+	if err := tx.Create(&booking).Error; err != nil {
+		t.Fatalf("failed to create booking: %v", err)
+	}
+	redemption := models.PromoRedemption{PromoCodeID: promo.ID, BookingID: booking.ID, GuestID: guest.ID, Code: promo.Code}
+	if err := tx.Create(&redemption).Error; err != nil {
+		t.Fatalf("failed to create redemption: %v", err)
+	}
+
+	ps := NewPromoService(tx, zap.NewNop())
+	if err := ps.checkUsage(tx, &promo, guest.ID); !errors.Is(err, ErrPromoNotUsable) {
+		t.Fatalf("expected the guest's second use to be refused, got %v", err)
+	}
+	if err := ps.checkUsage(tx, &promo, guest.ID+1); err != nil {
+		t.Fatalf("expected another guest to use the code, got %v", err)
+	}
+
+	if err := tx.Model(&booking).Update("status", models.BookingStatusCancelled).Error; err != nil {
+		t.Fatalf("failed to cancel booking: %v", err)
+	}
+	if err := ps.checkUsage(tx, &promo, guest.ID); err != nil {
+		t.Fatalf("expected a cancelled booking to free the use, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
@@ -9,27 +10,93 @@ import (
 	"time"
 
 	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"github.com/IamMaheshGurung/privateOnsenBooking/utils"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrRoomUnavailable is returned when a room already has a booking overlapping the requested dates
+var ErrRoomUnavailable = errors.New("room is not available for the selected dates")
+
+// ErrHoldExpired is returned when a pending booking is confirmed after its hold ran out
+var ErrHoldExpired = errors.New("booking hold has expired")
+
+// ErrBalanceDue is returned when a guest is checked out with money still owed
+var ErrBalanceDue = errors.New("booking has an outstanding balance")
+
+// ErrNoShowTooEarly is returned when a booking is marked as a no-show before
+// the no-show cutoff on its arrival date
+var ErrNoShowTooEarly = errors.New("guest can still arrive")
+
+// BookingBalance is how much of a booking has been paid, derived from its payments
+type BookingBalance struct {
+	BookingID   uint         `json:"booking_id"`
+	Total       models.Money `json:"total"`
+	Deposit     models.Money `json:"deposit"`
+	Paid        models.Money `json:"paid"`
+	Outstanding models.Money `json:"outstanding"`
+	DepositPaid bool         `json:"deposit_paid"`
+}
+
+// legacyServiceFeeRate is the percent service fee charged on bookings made
+// before tax rules, which have no tax breakdown
+const legacyServiceFeeRate = 5
+
+// BookingTotals returns the room total, taxes and amount due for a booking
+func BookingTotals(booking *models.RoomBooking) (roomTotal, tax, total models.Money) {
+	roomTotal = booking.TotalPrice
+	tax = booking.TaxAmount.In(roomTotal.Currency)
+	if booking.Taxes == nil {
+		tax = roomTotal.Percent(legacyServiceFeeRate)
+	}
+	return roomTotal, tax, roomTotal.Add(tax)
+}
+
+// Booking references look like KPG-7KX3Q9
+const (
+	bookingReferencePrefix = "KPG"
+	bookingReferenceLength = 6
+)
+
+// blockingBookings limits a query to bookings that occupy their room: everything
+// except cancelled, rejected, expired and no-show bookings and pending holds
+// that have run out
+func blockingBookings(now time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("status NOT IN (?, ?, ?, ?)", models.BookingStatusCancelled, models.BookingStatusRejected, models.BookingStatusExpired, models.BookingStatusNoShow).
+			Where("NOT (status = ? AND expires_at IS NOT NULL AND expires_at <= ?)", models.BookingStatusPending, now)
+	}
+}
+
 // RoomBookingService handles all room booking related operations
 type RoomBookingService struct {
 	db           *gorm.DB
 	logger       *zap.Logger
 	emailservice *EmailService
+	onsen        *OnsenBookingService
+	invoices     *InvoiceService
+	noShowCutoff time.Duration // Time of day on the arrival date after which guests are no-shows
 }
 
 // NewRoomBookingService creates a new instance of RoomBookingService
-func NewRoomBookingService(db *gorm.DB, logger *zap.Logger, emailservice *EmailService) *RoomBookingService {
+func NewRoomBookingService(db *gorm.DB, logger *zap.Logger, emailservice *EmailService, onsen *OnsenBookingService, invoices *InvoiceService) *RoomBookingService {
 	return &RoomBookingService{
 		db:           db,
 		logger:       logger,
 		emailservice: emailservice,
+		onsen:        onsen,
+		invoices:     invoices,
 	}
 }
 
+// SetNoShowCutoff sets the time of day on the arrival date, e.g. 22h, until
+// which a guest who has not checked in cannot be marked as a no-show
+func (rbs *RoomBookingService) SetNoShowCutoff(cutoff time.Duration) {
+	rbs.noShowCutoff = cutoff
+}
+
 func (rbs *RoomBookingService) GetAllRooms() ([]*models.Room, error) {
 	var rooms []*models.Room
 	if err := rbs.db.Find(&rooms).Error; err != nil {
@@ -76,14 +143,17 @@ func (rbs *RoomBookingService) CreateRoom(room models.Room) error {
 func (rbs *RoomBookingService) UpdateRoom(room models.Room) (*models.Room, error) {
 	// Create an updated room using keyed fields
 	updatedRoom := models.Room{
-		ID:            room.ID,
-		RoomNo:        room.RoomNo,
-		Type:          room.Type,
-		Capacity:      room.Capacity,
-		PricePerNight: room.PricePerNight,
-		Description:   room.Description,
-		Amenities:     room.Amenities,
-		ImageURL:      room.ImageURL,
+		ID:             room.ID,
+		RoomNo:         room.RoomNo,
+		Type:           room.Type,
+		Capacity:       room.Capacity,
+		PricePerNight:  room.PricePerNight,
+		BaseOccupancy:  room.BaseOccupancy,
+		ExtraAdultRate: room.ExtraAdultRate,
+		ChildRate:      room.ChildRate,
+		Description:    room.Description,
+		Amenities:      room.Amenities,
+		ImageURL:       room.ImageURL,
 	}
 
 	// Update the room in the database
@@ -106,11 +176,13 @@ func (rbs *RoomBookingService) DeactivateRoom(id uint) error {
 	// Check if room has any active bookings
 	var activeBookingCount int64
 	if err := rbs.db.Model(&models.RoomBooking{}).Where(
-		"room_id = ? AND check_out > ? AND status NOT IN (?, ?)",
+		"room_id = ? AND check_out > ? AND status NOT IN (?, ?, ?, ?)",
 		id,
 		time.Now(),
 		models.BookingStatusCancelled,
 		models.BookingStatusRejected,
+		models.BookingStatusExpired,
+		models.BookingStatusNoShow,
 	).Count(&activeBookingCount).Error; err != nil {
 		rbs.logger.Error("failed to check active bookings", zap.Error(err))
 		return fmt.Errorf("failed to check active bookings: %w", err)
@@ -136,8 +208,8 @@ func (rbs *RoomBookingService) IsRoomAvailable(roomID uint, checkIn, checkOut ti
 	var count int64
 
 	err := rbs.db.Model(&models.RoomBooking{}).
-		Where("room_id = ? AND check_in < ? AND check_out > ? AND status != ?",
-			roomID, checkOut, checkIn, models.BookingStatusCancelled).
+		Scopes(blockingBookings(time.Now())).
+		Where("room_id = ? AND check_in < ? AND check_out > ?", roomID, checkOut, checkIn).
 		Count(&count).Error
 
 	if err != nil {
@@ -148,13 +220,22 @@ func (rbs *RoomBookingService) IsRoomAvailable(roomID uint, checkIn, checkOut ti
 	return count == 0, nil
 }
 
+// IsRoomAvailableForUpdate checks if a room is free between checkIn and
+// checkOut for a booking moving there, ignoring the booking itself
 func (rbs *RoomBookingService) IsRoomAvailableForUpdate(roomID uint, bookingID uint, checkIn, checkOut time.Time) (bool, error) {
+	return rbs.roomAvailableForUpdate(rbs.db, roomID, bookingID, checkIn, checkOut)
+}
+
+// roomAvailableForUpdate is IsRoomAvailableForUpdate run on db, so it can be
+// checked inside a transaction holding the room lock
+func (rbs *RoomBookingService) roomAvailableForUpdate(db *gorm.DB, roomID uint, bookingID uint, checkIn, checkOut time.Time) (bool, error) {
 	var count int64
 
 	// Count conflicting bookings, EXCLUDING the current booking being updated
-	if err := rbs.db.Model(&models.RoomBooking{}).
-		Where("room_id = ? AND id != ? AND status != ? AND check_in < ? AND check_out > ?",
-			roomID, bookingID, models.BookingStatusCancelled, checkOut, checkIn).
+	if err := db.Model(&models.RoomBooking{}).
+		Scopes(blockingBookings(time.Now())).
+		Where("room_id = ? AND id != ? AND check_in < ? AND check_out > ?",
+			roomID, bookingID, checkOut, checkIn).
 		Count(&count).Error; err != nil {
 		rbs.logger.Error("failed to check room availability for update", zap.Error(err))
 		return false, fmt.Errorf("failed to check room availability for update: %w", err)
@@ -194,18 +275,8 @@ func (rbs *RoomBookingService) GetAvailableRooms(checkIn, checkOut time.Time, gu
 	return availableRooms, nil
 }
 
-// CreateBooking creates a new room booking
+// CreateBooking creates a new confirmed room booking
 func (rbs *RoomBookingService) CreateBooking(guestID, roomID uint, checkIn, checkOut time.Time) (*models.RoomBooking, error) {
-	available, err := rbs.IsRoomAvailable(roomID, checkIn, checkOut)
-	if err != nil {
-		return nil, err
-	}
-
-	if !available {
-		rbs.logger.Warn("room is not available", zap.Uint("roomID", roomID))
-		return nil, fmt.Errorf("room is not available")
-	}
-
 	booking := models.RoomBooking{
 		GuestID:  guestID,
 		RoomID:   roomID,
@@ -214,63 +285,508 @@ func (rbs *RoomBookingService) CreateBooking(guestID, roomID uint, checkIn, chec
 		Status:   models.BookingStatusConfirmed,
 	}
 
+	if err := rbs.insertBooking(&booking); err != nil {
+		return nil, err
+	}
+
+	return &booking, nil
+}
+
+// HoldStep completes a new hold within the transaction that inserts it, e.g.
+// redeeming its promo codes. An error from any step rolls the hold back.
+type HoldStep func(tx *gorm.DB, booking *models.RoomBooking) error
+
+// CreateHold creates a pending booking that keeps the room for holdFor while the
+// guest completes checkout. The booking is stored as priced by the caller and
+// the steps run before it is committed. Unpaid holds are released by
+// ReleaseExpiredHolds.
+func (rbs *RoomBookingService) CreateHold(booking models.RoomBooking, holdFor time.Duration, steps ...HoldStep) (*models.RoomBooking, error) {
+	expiresAt := time.Now().Add(holdFor)
+	booking.Status = models.BookingStatusPending
+	booking.ExpiresAt = &expiresAt
+
+	if err := rbs.insertBooking(&booking, steps...); err != nil {
+		return nil, err
+	}
+
+	rbs.logger.Info("room hold created",
+		zap.Uint("bookingID", booking.ID),
+		zap.Uint("roomID", booking.RoomID),
+		zap.Time("expiresAt", expiresAt))
+
+	return &booking, nil
+}
+
+// insertBooking stores a booking if its room is free for the dates, then runs
+// the steps in the same transaction
+func (rbs *RoomBookingService) insertBooking(booking *models.RoomBooking, steps ...HoldStep) error {
 	var guest models.Guest
-	if err := rbs.db.First(&guest, guestID).Error; err != nil {
+	if err := rbs.db.First(&guest, booking.GuestID).Error; err != nil {
 		rbs.logger.Error("failed to fetch guest", zap.Error(err))
-		return nil, fmt.Errorf("failed to fetch guest: %w", err)
+		return fmt.Errorf("failed to fetch guest: %w", err)
 	}
 
-	var room models.Room
-	if err := rbs.db.First(&room, roomID).Error; err != nil {
-		rbs.logger.Error("Failed to fetch the room details", zap.Error(err))
-		return nil, fmt.Errorf("failed to fetch the rooms: %w", err)
+	// The availability check and the insert run in one transaction holding a row
+	// lock on the room, so concurrent requests for the same room are serialized
+	return rbs.db.Transaction(func(tx *gorm.DB) error {
+		var room models.Room
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&room, booking.RoomID).Error; err != nil {
+			rbs.logger.Error("Failed to fetch the room details", zap.Error(err))
+			return fmt.Errorf("failed to fetch the rooms: %w", err)
+		}
+
+		var count int64
+		if err := tx.Model(&models.RoomBooking{}).
+			Scopes(blockingBookings(time.Now())).
+			Where("room_id = ? AND check_in < ? AND check_out > ?",
+				booking.RoomID, booking.CheckOut, booking.CheckIn).
+			Count(&count).Error; err != nil {
+			rbs.logger.Error("failed to check room availability", zap.Error(err))
+			return fmt.Errorf("failed to check room availability: %w", err)
+		}
+
+		if count > 0 {
+			rbs.logger.Warn("room is not available", zap.Uint("roomID", booking.RoomID))
+			return ErrRoomUnavailable
+		}
+
+		reference, err := rbs.newReferenceNumber(tx)
+		if err != nil {
+			return err
+		}
+		booking.ReferenceNumber = reference
+
+		if err := tx.Create(booking).Error; err != nil {
+			rbs.logger.Error("failed to create booking", zap.Error(err))
+			return fmt.Errorf("failed to create booking: %w", err)
+		}
+
+		for _, step := range steps {
+			if err := step(tx, booking); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// newReferenceNumber generates a booking reference that is not in use yet
+func (rbs *RoomBookingService) newReferenceNumber(tx *gorm.DB) (string, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		reference, err := utils.GenerateReference(bookingReferencePrefix, bookingReferenceLength)
+		if err != nil {
+			return "", err
+		}
+
+		var count int64
+		if err := tx.Model(&models.RoomBooking{}).Where("reference_number = ?", reference).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("failed to check booking reference: %w", err)
+		}
+
+		if count == 0 {
+			return reference, nil
+		}
 	}
 
-	if err := rbs.db.Create(&booking).Error; err != nil {
-		rbs.logger.Error("failed to create booking", zap.Error(err))
-		return nil, fmt.Errorf("failed to create booking: %w", err)
+	rbs.logger.Error("could not generate a unique booking reference")
+	return "", errors.New("could not generate a unique booking reference")
+}
+
+// AssignMissingReferences gives a reference number to bookings created before
+// references were generated
+func (rbs *RoomBookingService) AssignMissingReferences() error {
+	var bookings []models.RoomBooking
+	if err := rbs.db.Where("reference_number = '' OR reference_number IS NULL").Find(&bookings).Error; err != nil {
+		return fmt.Errorf("failed to find bookings without reference: %w", err)
 	}
 
-	return &booking, nil
+	for _, booking := range bookings {
+		reference, err := rbs.newReferenceNumber(rbs.db)
+		if err != nil {
+			return err
+		}
+
+		if err := rbs.db.Model(&booking).Update("reference_number", reference).Error; err != nil {
+			return fmt.Errorf("failed to assign booking reference: %w", err)
+		}
+	}
+
+	if len(bookings) > 0 {
+		rbs.logger.Info("assigned missing booking references", zap.Int("count", len(bookings)))
+	}
+
+	return nil
+}
+
+// ConfirmHold confirms a pending booking once it has been paid for. A hold that
+// has already run out is marked expired and ErrHoldExpired is returned.
+func (rbs *RoomBookingService) ConfirmHold(bookingID uint) error {
+	err := rbs.db.Transaction(func(tx *gorm.DB) error {
+		return rbs.confirmHold(tx, bookingID)
+	})
+	if errors.Is(err, ErrHoldExpired) {
+		rbs.expireHold(bookingID)
+	}
+
+	return err
+}
+
+// expireHold marks a pending booking whose hold ran out as expired. Bookings
+// no longer pending are left alone.
+func (rbs *RoomBookingService) expireHold(bookingID uint) {
+	err := rbs.db.Transaction(func(tx *gorm.DB) error {
+		var booking models.RoomBooking
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, bookingID).Error; err != nil {
+			return fmt.Errorf("failed to find booking: %w", err)
+		}
+		if booking.Status != models.BookingStatusPending {
+			return nil
+		}
+		return transitionBooking(tx, &booking, models.BookingStatusExpired, models.BookingActorSystem, "Hold released before payment", nil)
+	})
+	if err != nil {
+		rbs.logger.Error("failed to expire booking", zap.Uint("bookingID", bookingID), zap.Error(err))
+	}
 }
 
-// UpdateBookingByID updates an existing booking
-func (rbs *RoomBookingService) UpdateBookingByID(bookingID uint, checkIn, checkOut time.Time) error {
+// confirmHold is ConfirmHold within the caller's transaction. Confirming a
+// booking that is already confirmed is a no-op. It does not write anything when
+// the hold has expired; the caller settles the payment and expires the hold.
+func (rbs *RoomBookingService) confirmHold(tx *gorm.DB, bookingID uint) error {
 	var booking models.RoomBooking
-	if err := rbs.db.First(&booking, bookingID).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, bookingID).Error; err != nil {
 		return fmt.Errorf("failed to find booking: %w", err)
 	}
 
-	// If dates are changing, check availability
-	if !booking.CheckIn.Equal(checkIn) || !booking.CheckOut.Equal(checkOut) {
-		// Check if the room is available for the new check-in and check-out dates
-		// We need to exclude the current booking from the check
-		var count int64
-		err := rbs.db.Model(&models.RoomBooking{}).
-			Where("room_id = ? AND id != ? AND check_in < ? AND check_out > ? AND status != ?",
-				booking.RoomID, bookingID, checkOut, checkIn, models.BookingStatusCancelled).
-			Count(&count).Error
+	if booking.Status == models.BookingStatusConfirmed {
+		return nil
+	}
 
+	if booking.Status == models.BookingStatusExpired ||
+		(booking.Status == models.BookingStatusPending && booking.ExpiresAt != nil && !booking.ExpiresAt.After(time.Now())) {
+		rbs.logger.Warn("attempt to confirm an expired hold", zap.Uint("bookingID", bookingID))
+		return ErrHoldExpired
+	}
+
+	if err := transitionBooking(tx, &booking, models.BookingStatusConfirmed, models.BookingActorSystem, "Payment received", map[string]interface{}{
+		"expires_at": nil,
+	}); err != nil {
+		rbs.logger.Error("failed to confirm booking", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseExpiredHolds marks pending bookings whose hold has run out as expired
+func (rbs *RoomBookingService) ReleaseExpiredHolds() (int64, error) {
+	var bookingIDs []uint
+	if err := rbs.db.Model(&models.RoomBooking{}).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at <= ?", models.BookingStatusPending, time.Now()).
+		Pluck("id", &bookingIDs).Error; err != nil {
+		rbs.logger.Error("failed to release expired holds", zap.Error(err))
+		return 0, fmt.Errorf("failed to release expired holds: %w", err)
+	}
+
+	var released int64
+	for _, bookingID := range bookingIDs {
+		err := rbs.db.Transaction(func(tx *gorm.DB) error {
+			// Skip holds being paid for right now; the payment decides them
+			var booking models.RoomBooking
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("id = ? AND status = ?", bookingID, models.BookingStatusPending).
+				Limit(1).Find(&booking).Error; err != nil {
+				return err
+			}
+			if booking.ID == 0 {
+				return nil
+			}
+
+			if err := transitionBooking(tx, &booking, models.BookingStatusExpired, models.BookingActorSystem, "Hold ran out before payment", nil); err != nil {
+				return err
+			}
+			released++
+			return nil
+		})
 		if err != nil {
-			rbs.logger.Error("failed to check room availability", zap.Error(err))
-			return fmt.Errorf("failed to check room availability: %w", err)
+			rbs.logger.Error("failed to release expired hold", zap.Uint("bookingID", bookingID), zap.Error(err))
+			return released, fmt.Errorf("failed to release expired holds: %w", err)
+		}
+	}
+
+	if released > 0 {
+		rbs.logger.Info("released expired room holds", zap.Int64("count", released))
+	}
+
+	return released, nil
+}
+
+// RunHoldSweeper releases expired holds every interval until ctx is cancelled
+func (rbs *RoomBookingService) RunHoldSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := rbs.ReleaseExpiredHolds(); err != nil {
+				rbs.logger.Warn("hold sweep failed", zap.Error(err))
+			}
 		}
+	}
+}
 
-		if count > 0 {
-			rbs.logger.Warn("room is not available for update", zap.Uint("roomID", booking.RoomID))
-			return fmt.Errorf("room is not available for the new dates")
+// MarkNoShow marks a confirmed booking whose guest never arrived as a no-show,
+// once the no-show cutoff on its arrival date has passed. The no-show fee of its cancellation terms is kept, whatever was paid beyond
+// it is queued as a pending refund, and the room is free again for the
+// nights the booking held. Actor is recorded as who marked it.
+func (rbs *RoomBookingService) MarkNoShow(bookingID uint, actor string) (*models.RoomBooking, error) {
+	var booking models.RoomBooking
+	err := rbs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, bookingID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("booking not found")
+			}
+			return fmt.Errorf("failed to find booking: %w", err)
 		}
+
+		return rbs.markNoShow(tx, &booking, actor, "Guest did not arrive")
+	})
+	if err != nil {
+		rbs.logger.Error("failed to mark booking as no-show", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, err
 	}
 
-	// Update the booking details
-	booking.CheckIn = checkIn
-	booking.CheckOut = checkOut
+	rbs.logger.Info("booking marked as no-show",
+		zap.Uint("bookingID", bookingID),
+		zap.Stringer("noShowFee", booking.CancellationFee))
+	return &booking, nil
+}
 
-	if err := rbs.db.Save(&booking).Error; err != nil {
-		return fmt.Errorf("failed to update booking: %w", err)
+// markNoShow moves a booking locked in tx to no-show, keeping the no-show fee
+// of its cancellation terms. It returns ErrNoShowTooEarly before the no-show
+// cutoff on the arrival date.
+func (rbs *RoomBookingService) markNoShow(tx *gorm.DB, booking *models.RoomBooking, actor, reason string) error {
+	if cutoff := noShowCutoff(booking.CheckIn, rbs.noShowCutoff); time.Now().Before(cutoff) {
+		return fmt.Errorf("%w: not a no-show before %s", ErrNoShowTooEarly, cutoff.Format("Jan 2, 2006 15:04"))
 	}
 
-	return nil
+	booking.CancellationFee = booking.TotalPrice.Percent(BookingCancellationTerms(booking).NoShowFee())
+	booking.CancellationReason = reason
+
+	if err := transitionBooking(tx, booking, models.BookingStatusNoShow, actor, reason, map[string]interface{}{
+		"cancellation_reason":       booking.CancellationReason,
+		"cancellation_fee_minor":    booking.CancellationFee.Minor,
+		"cancellation_fee_currency": booking.CancellationFee.Currency,
+	}); err != nil {
+		return err
+	}
+
+	if err := rbs.cancelStaySessions(tx, booking.ID); err != nil {
+		return err
+	}
+
+	_, err := rbs.queueRefund(tx, booking)
+	return err
+}
+
+// cancelStaySessions cancels the onsen sessions still booked for a stay that
+// will not take place
+func (rbs *RoomBookingService) cancelStaySessions(tx *gorm.DB, bookingID uint) error {
+	if rbs.onsen == nil {
+		return nil
+	}
+
+	sessions, err := rbs.onsen.staySessions(tx, bookingID)
+	if err != nil {
+		return err
+	}
+
+	return rbs.onsen.cancelSessions(tx, sessions)
+}
+
+// MarkNoShows marks confirmed bookings not checked in by the no-show cutoff,
+// a time of day on their arrival date, as no-shows and tells the admin which
+// were marked. A booking that fails is logged and skipped; the others are
+// still marked.
+func (rbs *RoomBookingService) MarkNoShows() (int64, error) {
+	now := time.Now()
+
+	var candidates []models.RoomBooking
+	if err := rbs.db.Select("id", "check_in").
+		Where("status = ? AND check_in <= ?", models.BookingStatusConfirmed, now).
+		Find(&candidates).Error; err != nil {
+		rbs.logger.Error("failed to find no-shows", zap.Error(err))
+		return 0, fmt.Errorf("failed to find no-shows: %w", err)
+	}
+
+	reason := fmt.Sprintf("Not checked in by %s on the arrival date", cutoffText(rbs.noShowCutoff))
+	var marked []uint
+	failed := 0
+	for _, candidate := range candidates {
+		if now.Before(noShowCutoff(candidate.CheckIn, rbs.noShowCutoff)) {
+			continue
+		}
+
+		var bookingID uint
+		err := rbs.db.Transaction(func(tx *gorm.DB) error {
+			// Skip bookings the front desk is checking in right now
+			var booking models.RoomBooking
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("id = ? AND status = ?", candidate.ID, models.BookingStatusConfirmed).
+				Limit(1).Find(&booking).Error; err != nil {
+				return err
+			}
+			if booking.ID == 0 {
+				return nil
+			}
+
+			if err := rbs.markNoShow(tx, &booking, models.BookingActorSystem, reason); err != nil {
+				return err
+			}
+			bookingID = booking.ID
+			return nil
+		})
+		if err != nil {
+			rbs.logger.Error("failed to mark no-show", zap.Uint("bookingID", candidate.ID), zap.Error(err))
+			failed++
+			continue
+		}
+		if bookingID != 0 {
+			marked = append(marked, bookingID)
+		}
+	}
+
+	if len(marked) > 0 {
+		rbs.logger.Info("marked no-show bookings", zap.Int("count", len(marked)))
+		rbs.notifyNoShows(marked)
+	}
+
+	if failed > 0 {
+		return int64(len(marked)), fmt.Errorf("failed to mark %d no-show booking(s)", failed)
+	}
+	return int64(len(marked)), nil
+}
+
+// notifyNoShows emails the admin a list of bookings just marked as no-shows
+func (rbs *RoomBookingService) notifyNoShows(bookingIDs []uint) {
+	if rbs.emailservice == nil {
+		return
+	}
+
+	var bookings []models.RoomBooking
+	if err := rbs.db.Preload("Guest").Preload("Room").
+		Where("id IN ?", bookingIDs).
+		Order("check_in ASC, id ASC").
+		Find(&bookings).Error; err != nil {
+		rbs.logger.Error("failed to load no-show bookings", zap.Error(err))
+		return
+	}
+
+	rows := make([]map[string]interface{}, 0, len(bookings))
+	for _, booking := range bookings {
+		rows = append(rows, map[string]interface{}{
+			"Reference": booking.ReferenceNumber,
+			"GuestName": booking.Guest.Name,
+			"RoomNo":    booking.Room.RoomNo,
+			"CheckIn":   booking.CheckIn.Format("2006-01-02"),
+			"CheckOut":  booking.CheckOut.Format("2006-01-02"),
+			"Fee":       booking.CancellationFee.String(),
+		})
+	}
+
+	subject := fmt.Sprintf("%d booking(s) marked as no-show", len(bookings))
+	message := "These confirmed bookings were not checked in on their arrival date. " +
+		"Their no-show fees have been kept, any refunds are waiting for approval and their rooms are free again."
+	if err := rbs.emailservice.SendAdminNotification(subject, message, map[string]interface{}{
+		"Bookings": rows,
+	}); err != nil {
+		rbs.logger.Warn("failed to send no-show notification", zap.Error(err))
+	}
+}
+
+// notifyUnpaidConfirmation warns the admin that a confirmed booking lost the
+// payment it was confirmed with, so the balance can be collected or the booking
+// cancelled
+func (rbs *RoomBookingService) notifyUnpaidConfirmation(bookingID uint, reason string) {
+	rbs.logger.Error("authorized payment failed for a confirmed booking",
+		zap.Uint("bookingID", bookingID),
+		zap.String("reason", reason))
+	if rbs.emailservice == nil {
+		return
+	}
+
+	var booking models.RoomBooking
+	if err := rbs.db.Preload("Guest").Preload("Room").First(&booking, bookingID).Error; err != nil {
+		rbs.logger.Error("failed to load unpaid booking", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return
+	}
+	balance, err := rbs.balance(rbs.db, &booking)
+	if err != nil {
+		return
+	}
+
+	subject := fmt.Sprintf("Payment failed for confirmed booking %s", booking.ReferenceNumber)
+	message := "The payment authorization that confirmed this booking has failed. " +
+		"The room is still reserved; collect the balance from the guest or cancel the booking."
+	if reason != "" {
+		message += " The provider said: " + reason + "."
+	}
+	if err := rbs.emailservice.SendAdminNotification(subject, message, map[string]interface{}{
+		"AmountLabel": "Balance due",
+		"Bookings": []map[string]interface{}{{
+			"Reference": booking.ReferenceNumber,
+			"GuestName": booking.Guest.Name,
+			"RoomNo":    booking.Room.RoomNo,
+			"CheckIn":   booking.CheckIn.Format("2006-01-02"),
+			"CheckOut":  booking.CheckOut.Format("2006-01-02"),
+			"Fee":       balance.Outstanding.String(),
+		}},
+	}); err != nil {
+		rbs.logger.Warn("failed to send unpaid booking notification", zap.Error(err))
+	}
+}
+
+// RunNoShowSweeper marks no-shows once a day at the no-show cutoff until ctx
+// is cancelled
+func (rbs *RoomBookingService) RunNoShowSweeper(ctx context.Context) {
+	for {
+		timer := time.NewTimer(time.Until(nextNoShowSweep(time.Now(), rbs.noShowCutoff)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if _, err := rbs.MarkNoShows(); err != nil {
+				rbs.logger.Warn("no-show sweep failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// noShowCutoff returns the time on a booking's arrival date after which its
+// guest is a no-show
+func noShowCutoff(checkIn time.Time, cutoff time.Duration) time.Time {
+	arrival := time.Date(checkIn.Year(), checkIn.Month(), checkIn.Day(), 0, 0, 0, 0, checkIn.Location())
+	return arrival.Add(cutoff)
+}
+
+// nextNoShowSweep returns the next time after now that the clock reads cutoff
+func nextNoShowSweep(now time.Time, cutoff time.Duration) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(cutoff % (24 * time.Hour))
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// cutoffText writes a time of day given as time since midnight, e.g. 22:00
+func cutoffText(cutoff time.Duration) string {
+	cutoff %= 24 * time.Hour
+	return fmt.Sprintf("%02d:%02d", int(cutoff.Hours()), int(cutoff.Minutes())%60)
 }
 
 // GetBookingByID retrieves a booking by its ID
@@ -325,75 +841,6 @@ func (rbs *RoomBookingService) GetAllBookings(status string, future bool) ([]mod
 	return bookings, nil
 }
 
-// CancelBookingByID cancels a booking by its ID
-func (rbs *RoomBookingService) CancelBookingByID(bookingID uint) error {
-	var booking models.RoomBooking
-
-	if err := rbs.db.First(&booking, bookingID).Error; err != nil {
-		return fmt.Errorf("failed to find booking: %w", err)
-	}
-
-	booking.Status = models.BookingStatusCancelled
-
-	if err := rbs.db.Save(&booking).Error; err != nil {
-		rbs.logger.Error("failed to cancel booking", zap.Uint("bookingID", bookingID), zap.Error(err))
-		return fmt.Errorf("failed to cancel booking: %w", err)
-	}
-
-	return nil
-}
-
-// UpdateBookingStatus changes the status of a booking
-func (rbs *RoomBookingService) UpdateBookingStatus(bookingID uint, status string) error {
-	result := rbs.db.Model(&models.RoomBooking{}).
-		Where("id = ?", bookingID).
-		Update("status", status)
-
-	if result.Error != nil {
-		rbs.logger.Error("Failed to update booking status",
-			zap.Uint("bookingID", bookingID),
-			zap.String("status", status),
-			zap.Error(result.Error))
-		return fmt.Errorf("failed to update booking status: %w", result.Error)
-	}
-
-	if result.RowsAffected == 0 {
-		rbs.logger.Warn("No booking found to update status",
-			zap.Uint("bookingID", bookingID))
-		return fmt.Errorf("booking not found")
-	}
-
-	return nil
-}
-
-// UpdateBookingDetails updates additional details for a booking
-func (rbs *RoomBookingService) UpdateBookingDetails(bookingID uint, status string, specialRequests string, guestCount int, totalPrice float64) error {
-	// Find the booking
-	var booking models.RoomBooking
-	if err := rbs.db.First(&booking, bookingID).Error; err != nil {
-		rbs.logger.Error("Failed to find booking for update",
-			zap.Uint("bookingID", bookingID),
-			zap.Error(err))
-		return fmt.Errorf("booking not found: %w", err)
-	}
-
-	// Update fields
-	booking.Status = status
-	booking.SpecialRequests = specialRequests
-	booking.GuestCount = uint(guestCount)
-	booking.TotalPrice = totalPrice
-
-	// Save changes
-	if err := rbs.db.Save(&booking).Error; err != nil {
-		rbs.logger.Error("Failed to update booking details",
-			zap.Uint("bookingID", bookingID),
-			zap.Error(err))
-		return fmt.Errorf("failed to update booking: %w", err)
-	}
-
-	return nil
-}
-
 // GetBookingsByGuestID retrieves all bookings for a specific guest
 func (rbs *RoomBookingService) GetBookingsByGuestID(guestID uint) ([]models.RoomBooking, error) {
 	var bookings []models.RoomBooking
@@ -451,18 +898,18 @@ func (rbs *RoomBookingService) GetBookingsByDateRange(start, end time.Time) ([]m
 	return bookings, nil
 }
 
-// CheckGuestIn marks a booking as checked in
-func (rbs *RoomBookingService) CheckGuestIn(bookingID uint) error {
-	var booking models.RoomBooking
-
-	if err := rbs.db.First(&booking, bookingID).Error; err != nil {
-		return fmt.Errorf("failed to find booking: %w", err)
-	}
-
-	booking.Status = models.BookingStatusCheckedIn
-	booking.ActualCheckIn = time.Now()
+// CheckGuestIn marks a confirmed booking as checked in, recording actor as
+// who checked the guest in
+func (rbs *RoomBookingService) CheckGuestIn(bookingID uint, actor string) error {
+	err := rbs.db.Transaction(func(tx *gorm.DB) error {
+		var booking models.RoomBooking
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, bookingID).Error; err != nil {
+			return fmt.Errorf("failed to find booking: %w", err)
+		}
 
-	if err := rbs.db.Save(&booking).Error; err != nil {
+		return rbs.checkGuestIn(tx, &booking, actor)
+	})
+	if err != nil {
 		rbs.logger.Error("failed to check guest in", zap.Uint("bookingID", bookingID), zap.Error(err))
 		return fmt.Errorf("failed to check guest in: %w", err)
 	}
@@ -470,32 +917,141 @@ func (rbs *RoomBookingService) CheckGuestIn(bookingID uint) error {
 	return nil
 }
 
-// CheckGuestOut marks a booking as checked out
-func (rbs *RoomBookingService) CheckGuestOut(bookingID uint) error {
-	var booking models.RoomBooking
+// checkGuestIn is CheckGuestIn of a booking locked in tx
+func (rbs *RoomBookingService) checkGuestIn(tx *gorm.DB, booking *models.RoomBooking, actor string) error {
+	return transitionBooking(tx, booking, models.BookingStatusCheckedIn, actor, "", map[string]interface{}{
+		"actual_check_in": time.Now(),
+	})
+}
 
+// GetBalance returns what has been paid and what is still owed on a booking.
+// Only succeeded payments count as paid; authorized ones are still to be collected.
+func (rbs *RoomBookingService) GetBalance(bookingID uint) (*BookingBalance, error) {
+	var booking models.RoomBooking
 	if err := rbs.db.First(&booking, bookingID).Error; err != nil {
-		return fmt.Errorf("failed to find booking: %w", err)
+		return nil, fmt.Errorf("failed to find booking: %w", err)
+	}
+
+	return rbs.balance(rbs.db, &booking)
+}
+
+// balance is GetBalance of a booking already loaded from db
+func (rbs *RoomBookingService) balance(db *gorm.DB, booking *models.RoomBooking) (*BookingBalance, error) {
+	bookingID := booking.ID
+
+	var payments []models.Payment
+	if err := db.Where("booking_id = ? AND status = ?", bookingID, models.PaymentStatusSucceeded).
+		Find(&payments).Error; err != nil {
+		rbs.logger.Error("failed to sum booking payments", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, fmt.Errorf("failed to sum booking payments: %w", err)
+	}
+
+	// Charges posted during the stay come on top of the room; room nights
+	// posted to the folio are already part of the booking total
+	var charges []models.FolioItem
+	if err := db.Where("booking_id = ? AND category <> ? AND voided_at IS NULL", bookingID, models.FolioCategoryRoomNight).
+		Find(&charges).Error; err != nil {
+		rbs.logger.Error("failed to sum folio charges", zap.Uint("bookingID", bookingID), zap.Error(err))
+		return nil, fmt.Errorf("failed to sum folio charges: %w", err)
+	}
+
+	_, _, total := BookingTotals(booking)
+	for _, charge := range charges {
+		total = total.Add(charge.Amount)
 	}
 
-	booking.Status = models.BookingStatusCompleted
-	booking.ActualCheckOut = time.Now()
+	paid := models.NewMoney(0, total.Currency)
+	for _, payment := range payments {
+		paid = paid.Add(payment.Amount)
+	}
+
+	outstanding := total.Sub(paid)
+	if outstanding.IsNegative() {
+		outstanding = models.NewMoney(0, total.Currency)
+	}
 
-	if err := rbs.db.Save(&booking).Error; err != nil {
+	return &BookingBalance{
+		BookingID:   bookingID,
+		Total:       total,
+		Deposit:     booking.DepositAmount,
+		Paid:        paid,
+		Outstanding: outstanding,
+		DepositPaid: paid.Cmp(booking.DepositAmount) >= 0,
+	}, nil
+}
+
+// CheckGuestOut marks a checked in booking as checked out, recording actor as
+// who checked the guest out. Unless allowBalanceDue is set, it refuses with
+// ErrBalanceDue while money is still owed. A settled booking goes on to
+// completed; one left owing stays checked out until it is settled. The
+// balance at check-out is returned either way so callers can warn about it.
+func (rbs *RoomBookingService) CheckGuestOut(bookingID uint, allowBalanceDue bool, actor string) (*BookingBalance, error) {
+	var balance *BookingBalance
+	err := rbs.db.Transaction(func(tx *gorm.DB) error {
+		var booking models.RoomBooking
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, bookingID).Error; err != nil {
+			return fmt.Errorf("failed to find booking: %w", err)
+		}
+
+		var err error
+		balance, err = rbs.checkGuestOut(tx, &booking, allowBalanceDue, actor)
+		return err
+	})
+	if errors.Is(err, ErrBalanceDue) {
+		return balance, err
+	}
+	if err != nil {
 		rbs.logger.Error("failed to check guest out", zap.Uint("bookingID", bookingID), zap.Error(err))
-		return fmt.Errorf("failed to check guest out: %w", err)
+		return nil, fmt.Errorf("failed to check guest out: %w", err)
 	}
 
-	return nil
+	return balance, nil
+}
+
+// checkGuestOut is CheckGuestOut of a booking locked in tx
+func (rbs *RoomBookingService) checkGuestOut(tx *gorm.DB, booking *models.RoomBooking, allowBalanceDue bool, actor string) (*BookingBalance, error) {
+	balance, err := rbs.balance(tx, booking)
+	if err != nil {
+		return nil, err
+	}
+
+	if balance.Outstanding.IsPositive() {
+		if !allowBalanceDue {
+			return balance, ErrBalanceDue
+		}
+		rbs.logger.Warn("guest checked out with balance due",
+			zap.Uint("bookingID", booking.ID),
+			zap.Stringer("outstanding", balance.Outstanding))
+	}
+
+	if err := transitionBooking(tx, booking, models.BookingStatusCheckedOut, actor, "", map[string]interface{}{
+		"actual_check_out": time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	if rbs.invoices != nil {
+		if _, err := rbs.invoices.issueInvoice(tx, booking.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if !balance.Outstanding.IsPositive() {
+		if err := transitionBooking(tx, booking, models.BookingStatusCompleted, actor, "Settled at check-out", nil); err != nil {
+			return nil, err
+		}
+	}
+	return balance, nil
 }
 
-// GetBookingByEmailAndCode retrieves a booking by guest email and booking code
+// GetBookingByEmailAndCode retrieves a booking by guest email and reference number
 func (rbs *RoomBookingService) GetBookingByEmailAndCode(email, bookingCode string) (*models.RoomBooking, error) {
 	var booking models.RoomBooking
 
 	// Join with Guest table to check email
 	if err := rbs.db.Joins("JOIN guests ON guests.id = room_bookings.guest_id").
-		Where("guests.email = ? AND room_bookings.booking_code = ?", email, bookingCode).
+		Where("LOWER(guests.email) = LOWER(?) AND room_bookings.reference_number = ?",
+			strings.TrimSpace(email), utils.NormalizeReference(bookingCode)).
 		First(&booking).Error; err != nil {
 		rbs.logger.Error("failed to find booking by email and code", zap.Error(err))
 		return nil, fmt.Errorf("booking not found: %w", err)
@@ -510,9 +1066,10 @@ func (rbs *RoomBookingService) GetBookingByEmailAndCode(email, bookingCode strin
 	return &booking, nil
 }
 
-// VerifyBookingOwnership checks if the provided email and booking code match the booking
+// VerifyBookingOwnership checks if the provided email and reference number match the booking
 func (rbs *RoomBookingService) VerifyBookingOwnership(bookingID uint, email, bookingCode string) (bool, error) {
 	var booking models.RoomBooking
+	bookingCode = utils.NormalizeReference(bookingCode)
 
 	if err := rbs.db.First(&booking, bookingID).Error; err != nil {
 		rbs.logger.Error("Failed to find booking for verification",
@@ -524,7 +1081,7 @@ func (rbs *RoomBookingService) VerifyBookingOwnership(bookingID uint, email, boo
 	// If the booking doesn't have a guest assigned yet, check if it uses booking code
 	if booking.GuestID == 0 {
 		// For bookings without a guest, just check the reference number/booking code
-		return booking.ReferenceNumber == bookingCode, nil
+		return booking.ReferenceNumber != "" && booking.ReferenceNumber == bookingCode, nil
 	}
 
 	// Booking has a guest, so we need to check both the email and reference number
@@ -540,68 +1097,48 @@ func (rbs *RoomBookingService) VerifyBookingOwnership(bookingID uint, email, boo
 
 	// Check if email and booking reference match
 	emailMatches := strings.EqualFold(guest.Email, email) // Case-insensitive comparison
-	codeMatches := booking.ReferenceNumber == bookingCode
+	codeMatches := booking.ReferenceNumber != "" && booking.ReferenceNumber == bookingCode
 
 	return emailMatches && codeMatches, nil
 }
 
-// CancelBooking changes a booking's status to cancelled
-func (rbs *RoomBookingService) CancelBooking(bookingID uint) error {
-	// Get the booking
-	var booking models.RoomBooking
-	if err := rbs.db.First(&booking, bookingID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			rbs.logger.Error("booking not found for cancellation", zap.Uint("bookingID", bookingID))
-			return fmt.Errorf("booking not found")
-		}
-		rbs.logger.Error("database error while fetching booking for cancellation",
-			zap.Uint("bookingID", bookingID),
-			zap.Error(err))
-		return fmt.Errorf("failed to fetch booking: %w", err)
-	}
-
-	// Check if booking can be cancelled
-	if booking.Status == models.BookingStatusCancelled {
-		rbs.logger.Warn("attempt to cancel an already cancelled booking",
-			zap.Uint("bookingID", bookingID))
-		return fmt.Errorf("booking is already cancelled")
-	}
-
-	if booking.Status == models.BookingStatusCheckedIn || booking.Status == models.BookingStatusCheckedOut {
-		rbs.logger.Warn("attempt to cancel a checked-in or checked-out booking",
-			zap.Uint("bookingID", bookingID),
-			zap.String("status", string(booking.Status)))
-		return fmt.Errorf("cannot cancel a %s booking", booking.Status)
+// CancelBooking changes a booking's status to cancelled. A cancellation fee
+// applies under the booking's cancellation terms, and whatever was paid beyond
+// the fee is queued as pending refunds, one per payment it goes back to,
+// which are returned (none if nothing is owed back to the guest). Actor is
+// recorded as who cancelled it.
+func (rbs *RoomBookingService) CancelBooking(bookingID uint, reason, actor string) ([]models.Refund, error) {
+	if reason == "" {
+		reason = "Guest requested cancellation"
 	}
 
-	// Check if cancellation is within the allowed timeframe
-	// Typically hotels have a cancellation policy (e.g., 24/48 hours before check-in)
-	hoursBeforeCheckIn := time.Until(booking.CheckIn).Hours()
-
-	// Load cancellation policy from configuration or use default
-	// This could be moved to a settings service in a real application
-	const minHoursForFreeCancellation = 24.0
+	var booking models.RoomBooking
+	var refunds []models.Refund
+
+	err := rbs.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the booking so a concurrent cancellation cannot queue a second refund
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, bookingID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				rbs.logger.Error("booking not found for cancellation", zap.Uint("bookingID", bookingID))
+				return fmt.Errorf("booking not found")
+			}
+			rbs.logger.Error("database error while fetching booking for cancellation",
+				zap.Uint("bookingID", bookingID),
+				zap.Error(err))
+			return fmt.Errorf("failed to fetch booking: %w", err)
+		}
 
-	// Apply cancellation fee if within cancellation window
-	// You could implement a more sophisticated fee structure based on your business rules
-	cancellationFee := 0.0
-	if hoursBeforeCheckIn < minHoursForFreeCancellation && hoursBeforeCheckIn > 0 {
-		// For example, charge 50% of the total price as a cancellation fee
-		cancellationFee = booking.TotalPrice * 0.5
+		var err error
+		refunds, err = rbs.cancelBooking(tx, &booking, reason, actor)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Update booking status and save cancellation details
-	booking.Status = models.BookingStatusCancelled
-	booking.CancellationReason = "Guest requested cancellation"
-	booking.CancellationFee = cancellationFee
-	booking.CancelledAt = time.Now()
-
-	// Save changes to database
-	if err := rbs.db.Save(&booking).Error; err != nil {
-		rbs.logger.Error("failed to update booking status to cancelled",
-			zap.Uint("bookingID", bookingID),
-			zap.Error(err))
-		return fmt.Errorf("failed to cancel booking: %w", err)
+	refundAmount := models.NewMoney(0, booking.TotalPrice.Currency)
+	for _, refund := range refunds {
+		refundAmount = refundAmount.Add(refund.Amount)
 	}
 
 	// If there's a guest, try to load their details for notification
@@ -615,7 +1152,7 @@ func (rbs *RoomBookingService) CancelBooking(bookingID uint) error {
 				// Ignoring errors here as the booking has been cancelled successfully regardless of email
 				var room models.Room
 				if err := rbs.db.First(&room, booking.RoomID).Error; err == nil {
-					_ = rbs.emailservice.SendBookingCancellationNotice(&booking, &guest, &room)
+					_ = rbs.emailservice.SendBookingCancellationNotice(&booking, &guest, &room, refundAmount)
 				}
 			}
 		}
@@ -623,9 +1160,176 @@ func (rbs *RoomBookingService) CancelBooking(bookingID uint) error {
 
 	rbs.logger.Info("booking cancelled successfully",
 		zap.Uint("bookingID", bookingID),
-		zap.Float64("cancellationFee", cancellationFee))
+		zap.Stringer("cancellationFee", booking.CancellationFee),
+		zap.Stringer("refundAmount", refundAmount))
 
-	return nil
+	return refunds, nil
+}
+
+// cancelBooking cancels a booking locked in tx, charging the cancellation fee
+// of its terms and queueing refunds of what was paid beyond it
+func (rbs *RoomBookingService) cancelBooking(tx *gorm.DB, booking *models.RoomBooking, reason, actor string) ([]models.Refund, error) {
+	booking.CancellationReason = reason
+	booking.CancellationFee = cancellationFee(booking, time.Now())
+	booking.CancelledAt = time.Now()
+
+	if err := transitionBooking(tx, booking, models.BookingStatusCancelled, actor, reason, map[string]interface{}{
+		"cancellation_reason":       booking.CancellationReason,
+		"cancellation_fee_minor":    booking.CancellationFee.Minor,
+		"cancellation_fee_currency": booking.CancellationFee.Currency,
+		"cancelled_at":              booking.CancelledAt,
+	}); err != nil {
+		rbs.logger.Warn("failed to cancel booking",
+			zap.Uint("bookingID", booking.ID),
+			zap.String("status", booking.Status),
+			zap.Error(err))
+		return nil, err
+	}
+
+	if err := rbs.cancelStaySessions(tx, booking.ID); err != nil {
+		return nil, err
+	}
+
+	return rbs.queueRefund(tx, booking)
+}
+
+// changeStatus moves a booking locked in tx to status, recording what goes
+// with it: the arrival or departure time, or the cancellation or no-show fee
+// and the refunds it leaves, which are returned
+func (rbs *RoomBookingService) changeStatus(tx *gorm.DB, booking *models.RoomBooking, status, actor, reason string) ([]models.Refund, error) {
+	switch status {
+	case models.BookingStatusCheckedIn:
+		return nil, rbs.checkGuestIn(tx, booking, actor)
+	case models.BookingStatusCheckedOut:
+		_, err := rbs.checkGuestOut(tx, booking, false, actor)
+		return nil, err
+	case models.BookingStatusCancelled:
+		if reason == "" {
+			reason = "Guest requested cancellation"
+		}
+		return rbs.cancelBooking(tx, booking, reason, actor)
+	case models.BookingStatusNoShow:
+		if reason == "" {
+			reason = "Guest did not arrive"
+		}
+		if err := rbs.markNoShow(tx, booking, actor, reason); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	default:
+		return nil, transitionBooking(tx, booking, status, actor, reason, nil)
+	}
+}
+
+// BookingCancellationTerms returns the cancellation terms a booking was made
+// on. Bookings made before cancellation policies have the standard terms.
+func BookingCancellationTerms(booking *models.RoomBooking) models.CancellationTerms {
+	if booking.CancellationTerms.IsZero() {
+		return models.StandardCancellationTerms()
+	}
+	return booking.CancellationTerms
+}
+
+// cancellationFee returns the fee for cancelling a booking at the given time
+// under the cancellation terms it was made on
+func cancellationFee(booking *models.RoomBooking, at time.Time) models.Money {
+	hoursBeforeCheckIn := booking.CheckIn.Sub(at).Hours()
+	return booking.TotalPrice.Percent(BookingCancellationTerms(booking).FeePercent(hoursBeforeCheckIn))
+}
+
+// refundLatePayment queues refunds of money received for a booking that can
+// no longer be confirmed, e.g. a hold that ran out or a booking cancelled
+// while the guest was paying. Any cancellation fee the booking carries is kept.
+func (rbs *RoomBookingService) refundLatePayment(tx *gorm.DB, bookingID uint, reason string) ([]models.Refund, error) {
+	var booking models.RoomBooking
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, bookingID).Error; err != nil {
+		return nil, fmt.Errorf("failed to find booking: %w", err)
+	}
+
+	if booking.CancellationReason == "" {
+		booking.CancellationReason = reason
+	}
+
+	refunds, err := rbs.queueRefund(tx, &booking)
+	if err != nil {
+		return nil, err
+	}
+	if len(refunds) > 0 {
+		rbs.logger.Warn("refund queued for a payment the booking could not take",
+			zap.Uint("bookingID", bookingID),
+			zap.String("status", booking.Status),
+			zap.Int("refunds", len(refunds)))
+	}
+
+	return refunds, nil
+}
+
+// queueRefund records pending refunds of what was paid for a booking beyond
+// its cancellation fee and any refunds already queued. The amount is taken
+// from the latest payments first, each refund capped at what is left of its
+// payment, so money goes back through the method it was paid with.
+func (rbs *RoomBookingService) queueRefund(tx *gorm.DB, booking *models.RoomBooking) ([]models.Refund, error) {
+	var payments []models.Payment
+	if err := tx.Where("booking_id = ? AND status = ?", booking.ID, models.PaymentStatusSucceeded).
+		Order("created_at DESC, id DESC").
+		Find(&payments).Error; err != nil {
+		return nil, fmt.Errorf("failed to get booking payments: %w", err)
+	}
+
+	var queued []models.Refund
+	if err := tx.Where("booking_id = ?", booking.ID).Find(&queued).Error; err != nil {
+		return nil, fmt.Errorf("failed to get booking refunds: %w", err)
+	}
+
+	currency := booking.TotalPrice.Currency
+	refunded := make(map[uint]models.Money, len(queued))
+	amount := booking.CancellationFee.In(currency).Neg()
+	for _, payment := range payments {
+		amount = amount.Add(payment.Amount)
+	}
+	for _, refund := range queued {
+		refunded[refund.PaymentID] = refunded[refund.PaymentID].Add(refund.Amount)
+		amount = amount.Sub(refund.Amount)
+	}
+
+	refunds := splitRefund(amount, payments, refunded)
+	for i := range refunds {
+		refunds[i].BookingID = booking.ID
+		refunds[i].Reason = booking.CancellationReason
+		refunds[i].Status = models.RefundStatusPending
+		if err := tx.Create(&refunds[i]).Error; err != nil {
+			rbs.logger.Error("failed to queue refund", zap.Uint("bookingID", booking.ID), zap.Error(err))
+			return nil, fmt.Errorf("failed to queue refund: %w", err)
+		}
+	}
+
+	return refunds, nil
+}
+
+// splitRefund shares amount out over payments in the order given, each part
+// capped at what is left of its payment after what was already refunded
+func splitRefund(amount models.Money, payments []models.Payment, refunded map[uint]models.Money) []models.Refund {
+	var refunds []models.Refund
+	for _, payment := range payments {
+		if !amount.IsPositive() {
+			break
+		}
+
+		left := payment.Amount.Sub(refunded[payment.ID])
+		if !left.IsPositive() {
+			continue
+		}
+
+		refund := models.Refund{
+			PaymentID: payment.ID,
+			Amount:    amount.Min(left),
+			Method:    payment.Method,
+		}
+		amount = amount.Sub(refund.Amount)
+		refunds = append(refunds, refund)
+	}
+
+	return refunds
 }
 
 // GetSimilarRooms returns rooms similar to the specified room
@@ -669,11 +1373,12 @@ func (rbs *RoomBookingService) GetSimilarRooms(roomID uint, roomType string, lim
 		query = query.Where("type = ?", referenceRoom.Type)
 
 		// Calculate price range (±20% of reference room's price)
-		minPrice := referenceRoom.PricePerNight * 0.8
-		maxPrice := referenceRoom.PricePerNight * 1.2
+		minPrice := referenceRoom.PricePerNight.Percent(80)
+		maxPrice := referenceRoom.PricePerNight.Percent(120)
 
 		// Find rooms with similar price
-		query = query.Where("price_per_night BETWEEN ? AND ?", minPrice, maxPrice)
+		query = query.Where("price_per_night_currency = ?", referenceRoom.PricePerNight.Currency).
+			Where("price_per_night_minor BETWEEN ? AND ?", minPrice.Minor, maxPrice.Minor)
 
 		// Capacity should be at least the same as the reference room
 		query = query.Where("capacity >= ?", referenceRoom.Capacity)
@@ -685,7 +1390,7 @@ func (rbs *RoomBookingService) GetSimilarRooms(roomID uint, roomType string, lim
 		query = query.Where("type = ?", roomType)
 
 		// Order by price ascending (cheapest first)
-		query = query.Order("price_per_night ASC")
+		query = query.Order("price_per_night_minor ASC")
 	}
 
 	// Apply the limit
@@ -718,10 +1423,10 @@ func (rbs *RoomBookingService) GetSimilarRooms(roomID uint, roomType string, lim
 		if referenceRoom.ID != 0 {
 			// If we have the reference room, try to match by similar capacity
 			fallbackQuery = fallbackQuery.Where("capacity >= ?", referenceRoom.Capacity)
-			fallbackQuery = fallbackQuery.Order(gorm.Expr("ABS(price_per_night - ?) ASC", referenceRoom.PricePerNight))
+			fallbackQuery = fallbackQuery.Order(gorm.Expr("ABS(price_per_night_minor - ?) ASC", referenceRoom.PricePerNight.Minor))
 		} else {
 			// Otherwise just get the best rooms available
-			fallbackQuery = fallbackQuery.Order("price_per_night DESC")
+			fallbackQuery = fallbackQuery.Order("price_per_night_minor DESC")
 		}
 
 		fallbackQuery = fallbackQuery.Limit(remainingLimit)
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+	"go.uber.org/zap"
+)
+
+func TestCreateHoldConcurrentRequestsBookRoomOnce(t *testing.T) {
+	db := openTestDB(t)
+
+	// Committed rows, since each request runs in its own transaction
+	guest, room := createTestRoom(t, db, fmt.Sprintf("HOLD-%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		db.Where("room_id = ?", room.ID).Delete(&models.RoomBooking{})
+		db.Delete(room)
+		db.Delete(guest)
+	})
+
+	rbs := NewRoomBookingService(db, zap.NewNop(), nil, nil, nil)
+	checkIn := time.Now().AddDate(0, 0, 60).Truncate(24 * time.Hour)
+	checkOut := checkIn.AddDate(0, 0, 3)
+
+	const requests = 10
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := rbs.CreateHold(models.RoomBooking{
+				GuestID:    guest.ID,
+				RoomID:     room.ID,
+				CheckIn:    checkIn,
+				CheckOut:   checkOut,
+				TotalPrice: room.PricePerNight.Mul(3),
+			}, 15*time.Minute)
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrRoomUnavailable):
+			t.Errorf("expected ErrRoomUnavailable, got %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("expected exactly one hold to succeed, got %d", succeeded)
+	}
+
+	var count int64
+	db.Model(&models.RoomBooking{}).Where("room_id = ?", room.ID).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected one booking for the room, got %d", count)
+	}
+}
+
+func TestMarkNoShowRefusedBeforeCutoff(t *testing.T) {
+	tx := testTx(t, openTestDB(t))
+	guest, room := createTestRoom(t, tx, "NOSHOW-1")
+
+	today := time.Now()
+	arrival := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+	booking := models.RoomBooking{
+		GuestID:    guest.ID,
+		RoomID:     room.ID,
+		CheckIn:    arrival,
+		CheckOut:   arrival.AddDate(0, 0, 2),
+		TotalPrice: room.PricePerNight.Mul(2),
+		Status:     models.BookingStatusConfirmed,
+	}
+	if err := tx.Create(&booking).Error; err != nil {
+		t.Fatalf("failed to create booking: %v", err)
+	}
+
+	rbs := NewRoomBookingService(tx, zap.NewNop(), nil, nil, nil)
+
+	// The guest still has until the end of the arrival date
+	rbs.SetNoShowCutoff(24*time.Hour - time.Minute)
+	if _, err := rbs.MarkNoShow(booking.ID, models.BookingActorStaff); !errors.Is(err, ErrNoShowTooEarly) {
+		t.Fatalf("expected ErrNoShowTooEarly, got %v", err)
+	}
+
+	rbs.SetNoShowCutoff(0)
+	marked, err := rbs.MarkNoShow(booking.ID, models.BookingActorStaff)
+	if err != nil {
+		t.Fatalf("expected the booking to be marked once the cutoff passed, got %v", err)
+	}
+	if marked.Status != models.BookingStatusNoShow {
+		t.Errorf("expected status no_show, got %s", marked.Status)
+	}
+}
+
+func TestSplitRefund(t *testing.T) {
+	// Latest first, as queueRefund loads them
+	payments := []models.Payment{
+		{ID: 3, Amount: npr(5000), Method: models.PaymentMethodCard},
+		{ID: 2, Amount: npr(3000), Method: models.PaymentMethodFake},
+		{ID: 1, Amount: npr(2000), Method: models.PaymentMethodCash},
+	}
+	methods := map[uint]string{3: models.PaymentMethodCard, 2: models.PaymentMethodFake, 1: models.PaymentMethodCash}
+
+	type part struct {
+		paymentID uint
+		amount    models.Money
+	}
+	cases := []struct {
+		name     string
+		amount   models.Money
+		refunded map[uint]models.Money
+		want     []part
+	}{
+		{"within the latest payment", npr(4000), nil, []part{{3, npr(4000)}}},
+		{"over several payments", npr(9000), nil, []part{{3, npr(5000)}, {2, npr(3000)}, {1, npr(1000)}}},
+		{"capped at what was paid", npr(15000), nil, []part{{3, npr(5000)}, {2, npr(3000)}, {1, npr(2000)}}},
+		{"skips a refunded payment", npr(4000), map[uint]models.Money{3: npr(5000)}, []part{{2, npr(3000)}, {1, npr(1000)}}},
+		{"rest of a partly refunded payment", npr(3000), map[uint]models.Money{3: npr(4000)}, []part{{3, npr(1000)}, {2, npr(2000)}}},
+		{"nothing to refund", npr(0), nil, nil},
+		{"fee over what was paid", npr(-1000), nil, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			refunds := splitRefund(tc.amount, payments, tc.refunded)
+			if len(refunds) != len(tc.want) {
+				t.Fatalf("expected %d refunds, got %+v", len(tc.want), refunds)
+			}
+			for i, refund := range refunds {
+				if refund.PaymentID != tc.want[i].paymentID || refund.Amount != tc.want[i].amount {
+					t.Errorf("expected %s from payment %d, got %s from payment %d",
+						tc.want[i].amount, tc.want[i].paymentID, refund.Amount, refund.PaymentID)
+				}
+				if want := methods[refund.PaymentID]; refund.Method != want {
+					t.Errorf("expected the refund to go back through %s, got %s", want, refund.Method)
+				}
+			}
+		})
+	}
+}
+
+func TestNoShowCutoff(t *testing.T) {
+	loc := time.FixedZone("NPT", 5*60*60+45*60)
+	checkIn := time.Date(2025, 10, 10, 14, 0, 0, 0, loc)
+
+	want := time.Date(2025, 10, 10, 22, 0, 0, 0, loc)
+	if got := noShowCutoff(checkIn, 22*time.Hour); !got.Equal(want) {
+		t.Errorf("expected cutoff %v, got %v", want, got)
+	}
+	// A cutoff past midnight falls on the morning after arrival
+	want = time.Date(2025, 10, 11, 2, 0, 0, 0, loc)
+	if got := noShowCutoff(checkIn, 26*time.Hour); !got.Equal(want) {
+		t.Errorf("expected cutoff %v, got %v", want, got)
+	}
+}
+
+func TestNextNoShowSweep(t *testing.T) {
+	cases := []struct {
+		name   string
+		now    time.Time
+		cutoff time.Duration
+		want   time.Time
+	}{
+		{"later today", time.Date(2025, 10, 10, 9, 0, 0, 0, time.UTC), 22 * time.Hour, time.Date(2025, 10, 10, 22, 0, 0, 0, time.UTC)},
+		{"at the cutoff", time.Date(2025, 10, 10, 22, 0, 0, 0, time.UTC), 22 * time.Hour, time.Date(2025, 10, 11, 22, 0, 0, 0, time.UTC)},
+		{"after the cutoff", time.Date(2025, 10, 10, 23, 30, 0, 0, time.UTC), 22 * time.Hour, time.Date(2025, 10, 11, 22, 0, 0, 0, time.UTC)},
+		{"cutoff past midnight", time.Date(2025, 10, 10, 23, 30, 0, 0, time.UTC), 26 * time.Hour, time.Date(2025, 10, 11, 2, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nextNoShowSweep(tc.now, tc.cutoff); !got.Equal(tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCutoffText(t *testing.T) {
+	cases := map[time.Duration]string{
+		22 * time.Hour:                "22:00",
+		18*time.Hour + 30*time.Minute: "18:30",
+		24*time.Hour - time.Minute:    "23:59",
+		26 * time.Hour:                "02:00",
+		0:                             "00:00",
+	}
+	for cutoff, want := range cases {
+		if got := cutoffText(cutoff); got != want {
+			t.Errorf("%v: expected %s, got %s", cutoff, want, got)
+		}
+	}
+}
+
+func TestExpiredHoldReleasesRoom(t *testing.T) {
+	tx := testTx(t, openTestDB(t))
+	guest, room := createTestRoom(t, tx, "HOLD-EXPIRED")
+	rbs := NewRoomBookingService(tx, zap.NewNop(), nil, nil, nil)
+
+	checkIn := time.Now().AddDate(0, 0, 30).Truncate(24 * time.Hour)
+	hold := func(checkIn time.Time, holdFor time.Duration) *models.RoomBooking {
+		t.Helper()
+		booking, err := rbs.CreateHold(models.RoomBooking{
+			GuestID:    guest.ID,
+			RoomID:     room.ID,
+			CheckIn:    checkIn,
+			CheckOut:   checkIn.AddDate(0, 0, 2),
+			TotalPrice: room.PricePerNight.Mul(2),
+		}, holdFor)
+		if err != nil {
+			t.Fatalf("failed to create hold: %v", err)
+		}
+		return booking
+	}
+	status := func(bookingID uint) string {
+		t.Helper()
+		var booking models.RoomBooking
+		if err := tx.First(&booking, bookingID).Error; err != nil {
+			t.Fatalf("failed to fetch booking: %v", err)
+		}
+		return booking.Status
+	}
+
+	// A hold that ran out no longer blocks the room, before any sweep
+	expired := hold(checkIn, -time.Minute)
+	current := hold(checkIn, 15*time.Minute)
+
+	if err := rbs.ConfirmHold(expired.ID); !errors.Is(err, ErrHoldExpired) {
+		t.Fatalf("expected ErrHoldExpired, got %v", err)
+	}
+	if got := status(expired.ID); got != models.BookingStatusExpired {
+		t.Errorf("expected the hold to be expired, got %s", got)
+	}
+
+	// The sweep releases holds that ran out and leaves current ones alone
+	stale := hold(checkIn.AddDate(0, 0, 7), -time.Minute)
+	if _, err := rbs.ReleaseExpiredHolds(); err != nil {
+		t.Fatalf("failed to release expired holds: %v", err)
+	}
+	if got := status(stale.ID); got != models.BookingStatusExpired {
+		t.Errorf("expected the swept hold to be expired, got %s", got)
+	}
+	if got := status(current.ID); got != models.BookingStatusPending {
+		t.Errorf("expected the current hold to stay pending, got %s", got)
+	}
+
+	if err := rbs.ConfirmHold(current.ID); err != nil {
+		t.Fatalf("failed to confirm hold: %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidTaxRule is returned when a tax rule cannot be saved as given
+var ErrInvalidTaxRule = errors.New("invalid tax rule")
+
+// TaxQuote is a price split into its net amount and the taxes on it
+type TaxQuote struct {
+	Net   models.Money        `json:"net"`
+	Taxes models.TaxBreakdown `json:"taxes"`
+	Tax   models.Money        `json:"tax"`
+	Gross models.Money        `json:"gross"`
+}
+
+// TaxReport sums the charges posted to folios over a period and the taxes on them
+type TaxReport struct {
+	From  time.Time           `json:"from"`
+	To    time.Time           `json:"to"`
+	Taxes models.TaxBreakdown `json:"taxes"` // Tax by tax and rate
+	Net   models.Money        `json:"net"`
+	Tax   models.Money        `json:"tax"`
+	Gross models.Money        `json:"gross"`
+}
+
+// TaxService applies the service charge and VAT rules to prices
+type TaxService struct {
+	db               *gorm.DB
+	logger           *zap.Logger
+	pricesIncludeTax bool
+}
+
+// NewTaxService creates a new instance of TaxService. pricesIncludeTax says
+// whether room, onsen and charge prices are quoted with taxes included.
+func NewTaxService(db *gorm.DB, logger *zap.Logger, pricesIncludeTax bool) *TaxService {
+	return &TaxService{
+		db:               db,
+		logger:           logger,
+		pricesIncludeTax: pricesIncludeTax,
+	}
+}
+
+// PricesIncludeTax reports whether quoted prices include taxes
+func (ts *TaxService) PricesIncludeTax() bool {
+	return ts.pricesIncludeTax
+}
+
+// PriceNote returns the note shown next to quoted prices
+func (ts *TaxService) PriceNote() string {
+	if ts.pricesIncludeTax {
+		return "incl. service charge & VAT"
+	}
+	return "+ service charge & VAT"
+}
+
+// GetRules returns every tax rule in the order they are applied
+func (ts *TaxService) GetRules() ([]models.TaxRule, error) {
+	var rules []models.TaxRule
+	if err := ts.db.Order("sequence ASC, id ASC").Find(&rules).Error; err != nil {
+		ts.logger.Error("failed to get tax rules", zap.Error(err))
+		return nil, fmt.Errorf("failed to get tax rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// SetRule creates or updates the tax rule with the given code. Charges already
+// posted keep the taxes they were posted with.
+func (ts *TaxService) SetRule(code, name string, rate float64, sequence int, compound bool, categories []string, active bool) (*models.TaxRule, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	name = strings.TrimSpace(name)
+	if code == "" || name == "" {
+		return nil, fmt.Errorf("%w: code and name are required", ErrInvalidTaxRule)
+	}
+	if rate < 0 || rate > 100 {
+		return nil, fmt.Errorf("%w: rate must be between 0 and 100", ErrInvalidTaxRule)
+	}
+
+	cleaned := make([]string, 0, len(categories))
+	for _, category := range categories {
+		category = strings.ToLower(strings.TrimSpace(category))
+		if !isFolioCategory(category) {
+			return nil, fmt.Errorf("%w: unknown category %q", ErrInvalidTaxRule, category)
+		}
+		cleaned = append(cleaned, category)
+	}
+	if len(cleaned) == 0 {
+		return nil, fmt.Errorf("%w: at least one category is required", ErrInvalidTaxRule)
+	}
+
+	var rule models.TaxRule
+	err := ts.db.Where("code = ?", code).First(&rule).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load tax rule: %w", err)
+	}
+
+	rule.Code = code
+	rule.Name = name
+	rule.Rate = rate
+	rule.Sequence = sequence
+	rule.Compound = compound
+	rule.Categories = strings.Join(cleaned, ",")
+	rule.Active = active
+
+	if err := ts.db.Save(&rule).Error; err != nil {
+		ts.logger.Error("failed to save tax rule", zap.String("code", code), zap.Error(err))
+		return nil, fmt.Errorf("failed to save tax rule: %w", err)
+	}
+
+	return &rule, nil
+}
+
+// rulesFor returns the active rules that apply to a category of charge, in
+// the order they are applied
+func (ts *TaxService) rulesFor(category string) ([]models.TaxRule, error) {
+	var rules []models.TaxRule
+	if err := ts.db.Where("active = ?", true).Order("sequence ASC, id ASC").Find(&rules).Error; err != nil {
+		ts.logger.Error("failed to get tax rules", zap.Error(err))
+		return nil, fmt.Errorf("failed to get tax rules: %w", err)
+	}
+
+	applicable := rules[:0]
+	for _, rule := range rules {
+		for _, c := range strings.Split(rule.Categories, ",") {
+			if strings.TrimSpace(c) == category {
+				applicable = append(applicable, rule)
+				break
+			}
+		}
+	}
+
+	return applicable, nil
+}
+
+// taxLines works out each rule's tax on a net amount
+func taxLines(rules []models.TaxRule, net models.Money) models.TaxBreakdown {
+	lines := models.TaxBreakdown{}
+	taxes := models.NewMoney(0, net.Currency)
+	for _, rule := range rules {
+		taxable := net
+		if rule.Compound {
+			taxable = net.Add(taxes)
+		}
+
+		amount := taxable.Percent(rule.Rate)
+		lines = append(lines, models.TaxLine{
+			Code:     rule.Code,
+			Name:     rule.Name,
+			Rate:     rule.Rate,
+			Compound: rule.Compound,
+			Amount:   amount,
+		})
+		taxes = taxes.Add(amount)
+	}
+
+	return lines
+}
+
+// Quote splits a price quoted for a category of charge into its net amount
+// and taxes, adding the taxes to it or taking them out of it depending on
+// whether prices include tax
+func (ts *TaxService) Quote(category string, price models.Money) (*TaxQuote, error) {
+	if ts.pricesIncludeTax {
+		return ts.RemoveTax(category, price)
+	}
+	return ts.AddTax(category, price)
+}
+
+// AddTax works out the taxes on a net amount
+func (ts *TaxService) AddTax(category string, net models.Money) (*TaxQuote, error) {
+	rules, err := ts.rulesFor(category)
+	if err != nil {
+		return nil, err
+	}
+
+	return addTax(rules, net), nil
+}
+
+// addTax is AddTax under the given rules
+func addTax(rules []models.TaxRule, net models.Money) *TaxQuote {
+	net = net.In(models.DefaultCurrency)
+	lines := taxLines(rules, net)
+	tax := lines.Total(net.Currency)
+
+	return &TaxQuote{Net: net, Taxes: lines, Tax: tax, Gross: net.Add(tax)}
+}
+
+// RemoveTax takes the taxes out of an amount that includes them. Rounding is
+// left in the net amount so net and taxes add back up to exactly gross.
+func (ts *TaxService) RemoveTax(category string, gross models.Money) (*TaxQuote, error) {
+	rules, err := ts.rulesFor(category)
+	if err != nil {
+		return nil, err
+	}
+
+	return removeTax(rules, gross), nil
+}
+
+// removeTax is RemoveTax under the given rules
+func removeTax(rules []models.TaxRule, gross models.Money) *TaxQuote {
+	gross = gross.In(models.DefaultCurrency)
+	factor := taxLines(rules, models.NewMoney(0, gross.Currency)).Factor()
+	net := gross.Convert(new(big.Rat).Inv(factor), gross.Currency)
+
+	lines := taxLines(rules, net)
+	tax := lines.Total(gross.Currency)
+
+	return &TaxQuote{Net: gross.Sub(tax), Taxes: lines, Tax: tax, Gross: gross}
+}
+
+// Report sums the charges posted to folios with service dates from from to
+// to, inclusive, and the taxes on them by tax
+func (ts *TaxService) Report(from, to time.Time) (*TaxReport, error) {
+	var items []models.FolioItem
+	if err := ts.db.Where("voided_at IS NULL AND service_date >= ? AND service_date <= ?",
+		from.Format("2006-01-02"), to.Format("2006-01-02")).
+		Order("service_date ASC, id ASC").
+		Find(&items).Error; err != nil {
+		ts.logger.Error("failed to get folio items for tax report", zap.Error(err))
+		return nil, fmt.Errorf("failed to get folio items: %w", err)
+	}
+
+	currency := models.DefaultCurrency
+	report := &TaxReport{
+		From:  from,
+		To:    to,
+		Net:   models.NewMoney(0, currency),
+		Tax:   models.NewMoney(0, currency),
+		Gross: models.NewMoney(0, currency),
+	}
+
+	for _, item := range items {
+		report.Net = report.Net.Add(item.Amount.Sub(item.TaxAmount))
+		report.Tax = report.Tax.Add(item.TaxAmount)
+		report.Gross = report.Gross.Add(item.Amount)
+	}
+	report.Taxes = sumTaxes(items)
+
+	return report, nil
+}
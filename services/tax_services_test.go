@@ -0,0 +1,107 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/IamMaheshGurung/privateOnsenBooking/models"
+)
+
+// nepalTaxRules are the 10% service charge and 13% VAT charged on top of it
+var nepalTaxRules = []models.TaxRule{
+	{Code: "service", Name: "Service charge", Rate: 10, Sequence: 1},
+	{Code: "vat", Name: "VAT", Rate: 13, Sequence: 2, Compound: true},
+}
+
+func TestAddTax(t *testing.T) {
+	quote := addTax(nepalTaxRules, npr(10000))
+
+	// VAT is charged on the room and the service charge: 13% of 11,000
+	if len(quote.Taxes) != 2 || quote.Taxes[0].Amount != npr(1000) || quote.Taxes[1].Amount != npr(1430) {
+		t.Fatalf("expected service charge 1,000 and VAT 1,430, got %+v", quote.Taxes)
+	}
+	if quote.Tax != npr(2430) || quote.Gross != npr(12430) {
+		t.Errorf("expected tax 2,430 and gross 12,430, got %s and %s", quote.Tax, quote.Gross)
+	}
+	if rate := quote.Taxes.EffectiveRate(); rate != 24.3 {
+		t.Errorf("expected an effective rate of 24.3%%, got %v%%", rate)
+	}
+
+	simple := addTax([]models.TaxRule{nepalTaxRules[0], {Code: "vat", Name: "VAT", Rate: 13}}, npr(10000))
+	if simple.Tax != npr(2300) {
+		t.Errorf("expected VAT on the room only to give tax 2,300, got %s", simple.Tax)
+	}
+
+	if none := addTax(nil, npr(10000)); !none.Tax.IsZero() || none.Gross != npr(10000) {
+		t.Errorf("expected no tax without rules, got %s", none.Tax)
+	}
+}
+
+func TestRemoveTax(t *testing.T) {
+	cases := []struct {
+		name    string
+		gross   models.Money
+		net     models.Money
+		service models.Money
+		vat     models.Money
+	}{
+		{"exact", npr(12430), npr(10000), npr(1000), npr(1430)},
+		{"rounded", npr(10000), models.NewMoney(804505, "NPR"), models.NewMoney(80451, "NPR"), models.NewMoney(115044, "NPR")},
+		{"paisa", models.NewMoney(99999, "NPR"), models.NewMoney(80450, "NPR"), models.NewMoney(8045, "NPR"), models.NewMoney(11504, "NPR")},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			quote := removeTax(nepalTaxRules, tc.gross)
+			if quote.Net != tc.net {
+				t.Errorf("expected net %s, got %s", tc.net, quote.Net)
+			}
+			if quote.Taxes[0].Amount != tc.service || quote.Taxes[1].Amount != tc.vat {
+				t.Errorf("expected service charge %s and VAT %s, got %s and %s",
+					tc.service, tc.vat, quote.Taxes[0].Amount, quote.Taxes[1].Amount)
+			}
+			if sum := quote.Net.Add(quote.Tax); sum != tc.gross {
+				t.Errorf("expected net and tax to add up to %s, got %s", tc.gross, sum)
+			}
+		})
+	}
+}
+
+func TestSumTaxes(t *testing.T) {
+	items := []models.FolioItem{
+		{Taxes: models.TaxBreakdown{
+			{Code: "service", Name: "Service charge", Rate: 10, Amount: npr(100)},
+			{Code: "vat", Name: "VAT", Rate: 13, Amount: npr(143)},
+		}},
+		{Taxes: models.TaxBreakdown{
+			{Code: "vat", Name: "VAT", Rate: 13, Amount: npr(130)},
+		}},
+		// VAT at another rate is kept apart
+		{Taxes: models.TaxBreakdown{
+			{Code: "vat", Name: "VAT", Rate: 12, Amount: npr(120)},
+		}},
+		// Posted before tax rules
+		{TaxRate: 5, TaxAmount: npr(50)},
+		{Amount: npr(500)},
+	}
+
+	totals := sumTaxes(items)
+	want := []struct {
+		code   string
+		rate   float64
+		amount models.Money
+	}{
+		{"service", 10, npr(100)},
+		{"vat", 13, npr(273)},
+		{"vat", 12, npr(120)},
+		{"tax", 5, npr(50)},
+	}
+	if len(totals) != len(want) {
+		t.Fatalf("expected %d tax lines, got %+v", len(want), totals)
+	}
+	for i, line := range totals {
+		if line.Code != want[i].code || line.Rate != want[i].rate || line.Amount != want[i].amount {
+			t.Errorf("expected %s at %v%% of %s, got %s at %v%% of %s",
+				want[i].code, want[i].rate, want[i].amount, line.Code, line.Rate, line.Amount)
+		}
+	}
+}
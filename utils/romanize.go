@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Devanagari letters and signs in the romanization commonly used for Nepali
+// names, e.g. राम बहादुर श्रेष्ठ as Ram Bahadur Shrestha
+var (
+	devanagariVowels = map[rune]string{
+		'अ': "a", 'आ': "a", 'इ': "i", 'ई': "i", 'उ': "u", 'ऊ': "u", 'ऋ': "ri",
+		'ए': "e", 'ऐ': "ai", 'ओ': "o", 'औ': "au",
+	}
+	devanagariConsonants = map[rune]string{
+		'क': "k", 'ख': "kh", 'ग': "g", 'घ': "gh", 'ङ': "ng",
+		'च': "ch", 'छ': "chh", 'ज': "j", 'झ': "jh", 'ञ': "n",
+		'ट': "t", 'ठ': "th", 'ड': "d", 'ढ': "dh", 'ण': "n",
+		'त': "t", 'थ': "th", 'द': "d", 'ध': "dh", 'न': "n",
+		'प': "p", 'फ': "ph", 'ब': "b", 'भ': "bh", 'म': "m",
+		'य': "y", 'र': "r", 'ल': "l", 'व': "w",
+		'श': "sh", 'ष': "sh", 'स': "s", 'ह': "h",
+	}
+	devanagariVowelSigns = map[rune]string{
+		'ा': "a", 'ि': "i", 'ी': "i", 'ु': "u", 'ू': "u", 'ृ': "ri",
+		'े': "e", 'ै': "ai", 'ो': "o", 'ौ': "au",
+	}
+	devanagariSigns = map[rune]string{
+		'ं': "n", 'ँ': "n", 'ः': "h", '।': ".", '॥': ".",
+	}
+)
+
+const (
+	devanagariVirama = '्'
+	devanagariNukta  = '़'
+)
+
+// Romanize replaces characters that WinAnsi fonts cannot show with Latin
+// letters, so names print on PDFs. Devanagari is transliterated, accented
+// letters outside Latin-1 lose their accents, and anything else is left as is.
+func Romanize(s string) string {
+	var b strings.Builder
+	pending := false  // A consonant was written and its inherent "a" not yet
+	conjunct := false // That consonant followed a virama
+	wordStart := true
+
+	write := func(latin string) {
+		if wordStart {
+			latin = strings.ToUpper(latin[:1]) + latin[1:]
+			wordStart = false
+		}
+		b.WriteString(latin)
+	}
+	// settle writes the inherent "a" of a pending consonant, unless it ends
+	// the word on its own, e.g. the m of राम
+	settle := func(wordEnds bool) {
+		if pending && (!wordEnds || conjunct) {
+			write("a")
+		}
+		pending, conjunct = false, false
+	}
+
+	runes := []rune(s)
+	for i, r := range runes {
+		if latin, ok := devanagariVowelSigns[r]; ok {
+			pending, conjunct = false, false
+			write(latin)
+			continue
+		}
+
+		switch {
+		case r == devanagariNukta:
+			continue
+		case r == devanagariVirama:
+			if pending {
+				pending = false
+				conjunct = true
+			}
+			continue
+		}
+
+		if latin, ok := devanagariConsonants[r]; ok {
+			afterVirama := conjunct && !pending
+			if pending {
+				write("a")
+			}
+			// ष before ट or ठ is written s, as in श्रेष्ठ, Shrestha
+			if r == 'ष' && i+2 < len(runes) && runes[i+1] == devanagariVirama && (runes[i+2] == 'ट' || runes[i+2] == 'ठ') {
+				latin = "s"
+			}
+			write(latin)
+			pending, conjunct = true, afterVirama
+			continue
+		}
+
+		if latin, ok := devanagariVowels[r]; ok {
+			settle(false)
+			write(latin)
+			continue
+		}
+		if latin, ok := devanagariSigns[r]; ok {
+			settle(false)
+			write(latin)
+			continue
+		}
+		if r >= '०' && r <= '९' {
+			settle(true)
+			b.WriteRune('0' + (r - '०'))
+			wordStart = false
+			continue
+		}
+
+		settle(true)
+		conjunct = false
+		wordStart = !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		if r <= 0xff {
+			b.WriteRune(r)
+			continue
+		}
+
+		// Drop the accents of letters like ā or ś, keeping the base letter
+		stripped := false
+		for _, d := range norm.NFD.String(string(r)) {
+			if d <= 0xff && !unicode.Is(unicode.Mn, d) {
+				b.WriteRune(d)
+				stripped = true
+			}
+		}
+		if !stripped {
+			b.WriteRune(r)
+		}
+	}
+	settle(true)
+
+	return b.String()
+}
@@ -0,0 +1,21 @@
+package utils
+
+import "testing"
+
+func TestRomanize(t *testing.T) {
+	tests := map[string]string{
+		"राम बहादुर थापा": "Ram Bahadur Thapa",
+		"सीता श्रेष्ठ":    "Sita Shrestha",
+		"कृष्ण प्रसाद":    "Krishna Prasad",
+		"संजय":            "Sanjay",
+		"Ramesh Śarmā":    "Ramesh Sarma",
+		"José Müller":     "José Müller",
+		"Room ३०१, टोल ५": "Room 301, Tol 5",
+	}
+
+	for in, want := range tests {
+		if got := Romanize(in); got != want {
+			t.Errorf("Romanize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -1,47 +1,65 @@
 package utils
 
 import (
-	"math"
+	"crypto/rand"
+	"fmt"
+	"math/big"
 	"regexp"
+	"strings"
 	"time"
 )
 
-func GetTimeSlots() []string {
-	start := time.Date(0, 1, 1, 18, 0, 0, 0, time.UTC)
-	slots := []string{}
-	for i := 0; i < 10; i++ {
-		slot := start.Add(time.Duration(i*30) * time.Minute)
-		slots = append(slots, slot.Format("15:04"))
+// referenceAlphabet leaves out characters that are easily confused (0/O, 1/I/L)
+const referenceAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// GenerateReference returns a random booking reference such as "KPG-7KX3Q9"
+func GenerateReference(prefix string, length int) (string, error) {
+	max := big.NewInt(int64(len(referenceAlphabet)))
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate reference: %w", err)
+		}
+		code[i] = referenceAlphabet[n.Int64()]
 	}
 
-	return slots
+	return prefix + "-" + string(code), nil
 }
 
-func GetAvailableSlots(date time.Time) []string {
-	allSlot := GetTimeSlots()
-	booked := []string{"room", "room1", "room2", "room3", "room4", "room5", "room6", "room7", "room8", "room9"}
+// NormalizeReference uppercases a reference typed by a guest and strips spaces
+func NormalizeReference(reference string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(reference), " ", ""))
+}
 
-	available := []string{}
+// GetTimeSlots lays out back-to-back sessions of slotLength between open and
+// close (both "HH:MM"), leaving buffer between sessions for cleaning. Each
+// slot is formatted as "HH:MM-HH:MM".
+func GetTimeSlots(open, close string, slotLength, buffer time.Duration) ([]string, error) {
+	start, err := time.Parse("15:04", open)
+	if err != nil {
+		return nil, fmt.Errorf("invalid opening time %q", open)
+	}
 
-	for _, slot := range allSlot {
-		//if the slot in conatins found false then append to available
-		if !contains(booked, slot) {
-			available = append(available, slot)
-		}
+	end, err := time.Parse("15:04", close)
+	if err != nil {
+		return nil, fmt.Errorf("invalid closing time %q", close)
 	}
-	return available
 
-}
+	if slotLength <= 0 {
+		return nil, fmt.Errorf("slot length must be positive")
+	}
 
-func contains(slots []string, target string) bool {
-	for _, s := range slots {
-		if s == target {
-			return true
-		}
+	if buffer < 0 {
+		buffer = 0
+	}
 
+	slots := []string{}
+	for slot := start; !slot.Add(slotLength).After(end); slot = slot.Add(slotLength + buffer) {
+		slots = append(slots, slot.Format("15:04")+"-"+slot.Add(slotLength).Format("15:04"))
 	}
 
-	return false
+	return slots, nil
 }
 
 func IsValidEmail(email string) bool {
@@ -49,6 +67,72 @@ func IsValidEmail(email string) bool {
 	return re.MatchString(email)
 }
 
-func IsCloseEnough(a, b, epsilon float64) bool {
-	return math.Abs(a-b) <= epsilon
+// shrawanFirst gives the Gregorian date of 1 Shrawan, the first day of the
+// Nepali fiscal year, for each Bikram Sambat year. The Bikram Sambat calendar
+// is set by observation, so month lengths (and with them this date) follow no
+// rule; add the next year from the official calendar before it starts.
+var shrawanFirst = map[int]string{
+	2070: "2013-07-17",
+	2071: "2014-07-17",
+	2072: "2015-07-17",
+	2073: "2016-07-16",
+	2074: "2017-07-16",
+	2075: "2018-07-17",
+	2076: "2019-07-17",
+	2077: "2020-07-16",
+	2078: "2021-07-16",
+	2079: "2022-07-17",
+	2080: "2023-07-17",
+	2081: "2024-07-16",
+	2082: "2025-07-17",
+	2083: "2026-07-17",
+	2084: "2027-07-17",
+}
+
+// bikramSambatOffset is the difference between a Bikram Sambat year and the
+// Gregorian year in which its Shrawan falls
+const bikramSambatOffset = 57
+
+// shrawanEarliest is the earliest day of July that 1 Shrawan falls on. Dates
+// before it belong to the fiscal year that started the July before, whether or
+// not this year's 1 Shrawan is in the table yet.
+const shrawanEarliest = 15
+
+// NepaliFiscalYear returns the label, e.g. "2081/82", and the first day of the
+// Nepali fiscal year that t falls in: the one whose 1 Shrawan, looked up in the
+// Bikram Sambat calendar table, is on or before t. It is an error only when
+// that year is not in the table.
+func NepaliFiscalYear(t time.Time) (string, time.Time, error) {
+	bsYear := t.Year() + bikramSambatOffset
+	if t.Before(time.Date(t.Year(), time.July, shrawanEarliest, 0, 0, 0, 0, t.Location())) {
+		bsYear--
+	} else {
+		start, err := shrawanFirstDate(bsYear, t.Location())
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		if t.Before(start) {
+			bsYear--
+		}
+	}
+
+	start, err := shrawanFirstDate(bsYear, t.Location())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return fmt.Sprintf("%d/%02d", bsYear, (bsYear+1)%100), start, nil
+}
+
+// shrawanFirstDate returns the start of 1 Shrawan of a Bikram Sambat year in loc
+func shrawanFirstDate(bsYear int, loc *time.Location) (time.Time, error) {
+	date, ok := shrawanFirst[bsYear]
+	if !ok {
+		return time.Time{}, fmt.Errorf("Bikram Sambat year %d is not in the fiscal year calendar", bsYear)
+	}
+
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q for 1 Shrawan %d: %w", date, bsYear, err)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc), nil
 }
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNepaliFiscalYear(t *testing.T) {
+	tests := []struct {
+		date  string
+		label string
+		start string
+	}{
+		{"2024-07-15", "2080/81", "2023-07-17"},
+		{"2024-07-16", "2081/82", "2024-07-16"},
+		{"2025-04-14", "2081/82", "2024-07-16"},
+		{"2025-07-16", "2081/82", "2024-07-16"},
+		{"2025-07-17", "2082/83", "2025-07-17"},
+		{"2027-07-16", "2083/84", "2026-07-17"},
+		{"2027-07-17", "2084/85", "2027-07-17"},
+		// 2085 is not in the table, but mid-April and early July 2028 are
+		// still in 2084/85
+		{"2028-04-13", "2084/85", "2027-07-17"},
+		{"2028-07-14", "2084/85", "2027-07-17"},
+	}
+
+	for _, tt := range tests {
+		date, _ := time.Parse("2006-01-02", tt.date)
+		label, start, err := NepaliFiscalYear(date.Add(12 * time.Hour))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.date, err)
+			continue
+		}
+		if label != tt.label || start.Format("2006-01-02") != tt.start {
+			t.Errorf("%s: got %s starting %s, want %s starting %s",
+				tt.date, label, start.Format("2006-01-02"), tt.label, tt.start)
+		}
+	}
+}
+
+func TestNepaliFiscalYearOutsideTable(t *testing.T) {
+	for _, date := range []string{"2013-07-16", "2028-07-20"} {
+		d, _ := time.Parse("2006-01-02", date)
+		if _, _, err := NepaliFiscalYear(d); err == nil {
+			t.Errorf("%s: expected an error for a date outside the calendar table", date)
+		}
+	}
+}
+
+// TestShrawanTableCoversNextYear fails once the calendar table runs out within
+// a year, so the next Bikram Sambat year is added before invoices need it
+func TestShrawanTableCoversNextYear(t *testing.T) {
+	if _, _, err := NepaliFiscalYear(time.Now().AddDate(1, 0, 0)); err != nil {
+		t.Fatalf("add the next 1 Shrawan to the fiscal year calendar: %v", err)
+	}
+}